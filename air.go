@@ -37,35 +37,59 @@ components) will be parsed into the `Request` and can be accessed via the
 PARAM component always discards its leading ":", such as ":UserID" will become
 "UserID". The name of a `RequestParam` parsed from an ANY component is "*".
 
+A PARAM component may be constrained by a regular expression that follows its
+name and a "|", such as ":UserID|[0-9]+". A constrained PARAM component only
+matches the path segments that fully match its regular expression, and the
+regular expression cannot contain "/". All routes that share the same PARAM
+component must agree on its constraint.
+
 The second param is a `Handler` that serves the requests that match this route.
 */
 package air
 
 import (
+	"compress/flate"
 	"compress/gzip"
 	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"io/ioutil"
 	"log"
+	"math/big"
+	"mime"
 	"net"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"runtime/debug"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pelletier/go-toml"
 	"golang.org/x/crypto/acme"
 	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/http/httpguts"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 	"gopkg.in/yaml.v3"
@@ -108,15 +132,86 @@ type Air struct {
 	// Default value: false
 	DebugMode bool `mapstructure:"debug_mode"`
 
+	// TestMode indicates whether the web application is in test mode.
+	//
+	// The `TestMode` suppresses the startup of the background goroutines
+	// so that tests are deterministic and leak-free, while keeping the
+	// request handling intact. The affected features are:
+	//
+	//   * The file watchers of the renderer, i18n and coffer. The template
+	//     files, locale files and asset files are loaded as usual, but
+	//     their changes are no longer picked up automatically.
+	//   * The keep-alive goroutines of the WebSocket connections (see the
+	//     `WebSocket.StartKeepAlive`).
+	//   * The OCSP response refreshers (see the `OCSPStaplingEnabled`).
+	//     The OCSP responses are fetched synchronously during the TLS
+	//     handshakes instead.
+	//
+	// Default value: false
+	TestMode bool `mapstructure:"test_mode"`
+
 	// Address is the TCP address that the server listens on.
 	//
 	// The `Address` is never empty and contains a free port. If the port of
 	// the `Address` is "0", a random port is automatically chosen. The
 	// `Addresses` can be used to discover the chosen port.
 	//
+	// The `Address` may also be a Unix domain socket with the "unix:"
+	// prefix (such as "unix:/run/air.sock"), which is useful for serving
+	// behind a reverse proxy on the same host. A stale socket file is
+	// removed before listening, and the socket file is removed when the
+	// server is closed. The PROXY protocol is still supported on it.
+	//
+	// See the `ExtraAddresses` and `ExtraListeners` for serving on
+	// multiple addresses simultaneously.
+	//
 	// Default value: "localhost:8080"
 	Address string `mapstructure:"address"`
 
+	// PortRange is the range of ports that the server tries to listen on
+	// when the port of the `Address` is "0".
+	//
+	// The `PortRange` is in the form of [min, max] and is inclusive. The
+	// ports within the `PortRange` are tried sequentially until one of
+	// them is bound successfully. A zero `PortRange` means a random port
+	// is chosen by the OS.
+	//
+	// Default value: [0, 0]
+	PortRange [2]int `mapstructure:"port_range"`
+
+	// ExtraAddresses is the list of the extra TCP addresses that the server
+	// listens on in addition to the `Address`.
+	//
+	// Each of the `ExtraAddresses` is bound with its own listener, and all
+	// of them share the same handler and configuration (including TLS) as
+	// the `Address`. The `Address` always remains the primary one. The
+	// `Addresses` returns the addresses that are actually listened on in
+	// the order of the `Address`, the HTTPS enforced address (if any) and
+	// then the `ExtraAddresses`. Like the `Address`, each of them may also
+	// be a Unix domain socket with the "unix:" prefix.
+	//
+	// Default value: nil
+	ExtraAddresses []string `mapstructure:"extra_addresses"`
+
+	// ExtraListeners is the list of the extra listeners that the server
+	// listens on in addition to the `Address` and the `ExtraAddresses`.
+	//
+	// Unlike the `ExtraAddresses`, each of the `ExtraListeners` has its own
+	// TLS configuration, and none of the TLS-related fields of the a (such
+	// as the `TLSConfig` and the `ACMEEnabled`) applies to it. So it is
+	// possible to serve, for example, an internal mutual TLS address and a
+	// public ACME address in the same process. All of them still share the
+	// same handler and the rest of the configuration.
+	//
+	// The `Addresses` returns the addresses of the `ExtraListeners` after
+	// the ones of the `ExtraAddresses`, in the order of the
+	// `ExtraListeners`. All of them are closed by the `Close` and the
+	// `Shutdown` just like the `Address`, regardless of their TLS
+	// configurations.
+	//
+	// Default value: nil
+	ExtraListeners []ExtraListener `mapstructure:"extra_listeners"`
+
 	// ReadTimeout is the maximum duration allowed for the server to read a
 	// request entirely, including the body part.
 	//
@@ -195,6 +290,81 @@ type Air struct {
 	// Default value: ""
 	TLSKeyFile string `mapstructure:"tls_key_file"`
 
+	// TLSMinVersion is the minimum TLS version acceptable by the server
+	// (such as the `tls.VersionTLS12`).
+	//
+	// If the `TLSMinVersion` is not zero, it is applied to the `TLSConfig`'s
+	// clone (or the created `tls.Config`) unless its `MinVersion` has been
+	// explicitly set. The zero value means the Go's default.
+	//
+	// Default value: 0
+	TLSMinVersion uint16 `mapstructure:"tls_min_version"`
+
+	// TLSCipherSuites is the list of the enabled TLS 1.0-1.2 cipher suites
+	// (such as the `tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256`). The TLS
+	// 1.3 cipher suites are not configurable.
+	//
+	// If the `TLSCipherSuites` is not empty, it is applied to the
+	// `TLSConfig`'s clone (or the created `tls.Config`) unless its
+	// `CipherSuites` has been explicitly set. The empty value means the Go's
+	// default.
+	//
+	// Default value: nil
+	TLSCipherSuites []uint16 `mapstructure:"tls_cipher_suites"`
+
+	// TLSClientCAFile is the path to the PEM-encoded CA certificates file
+	// used to verify the client certificates (that is, the mutual TLS).
+	//
+	// The certificates targeted by the `TLSClientCAFile` will be added to
+	// a copy of the `ClientCAs` of the `TLSConfig` (or a new pool if it is
+	// nil), so the `ClientCAs` itself is never modified. Note that the copy
+	// requires Go 1.19 or later. It only takes effect when the server
+	// serves TLS.
+	//
+	// Default value: ""
+	TLSClientCAFile string `mapstructure:"tls_client_ca_file"`
+
+	// TLSClientAuth is the policy the server will follow for the TLS
+	// client authentication.
+	//
+	// If the `TLSClientAuth` is not the `tls.NoClientCert`, it overrides
+	// the `ClientAuth` of the `TLSConfig`'s clone. The verified client
+	// certificates can be accessed via the `Request.ClientCertificates`. It
+	// only takes effect when the server serves TLS.
+	//
+	// Default value: `tls.NoClientCert`
+	TLSClientAuth tls.ClientAuthType `mapstructure:"tls_client_auth"`
+
+	// DevTLS indicates whether the server serves TLS with an in-memory
+	// self-signed certificate for the "localhost", "127.0.0.1" and "::1"
+	// when no certificate is configured.
+	//
+	// The `DevTLS` is only for local development, so it only takes effect
+	// when the `DebugMode` is true and neither the `TLSConfig` nor the
+	// `TLSCertFile` and `TLSKeyFile` nor the ACME feature provides any
+	// certificate. The certificate is generated each time the server
+	// starts and is never trusted by clients by default.
+	//
+	// Default value: false
+	DevTLS bool `mapstructure:"dev_tls"`
+
+	// TLSNextProtos is the map of the extra TLS ALPN protocols to the
+	// functions that handle the connections negotiated with them. It is
+	// useful for serving non-HTTP protocols on the same TLS listener.
+	//
+	// The protocols are appended to the `tls.Config.NextProtos` after the
+	// "h2" and "http/1.1" (and the "acme-tls/1" when the ACME feature is
+	// enabled), so the client-preferred protocols are chosen in that
+	// server-side order. The "h2", "http/1.1" and "acme-tls/1" are
+	// reserved and ignored, as are nil functions. Each function must
+	// handle the connection synchronously, the connection is closed after
+	// the function returns.
+	//
+	// The `TLSNextProtos` only takes effect when the server serves TLS.
+	//
+	// Default value: nil
+	TLSNextProtos map[string]func(net.Conn) `mapstructure:"-"`
+
 	// ACMEEnabled indicates whether the ACME feature is enabled.
 	//
 	// The `ACMEEnabled` gives the server the ability to automatically
@@ -245,6 +415,16 @@ type Air struct {
 	// Default value: "acme-certs"
 	ACMECertRoot string `mapstructure:"acme_cert_root"`
 
+	// ACMECache is the cache of the certificates of the ACME feature.
+	//
+	// If the `ACMECache` is not nil, it is used instead of the
+	// `ACMECertRoot`. It is useful for sharing the certificates between
+	// multiple instances (such as behind a load balancer) by storing them
+	// in a shared storage (such as Redis or S3).
+	//
+	// Default value: nil
+	ACMECache autocert.Cache `mapstructure:"-"`
+
 	// ACMEHostWhitelist is the list of hosts allowed by the ACME feature.
 	//
 	// It is highly recommended to set the `ACMEHostWhitelist`. If the
@@ -278,6 +458,19 @@ type Air struct {
 	// Default value: false
 	HTTPSEnforced bool `mapstructure:"https_enforced"`
 
+	// OCSPStaplingEnabled indicates whether the OCSP stapling is enabled.
+	//
+	// If the `OCSPStaplingEnabled` is true, the OCSP responses of the TLS
+	// certificates (including those loaded from the `TLSCertFile` and
+	// those obtained via the ACME feature) will be fetched in the
+	// background from the OCSP servers of their issuers and stapled to the
+	// TLS handshakes. Each OCSP response is refreshed halfway through its
+	// validity period. The certificates without their issuers in the
+	// chains or without any OCSP server specified are not stapled.
+	//
+	// Default value: false
+	OCSPStaplingEnabled bool `mapstructure:"ocsp_stapling_enabled"`
+
 	// HTTPSEnforcedPort is the port of the TCP address (share the same host
 	// as the `Address`) that the server listens on. All requests to this
 	// port will be automatically redirected to HTTPS.
@@ -288,6 +481,17 @@ type Air struct {
 	// Default value: "0"
 	HTTPSEnforcedPort string `mapstructure:"https_enforced_port"`
 
+	// H2CUpgrade indicates whether the server honors the upgrade to the
+	// cleartext HTTP/2 (h2c) via the "Upgrade: h2c" header.
+	//
+	// The `H2CUpgrade` only controls the upgrade mechanism. The cleartext
+	// HTTP/2 with prior knowledge is always supported when the server is
+	// not serving TLS. If the `H2CUpgrade` is false, the requests asking
+	// for the upgrade are served as plain HTTP/1.x requests.
+	//
+	// Default value: true
+	H2CUpgrade bool `mapstructure:"h2c_upgrade"`
+
 	// WebSocketHandshakeTimeout is the maximum duration allowed for the
 	// server to wait for a WebSocket handshake to complete.
 	//
@@ -306,6 +510,45 @@ type Air struct {
 	// Default value: nil
 	WebSocketSubprotocols []string `mapstructure:"websocket_subprotocols"`
 
+	// WebSocketCompressionEnabled indicates whether the per-message
+	// compression (see RFC 7692) of the WebSocket connections is enabled.
+	//
+	// If the `WebSocketCompressionEnabled` is true, the
+	// `Response.WebSocket` negotiates the "permessage-deflate" extension
+	// with the client, and the outgoing messages are compressed if it is
+	// negotiated.
+	//
+	// Default value: false
+	WebSocketCompressionEnabled bool `mapstructure:"websocket_compression_enabled"`
+
+	// WebSocketCompressionLevel is the compression level of the
+	// per-message compression of the WebSocket connections. Invalid levels
+	// are ignored.
+	//
+	// Default value: `flate.BestSpeed`
+	WebSocketCompressionLevel int `mapstructure:"websocket_compression_level"`
+
+	// WebSocketShutdownTimeout is the maximum duration allowed for the
+	// `Shutdown` to wait for the WebSocket connections to close after
+	// sending them the connection close messages.
+	//
+	// If the `WebSocketShutdownTimeout` is zero, the `Shutdown` sends the
+	// connection close messages without waiting.
+	//
+	// Default value: 0
+	WebSocketShutdownTimeout time.Duration `mapstructure:"websocket_shutdown_timeout"`
+
+	// EventStreamKeepAliveInterval is the interval at which the
+	// `Response.StreamEvents` sends a comment line to keep the event
+	// stream alive when there are no events to send, which prevents the
+	// idle streams from being dropped by the proxies.
+	//
+	// If the `EventStreamKeepAliveInterval` is not greater than zero, no
+	// comment lines are sent.
+	//
+	// Default value: 15 * time.Second
+	EventStreamKeepAliveInterval time.Duration `mapstructure:"event_stream_keep_alive_interval"`
+
 	// PROXYEnabled indicates whether the PROXY feature is enabled.
 	//
 	// The `PROXYEnabled` gives the server the ability to support the PROXY
@@ -332,6 +575,10 @@ type Air struct {
 	// relayed from the IP addresses are not in it will not be able to act
 	// the PROXY protocol.
 	//
+	// When listening on a Unix domain socket, the relayers are treated as
+	// the loopback ones (127.0.0.1 and ::1), since they are always on the
+	// local machine.
+	//
 	// Default value: nil
 	PROXYRelayerIPWhitelist []string `mapstructure:"proxy_relayer_ip_whitelist"`
 
@@ -367,6 +614,60 @@ type Air struct {
 	// Default value: `DefaultMethodNotAllowedHandler`
 	MethodNotAllowedHandler func(*Request, *Response) error `mapstructure:"-"`
 
+	// AutoOptionsForCORS indicates whether the router automatically answers
+	// the CORS preflight requests.
+	//
+	// A CORS preflight request is an OPTIONS request with the
+	// Access-Control-Request-Method header. If the `AutoOptionsForCORS` is
+	// true, such a request that matches a route without a registered
+	// OPTIONS method is answered with the `http.StatusNoContent` and an
+	// Allow header listing the methods registered for the route, instead
+	// of being handled by the `MethodNotAllowedHandler`. The `Gases` still
+	// run around it, so a CORS gas can add the rest of the CORS headers.
+	//
+	// Default value: false
+	AutoOptionsForCORS bool `mapstructure:"auto_options_for_cors"`
+
+	// ExpectContinueHandler is the handler that decides whether to accept
+	// a request carrying the "Expect: 100-continue" header before its body
+	// is sent by the client.
+	//
+	// The `ExpectContinueHandler` is consulted before the `Pregases` (so
+	// the route params are not yet available) and only the request headers
+	// should be inspected. If it returns an error, the request-response
+	// cycle ends with the error handled by the `ErrorHandler` and the
+	// "100 Continue" interim response is never sent, which means the
+	// client will not send the body. The `Response.Status` will be the
+	// `http.StatusExpectationFailed` unless the `ExpectContinueHandler` has
+	// set it to another error status (for example, the
+	// `http.StatusRequestEntityTooLarge` based on the Content-Length
+	// header).
+	//
+	// For HTTP/1.x, the "100 Continue" interim response is sent when the
+	// body is read for the first time.
+	//
+	// For HTTP/2, the "100 Continue" interim response is also sent when the
+	// body is read for the first time. But since the HTTP/2 clients are not
+	// required to wait for it, some of them may have already started
+	// sending the body when the request is rejected, in which case the
+	// stream is simply reset.
+	//
+	// Default value: nil
+	ExpectContinueHandler func(*Request, *Response) error `mapstructure:"-"`
+
+	// BeforeWriteHeader is the function that is called exactly once for
+	// each response right before its headers are committed.
+	//
+	// The `BeforeWriteHeader` is the last chance to modify the
+	// `Response.Header` and `Response.Status`, which makes it useful for
+	// adding or stripping headers uniformly. It is also called for the
+	// streaming responses that are flushed before anything is written, but
+	// never for the hijacked connections since their headers are not
+	// written by the server.
+	//
+	// Default value: nil
+	BeforeWriteHeader func(*Response) `mapstructure:"-"`
+
 	// ErrorHandler is the centralized error handler.
 	//
 	// The `ErrorHandler` is never nil because the server will use it in
@@ -375,6 +676,63 @@ type Air struct {
 	// Default value: `DefaultErrorHandler`
 	ErrorHandler func(error, *Request, *Response) `mapstructure:"-"`
 
+	// OnPostWriteError is the function that is called when the handler
+	// chain returns an error after the response has already been written.
+	//
+	// In this case the status and (part of) the body have already been
+	// sent to the client, so the `ErrorHandler` can no longer respond with
+	// the error, and the client may receive a half-written response. The
+	// `OnPostWriteError` is called before the `ErrorHandler` so that the
+	// inconsistency can at least be logged.
+	//
+	// Default value: nil
+	OnPostWriteError func(err error, req *Request, res *Response) `mapstructure:"-"`
+
+	// PanicStackFormatter is the function that formats the recovered value
+	// and the stack (as returned by the `debug.Stack`) of each panic
+	// recovered by the framework into the text that is logged and, in the
+	// `DebugMode`, included in the response.
+	//
+	// It is useful for adapting the stacks to various logging pipelines,
+	// such as formatting them as JSON.
+	//
+	// If the `PanicStackFormatter` is nil, the
+	// `DefaultPanicStackFormatter` is used.
+	//
+	// Default value: `DefaultPanicStackFormatter`
+	PanicStackFormatter func(recovered interface{}, stack []byte) string `mapstructure:"-"`
+
+	// ErrorPages is the map of status codes to the template names used by
+	// the `DefaultErrorHandler` to render the error pages.
+	//
+	// The error pages are only rendered for the requests that accept the
+	// "text/html". The data passed to the templates contains the "Status",
+	// "StatusText" and "Message". If rendering an error page fails, the
+	// `DefaultErrorHandler` falls back to writing the message as text.
+	//
+	// Default value: nil
+	ErrorPages map[int]string `mapstructure:"-"`
+
+	// ErrorEnvelope is used by the `DefaultErrorHandler` to produce the
+	// value that is encoded as the JSON body of the error responses.
+	//
+	// The status is the status code of the response, the message is the
+	// message that would be written as text, the internal is the error
+	// being handled, and the debug is the `DebugMode`.
+	//
+	// If the `ErrorEnvelope` is not nil, the JSON error responses are
+	// written for the requests that accept the "application/json" (or any
+	// "+json" media type) and have not been served with an error page.
+	// Setting it to nil makes all error responses written as text.
+	//
+	// Default value: `DefaultErrorEnvelope`
+	ErrorEnvelope func(
+		status int,
+		message string,
+		internal error,
+		debug bool,
+	) interface{} `mapstructure:"-"`
+
 	// ErrorLogger is the `log.Logger` that logs errors that occur in the
 	// web application.
 	//
@@ -384,6 +742,108 @@ type Air struct {
 	// Default value: nil
 	ErrorLogger *log.Logger `mapstructure:"-"`
 
+	// StartupLogWriter is the `io.Writer` that the `Serve` writes the
+	// startup messages (such as the "air: listening on ..." line) to.
+	//
+	// If the `StartupLogWriter` is nil, the startup messages are written to
+	// the `os.Stdout`.
+	//
+	// Default value: nil
+	StartupLogWriter io.Writer `mapstructure:"-"`
+
+	// OnAcceptError is the function that is called when the server fails
+	// to accept new connections.
+	//
+	// The temporary errors (such as running out of file descriptors) are
+	// retried with an exponential backoff, and the `OnAcceptError` is only
+	// called once the backoff reaches its cap, which means the failure is
+	// persistent. The permanent errors are reported immediately, except
+	// those caused by closing the server.
+	//
+	// Default value: nil
+	OnAcceptError func(error) `mapstructure:"-"`
+
+	// ConnStateHook is the function that is called when a client connection
+	// of the server changes state. See the `http.ConnState` for details.
+	//
+	// The connection states are always tracked for the
+	// `ConnectionStats`, regardless of the `ConnStateHook`.
+	//
+	// Default value: nil
+	ConnStateHook func(conn net.Conn, state http.ConnState) `mapstructure:"-"`
+
+	// SlowRequestThreshold is the duration that the handling of a request
+	// must exceed to be logged as a slow request.
+	//
+	// The slow requests are logged like errors (see the `ErrorLogger`)
+	// with their methods, matched route paths (or raw paths if no route is
+	// matched) and handling durations. A zero `SlowRequestThreshold`
+	// disables the logging of slow requests.
+	//
+	// Default value: 0
+	SlowRequestThreshold time.Duration `mapstructure:"slow_request_threshold"`
+
+	// DefaultCharset is the charset used in the "Content-Type" header
+	// written by the `Response.WriteString` and `Response.WriteHTML`.
+	//
+	// The `DefaultCharset` only affects the header. The content is written
+	// as is, so it must already be encoded in the `DefaultCharset`. If the
+	// `DefaultCharset` is empty, no charset parameter will be written.
+	//
+	// Default value: "utf-8"
+	DefaultCharset string `mapstructure:"default_charset"`
+
+	// DefaultResponseHeaders is the headers that every response starts
+	// with. They can be overridden by the handlers and gases.
+	//
+	// The hop-by-hop headers (such as the Connection) are ignored since
+	// they are managed by the server.
+	//
+	// The values are shared by all responses instead of being copied,
+	// so they should never be modified in place after the server starts.
+	//
+	// Default value: nil
+	DefaultResponseHeaders http.Header `mapstructure:"default_response_headers"`
+
+	// CanonicalizeResponseHeaders indicates whether the header names of
+	// each response are canonicalized (see the `http.CanonicalHeaderKey`)
+	// before being written to the client.
+	//
+	// If the `CanonicalizeResponseHeaders` is true, the header names set
+	// directly into the `Response.Header` map (such as
+	// `res.Header["x-foo-ID"] = []string{"bar"}`) are canonicalized and
+	// the values of the duplicate names are merged. Otherwise, they are
+	// written with their exact casing over HTTP/1.x, which may be required
+	// by some picky clients. Note that the methods of the `http.Header`
+	// (such as the `Set`) always canonicalize the header names, and that
+	// HTTP/2 always writes the header names in lowercase regardless.
+	//
+	// Default value: false
+	CanonicalizeResponseHeaders bool `mapstructure:"canonicalize_response_headers"`
+
+	// FormBindStyle is the style of the request param names used by the
+	// `Request.Bind` to bind the request params into structs.
+	//
+	// The `FlatFormBindStyle` matches each param name with a single field.
+	// The `BracketFormBindStyle` additionally understands the bracket (and
+	// dot) notation, such as "items[0][name]", "items[0].name" and
+	// "obj[field]", so that the params can be bound into the nested
+	// structs, slices and maps.
+	//
+	// Default value: `FlatFormBindStyle`
+	FormBindStyle FormBindStyle `mapstructure:"form_bind_style"`
+
+	// Validator is used by the `Request.Bind` to validate the value after
+	// it has been successfully bound. If it returns an error, the
+	// `Request.Bind` returns it with the `http.StatusBadRequest`.
+	//
+	// It is useful for plugging in a third-party validation library. Note
+	// that the value is also validated by its own `Validate() error`
+	// method (if any) before the `Validator` is called.
+	//
+	// Default value: nil
+	Validator func(v interface{}) error `mapstructure:"-"`
+
 	// RendererTemplateRoot is the root of the HTML templates of the
 	// renderer feature.
 	//
@@ -438,6 +898,32 @@ type Air struct {
 	// Default value: nil
 	RendererTemplateFuncMap template.FuncMap `mapstructure:"-"`
 
+	// RendererBuiltinFuncs indicates whether the following built-in HTML
+	// template functions of the renderer feature are available:
+	//  * dict
+	//      Returns a map built from its arguments, which are key-value
+	//      pairs with string keys. It is useful for passing multiple
+	//      values to sub-templates.
+	//  * default
+	//      Returns its second argument if it is not empty, otherwise
+	//      returns its first argument.
+	//  * safeHTML
+	//      Returns a `template.HTML` for its argument.
+	//  * safeURL
+	//      Returns a `template.URL` for its argument.
+	//  * T
+	//      Returns a localized string for its argument. It works exactly
+	//      the same as the `Request.LocalizedString`.
+	//  * asset
+	//      Returns the fingerprinted URL for its argument. It works
+	//      exactly the same as the `AssetURL`.
+	//
+	// The functions in the `RendererTemplateFuncMap` win on name
+	// collision.
+	//
+	// Default value: false
+	RendererBuiltinFuncs bool `mapstructure:"renderer_builtin_funcs"`
+
 	// MinifierEnabled indicates whether the minifier feature is enabled.
 	//
 	// The `MinifierEnabled` gives the `Response.Write` the ability to
@@ -475,7 +961,7 @@ type Air struct {
 	// GzipMIMETypes is the list of MIME types of the gzip feature that will
 	// trigger the gzip.
 	//
-	// Default value: ["text/plain", "text/html", "text/css",
+	// Default value: ["text/plain", "text/html", "text/css", "text/csv",
 	// "application/javascript", "application/json", "application/xml",
 	// "application/toml", "application/yaml", "image/svg+xml"]
 	GzipMIMETypes []string `mapstructure:"gzip_mime_types"`
@@ -492,14 +978,84 @@ type Air struct {
 	// Default value: 1024
 	GzipMinContentLength int64 `mapstructure:"gzip_min_content_length"`
 
+	// BrotliEnabled indicates whether the brotli feature is enabled.
+	//
+	// The `BrotliEnabled` gives the `Response` the ability to compress the
+	// matching response body with the brotli (see RFC 7932) on the fly
+	// based on the Content-Type header. When both the brotli and gzip
+	// features are enabled, the brotli is preferred unless the client
+	// prefers the gzip via the q-values of the Accept-Encoding header. The
+	// coffer assets that have been gzipped in advance are still served
+	// gzipped.
+	//
+	// Default value: false
+	BrotliEnabled bool `mapstructure:"brotli_enabled"`
+
+	// BrotliMIMETypes is the list of MIME types of the brotli feature that
+	// will trigger the brotli.
+	//
+	// Default value: ["text/plain", "text/html", "text/css", "text/csv",
+	// "application/javascript", "application/json", "application/xml",
+	// "application/toml", "application/yaml", "image/svg+xml"]
+	BrotliMIMETypes []string `mapstructure:"brotli_mime_types"`
+
+	// BrotliCompressionLevel is the compression level of the brotli
+	// feature.
+	//
+	// Default value: `brotli.DefaultCompression`
+	BrotliCompressionLevel int `mapstructure:"brotli_compression_level"`
+
+	// BrotliMinContentLength is the minimum content length of the brotli
+	// feature used to limit at least how big (determined only from the
+	// Content-Length header) response body can be compressed.
+	//
+	// Default value: 1024
+	BrotliMinContentLength int64 `mapstructure:"brotli_min_content_length"`
+
+	// ETagStrategy is the strategy used by the `Response.WriteFile` to
+	// generate the ETags of the files.
+	//
+	// The `StrongContentHash` hashes the entire content of each file, which
+	// may be expensive for large files. The `WeakSizeModTime` generates a
+	// weak ETag from the size and modification time of each file without
+	// reading it. The assets of the coffer feature always have strong
+	// ETags since their digests are precomputed.
+	//
+	// Default value: `StrongContentHash`
+	ETagStrategy ETagStrategy `mapstructure:"etag_strategy"`
+
+	// ETagHashMaxFileSize is the maximum size in bytes of the files whose
+	// ETags are generated by the `StrongContentHash`. Larger files fall
+	// back to the `WeakSizeModTime` so that they are not read twice (once
+	// for hashing and once for serving).
+	//
+	// If the `ETagHashMaxFileSize` is zero, there is no limit.
+	//
+	// Default value: 0
+	ETagHashMaxFileSize int64 `mapstructure:"etag_hash_max_file_size"`
+
 	// CofferEnabled indicates whether the coffer feature is enabled.
 	//
 	// The `CofferEnabled` gives the `Response.WriteFile` the ability to use
 	// the runtime memory to reduce the disk I/O pressure.
 	//
+	// See the `CofferWatchEnabled` for reloading the changed asset files.
+	//
 	// Default value: false
 	CofferEnabled bool `mapstructure:"coffer_enabled"`
 
+	// CofferWatchEnabled indicates whether the asset files loaded into the
+	// coffer are watched.
+	//
+	// If the `CofferWatchEnabled` is true, the changed asset files are
+	// reloaded from the disk when they are requested next time. So there is
+	// no need to restart the server after changing them. Otherwise, the
+	// asset files are loaded only once, which saves a file watcher for each
+	// of them. It is always treated as false when the `TestMode` is true.
+	//
+	// Default value: true
+	CofferWatchEnabled bool `mapstructure:"coffer_watch_enabled"`
+
 	// CofferMaxMemoryBytes is the maximum number of bytes of the runtime
 	// memory allowed for the coffer feature to use.
 	//
@@ -546,6 +1102,74 @@ type Air struct {
 	// Default value: "en-US"
 	I18nLocaleBase string `mapstructure:"i18n_locale_base"`
 
+	// ContentTypeSnifferBufferSize is the size in bytes of the buffers
+	// used to sniff the "Content-Type" of the responses.
+	//
+	// Only the first 512 bytes are considered by the sniffing algorithm,
+	// so a larger `ContentTypeSnifferBufferSize` is pointless.
+	//
+	// Default value: 512
+	ContentTypeSnifferBufferSize int `mapstructure:"content_type_sniffer_buffer_size"`
+
+	// ContentTypeSnifferBufferPool is the pool of the buffers used to sniff
+	// the "Content-Type" of the responses.
+	//
+	// The `ContentTypeSnifferBufferPool` must only return non-nil []byte.
+	// If it is nil, an internal pool that allocates buffers with the
+	// `ContentTypeSnifferBufferSize` is used.
+	//
+	// Default value: nil
+	ContentTypeSnifferBufferPool *sync.Pool `mapstructure:"-"`
+
+	// GzipWriterPool is the pool of the writers used by the gzip feature.
+	//
+	// The `GzipWriterPool` must only return non-nil *gzip.Writer, and the
+	// `GzipCompressionLevel` has no effect on it. If it is nil, an internal
+	// pool that allocates writers with the `GzipCompressionLevel` is used.
+	//
+	// Default value: nil
+	GzipWriterPool *sync.Pool `mapstructure:"-"`
+
+	// ReverseProxyBufferSize is the size in bytes of the buffers used by
+	// the `Response.ProxyPass` to copy the response bodies.
+	//
+	// Default value: 33554432
+	ReverseProxyBufferSize int `mapstructure:"reverse_proxy_buffer_size"`
+
+	// ReverseProxyBufferPool is the pool of the buffers used by the
+	// `Response.ProxyPass` to copy the response bodies.
+	//
+	// If the `ReverseProxyBufferPool` is nil, an internal pool that
+	// allocates buffers with the `ReverseProxyBufferSize` is used.
+	//
+	// Default value: nil
+	ReverseProxyBufferPool httputil.BufferPool `mapstructure:"-"`
+
+	// ReverseProxyMaxIdleConnsPerHost is the maximum number of idle
+	// connections to keep per host of the targets of the
+	// `Response.ProxyPass`.
+	//
+	// Default value: 200
+	ReverseProxyMaxIdleConnsPerHost int `mapstructure:"reverse_proxy_max_idle_conns_per_host"`
+
+	// ReverseProxyIdleConnTimeout is the maximum amount of time an idle
+	// connection to the targets of the `Response.ProxyPass` will remain
+	// idle before closing itself.
+	//
+	// If the `ReverseProxyIdleConnTimeout` is zero, there is no limit.
+	//
+	// Default value: 90 * time.Second
+	ReverseProxyIdleConnTimeout time.Duration `mapstructure:"reverse_proxy_idle_conn_timeout"`
+
+	// ReverseProxyMaxConnsPerHost is the maximum number of connections
+	// (including those in the dialing, active and idle states) per host of
+	// the targets of the `Response.ProxyPass`.
+	//
+	// If the `ReverseProxyMaxConnsPerHost` is zero, there is no limit.
+	//
+	// Default value: 0
+	ReverseProxyMaxConnsPerHost int `mapstructure:"reverse_proxy_max_conns_per_host"`
+
 	// ConfigFile is the path to the configuration file that will be parsed
 	// into the matching fields before starting the server.
 	//
@@ -559,24 +1183,37 @@ type Air struct {
 	// Default value: ""
 	ConfigFile string `mapstructure:"-"`
 
-	server   *http.Server
-	router   *router
-	binder   *binder
-	renderer *renderer
-	minifier *minifier
-	coffer   *coffer
-	i18n     *i18n
+	server      *http.Server
+	router      *router
+	binder      *binder
+	renderer    *renderer
+	minifier    *minifier
+	coffer      *coffer
+	i18n        *i18n
+	ocspStapler *ocspStapler
 
 	context                      context.Context
 	contextCancel                context.CancelFunc
 	addressMap                   map[string]int
+	mainListener                 *listener
+	mainListenerMutex            sync.Mutex
 	shutdownJobs                 []func()
 	shutdownJobMutex             sync.Mutex
 	shutdownJobDone              chan struct{}
+	webSockets                   map[*WebSocket]struct{}
+	webSocketMutex               sync.Mutex
+	eventStreams                 map[*eventStream]struct{}
+	eventStreamMutex             sync.Mutex
+	statusObservers              []statusObserver
+	statusObserverMutex          sync.RWMutex
+	connStats                    *connStats
+	assetURLPrefix               string
 	requestPool                  sync.Pool
 	responsePool                 sync.Pool
 	contentTypeSnifferBufferPool sync.Pool
 	gzipWriterPool               sync.Pool
+	gzipLevelWriterPools         [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+	brotliWriterPool             sync.Pool
 	reverseProxyTransport        *reverseProxyTransport
 	reverseProxyBufferPool       *reverseProxyBufferPool
 }
@@ -600,9 +1237,15 @@ func New() *Air {
 		ACMECertRoot:            "acme-certs",
 		ACMERenewalWindow:       30 * 24 * time.Hour,
 		HTTPSEnforcedPort:       "0",
+		H2CUpgrade:              true,
 		NotFoundHandler:         DefaultNotFoundHandler,
 		MethodNotAllowedHandler: DefaultMethodNotAllowedHandler,
 		ErrorHandler:            DefaultErrorHandler,
+		ErrorEnvelope:           DefaultErrorEnvelope,
+		PanicStackFormatter:     DefaultPanicStackFormatter,
+		DefaultCharset:          "utf-8",
+		FormBindStyle:           FlatFormBindStyle,
+		ETagStrategy:            StrongContentHash,
 		MinifierMIMETypes: []string{
 			"text/html",
 			"text/css",
@@ -615,6 +1258,21 @@ func New() *Air {
 			"text/plain",
 			"text/html",
 			"text/css",
+			"text/csv",
+			"application/javascript",
+			"application/json",
+			"application/xml",
+			"application/toml",
+			"application/yaml",
+			"image/svg+xml",
+		},
+		GzipCompressionLevel: gzip.DefaultCompression,
+		GzipMinContentLength: 1 << 10,
+		BrotliMIMETypes: []string{
+			"text/plain",
+			"text/html",
+			"text/css",
+			"text/csv",
 			"application/javascript",
 			"application/json",
 			"application/xml",
@@ -622,12 +1280,13 @@ func New() *Air {
 			"application/yaml",
 			"image/svg+xml",
 		},
-		GzipCompressionLevel:       gzip.DefaultCompression,
-		GzipMinContentLength:       1 << 10,
+		BrotliCompressionLevel:     brotli.DefaultCompression,
+		BrotliMinContentLength:     1 << 10,
 		RendererTemplateRoot:       "templates",
 		RendererTemplateExts:       []string{".html"},
 		RendererTemplateLeftDelim:  "{{",
 		RendererTemplateRightDelim: "}}",
+		CofferWatchEnabled:         true,
 		CofferMaxMemoryBytes:       32 << 20,
 		CofferAssetRoot:            "assets",
 		CofferAssetExts: []string{
@@ -645,8 +1304,14 @@ func New() *Air {
 			".png",
 			".gif",
 		},
-		I18nLocaleRoot: "locales",
-		I18nLocaleBase: "en-US",
+		I18nLocaleRoot:                  "locales",
+		I18nLocaleBase:                  "en-US",
+		WebSocketCompressionLevel:       flate.BestSpeed,
+		EventStreamKeepAliveInterval:    15 * time.Second,
+		ContentTypeSnifferBufferSize:    512,
+		ReverseProxyBufferSize:          32 << 20,
+		ReverseProxyMaxIdleConnsPerHost: 200,
+		ReverseProxyIdleConnTimeout:     90 * time.Second,
 	}
 
 	a.server = &http.Server{}
@@ -656,10 +1321,14 @@ func New() *Air {
 	a.minifier = newMinifier(a)
 	a.coffer = newCoffer(a)
 	a.i18n = newI18n(a)
+	a.ocspStapler = newOCSPStapler(a)
 
 	a.context, a.contextCancel = context.WithCancel(context.Background())
 	a.addressMap = map[string]int{}
 	a.shutdownJobDone = make(chan struct{})
+	a.webSockets = map[*WebSocket]struct{}{}
+	a.eventStreams = map[*eventStream]struct{}{}
+	a.connStats = &connStats{}
 	a.requestPool.New = func() interface{} {
 		return &Request{}
 	}
@@ -669,7 +1338,7 @@ func New() *Air {
 	}
 
 	a.contentTypeSnifferBufferPool.New = func() interface{} {
-		return make([]byte, 512)
+		return make([]byte, a.ContentTypeSnifferBufferSize)
 	}
 
 	a.gzipWriterPool.New = func() interface{} {
@@ -677,8 +1346,12 @@ func New() *Air {
 		return w
 	}
 
-	a.reverseProxyTransport = newReverseProxyTransport()
-	a.reverseProxyBufferPool = newReverseProxyBufferPool()
+	a.brotliWriterPool.New = func() interface{} {
+		return brotli.NewWriterLevel(nil, a.BrotliCompressionLevel)
+	}
+
+	a.reverseProxyTransport = newReverseProxyTransport(a)
+	a.reverseProxyBufferPool = newReverseProxyBufferPool(a)
 
 	return a
 }
@@ -839,7 +1512,7 @@ func (a *Air) FILE(path, filename string, gases ...Gas) {
 		return err
 	}
 
-	a.BATCH([]string{http.MethodGet, http.MethodHead}, path, h, gases...)
+	a.router.registerFiles(path, h, gases...)
 }
 
 // FILES registers some new GET and HEAD route paris with the path prefix in the
@@ -874,70 +1547,445 @@ func (a *Air) FILES(prefix, root string, gases ...Gas) {
 		return err
 	}
 
-	a.BATCH([]string{http.MethodGet, http.MethodHead}, prefix, h, gases...)
+	a.router.registerFiles(prefix, h, gases...)
 }
 
-// Group returns a new instance of the `Group` with the path prefix and optional
-// group-level gases that inherited from the a.
+// FILESFromCoffer registers some new GET and HEAD route pairs with the path
+// prefix in the router of the a to serve the asset files from the coffer with
+// optional route-level gases.
 //
-// The prefix may consit of STATIC and PARAM components, but it must not contain
-// ANY component.
+// Unlike the `FILES`, the assetRoot is a logical path relative to the
+// `CofferAssetRoot`, and the path of each request after the prefix is resolved
+// against it. So the assets are served from the coffer (with their digests and
+// gzipped contents) when the `CofferEnabled` is true, or from the disk
+// otherwise. The resolved path never escapes the assetRoot.
 //
 // The gases is always FILO.
-func (a *Air) Group(prefix string, gases ...Gas) *Group {
-	return &Group{
-		Air:    a,
-		Prefix: prefix,
-		Gases:  gases,
+func (a *Air) FILESFromCoffer(prefix, assetRoot string, gases ...Gas) {
+	if strings.HasSuffix(prefix, "/") {
+		prefix += "*"
+	} else {
+		prefix += "/*"
 	}
-}
 
-// Serve starts the server of the a.
-func (a *Air) Serve() error {
-	if a.ConfigFile != "" {
-		b, err := ioutil.ReadFile(a.ConfigFile)
-		if err != nil {
-			return err
-		}
+	assetRoot = filepath.Clean(filepath.FromSlash(fmt.Sprint("/", assetRoot)))
 
-		m := map[string]interface{}{}
-		switch e := strings.ToLower(filepath.Ext(a.ConfigFile)); e {
-		case ".json":
-			err = json.Unmarshal(b, &m)
-		case ".toml":
-			err = toml.Unmarshal(b, &m)
-		case ".yaml", ".yml":
-			err = yaml.Unmarshal(b, &m)
-		default:
-			err = fmt.Errorf(
-				"air: unsupported configuration file "+
-					"extension: %s",
-				e,
-			)
-		}
+	h := func(req *Request, res *Response) error {
+		path := req.Param("*").Value().String()
+		path = filepath.FromSlash(fmt.Sprint("/", path))
+		path = filepath.Clean(path)
 
-		if err != nil {
-			return err
-		} else if err := mapstructure.Decode(m, a); err != nil {
-			return err
+		err := res.WriteFile(filepath.Join(
+			a.CofferAssetRoot,
+			assetRoot,
+			path,
+		))
+		if os.IsNotExist(err) {
+			return a.NotFoundHandler(req, res)
 		}
-	}
 
-	host, port, err := net.SplitHostPort(a.Address)
-	if err != nil {
 		return err
 	}
 
-	a.server.Addr = net.JoinHostPort(host, port)
-	a.server.Handler = a
-	a.server.ReadTimeout = a.ReadTimeout
-	a.server.ReadHeaderTimeout = a.ReadHeaderTimeout
-	a.server.WriteTimeout = a.WriteTimeout
-	a.server.IdleTimeout = a.IdleTimeout
-	a.server.MaxHeaderBytes = a.MaxHeaderBytes
-	a.server.ErrorLog = a.ErrorLogger
+	a.router.registerFiles(prefix, h, gases...)
+}
 
-	tlsConfig := a.TLSConfig
+// ASSETS registers some new GET and HEAD route pairs with the path prefix in
+// the router of the a to serve the asset files under the `CofferAssetRoot` at
+// the fingerprinted URLs returned by the `AssetURL` with optional route-level
+// gases.
+//
+// The digest embedded in the path of each request is stripped before the asset
+// file is served. If it matches the current digest of the asset file, the asset
+// file is served with a Cache-Control header that allows it to be cached
+// forever. Otherwise (such as when the asset file has changed since the URL was
+// generated, or when there is no digest), the asset file is served as usual.
+//
+// The gases is always FILO.
+func (a *Air) ASSETS(prefix string, gases ...Gas) {
+	a.assetURLPrefix = strings.TrimSuffix(prefix, "/")
+
+	h := func(req *Request, res *Response) error {
+		p := path.Clean(fmt.Sprint("/", req.Param("*").Value().String()))
+
+		lp, digest := splitAssetDigest(p)
+		if digest != "" && digest == a.assetDigest(lp) {
+			res.Header.Set(
+				"Cache-Control",
+				"public, max-age=31536000, immutable",
+			)
+		}
+
+		err := res.WriteFile(filepath.Join(
+			a.CofferAssetRoot,
+			filepath.FromSlash(lp),
+		))
+		if os.IsNotExist(err) {
+			return a.NotFoundHandler(req, res)
+		}
+
+		return err
+	}
+
+	a.router.registerFiles(
+		fmt.Sprint(a.assetURLPrefix, "/*"),
+		h,
+		gases...,
+	)
+}
+
+// AssetURL returns the URL of the asset file at the logicalPath (relative to
+// the `CofferAssetRoot`) for the route pairs registered by the `ASSETS`, with
+// the digest of the asset file embedded in the filename.
+//
+// E.g.: "js/app.js" -> "/assets/js/app.0123456789abcdef.js"
+//
+// The digests are computed by the coffer feature, so the URL is returned
+// without a digest if the `CofferEnabled` is false or the asset file cannot be
+// loaded by the coffer feature.
+func (a *Air) AssetURL(logicalPath string) string {
+	lp := path.Clean(fmt.Sprint("/", filepath.ToSlash(logicalPath)))
+	u := fmt.Sprint(a.assetURLPrefix, lp)
+
+	digest := a.assetDigest(lp)
+	if digest == "" {
+		return u
+	}
+
+	ext := path.Ext(u)
+
+	return fmt.Sprint(u[:len(u)-len(ext)], ".", digest, ext)
+}
+
+// assetDigest returns the hex-encoded digest of the asset file at the
+// logicalPath. It returns an empty string if the digest is not available.
+func (a *Air) assetDigest(logicalPath string) string {
+	if !a.CofferEnabled {
+		return ""
+	}
+
+	name, err := filepath.Abs(filepath.Join(
+		a.CofferAssetRoot,
+		filepath.FromSlash(logicalPath),
+	))
+	if err != nil {
+		return ""
+	}
+
+	ast, err := a.coffer.asset(name)
+	if err != nil || ast == nil {
+		return ""
+	}
+
+	return hex.EncodeToString(ast.digest)
+}
+
+// Favicon registers a new GET and HEAD route pair with the "/favicon.ico" in
+// the router of the a to serve the favicon file with the filename and optional
+// route-level gases.
+//
+// The favicon is served with a Cache-Control header that allows it to be
+// cached for 30 days.
+//
+// The gases is always FILO.
+func (a *Air) Favicon(filename string, gases ...Gas) {
+	a.FILE(
+		"/favicon.ico",
+		filename,
+		append([]Gas{cacheControlGas("public, max-age=2592000")}, gases...)...,
+	)
+}
+
+// Robots registers a new GET and HEAD route pair with the "/robots.txt" in the
+// router of the a to serve the content as the robots.txt with optional
+// route-level gases.
+//
+// The robots.txt is served with a Cache-Control header that allows it to be
+// cached for one day.
+//
+// The gases is always FILO.
+func (a *Air) Robots(content string, gases ...Gas) {
+	b := []byte(content)
+	a.BATCH(
+		[]string{http.MethodGet, http.MethodHead},
+		"/robots.txt",
+		func(req *Request, res *Response) error {
+			return res.WriteBytes("text/plain; charset=utf-8", b)
+		},
+		append([]Gas{cacheControlGas("public, max-age=86400")}, gases...)...,
+	)
+}
+
+// WellKnown registers a new GET and HEAD route pair with the
+// "/.well-known/<name>" (see RFC 8615) in the router of the a with the h and
+// optional route-level gases. The name may contain multiple segments, such as
+// "matrix/server".
+//
+// If the `ACMEEnabled` is true, the names under the "acme-challenge" are
+// reserved for the ACME feature, so they are rejected with a panic. The ACME
+// HTTP-01 challenges are always served by the ACME feature on the
+// `HTTPSEnforcedPort` before anything else, and the other requests to the
+// `HTTPSEnforcedPort` (including those to the well-known URIs registered by
+// the `WellKnown`) are redirected to HTTPS. So the registered well-known URIs
+// never interfere with the ACME feature. Otherwise, the "acme-challenge" can be
+// registered like any other name, which is useful for solving the challenges
+// of an external ACME client.
+//
+// The gases is always FILO.
+func (a *Air) WellKnown(name string, h Handler, gases ...Gas) {
+	name = strings.TrimPrefix(path.Clean(fmt.Sprint("/", name)), "/")
+	if name == "" {
+		panic("air: well-known name cannot be empty")
+	} else if a.ACMEEnabled && (name == "acme-challenge" ||
+		strings.HasPrefix(name, "acme-challenge/")) {
+		panic("air: well-known name is reserved: " + name)
+	}
+
+	a.BATCH(
+		[]string{http.MethodGet, http.MethodHead},
+		fmt.Sprint("/.well-known/", name),
+		h,
+		gases...,
+	)
+}
+
+// RegisterRoutes registers all of the routes in the router of the a. It is
+// useful for centralizing route definitions in a declarative table.
+//
+// The `Method` of each route must be one of the "GET", "HEAD", "POST", "PUT",
+// "PATCH", "DELETE", "CONNECT", "OPTIONS" and "TRACE". The `Name` of each route
+// must be unique if it is not empty.
+func (a *Air) RegisterRoutes(routes []Route) {
+	for _, rt := range routes {
+		switch rt.Method {
+		case http.MethodGet,
+			http.MethodHead,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+			http.MethodConnect,
+			http.MethodOptions,
+			http.MethodTrace:
+		default:
+			panic(fmt.Sprintf(
+				"air: unsupported route method: %s",
+				rt.Method,
+			))
+		}
+
+		rt := rt
+		a.router.registerRoute(&rt)
+	}
+}
+
+// AddNamed registers a new route named the name for the method and path with
+// the matching h in the router of the a with the optional route-level gases.
+// The name can be used to generate URLs for the route via the `URL`.
+//
+// The method must be one of the methods supported by the `RegisterRoutes`. The
+// name must not be empty and must be unique.
+//
+// The gases is always FILO.
+func (a *Air) AddNamed(
+	name string,
+	method string,
+	path string,
+	h Handler,
+	gases ...Gas,
+) {
+	if name == "" {
+		panic("air: route name cannot be empty")
+	}
+
+	a.RegisterRoutes([]Route{{
+		Method:  method,
+		Path:    path,
+		Handler: h,
+		Gases:   gases,
+		Name:    name,
+	}})
+}
+
+// URL returns the path of the route named the name in the router of the a,
+// with each PARAM and ANY component substituted with the value of the same
+// name (or "*" for the ANY component) in the params. The values are formatted
+// via the `fmt.Sprint` and then URL-escaped.
+//
+// It returns an error if the route is not found, or if a PARAM component has
+// no value, has an empty value or has a value that does not match its
+// constraint. A missing ANY component value is treated as empty. The slashes in
+// the value of an ANY component are kept as is.
+func (a *Air) URL(name string, params map[string]interface{}) (string, error) {
+	a.router.Lock()
+	rt := a.router.namedRoutes[name]
+	a.router.Unlock()
+	if rt == nil {
+		return "", fmt.Errorf("air: route not found: %s", name)
+	}
+
+	path := rt.Path
+	b := strings.Builder{}
+	b.Grow(len(path))
+	for i, l := 0, len(path); i < l; i++ {
+		switch path[i] {
+		case ':':
+			j := i + 1
+			for ; i < l && path[i] != '/'; i++ {
+			}
+
+			pn := path[j:i]
+			pv, ok := params[pn]
+			if !ok || pv == nil {
+				return "", fmt.Errorf(
+					"air: missing route param: %s",
+					pn,
+				)
+			}
+
+			s := fmt.Sprint(pv)
+			if s == "" {
+				return "", fmt.Errorf(
+					"air: empty route param: %s",
+					pn,
+				)
+			} else if c := rt.paramConstraints[pn]; c != nil &&
+				!c.MatchString(s) {
+				return "", fmt.Errorf(
+					"air: route param %s does not match "+
+						"its constraint: %s",
+					pn,
+					s,
+				)
+			}
+
+			b.WriteString(url.PathEscape(s))
+			i--
+		case '*':
+			if pv, ok := params["*"]; ok && pv != nil {
+				ss := strings.Split(fmt.Sprint(pv), "/")
+				for k, s := range ss {
+					ss[k] = url.PathEscape(s)
+				}
+
+				b.WriteString(strings.Join(ss, "/"))
+			}
+		default:
+			b.WriteByte(path[i])
+		}
+	}
+
+	return b.String(), nil
+}
+
+// Routes returns the information of all routes registered in the router of the
+// a, sorted by the path and then the method.
+func (a *Air) Routes() []RouteInfo {
+	routes := a.router.snapshotRoutes()
+	ris := make([]RouteInfo, 0, len(routes))
+	for _, rt := range routes {
+		paramNames := []string{}
+		for i, l := 0, len(rt.Path); i < l; i++ {
+			switch rt.Path[i] {
+			case ':':
+				j := i + 1
+				for ; i < l && rt.Path[i] != '/'; i++ {
+				}
+
+				paramNames = append(paramNames, rt.Path[j:i])
+			case '*':
+				paramNames = append(paramNames, "*")
+			}
+		}
+
+		ris = append(ris, RouteInfo{
+			Method:      rt.Method,
+			Path:        rt.Path,
+			ParamNames:  paramNames,
+			Name:        rt.Name,
+			ServesFiles: rt.servesFiles,
+		})
+	}
+
+	sort.SliceStable(ris, func(i, j int) bool {
+		if ris[i].Path != ris[j].Path {
+			return ris[i].Path < ris[j].Path
+		}
+
+		return ris[i].Method < ris[j].Method
+	})
+
+	return ris
+}
+
+// Group returns a new instance of the `Group` with the path prefix and optional
+// group-level gases that inherited from the a.
+//
+// The prefix may consit of STATIC and PARAM components, but it must not contain
+// ANY component.
+//
+// The gases is always FILO.
+func (a *Air) Group(prefix string, gases ...Gas) *Group {
+	return &Group{
+		Air:    a,
+		Prefix: prefix,
+		Gases:  gases,
+	}
+}
+
+// Serve starts the server of the a.
+func (a *Air) Serve() error {
+	if a.ConfigFile != "" {
+		b, err := ioutil.ReadFile(a.ConfigFile)
+		if err != nil {
+			return err
+		}
+
+		m := map[string]interface{}{}
+		switch e := strings.ToLower(filepath.Ext(a.ConfigFile)); e {
+		case ".json":
+			err = json.Unmarshal(b, &m)
+		case ".toml":
+			err = toml.Unmarshal(b, &m)
+		case ".yaml", ".yml":
+			err = yaml.Unmarshal(b, &m)
+		default:
+			err = fmt.Errorf(
+				"air: unsupported configuration file "+
+					"extension: %s",
+				e,
+			)
+		}
+
+		if err != nil {
+			return err
+		} else if err := mapstructure.Decode(m, a); err != nil {
+			return err
+		}
+	}
+
+	var host, port string
+	if _, ok := unixSocketPath(a.Address); ok {
+		a.server.Addr = a.Address
+	} else {
+		var err error
+		if host, port, err = net.SplitHostPort(a.Address); err != nil {
+			return err
+		}
+
+		a.server.Addr = net.JoinHostPort(host, port)
+	}
+	a.server.Handler = a
+	a.server.ReadTimeout = a.ReadTimeout
+	a.server.ReadHeaderTimeout = a.ReadHeaderTimeout
+	a.server.WriteTimeout = a.WriteTimeout
+	a.server.IdleTimeout = a.IdleTimeout
+	a.server.MaxHeaderBytes = a.MaxHeaderBytes
+	a.server.ErrorLog = a.ErrorLogger
+	a.server.ConnState = a.connState
+	a.server.ConnContext = a.connContext
+
+	tlsConfig := a.TLSConfig
 	if tlsConfig != nil {
 		tlsConfig = tlsConfig.Clone()
 	}
@@ -955,6 +2003,26 @@ func (a *Air) Serve() error {
 		tlsConfig.Certificates = append(tlsConfig.Certificates, c)
 	}
 
+	if a.DevTLS && a.DebugMode && !a.ACMEEnabled && (tlsConfig == nil ||
+		(len(tlsConfig.Certificates) == 0 &&
+			tlsConfig.GetCertificate == nil)) {
+		c, err := newDevTLSCertificate()
+		if err != nil {
+			return err
+		}
+
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+
+		tlsConfig.Certificates = append(tlsConfig.Certificates, c)
+
+		a.logStartupf(
+			"air: serving with a self-signed certificate for " +
+				"local development",
+		)
+	}
+
 	if tlsConfig != nil {
 		for _, proto := range []string{"h2", "http/1.1"} {
 			if !stringSliceContains(
@@ -979,7 +2047,7 @@ func (a *Air) Serve() error {
 			host = r.Host
 		}
 
-		if port != "443" {
+		if port != "443" && port != "" {
 			host = net.JoinHostPort(host, port)
 		}
 
@@ -991,36 +2059,9 @@ func (a *Air) Serve() error {
 		)
 	}))
 
+	var acm *autocert.Manager
 	if a.ACMEEnabled {
-		acm := &autocert.Manager{
-			Prompt: func(tosURL string) bool {
-				if len(a.ACMETOSURLWhitelist) == 0 {
-					return true
-				}
-
-				for _, u := range a.ACMETOSURLWhitelist {
-					if u == tosURL {
-						return true
-					}
-				}
-
-				return false
-			},
-			Cache:       autocert.DirCache(a.ACMECertRoot),
-			RenewBefore: a.ACMERenewalWindow,
-			Client: &acme.Client{
-				Key:          a.ACMEAccountKey,
-				DirectoryURL: a.ACMEDirectoryURL,
-			},
-			Email:           a.MaintainerEmail,
-			ExtraExtensions: a.ACMEExtraExts,
-		}
-		if a.ACMEHostWhitelist != nil {
-			acm.HostPolicy = autocert.HostWhitelist(
-				a.ACMEHostWhitelist...,
-			)
-		}
-
+		acm = a.newACMEManager()
 		hh = acm.HTTPHandler(hh)
 
 		if tlsConfig == nil {
@@ -1059,12 +2100,151 @@ func (a *Air) Serve() error {
 		}
 	}
 
+	if tlsConfig != nil && a.OCSPStaplingEnabled {
+		certificates := tlsConfig.Certificates
+		for i := range certificates {
+			a.ocspStapler.staple(&certificates[i])
+		}
+
+		tlsConfig.Certificates = nil
+
+		getCertificate := tlsConfig.GetCertificate
+		tlsConfig.GetCertificate = func(
+			chi *tls.ClientHelloInfo,
+		) (*tls.Certificate, error) {
+			if getCertificate != nil &&
+				(len(certificates) == 0 || chi.ServerName != "") {
+				c, err := getCertificate(chi)
+				if err != nil {
+					return nil, err
+				}
+
+				if c != nil {
+					return a.ocspStapler.staple(c), nil
+				}
+			}
+
+			c := matchTLSCertificate(certificates, chi.ServerName)
+			if c == nil {
+				return nil, errors.New(
+					"air: no certificates configured",
+				)
+			}
+
+			return a.ocspStapler.staple(c), nil
+		}
+	}
+
+	if tlsConfig != nil {
+		if tlsConfig.MinVersion == 0 {
+			tlsConfig.MinVersion = a.TLSMinVersion
+		}
+
+		if tlsConfig.CipherSuites == nil {
+			tlsConfig.CipherSuites = a.TLSCipherSuites
+		}
+	}
+
+	if tlsConfig != nil && a.TLSClientCAFile != "" {
+		b, err := ioutil.ReadFile(a.TLSClientCAFile)
+		if err != nil {
+			return err
+		}
+
+		// The `ClientCAs` is shared with the `TLSConfig`, so it must
+		// be copied before being modified.
+		clientCAs := x509.NewCertPool()
+		if tlsConfig.ClientCAs != nil {
+			clientCAs = cloneCertPool(tlsConfig.ClientCAs)
+			if clientCAs == nil {
+				return errors.New(
+					"air: tls client ca file cannot be merged " +
+						"into existing client cas before go1.19",
+				)
+			}
+		}
+
+		if !clientCAs.AppendCertsFromPEM(b) {
+			return fmt.Errorf(
+				"air: no certificates found in tls client ca "+
+					"file: %s",
+				a.TLSClientCAFile,
+			)
+		}
+
+		tlsConfig.ClientCAs = clientCAs
+	}
+
+	if tlsConfig != nil && a.TLSClientAuth != tls.NoClientCert {
+		tlsConfig.ClientAuth = a.TLSClientAuth
+	}
+
+	a.server.TLSNextProto = nil
+	if tlsConfig != nil && len(a.TLSNextProtos) > 0 {
+		// The HTTP/2 must be configured explicitly since the
+		// `http.Server` does not do it when the `TLSNextProto` is set.
+		a.server.TLSConfig = nil
+		if err := http2.ConfigureServer(a.server, &http2.Server{
+			IdleTimeout: a.IdleTimeout,
+		}); err != nil {
+			return err
+		}
+
+		for proto, f := range a.TLSNextProtos {
+			switch proto {
+			case "h2", "http/1.1", acme.ALPNProto:
+				continue
+			}
+
+			if f == nil {
+				continue
+			}
+
+			f := f
+			a.server.TLSNextProto[proto] = func(
+				_ *http.Server,
+				c *tls.Conn,
+				_ http.Handler,
+			) {
+				f(c)
+			}
+
+			if !stringSliceContains(
+				tlsConfig.NextProtos,
+				proto,
+				false,
+			) {
+				tlsConfig.NextProtos = append(
+					tlsConfig.NextProtos,
+					proto,
+				)
+			}
+		}
+	}
+
 	listener := newListener(a)
-	if err := listener.listen(a.server.Addr); err != nil {
+	if fd, inherited, err := inheritedListenerFD(); err != nil {
+		return err
+	} else if inherited {
+		if err := listener.inherit(fd); err != nil {
+			return err
+		}
+
+		os.Unsetenv(listenFDEnvKey)
+	} else if err := listener.listen(a.server.Addr); err != nil {
 		return err
 	}
 	defer listener.Close()
 
+	a.mainListenerMutex.Lock()
+	a.mainListener = listener
+	a.mainListenerMutex.Unlock()
+	defer func() {
+		a.mainListenerMutex.Lock()
+		a.mainListener = nil
+		a.mainListenerMutex.Unlock()
+	}()
+
 	a.addressMap[listener.Addr().String()] = 0
 	defer delete(a.addressMap, listener.Addr().String())
 
@@ -1107,12 +2287,136 @@ func (a *Air) Serve() error {
 			h2s.IdleTimeout = a.ReadTimeout
 		}
 
-		a.server.Handler = h2c.NewHandler(a.server.Handler, h2s)
+		h := a.server.Handler
+		h2ch := h2c.NewHandler(h, h2s)
+		a.server.Handler = http.HandlerFunc(func(
+			rw http.ResponseWriter,
+			r *http.Request,
+		) {
+			if !a.H2CUpgrade && isH2CUpgrade(r) {
+				// Serve it as a plain HTTP/1.x request.
+				h.ServeHTTP(rw, r)
+				return
+			}
+
+			h2ch.ServeHTTP(rw, r)
+		})
 	}
 
-	if port == "0" || (httpsEnforced && a.HTTPSEnforcedPort == "0") {
+	extraRandomPort := false
+	for i, el := range a.ExtraListeners {
+		if _, p, err := net.SplitHostPort(el.Address); err == nil &&
+			p == "0" {
+			extraRandomPort = true
+		}
+
+		var elTLSConfig *tls.Config
+		if el.TLSConfig != nil {
+			elTLSConfig = el.TLSConfig.Clone()
+		}
+
+		if el.ACMEEnabled {
+			if acm == nil {
+				acm = a.newACMEManager()
+			}
+
+			if elTLSConfig == nil {
+				elTLSConfig = &tls.Config{}
+			}
+
+			getCertificate := elTLSConfig.GetCertificate
+			elTLSConfig.GetCertificate = func(
+				chi *tls.ClientHelloInfo,
+			) (*tls.Certificate, error) {
+				if getCertificate != nil {
+					c, err := getCertificate(chi)
+					if err != nil {
+						return nil, err
+					}
+
+					if c != nil {
+						return c, nil
+					}
+				}
+
+				return acm.GetCertificate(chi)
+			}
+
+			elTLSConfig.NextProtos = append(
+				elTLSConfig.NextProtos,
+				acme.ALPNProto,
+			)
+		}
+
+		if elTLSConfig != nil {
+			for _, proto := range []string{"h2", "http/1.1"} {
+				if !stringSliceContains(
+					elTLSConfig.NextProtos,
+					proto,
+					false,
+				) {
+					elTLSConfig.NextProtos = append(
+						elTLSConfig.NextProtos,
+						proto,
+					)
+				}
+			}
+		}
+
+		l := newListener(a)
+		if err := l.listen(el.Address); err != nil {
+			return err
+		}
+		defer l.Close()
+
+		a.addressMap[l.Addr().String()] = 2 + len(a.ExtraAddresses) + i
+		defer delete(a.addressMap, l.Addr().String())
+
+		nl := net.Listener(l)
+		if elTLSConfig != nil {
+			nl = tls.NewListener(nl, elTLSConfig)
+		}
+
+		go func() {
+			err := a.server.Serve(nl)
+			if err != nil && err != http.ErrServerClosed {
+				a.logErrorf("air: failed to serve: %v", err)
+			}
+		}()
+	}
+
+	for i, ea := range a.ExtraAddresses {
+		if _, p, err := net.SplitHostPort(ea); err == nil && p == "0" {
+			extraRandomPort = true
+		}
+
+		l := newListener(a)
+		if err := l.listen(ea); err != nil {
+			return err
+		}
+		defer l.Close()
+
+		a.addressMap[l.Addr().String()] = 2 + i
+		defer delete(a.addressMap, l.Addr().String())
+
+		nl := net.Listener(l)
+		if tlsConfig != nil {
+			nl = tls.NewListener(nl, tlsConfig)
+		}
+
+		go func() {
+			err := a.server.Serve(nl)
+			if err != nil && err != http.ErrServerClosed {
+				a.logErrorf("air: failed to serve: %v", err)
+			}
+		}()
+	}
+
+	if port == "0" ||
+		(httpsEnforced && a.HTTPSEnforcedPort == "0") ||
+		extraRandomPort {
 		_, port, _ = net.SplitHostPort(netListener.Addr().String())
-		fmt.Printf("air: listening on %v\n", a.Addresses())
+		a.logStartupf("air: listening on %v", a.Addresses())
 	}
 
 	shutdownJobRunOnce := sync.Once{}
@@ -1131,17 +2435,114 @@ func (a *Air) Serve() error {
 				}
 			}
 
-			waitGroup.Wait()
+			waitGroup.Wait()
+
+			close(a.shutdownJobDone)
+		})
+	})
+
+	if a.DebugMode {
+		a.logStartupf("air: serving in debug mode")
+	}
+
+	return a.server.Serve(netListener)
+}
+
+// newACMEManager returns a new instance of the `autocert.Manager` configured
+// from the ACME fields of the a.
+func (a *Air) newACMEManager() *autocert.Manager {
+	acm := &autocert.Manager{
+		Prompt: func(tosURL string) bool {
+			if len(a.ACMETOSURLWhitelist) == 0 {
+				return true
+			}
+
+			for _, u := range a.ACMETOSURLWhitelist {
+				if u == tosURL {
+					return true
+				}
+			}
+
+			return false
+		},
+		RenewBefore: a.ACMERenewalWindow,
+		Client: &acme.Client{
+			Key:          a.ACMEAccountKey,
+			DirectoryURL: a.ACMEDirectoryURL,
+		},
+		Email:           a.MaintainerEmail,
+		ExtraExtensions: a.ACMEExtraExts,
+	}
+	if a.ACMECache != nil {
+		acm.Cache = a.ACMECache
+	} else {
+		acm.Cache = autocert.DirCache(a.ACMECertRoot)
+	}
+
+	if a.ACMEHostWhitelist != nil {
+		acm.HostPolicy = autocert.HostWhitelist(a.ACMEHostWhitelist...)
+	}
 
-			close(a.shutdownJobDone)
-		})
-	})
+	return acm
+}
 
-	if a.DebugMode {
-		fmt.Println("air: serving in debug mode")
+// HandOff starts a new process of the current executable with the same
+// arguments and environment variables, and hands off the listener of the
+// `Address` to it, which is useful for restarting the server without dropping
+// any connection (such as when deploying a new version of the executable).
+//
+// The new process adopts the listener via the AIR_LISTEN_FD environment
+// variable in its `Serve` instead of listening on the `Address`, so the
+// connections keep being accepted while both processes are running. The caller
+// should call the `Shutdown` after the `HandOff` returns to let the current
+// process finish the active connections and exit. Only the listener of the
+// `Address` is handed off, the other ones (such as the `ExtraAddresses`) are
+// listened on again by the new process.
+//
+// The `HandOff` is usually called when the SIGUSR2 is received:
+//
+//	sc := make(chan os.Signal, 1)
+//	signal.Notify(sc, syscall.SIGUSR2)
+//	<-sc
+//	if _, err := a.HandOff(); err != nil {
+//		log.Fatal(err)
+//	}
+//
+//	a.Shutdown(context.Background())
+func (a *Air) HandOff() (*os.Process, error) {
+	a.mainListenerMutex.Lock()
+	l := a.mainListener
+	a.mainListenerMutex.Unlock()
+	if l == nil {
+		return nil, errors.New("air: server is not running")
 	}
 
-	return a.server.Serve(netListener)
+	f, err := l.file()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	env := make([]string, 0, len(os.Environ())+1)
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, listenFDEnvKey+"=") {
+			env = append(env, e)
+		}
+	}
+
+	// The first three file descriptors of the new process are the standard
+	// streams, so the listener is the fourth one.
+	env = append(env, listenFDEnvKey+"=3")
+
+	return os.StartProcess(exe, os.Args, &os.ProcAttr{
+		Env:   env,
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr, f},
+	})
 }
 
 // Close closes the server of the a immediately.
@@ -1163,13 +2564,23 @@ func (a *Air) Close() error {
 // `http.ErrServerClosed`. Make sure the program does not exit and waits instead
 // for the `Shutdown` to return.
 //
-// The `Shutdown` does not attempt to close nor wait for hijacked connections
-// such as WebSockets. The caller should separately notify such long-lived
-// connections of shutdown and wait for them to close, if desired. See the
-// `AddShutdownJob` for a way to add shutdown jobs.
+// The `Shutdown` sends a connection close message with the "Service Restart"
+// status to each WebSocket connection created by the `Response.WebSocket` that
+// is still open, and then waits up to the `WebSocketShutdownTimeout` for them
+// to close. See the `DrainLongLived` for an observable way to wait for them
+// without the timeout. It does not attempt to close nor wait for other hijacked
+// connections. The caller should separately notify such long-lived connections
+// of shutdown and wait for them to close, if desired. See the `AddShutdownJob`
+// for a way to add shutdown jobs.
 func (a *Air) Shutdown(ctx context.Context) error {
 	defer a.contextCancel()
 
+	webSocketsDone := make(chan struct{})
+	go func() {
+		a.shutdownWebSockets(ctx)
+		close(webSocketsDone)
+	}()
+
 	err := a.server.Shutdown(ctx)
 	select {
 	case <-ctx.Done():
@@ -1177,9 +2588,141 @@ func (a *Air) Shutdown(ctx context.Context) error {
 	case <-a.shutdownJobDone:
 	}
 
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-webSocketsDone:
+	}
+
 	return err
 }
 
+// shutdownWebSockets sends a connection close message to each open WebSocket
+// connection of the a and waits up to the `WebSocketShutdownTimeout` or until
+// the ctx is done for them to close.
+func (a *Air) shutdownWebSockets(ctx context.Context) {
+	a.webSocketMutex.Lock()
+	wss := make([]*WebSocket, 0, len(a.webSockets))
+	for ws := range a.webSockets {
+		wss = append(wss, ws)
+	}
+	a.webSocketMutex.Unlock()
+
+	if len(wss) == 0 {
+		return
+	}
+
+	for _, ws := range wss {
+		ws.notifyShutdown()
+	}
+
+	if a.WebSocketShutdownTimeout <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(a.WebSocketShutdownTimeout)
+	defer timer.Stop()
+
+	for _, ws := range wss {
+		select {
+		case <-ws.untracked:
+		case <-timer.C:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// DrainLongLived signals each long-lived connection of the a to close and waits
+// until all of them are closed. It returns nil once no long-lived connection
+// remains, otherwise it returns the ctx's error when the ctx expires.
+//
+// The long-lived connections are the WebSocket connections created by the
+// `Response.WebSocket`, which are sent a connection close message with the
+// "Service Restart" status, and the streams of server-sent events written by
+// the `Response.StreamEvents` or `Response.WriteEvent`, whose
+// `Request.Context` is canceled so that the `Response.StreamEvents` returns
+// and the `Response.WriteEvent` returns an error. A stream of server-sent
+// events remains until its request-response cycle ends.
+//
+// The progress, if not nil, is called with the number of the remaining
+// long-lived connections right away and then periodically until the
+// `DrainLongLived` returns. The long-lived connections created during the drain
+// are also signaled to close.
+//
+// The `DrainLongLived` complements the `Shutdown`, which does not wait for the
+// long-lived connections beyond the `WebSocketShutdownTimeout`. It can be
+// called either before or after the `Shutdown`.
+func (a *Air) DrainLongLived(
+	ctx context.Context,
+	progress func(remaining int),
+) error {
+	ticker := time.NewTicker(longLivedConnDrainInterval)
+	defer ticker.Stop()
+
+	notified := map[longLivedConn]struct{}{}
+	for {
+		llcs := a.longLivedConns()
+		stillNotified := make(map[longLivedConn]struct{}, len(llcs))
+		for _, llc := range llcs {
+			if _, ok := notified[llc]; !ok {
+				llc.notifyShutdown()
+			}
+
+			stillNotified[llc] = struct{}{}
+		}
+
+		notified = stillNotified
+
+		if progress != nil {
+			progress(len(llcs))
+		}
+
+		if len(llcs) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// longLivedConnDrainInterval is the interval at which the `Air.DrainLongLived`
+// checks the remaining long-lived connections.
+const longLivedConnDrainInterval = 100 * time.Millisecond
+
+// longLivedConn is a long-lived connection that can be drained by the
+// `Air.DrainLongLived`.
+type longLivedConn interface {
+	// notifyShutdown signals the remote peer of the long-lived connection
+	// to close it. It must be safe to be called concurrently with other
+	// write methods of the long-lived connection.
+	notifyShutdown() error
+}
+
+// longLivedConns returns a snapshot of all open long-lived connections of the
+// a.
+func (a *Air) longLivedConns() []longLivedConn {
+	a.webSocketMutex.Lock()
+	llcs := make([]longLivedConn, 0, len(a.webSockets))
+	for ws := range a.webSockets {
+		llcs = append(llcs, ws)
+	}
+	a.webSocketMutex.Unlock()
+
+	a.eventStreamMutex.Lock()
+	for es := range a.eventStreams {
+		llcs = append(llcs, es)
+	}
+	a.eventStreamMutex.Unlock()
+
+	return llcs
+}
+
 // AddShutdownJob adds the f as a shutdown job that will run only once when the
 // `Shutdown` is called. The return value is an unique ID assigned to the f,
 // which can be used to remove the f from the shutdown job queue by calling the
@@ -1201,8 +2744,123 @@ func (a *Air) RemoveShutdownJob(id int) {
 	}
 }
 
-// Addresses returns all TCP addresses that the server of the a actually listens
-// on.
+// AddStatusObserver adds the f as a status observer that will be called once
+// for each request whose final response status is within the range [min, max].
+// The return value is an unique ID assigned to the f, which can be used to
+// remove the f from the status observers by calling the
+// `RemoveStatusObserver`.
+//
+// The f is called after the request is handled and all the functions deferred
+// via the `Response.Defer` are executed, so the `Response.Status` it reads is
+// the committed one. The f must not modify the response, it has already been
+// sent to the client.
+func (a *Air) AddStatusObserver(min, max int, f func(*Request, *Response)) int {
+	a.statusObserverMutex.Lock()
+	defer a.statusObserverMutex.Unlock()
+	a.statusObservers = append(a.statusObservers, statusObserver{
+		min: min,
+		max: max,
+		f:   f,
+	})
+	return len(a.statusObservers) - 1
+}
+
+// RemoveStatusObserver removes the status observer targeted by the id from the
+// status observers.
+func (a *Air) RemoveStatusObserver(id int) {
+	a.statusObserverMutex.Lock()
+	defer a.statusObserverMutex.Unlock()
+	if id >= 0 && id < len(a.statusObservers) {
+		a.statusObservers[id].f = nil
+	}
+}
+
+// notifyStatusObservers calls each status observer of the a whose range covers
+// the status of the res.
+func (a *Air) notifyStatusObservers(req *Request, res *Response) {
+	a.statusObserverMutex.RLock()
+	defer a.statusObserverMutex.RUnlock()
+	for _, so := range a.statusObservers {
+		if so.f != nil && res.Status >= so.min && res.Status <= so.max {
+			so.f(req, res)
+		}
+	}
+}
+
+// RegisterBinder registers the fn as the binder used by the `Request.Bind` for
+// the requests whose Content-Type header has the MIME type mimeType. The
+// mimeType is case-insensitive and must not contain params (such as
+// "text/csv"). A nil fn unregisters the binder of the mimeType.
+//
+// The registered binders take precedence over the built-in ones, so the
+// built-in binding of a MIME type (such as the "application/json") can be
+// replaced. Note that a binder registered for the
+// "application/x-www-form-urlencoded" or "multipart/form-data" is responsible
+// for the `FormBindStyle` by itself. The value bound by the fn is still
+// validated like the built-in ones.
+func (a *Air) RegisterBinder(
+	mimeType string,
+	fn func(req *Request, v interface{}) error,
+) {
+	a.binder.register(mimeType, fn)
+}
+
+// ConnectionStats returns the numbers of the active and idle client connections
+// of the server of the a, and the total number of the client connections that
+// have been hijacked (such as by the WebSocket feature).
+func (a *Air) ConnectionStats() (active, idle, hijacked int64) {
+	return atomic.LoadInt64(&a.connStats.active),
+		atomic.LoadInt64(&a.connStats.idle),
+		atomic.LoadInt64(&a.connStats.hijacked)
+}
+
+// connContext returns the context for the requests received over the c. It
+// carries the `proxyConn` (if any) of the c.
+func (a *Air) connContext(ctx context.Context, c net.Conn) context.Context {
+	if pc, ok := underlyingConn(c).(*proxyConn); ok {
+		return context.WithValue(ctx, proxyConnContextKey{}, pc)
+	}
+
+	return ctx
+}
+
+// connState tracks the state of the c and calls the `ConnStateHook` of the a.
+func (a *Air) connState(c net.Conn, state http.ConnState) {
+	cs := a.connStats
+	if ps, ok := cs.states.Load(c); ok {
+		switch ps.(http.ConnState) {
+		case http.StateActive:
+			atomic.AddInt64(&cs.active, -1)
+		case http.StateIdle:
+			atomic.AddInt64(&cs.idle, -1)
+		}
+	}
+
+	switch state {
+	case http.StateActive:
+		atomic.AddInt64(&cs.active, 1)
+	case http.StateIdle:
+		atomic.AddInt64(&cs.idle, 1)
+	case http.StateHijacked:
+		atomic.AddInt64(&cs.hijacked, 1)
+	}
+
+	switch state {
+	case http.StateHijacked, http.StateClosed:
+		cs.states.Delete(c)
+	default:
+		cs.states.Store(c, state)
+	}
+
+	if a.ConnStateHook != nil {
+		a.ConnStateHook(c, state)
+	}
+}
+
+// Addresses returns all addresses that the server of the a actually listens on.
+// They are in the order of the `Address`, the HTTPS enforced address (if any),
+// the `ExtraAddresses` and then the `ExtraListeners`. The address of a Unix
+// domain socket is its path.
 func (a *Air) Addresses() []string {
 	asl := len(a.addressMap)
 	if asl == 0 {
@@ -1223,6 +2881,11 @@ func (a *Air) Addresses() []string {
 
 // ServeHTTP implements the `http.Handler`.
 func (a *Air) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	var startTime time.Time
+	if a.SlowRequestThreshold > 0 {
+		startTime = time.Now()
+	}
+
 	// Get the request and response from the pool.
 
 	req := a.requestPool.Get().(*Request)
@@ -1250,8 +2913,27 @@ func (a *Air) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 
 	// Execute the chain.
 
-	if err := h(req, res); err != nil {
-		if !res.Written && res.Status < http.StatusBadRequest {
+	var err error
+	if a.ExpectContinueHandler != nil && strings.EqualFold(
+		req.Header.Get("Expect"),
+		"100-continue",
+	) {
+		if err = a.ExpectContinueHandler(req, res); err != nil &&
+			res.Status < http.StatusBadRequest {
+			res.Status = http.StatusExpectationFailed
+		}
+	}
+
+	if err == nil {
+		err = h(req, res)
+	}
+
+	if err != nil {
+		if res.Written {
+			if a.OnPostWriteError != nil {
+				a.OnPostWriteError(err, req, res)
+			}
+		} else if res.Status < http.StatusBadRequest {
 			res.Status = http.StatusInternalServerError
 		}
 
@@ -1264,6 +2946,32 @@ func (a *Air) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		res.deferredFuncs[i]()
 	}
 
+	// Remove the temporary files of the multipart form.
+
+	req.CleanupMultipart()
+
+	// Notify the status observers.
+
+	a.notifyStatusObservers(req, res)
+
+	// Log the request if it is slow.
+
+	if a.SlowRequestThreshold > 0 {
+		if d := time.Since(startTime); d > a.SlowRequestThreshold {
+			p := req.RawPath()
+			if rt := req.Route(); rt != nil {
+				p = rt.Path
+			}
+
+			a.logErrorf(
+				"air: slow request: %s %s took %v",
+				req.Method,
+				p,
+				d,
+			)
+		}
+	}
+
 	// Put the route param values back to the pool.
 
 	if req.routeParamValues != nil {
@@ -1276,6 +2984,41 @@ func (a *Air) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	a.responsePool.Put(res)
 }
 
+// StripPrefixHandler returns an `http.Handler` that serves requests by removing
+// the prefix from the path of each request and then letting the a to serve
+// them. It is useful for mounting the a into a larger `http.Handler` (such as
+// the `http.ServeMux`) at the prefix.
+//
+// Requests whose path does not start with the prefix are replied with an HTTP
+// 404 not found error, just like the `http.StripPrefix` does.
+//
+// The `StripPrefixHandler` is the inverse of the `WrapHTTPHandler`.
+func (a *Air) StripPrefixHandler(prefix string) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.RequestURI, prefix) {
+			http.NotFound(rw, r)
+			return
+		}
+
+		ru := r.RequestURI[len(prefix):]
+		if ru == "" || ru[0] != '/' {
+			ru = fmt.Sprint("/", ru)
+		}
+
+		u, err := url.ParseRequestURI(ru)
+		if err != nil {
+			http.NotFound(rw, r)
+			return
+		}
+
+		r2 := r.WithContext(r.Context())
+		r2.URL = u
+		r2.RequestURI = ru
+
+		a.ServeHTTP(rw, r2)
+	})
+}
+
 // logErrorf logs the v as an error in the format.
 func (a *Air) logErrorf(format string, v ...interface{}) {
 	e := fmt.Errorf(format, v...)
@@ -1286,9 +3029,244 @@ func (a *Air) logErrorf(format string, v ...interface{}) {
 	}
 }
 
+// logStartupf writes the v as a startup message in the format to the
+// `StartupLogWriter` of the a.
+func (a *Air) logStartupf(format string, v ...interface{}) {
+	w := a.StartupLogWriter
+	if w == nil {
+		w = os.Stdout
+	}
+
+	fmt.Fprintf(w, format+"\n", v...)
+}
+
+// formatPanicStack formats the recovered value and the current stack with the
+// `PanicStackFormatter` of the a.
+func (a *Air) formatPanicStack(recovered interface{}) string {
+	psf := a.PanicStackFormatter
+	if psf == nil {
+		psf = DefaultPanicStackFormatter
+	}
+
+	return psf(recovered, debug.Stack())
+}
+
+// newDevTLSCertificate returns a new self-signed `tls.Certificate` for the
+// "localhost", "127.0.0.1" and "::1". It is used by the `Air.DevTLS`.
+func newDevTLSCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	sn, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	now := time.Now()
+	cert := &x509.Certificate{
+		SerialNumber: sn,
+		Subject: pkix.Name{
+			Organization: []string{"Air Development"},
+			CommonName:   "localhost",
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses: []net.IP{
+			net.IPv4(127, 0, 0, 1),
+			net.IPv6loopback,
+		},
+	}
+
+	der, err := x509.CreateCertificate(
+		rand.Reader,
+		cert,
+		cert,
+		&key.PublicKey,
+		key,
+	)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// isH2CUpgrade reports whether the r asks for the upgrade to the cleartext
+// HTTP/2.
+//
+// See RFC 7540, section 3.2.
+func isH2CUpgrade(r *http.Request) bool {
+	if r.ProtoMajor != 1 || r.Method == "PRI" {
+		return false
+	}
+
+	return httpguts.HeaderValuesContainsToken(r.Header["Upgrade"], "h2c") &&
+		httpguts.HeaderValuesContainsToken(
+			r.Header["Connection"],
+			"HTTP2-Settings",
+		)
+}
+
+// connStats is the connection statistics of the `Air.ConnectionStats`.
+type connStats struct {
+	// The int64 fields must be kept at the beginning of the struct to
+	// guarantee the 64-bit alignment required by the atomic operations.
+	active   int64
+	idle     int64
+	hijacked int64
+
+	states sync.Map
+}
+
+// statusObserver is a status observer added via the `Air.AddStatusObserver`.
+type statusObserver struct {
+	min int
+	max int
+	f   func(*Request, *Response)
+}
+
+// ETagStrategy is a strategy for generating the ETags of the files.
+type ETagStrategy string
+
+// The ETag strategies.
+const (
+	StrongContentHash ETagStrategy = "strong_content_hash"
+	WeakSizeModTime   ETagStrategy = "weak_size_mod_time"
+)
+
+// FormBindStyle is a style of the request param names used by the
+// `Request.Bind`.
+type FormBindStyle string
+
+// The form bind styles.
+const (
+	FlatFormBindStyle    FormBindStyle = "flat"
+	BracketFormBindStyle FormBindStyle = "bracket"
+)
+
 // Handler defines a function to serve requests.
 type Handler func(*Request, *Response) error
 
+// ExtraListener is an extra listener of the server of the `Air`.
+type ExtraListener struct {
+	// Address is the TCP address that the listener listens on.
+	Address string `mapstructure:"address"`
+
+	// TLSConfig is the TLS configuration of the listener.
+	//
+	// If the `TLSConfig` is nil and the `ACMEEnabled` is false, the
+	// listener serves plain HTTP.
+	TLSConfig *tls.Config `mapstructure:"-"`
+
+	// ACMEEnabled indicates whether the listener obtains its certificates
+	// via the ACME. It uses the same ACME-related fields of the `Air` (such
+	// as the `Air.ACMECertRoot`), and the certificates returned by the
+	// `TLSConfig` take precedence.
+	//
+	// Unless the `Air.ACMEEnabled` is also true, the HTTP-01 challenges are
+	// not answered, so only the TLS-ALPN-01 challenges can be used.
+	ACMEEnabled bool `mapstructure:"acme_enabled"`
+}
+
+// Route is a route registered in the router.
+type Route struct {
+	// Method is the method of the route.
+	Method string
+
+	// Path is the path of the route.
+	//
+	// The `Path` may consist of STATIC, PARAM and ANY components. It will
+	// be cleaned when the route is registered.
+	Path string
+
+	// Handler is the `Handler` that serves the requests that match the
+	// route.
+	Handler Handler
+
+	// Gases is the route-level gases.
+	//
+	// The `Gases` is always FILO.
+	Gases []Gas
+
+	// Name is the name of the route.
+	//
+	// The `Name` is optional, but it must be unique if it is not empty.
+	Name string
+
+	// Priority is the priority of the route. It is used to disambiguate the
+	// overlapping routes.
+	//
+	// By default, the router tries the children of each path node in the
+	// order of STATIC > PARAM > ANY. The priority of a path node is the
+	// highest priority of all routes registered under it (the default is
+	// zero). When a path node has more than one kind of children that could
+	// match the rest of the request path, the child with the strictly
+	// highest priority is tried first, and ties are broken by the default
+	// order. If a PARAM child is preferred over a STATIC child but fails to
+	// match the rest of the request path, the STATIC child is tried next.
+	// An ANY child always matches, so no other child is tried once an ANY
+	// child is preferred.
+	//
+	// Since the routes of different methods share the same path nodes, the
+	// `Priority` affects all methods registered for the same path. It never
+	// makes a route match a request path it does not match by default.
+	//
+	// The `Priority` can only be set via the `Air.RegisterRoutes`.
+	Priority int
+
+	// Metadata is the metadata of the route.
+	//
+	// The `Metadata` is never used by the router, which means it can be
+	// used to attach anything to the route, such as the authorization
+	// requirements.
+	Metadata map[string]interface{}
+
+	// OpenAPI is the OpenAPI metadata of the route.
+	//
+	// The `OpenAPI` is only used by the `Air.EnableOpenAPI`.
+	OpenAPI *OpenAPIOperation
+
+	servesFiles      bool
+	paramConstraints map[string]*regexp.Regexp
+}
+
+// RouteInfo is the information of a route registered in the router. See the
+// `Air.Routes`.
+type RouteInfo struct {
+	// Method is the method of the route.
+	Method string
+
+	// Path is the cleaned path of the route.
+	Path string
+
+	// ParamNames is the names of the route params in the order they appear
+	// in the `Path`. The name of the ANY component is "*".
+	ParamNames []string
+
+	// Name is the name of the route.
+	Name string
+
+	// ServesFiles indicates whether the route serves files, which means it
+	// is registered by the `Air.FILE`, `Air.FILES`, `Air.FILESFromCoffer`
+	// or `Air.ASSETS`.
+	ServesFiles bool
+}
+
 // WrapHTTPHandler provides a convenient way to wrap an `http.Handler` into a
 // `Handler`.
 func WrapHTTPHandler(hh http.Handler) Handler {
@@ -1305,8 +3283,13 @@ func DefaultNotFoundHandler(req *Request, res *Response) error {
 }
 
 // DefaultMethodNotAllowedHandler is the default `Handler` that returns method
-// not allowed error.
+// not allowed error. It also sets the Allow header from the
+// `Request.AllowedMethods`.
 func DefaultMethodNotAllowedHandler(req *Request, res *Response) error {
+	if ms := req.AllowedMethods(); len(ms) > 0 {
+		res.Header.Set("Allow", strings.Join(ms, ", "))
+	}
+
 	res.Status = http.StatusMethodNotAllowed
 	return errors.New(http.StatusText(res.Status))
 }
@@ -1317,11 +3300,92 @@ func DefaultErrorHandler(err error, req *Request, res *Response) {
 		return
 	}
 
+	if req.Method == http.MethodHead {
+		// There is no body to describe the error, so commit a clean
+		// response with no content.
+		res.Header.Set("Content-Length", "0")
+		res.Write(nil)
+		return
+	}
+
+	// The "Content-Type" header may have been set for the content that was
+	// never written, so it must not describe the error.
+	res.Header.Del("Content-Type")
+
+	m := err.Error()
 	if !req.Air.DebugMode && res.Status == http.StatusInternalServerError {
-		res.WriteString(http.StatusText(res.Status))
-	} else {
-		res.WriteString(err.Error())
+		m = http.StatusText(res.Status)
+	}
+
+	if t, ok := req.Air.ErrorPages[res.Status]; ok && strings.Contains(
+		strings.ToLower(req.Header.Get("Accept")),
+		"text/html",
+	) {
+		if res.Render(map[string]interface{}{
+			"Status":     res.Status,
+			"StatusText": http.StatusText(res.Status),
+			"Message":    m,
+		}, t) == nil {
+			return
+		}
+	}
+
+	if req.Air.ErrorEnvelope != nil &&
+		acceptsJSON(req.Header.Get("Accept")) {
+		if res.WriteJSON(req.Air.ErrorEnvelope(
+			res.Status,
+			m,
+			err,
+			req.Air.DebugMode,
+		)) == nil || res.Written {
+			return
+		}
+	}
+
+	res.WriteString(m)
+}
+
+// DefaultErrorEnvelope is the default value that can be used as the
+// `Air.ErrorEnvelope`. It produces an envelope like
+// `{"message": "Not Found", "status": 404}`.
+func DefaultErrorEnvelope(
+	status int,
+	message string,
+	internal error,
+	debug bool,
+) interface{} {
+	return map[string]interface{}{
+		"message": message,
+		"status":  status,
+	}
+}
+
+// acceptsJSON reports whether the accept, which is the value of an Accept
+// header, accepts the "application/json" or any "+json" media type.
+func acceptsJSON(accept string) bool {
+	for _, mr := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(mr)
+		if err != nil {
+			continue
+		}
+
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil &&
+			q <= 0 {
+			continue
+		}
+
+		if mt == "application/json" || strings.HasSuffix(mt, "+json") {
+			return true
+		}
 	}
+
+	return false
+}
+
+// DefaultPanicStackFormatter is the default panic stack formatter. It returns
+// the recovered value followed by the stack in plain text.
+func DefaultPanicStackFormatter(recovered interface{}, stack []byte) string {
+	return fmt.Sprintf("%v\n%s", recovered, stack)
 }
 
 // Gas defines a function to process gases.
@@ -1379,3 +3443,35 @@ func stringSliceContains(ss []string, s string, caseInsensitive bool) bool {
 
 	return false
 }
+
+// splitAssetDigest splits the hex-encoded digest embedded by the `Air.AssetURL`
+// from the p. It returns the p itself and an empty digest if there is no digest
+// in the p.
+//
+// E.g.: "/js/app.0123456789abcdef.js" -> "/js/app.js", "0123456789abcdef"
+func splitAssetDigest(p string) (string, string) {
+	ext := path.Ext(p)
+	stem := p[:len(p)-len(ext)]
+	if isAssetDigest(ext) {
+		return stem, ext[1:]
+	}
+
+	i := strings.LastIndexByte(stem, '.')
+	if i < 0 || !isAssetDigest(stem[i:]) {
+		return p, ""
+	}
+
+	return fmt.Sprint(stem[:i], ext), stem[i+1:]
+}
+
+// isAssetDigest reports whether the s is a "." followed by a hex-encoded digest
+// embedded by the `Air.AssetURL`.
+func isAssetDigest(s string) bool {
+	if len(s) != 17 || s[0] != '.' {
+		return false
+	}
+
+	_, err := hex.DecodeString(s[1:])
+
+	return err == nil
+}
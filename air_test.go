@@ -2,24 +2,33 @@ package air
 
 import (
 	"bytes"
+	"compress/flate"
 	"compress/gzip"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/andybalholm/brotli"
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/http2"
 )
 
 const easterEgg = `
@@ -33,7 +42,11 @@ func TestNew(t *testing.T) {
 	assert.Equal(t, "air", a.AppName)
 	assert.Empty(t, a.MaintainerEmail)
 	assert.False(t, a.DebugMode)
+	assert.False(t, a.TestMode)
 	assert.Equal(t, "localhost:8080", a.Address)
+	assert.Zero(t, a.PortRange)
+	assert.Nil(t, a.ExtraAddresses)
+	assert.Nil(t, a.ExtraListeners)
 	assert.Zero(t, a.ReadTimeout)
 	assert.Zero(t, a.ReadHeaderTimeout)
 	assert.Zero(t, a.WriteTimeout)
@@ -41,6 +54,12 @@ func TestNew(t *testing.T) {
 	assert.Equal(t, 1048576, a.MaxHeaderBytes)
 	assert.Empty(t, a.TLSCertFile)
 	assert.Empty(t, a.TLSKeyFile)
+	assert.Zero(t, a.TLSMinVersion)
+	assert.Nil(t, a.TLSCipherSuites)
+	assert.Empty(t, a.TLSClientCAFile)
+	assert.Equal(t, tls.NoClientCert, a.TLSClientAuth)
+	assert.False(t, a.DevTLS)
+	assert.Nil(t, a.TLSNextProtos)
 	assert.False(t, a.ACMEEnabled)
 	assert.Equal(
 		t,
@@ -50,13 +69,20 @@ func TestNew(t *testing.T) {
 	assert.Nil(t, a.ACMETOSURLWhitelist)
 	assert.Nil(t, a.ACMEAccountKey)
 	assert.Equal(t, "acme-certs", a.ACMECertRoot)
+	assert.Nil(t, a.ACMECache)
 	assert.Nil(t, a.ACMEHostWhitelist)
 	assert.Equal(t, 30*24*time.Hour, a.ACMERenewalWindow)
 	assert.Nil(t, a.ACMEExtraExts)
 	assert.False(t, a.HTTPSEnforced)
+	assert.False(t, a.OCSPStaplingEnabled)
 	assert.Equal(t, "0", a.HTTPSEnforcedPort)
+	assert.True(t, a.H2CUpgrade)
 	assert.Zero(t, a.WebSocketHandshakeTimeout)
 	assert.Nil(t, a.WebSocketSubprotocols)
+	assert.False(t, a.WebSocketCompressionEnabled)
+	assert.Equal(t, flate.BestSpeed, a.WebSocketCompressionLevel)
+	assert.Zero(t, a.WebSocketShutdownTimeout)
+	assert.Equal(t, 15*time.Second, a.EventStreamKeepAliveInterval)
 	assert.False(t, a.PROXYEnabled)
 	assert.Zero(t, a.PROXYReadHeaderTimeout)
 	assert.Nil(t, a.PROXYRelayerIPWhitelist)
@@ -68,8 +94,24 @@ func TestNew(t *testing.T) {
 		DefaultMethodNotAllowedHandler,
 		a.MethodNotAllowedHandler,
 	)
+	assert.False(t, a.AutoOptionsForCORS)
+	assert.Nil(t, a.ExpectContinueHandler)
+	assert.Nil(t, a.BeforeWriteHeader)
 	assert.IsType(t, DefaultErrorHandler, a.ErrorHandler)
+	assert.Nil(t, a.OnPostWriteError)
+	assert.IsType(t, DefaultPanicStackFormatter, a.PanicStackFormatter)
+	assert.Nil(t, a.ErrorPages)
+	assert.NotNil(t, a.ErrorEnvelope)
 	assert.Nil(t, a.ErrorLogger)
+	assert.Nil(t, a.StartupLogWriter)
+	assert.Nil(t, a.OnAcceptError)
+	assert.Nil(t, a.ConnStateHook)
+	assert.Zero(t, a.SlowRequestThreshold)
+	assert.Equal(t, "utf-8", a.DefaultCharset)
+	assert.Nil(t, a.DefaultResponseHeaders)
+	assert.False(t, a.CanonicalizeResponseHeaders)
+	assert.Equal(t, FlatFormBindStyle, a.FormBindStyle)
+	assert.Nil(t, a.Validator)
 	assert.False(t, a.MinifierEnabled)
 	assert.ElementsMatch(t, a.MinifierMIMETypes, []string{
 		"text/html",
@@ -84,6 +126,7 @@ func TestNew(t *testing.T) {
 		"text/plain",
 		"text/html",
 		"text/css",
+		"text/csv",
 		"application/javascript",
 		"application/json",
 		"application/xml",
@@ -93,12 +136,31 @@ func TestNew(t *testing.T) {
 	})
 	assert.Equal(t, gzip.DefaultCompression, a.GzipCompressionLevel)
 	assert.Equal(t, int64(1024), a.GzipMinContentLength)
+	assert.False(t, a.BrotliEnabled)
+	assert.ElementsMatch(t, a.BrotliMIMETypes, []string{
+		"text/plain",
+		"text/html",
+		"text/css",
+		"text/csv",
+		"application/javascript",
+		"application/json",
+		"application/xml",
+		"application/toml",
+		"application/yaml",
+		"image/svg+xml",
+	})
+	assert.Equal(t, brotli.DefaultCompression, a.BrotliCompressionLevel)
+	assert.Equal(t, int64(1024), a.BrotliMinContentLength)
+	assert.Equal(t, StrongContentHash, a.ETagStrategy)
+	assert.Zero(t, a.ETagHashMaxFileSize)
 	assert.Equal(t, "templates", a.RendererTemplateRoot)
 	assert.ElementsMatch(t, a.RendererTemplateExts, []string{".html"})
 	assert.Equal(t, "{{", a.RendererTemplateLeftDelim)
 	assert.Equal(t, "}}", a.RendererTemplateRightDelim)
 	assert.Nil(t, a.RendererTemplateFuncMap)
+	assert.False(t, a.RendererBuiltinFuncs)
 	assert.False(t, a.CofferEnabled)
+	assert.True(t, a.CofferWatchEnabled)
 	assert.Equal(t, 33554432, a.CofferMaxMemoryBytes)
 	assert.Equal(t, "assets", a.CofferAssetRoot)
 	assert.ElementsMatch(t, a.CofferAssetExts, []string{
@@ -119,6 +181,14 @@ func TestNew(t *testing.T) {
 	assert.False(t, a.I18nEnabled)
 	assert.Equal(t, "locales", a.I18nLocaleRoot)
 	assert.Equal(t, "en-US", a.I18nLocaleBase)
+	assert.Equal(t, 512, a.ContentTypeSnifferBufferSize)
+	assert.Nil(t, a.ContentTypeSnifferBufferPool)
+	assert.Nil(t, a.GzipWriterPool)
+	assert.Equal(t, 33554432, a.ReverseProxyBufferSize)
+	assert.Equal(t, 200, a.ReverseProxyMaxIdleConnsPerHost)
+	assert.Equal(t, 90*time.Second, a.ReverseProxyIdleConnTimeout)
+	assert.Zero(t, a.ReverseProxyMaxConnsPerHost)
+	assert.Nil(t, a.ReverseProxyBufferPool)
 	assert.Empty(t, a.ConfigFile)
 
 	assert.NotNil(t, a.server)
@@ -134,6 +204,7 @@ func TestNew(t *testing.T) {
 	assert.NotNil(t, a.addressMap)
 	assert.Nil(t, a.shutdownJobs)
 	assert.Zero(t, cap(a.shutdownJobDone))
+	assert.NotNil(t, a.webSockets)
 	assert.IsType(t, &Request{}, a.requestPool.Get())
 	assert.IsType(t, &Response{}, a.responsePool.Get())
 
@@ -482,6 +553,19 @@ func TestAirFILE(t *testing.T) {
 	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
 
 	assert.Equal(t, http.StatusNotFound, hrwr.StatusCode)
+	assert.Equal(t, "0", hrwr.Header.Get("Content-Length"))
+	assert.Len(t, hrwrb, 0)
+
+	hr = httptest.NewRequest(http.MethodHead, "/nowhere", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusNotFound, hrwr.StatusCode)
+	assert.Equal(t, "0", hrwr.Header.Get("Content-Length"))
 	assert.Len(t, hrwrb, 0)
 }
 
@@ -588,137 +672,726 @@ func TestAirFILES(t *testing.T) {
 	assert.Len(t, hrwrb, 0)
 }
 
-func TestAirGroup(t *testing.T) {
-	a := New()
+func TestAirFILESFromCoffer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "air.TestAirFILESFromCoffer")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, dir)
+	defer os.RemoveAll(dir)
 
-	g := a.Group("/foobar")
-	assert.NotNil(t, g)
-	assert.Equal(t, a, g.Air)
-	assert.Equal(t, "/foobar", g.Prefix)
-	assert.Nil(t, g.Gases)
-}
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "static"), 0755))
+	assert.NoError(t, ioutil.WriteFile(
+		filepath.Join(dir, "static", "foo.css"),
+		[]byte("Foobar"),
+		0644,
+	))
+	assert.NoError(t, ioutil.WriteFile(
+		filepath.Join(dir, "bar.css"),
+		[]byte("Barfoo"),
+		0644,
+	))
 
-func TestAirServe(t *testing.T) {
 	a := New()
-	a.Address = "localhost:0"
+	a.CofferEnabled = true
+	a.CofferAssetRoot = dir
+	a.FILESFromCoffer("/assets", "static")
 
-	hijackOSStdout()
+	hr := httptest.NewRequest(http.MethodGet, "/assets/foo.css", nil)
+	hrw := httptest.NewRecorder()
 
-	go a.Serve()
-	time.Sleep(100 * time.Millisecond)
+	a.ServeHTTP(hrw, hr)
 
-	revertOSStdout()
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
 
-	assert.NoError(t, a.Close())
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "text/css; charset=utf-8", hrwr.Header.Get("Content-Type"))
+	assert.NotEmpty(t, hrwr.Header.Get("ETag"))
+	assert.Equal(t, "Foobar", string(hrwrb))
 
-	a = New()
-	a.Address = "-1:0"
+	ai, ok := a.coffer.assets.Load(filepath.Join(dir, "static", "foo.css"))
+	assert.True(t, ok)
+	assert.NotNil(t, ai)
 
-	assert.Error(t, a.Serve())
+	hr = httptest.NewRequest(http.MethodHead, "/assets/foo.css", nil)
+	hrw = httptest.NewRecorder()
 
-	a = New()
-	a.Address = ""
+	a.ServeHTTP(hrw, hr)
 
-	assert.Error(t, a.Serve())
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
 
-	a = New()
-	a.Address = ":-1"
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Len(t, hrwrb, 0)
 
-	assert.Error(t, a.Serve())
+	hr = httptest.NewRequest(http.MethodGet, "/assets/../bar.css", nil)
+	hr.URL.Path = "/assets/../bar.css"
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+
+	assert.Equal(t, http.StatusNotFound, hrwr.StatusCode)
+
+	hr = httptest.NewRequest(http.MethodGet, "/assets/nowhere.css", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusNotFound, hrwr.StatusCode)
+	assert.Equal(t, http.StatusText(hrwr.StatusCode), string(hrwrb))
 
 	a = New()
-	a.Address = ""
+	a.CofferAssetRoot = dir
+	a.FILESFromCoffer("/", "/")
 
-	assert.Error(t, a.Serve())
+	hr = httptest.NewRequest(http.MethodGet, "/bar.css", nil)
+	hrw = httptest.NewRecorder()
 
-	dir, err := ioutil.TempDir("", "air.TestAirServe")
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "Barfoo", string(hrwrb))
+}
+
+func TestAirASSETS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "air.TestAirASSETS")
 	assert.NoError(t, err)
 	assert.NotEmpty(t, dir)
 	defer os.RemoveAll(dir)
 
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "js"), 0755))
+	assert.NoError(t, ioutil.WriteFile(
+		filepath.Join(dir, "js", "app.js"),
+		[]byte("Foobar"),
+		0644,
+	))
+	assert.NoError(t, ioutil.WriteFile(
+		filepath.Join(dir, "layout.html"),
+		[]byte(`<script src="{{asset "js/app.js"}}"></script>`),
+		0644,
+	))
+
+	a := New()
+	a.CofferEnabled = true
+	a.CofferAssetRoot = dir
+	a.RendererTemplateRoot = dir
+	a.RendererBuiltinFuncs = true
+	a.ASSETS("/assets/")
+
+	au := a.AssetURL("js/app.js")
+	assert.Regexp(t, `^/assets/js/app\.[0-9a-f]{16}\.js$`, au)
+	assert.Equal(t, au, a.AssetURL("/js/../js/app.js"))
+	assert.Equal(t, "/assets/js/nowhere.js", a.AssetURL("js/nowhere.js"))
+
+	hr := httptest.NewRequest(http.MethodGet, au, nil)
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(
+		t,
+		"public, max-age=31536000, immutable",
+		hrwr.Header.Get("Cache-Control"),
+	)
+	assert.Equal(t, "Foobar", string(hrwrb))
+
+	for _, p := range []string{
+		"/assets/js/app.js",
+		"/assets/js/app.0123456789abcdef.js",
+	} {
+		hr = httptest.NewRequest(http.MethodGet, p, nil)
+		hrw = httptest.NewRecorder()
+
+		a.ServeHTTP(hrw, hr)
+
+		hrwr = hrw.Result()
+		hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+		assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+		assert.Empty(t, hrwr.Header.Get("Cache-Control"))
+		assert.Equal(t, "Foobar", string(hrwrb))
+	}
+
+	hr = httptest.NewRequest(http.MethodGet, "/assets/js/nowhere.js", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusNotFound, hrw.Code)
+
+	_, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.NoError(t, res.Render(nil, "layout.html"))
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, `<script src="`+au+`"></script>`, string(hrwrb))
+
 	a = New()
-	a.DebugMode = true
-	a.Address = "localhost:0"
+	a.CofferAssetRoot = dir
+	a.ASSETS("/static")
 
-	stdout, err := ioutil.TempFile(dir, "")
+	assert.Equal(t, "/static/js/app.js", a.AssetURL("js/app.js"))
+}
+
+func TestAirFavicon(t *testing.T) {
+	a := New()
+
+	f, err := ioutil.TempFile("", "air.TestAirFavicon.*.ico")
 	assert.NoError(t, err)
+	assert.NotNil(t, f)
+	defer os.Remove(f.Name())
 
-	stdoutBackup := os.Stdout
-	os.Stdout = stdout
+	_, err = f.Write([]byte("Foobar"))
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
 
-	go a.Serve()
-	time.Sleep(100 * time.Millisecond)
+	a.Favicon(f.Name())
 
-	os.Stdout = stdoutBackup
+	hr := httptest.NewRequest(http.MethodGet, "/favicon.ico", nil)
+	hrw := httptest.NewRecorder()
 
-	assert.NoError(t, stdout.Close())
+	a.ServeHTTP(hrw, hr)
 
-	b, err := ioutil.ReadFile(stdout.Name())
-	assert.NoError(t, err)
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
 	assert.Equal(
 		t,
-		fmt.Sprintf(
-			"air: listening on %v\nair: serving in debug mode\n",
-			a.Addresses(),
-		),
-		string(b),
+		"public, max-age=2592000",
+		hrwr.Header.Get("Cache-Control"),
 	)
+	assert.Equal(t, "Foobar", string(hrwrb))
 
-	assert.NoError(t, a.Close())
+	hr = httptest.NewRequest(http.MethodHead, "/favicon.ico", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Empty(t, hrwrb)
+}
+
+func TestAirRobots(t *testing.T) {
+	a := New()
+
+	a.Robots("User-agent: *\nDisallow: /admin/\n", func(
+		next Handler,
+	) Handler {
+		return func(req *Request, res *Response) error {
+			res.Header.Set("Cache-Control", "no-cache")
+			return next(req, res)
+		}
+	})
+
+	hr := httptest.NewRequest(http.MethodGet, "/robots.txt", nil)
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(
+		t,
+		"text/plain; charset=utf-8",
+		hrwr.Header.Get("Content-Type"),
+	)
+	assert.Equal(t, "no-cache", hrwr.Header.Get("Cache-Control"))
+	assert.NotEmpty(t, hrwr.Header.Get("ETag"))
+	assert.Equal(t, "User-agent: *\nDisallow: /admin/\n", string(hrwrb))
 
 	a = New()
-	a.Address = "localhost:0"
 
-	hijackOSStdout()
+	a.Robots("User-agent: *\n")
 
-	go a.Serve()
-	time.Sleep(100 * time.Millisecond)
+	hr = httptest.NewRequest(http.MethodHead, "/robots.txt", nil)
+	hrw = httptest.NewRecorder()
 
-	revertOSStdout()
+	a.ServeHTTP(hrw, hr)
 
-	res, err := http.DefaultClient.Do(&http.Request{
-		Method: http.MethodGet,
-		URL: &url.URL{
-			Scheme: "http",
-			Host:   a.Addresses()[0],
-		},
-		Host: "localhost",
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(
+		t,
+		"public, max-age=86400",
+		hrwr.Header.Get("Cache-Control"),
+	)
+	assert.Empty(t, hrwrb)
+}
+
+func TestAirWellKnown(t *testing.T) {
+	a := New()
+
+	assert.Panics(t, func() {
+		a.WellKnown("", nil)
+	})
+	assert.Panics(t, func() {
+		a.WellKnown("/", nil)
 	})
-	assert.NoError(t, err)
-	assert.NotNil(t, res)
 
-	res, err = http.DefaultClient.Do(&http.Request{
-		Method: http.MethodGet,
-		URL: &url.URL{
-			Scheme: "http",
-			Host:   a.Addresses()[0],
-		},
-		Host: "example.com",
+	a.ACMEEnabled = true
+
+	assert.Panics(t, func() {
+		a.WellKnown("acme-challenge", nil)
+	})
+	assert.Panics(t, func() {
+		a.WellKnown("acme-challenge/:Token", nil)
 	})
-	assert.NoError(t, err)
-	assert.NotNil(t, res)
 
-	assert.NoError(t, a.Close())
+	a.ACMEEnabled = false
 
-	a = New()
-	a.Address = "localhost:0"
+	a.WellKnown("acme-challenge/:Token", func(
+		req *Request,
+		res *Response,
+	) error {
+		return res.WriteString(req.Param("Token").Value().String())
+	})
 
-	assert.NoError(t, ioutil.WriteFile(
-		filepath.Join(dir, "tls_cert.pem"),
-		nil,
-		os.ModePerm,
-	))
+	a.WellKnown("webfinger", func(req *Request, res *Response) error {
+		return res.WriteJSON(map[string]interface{}{
+			"subject": req.Param("resource").Value().String(),
+		})
+	})
+	a.WellKnown("/matrix/server", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	})
 
-	assert.NoError(t, ioutil.WriteFile(
-		filepath.Join(dir, "tls_key.pem"),
+	hr := httptest.NewRequest(
+		http.MethodGet,
+		"/.well-known/webfinger?resource=acct:foo@example.com",
 		nil,
-		os.ModePerm,
-	))
+	)
+	hrw := httptest.NewRecorder()
 
-	a.TLSCertFile = filepath.Join(dir, "tls_cert.pem")
-	a.TLSKeyFile = filepath.Join(dir, "tls_key.pem")
+	a.ServeHTTP(hrw, hr)
 
-	assert.Error(t, a.Serve())
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, `{"subject":"acct:foo@example.com"}`, string(hrwrb))
+
+	hr = httptest.NewRequest(http.MethodHead, "/.well-known/matrix/server", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Empty(t, hrwrb)
+
+	hr = httptest.NewRequest(http.MethodPost, "/.well-known/matrix/server", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, hrw.Code)
+
+	hr = httptest.NewRequest(
+		http.MethodGet,
+		"/.well-known/acme-challenge/foobar",
+		nil,
+	)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+	assert.Equal(t, "foobar", hrw.Body.String())
+}
+
+func TestAirRegisterRoutes(t *testing.T) {
+	a := New()
+
+	a.RegisterRoutes([]Route{
+		{
+			Method: http.MethodGet,
+			Path:   "/foo",
+			Handler: func(req *Request, res *Response) error {
+				return res.WriteString("Matched [GET /foo]")
+			},
+			Name: "foo",
+			Metadata: map[string]interface{}{
+				"Role": "admin",
+			},
+		},
+		{
+			Method: http.MethodPost,
+			Path:   "/foo//:Bar",
+			Handler: func(req *Request, res *Response) error {
+				return res.WriteString(fmt.Sprint(
+					"Matched [POST /foo/:Bar] - ",
+					req.Route().Name,
+				))
+			},
+			Gases: []Gas{func(next Handler) Handler {
+				return func(req *Request, res *Response) error {
+					res.Header.Set("Foo", "bar")
+					return next(req, res)
+				}
+			}},
+			Name: "bar",
+		},
+	})
+
+	assert.Len(t, a.router.routes, 2)
+	assert.Len(t, a.router.namedRoutes, 2)
+	assert.Equal(t, "/foo/:Bar", a.router.namedRoutes["bar"].Path)
+
+	hr := httptest.NewRequest(http.MethodGet, "/foo", nil)
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "Matched [GET /foo]", string(hrwrb))
+
+	hr = httptest.NewRequest(http.MethodPost, "/foo/bar", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "bar", hrwr.Header.Get("Foo"))
+	assert.Equal(t, "Matched [POST /foo/:Bar] - bar", string(hrwrb))
+
+	assert.PanicsWithValue(
+		t,
+		"air: unsupported route method: FOOBAR",
+		func() {
+			a.RegisterRoutes([]Route{{
+				Method: "FOOBAR",
+				Path:   "/foobar",
+				Handler: func(req *Request, res *Response) error {
+					return nil
+				},
+			}})
+		},
+	)
+
+	assert.PanicsWithValue(t, "air: route name already exists", func() {
+		a.RegisterRoutes([]Route{{
+			Method: http.MethodGet,
+			Path:   "/foobar",
+			Handler: func(req *Request, res *Response) error {
+				return nil
+			},
+			Name: "foo",
+		}})
+	})
+}
+
+func TestAirAddNamed(t *testing.T) {
+	a := New()
+
+	a.AddNamed(
+		"user",
+		http.MethodGet,
+		"/users/:id",
+		func(req *Request, res *Response) error {
+			return res.WriteString("Matched [GET /users/:id]")
+		},
+	)
+
+	req, res, hrw := fakeRRCycle(a, http.MethodGet, "/users/1", nil)
+
+	assert.NoError(t, a.router.route(req)(req, res))
+	assert.Equal(t, "Matched [GET /users/:id]", hrw.Body.String())
+	assert.Equal(t, "user", req.Route().Name)
+
+	h := func(*Request, *Response) error {
+		return nil
+	}
+
+	assert.PanicsWithValue(t, "air: route name cannot be empty", func() {
+		a.AddNamed("", http.MethodGet, "/", h)
+	})
+
+	assert.PanicsWithValue(t, "air: route name already exists", func() {
+		a.AddNamed("user", http.MethodGet, "/", h)
+	})
+
+	assert.Panics(t, func() {
+		a.AddNamed("foo", "FOO", "/", h)
+	})
+}
+
+func TestAirURL(t *testing.T) {
+	a := New()
+
+	h := func(*Request, *Response) error {
+		return nil
+	}
+
+	a.AddNamed("index", http.MethodGet, "/", h)
+	a.AddNamed("post", http.MethodGet, "/users/:UserID/posts/:PostID", h)
+	a.AddNamed("asset", http.MethodGet, "/users/:UserID/assets/*", h)
+
+	u, err := a.URL("index", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "/", u)
+
+	u, err = a.URL("post", map[string]interface{}{
+		"UserID": 1,
+		"PostID": "foo bar/baz",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "/users/1/posts/foo%20bar%2Fbaz", u)
+
+	u, err = a.URL("asset", map[string]interface{}{
+		"UserID": 1,
+		"*":      "foo bar/baz.png",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "/users/1/assets/foo%20bar/baz.png", u)
+
+	u, err = a.URL("asset", map[string]interface{}{
+		"UserID": 1,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "/users/1/assets/", u)
+
+	u, err = a.URL("post", map[string]interface{}{
+		"UserID": 1,
+	})
+	assert.EqualError(t, err, "air: missing route param: PostID")
+	assert.Empty(t, u)
+
+	u, err = a.URL("post", map[string]interface{}{
+		"UserID": 1,
+		"PostID": "",
+	})
+	assert.EqualError(t, err, "air: empty route param: PostID")
+	assert.Empty(t, u)
+
+	a.AddNamed("comment", http.MethodGet, "/comments/:CommentID|[0-9]+", h)
+
+	u, err = a.URL("comment", map[string]interface{}{
+		"CommentID": 1,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "/comments/1", u)
+
+	u, err = a.URL("comment", map[string]interface{}{
+		"CommentID": "foo",
+	})
+	assert.EqualError(
+		t,
+		err,
+		"air: route param CommentID does not match its constraint: foo",
+	)
+	assert.Empty(t, u)
+
+	u, err = a.URL("foobar", nil)
+	assert.EqualError(t, err, "air: route not found: foobar")
+	assert.Empty(t, u)
+}
+
+func TestAirRoutes(t *testing.T) {
+	a := New()
+
+	assert.Empty(t, a.Routes())
+
+	h := func(*Request, *Response) error {
+		return nil
+	}
+
+	a.POST("/users/:UserID/posts/:PostID", h)
+	a.GET("/users/:UserID/posts/:PostID/", h)
+	a.AddNamed("index", http.MethodGet, "//", h)
+	a.FILES("/assets", "assets")
+
+	assert.Equal(t, []RouteInfo{
+		{
+			Method:     http.MethodGet,
+			Path:       "/",
+			ParamNames: []string{},
+			Name:       "index",
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/assets/*",
+			ParamNames:  []string{"*"},
+			ServesFiles: true,
+		},
+		{
+			Method:      http.MethodHead,
+			Path:        "/assets/*",
+			ParamNames:  []string{"*"},
+			ServesFiles: true,
+		},
+		{
+			Method:     http.MethodPost,
+			Path:       "/users/:UserID/posts/:PostID",
+			ParamNames: []string{"UserID", "PostID"},
+		},
+		{
+			Method:     http.MethodGet,
+			Path:       "/users/:UserID/posts/:PostID/",
+			ParamNames: []string{"UserID", "PostID"},
+		},
+	}, a.Routes())
+}
+
+func TestAirGroup(t *testing.T) {
+	a := New()
+
+	g := a.Group("/foobar")
+	assert.NotNil(t, g)
+	assert.Equal(t, a, g.Air)
+	assert.Equal(t, "/foobar", g.Prefix)
+	assert.Nil(t, g.Gases)
+}
+
+func TestAirServe(t *testing.T) {
+	a := New()
+	a.Address = "localhost:0"
+
+	hijackOSStdout()
+
+	go a.Serve()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	assert.NoError(t, a.Close())
+
+	a = New()
+	a.Address = "-1:0"
+
+	assert.Error(t, a.Serve())
+
+	a = New()
+	a.Address = ""
+
+	assert.Error(t, a.Serve())
+
+	a = New()
+	a.Address = ":-1"
+
+	assert.Error(t, a.Serve())
+
+	a = New()
+	a.Address = ""
+
+	assert.Error(t, a.Serve())
+
+	dir, err := ioutil.TempDir("", "air.TestAirServe")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, dir)
+	defer os.RemoveAll(dir)
+
+	a = New()
+	a.DebugMode = true
+	a.Address = "localhost:0"
+
+	stdout, err := ioutil.TempFile(dir, "")
+	assert.NoError(t, err)
+
+	stdoutBackup := os.Stdout
+	os.Stdout = stdout
+
+	go a.Serve()
+	time.Sleep(100 * time.Millisecond)
+
+	os.Stdout = stdoutBackup
+
+	assert.NoError(t, stdout.Close())
+
+	b, err := ioutil.ReadFile(stdout.Name())
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		fmt.Sprintf(
+			"air: listening on %v\nair: serving in debug mode\n",
+			a.Addresses(),
+		),
+		string(b),
+	)
+
+	assert.NoError(t, a.Close())
+
+	a = New()
+	a.Address = "localhost:0"
+
+	hijackOSStdout()
+
+	go a.Serve()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	res, err := http.DefaultClient.Do(&http.Request{
+		Method: http.MethodGet,
+		URL: &url.URL{
+			Scheme: "http",
+			Host:   a.Addresses()[0],
+		},
+		Host: "localhost",
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, res)
+
+	res, err = http.DefaultClient.Do(&http.Request{
+		Method: http.MethodGet,
+		URL: &url.URL{
+			Scheme: "http",
+			Host:   a.Addresses()[0],
+		},
+		Host: "example.com",
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, res)
+
+	assert.NoError(t, a.Close())
+
+	a = New()
+	a.Address = "localhost:0"
+
+	assert.NoError(t, ioutil.WriteFile(
+		filepath.Join(dir, "tls_cert.pem"),
+		nil,
+		os.ModePerm,
+	))
+
+	assert.NoError(t, ioutil.WriteFile(
+		filepath.Join(dir, "tls_key.pem"),
+		nil,
+		os.ModePerm,
+	))
+
+	a.TLSCertFile = filepath.Join(dir, "tls_cert.pem")
+	a.TLSKeyFile = filepath.Join(dir, "tls_key.pem")
+
+	assert.Error(t, a.Serve())
 
 	a = New()
 	a.Address = "localhost:0"
@@ -945,13 +1618,91 @@ l7j2fuWjNfj9JfnXoP2SEgPG
 	assert.NoError(t, a.Close())
 }
 
-func TestAirClose(t *testing.T) {
-	a := New()
-	a.Address = "localhost:0"
+func TestAirServeUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "air.TestAirServeUnix")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
 
-	hijackOSStdout()
+	sp := filepath.Join(dir, "air.sock")
 
-	go a.Serve()
+	a := New()
+	a.Address = "unix:" + sp
+
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	})
+
+	hijackOSStdout()
+
+	go a.Serve()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	assert.Equal(t, []string{sp}, a.Addresses())
+
+	hc := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(
+				ctx context.Context,
+				_ string,
+				_ string,
+			) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(
+					ctx,
+					"unix",
+					sp,
+				)
+			},
+		},
+	}
+
+	res, err := hc.Get("http://localhost/")
+	assert.NoError(t, err)
+	assert.NotNil(t, res)
+
+	b, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "Foobar", string(b))
+
+	assert.NoError(t, a.Close())
+	time.Sleep(100 * time.Millisecond)
+
+	_, err = os.Stat(sp)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestAirHandOff(t *testing.T) {
+	a := New()
+
+	p, err := a.HandOff()
+	assert.EqualError(t, err, "air: server is not running")
+	assert.Nil(t, p)
+
+	a.Address = "localhost:0"
+
+	hijackOSStdout()
+
+	go a.Serve()
+	defer a.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	a.mainListenerMutex.Lock()
+	assert.NotNil(t, a.mainListener)
+	assert.Equal(t, a.Addresses()[0], a.mainListener.Addr().String())
+	a.mainListenerMutex.Unlock()
+}
+
+func TestAirClose(t *testing.T) {
+	a := New()
+	a.Address = "localhost:0"
+
+	hijackOSStdout()
+
+	go a.Serve()
 	time.Sleep(100 * time.Millisecond)
 
 	revertOSStdout()
@@ -1001,6 +1752,193 @@ func TestAirShutdown(t *testing.T) {
 	assert.Error(t, context.Canceled, a.Shutdown(ctx))
 	assert.Empty(t, foo)
 	assert.Len(t, a.shutdownJobs, 1)
+
+	a = New()
+	a.Address = "localhost:0"
+	a.WebSocketShutdownTimeout = time.Second
+
+	wsClosed := make(chan struct{})
+	a.GET("/", func(req *Request, res *Response) error {
+		ws, err := res.WebSocket()
+		if err != nil {
+			return err
+		}
+
+		ws.Listen()
+		close(wsClosed)
+
+		return nil
+	})
+
+	hijackOSStdout()
+
+	go a.Serve()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	conn, _, err := websocket.DefaultDialer.Dial(
+		"ws://"+a.Addresses()[0],
+		nil,
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, conn)
+	defer conn.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	a.webSocketMutex.Lock()
+	assert.Len(t, a.webSockets, 1)
+	a.webSocketMutex.Unlock()
+
+	go func() {
+		_, _, err := conn.ReadMessage()
+		assert.True(t, websocket.IsCloseError(
+			err,
+			websocket.CloseServiceRestart,
+		))
+	}()
+
+	assert.NoError(t, a.Shutdown(context.Background()))
+
+	<-wsClosed
+
+	a.webSocketMutex.Lock()
+	assert.Empty(t, a.webSockets)
+	a.webSocketMutex.Unlock()
+}
+
+func TestAirDrainLongLived(t *testing.T) {
+	a := New()
+
+	remainings := []int{}
+	assert.NoError(t, a.DrainLongLived(
+		context.Background(),
+		func(remaining int) {
+			remainings = append(remainings, remaining)
+		},
+	))
+	assert.Equal(t, []int{0}, remainings)
+
+	a = New()
+	a.Address = "localhost:0"
+
+	wsClosed := make(chan struct{})
+	a.GET("/", func(req *Request, res *Response) error {
+		ws, err := res.WebSocket()
+		if err != nil {
+			return err
+		}
+
+		ws.Listen()
+		close(wsClosed)
+
+		return nil
+	})
+
+	hijackOSStdout()
+
+	go a.Serve()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	conn, _, err := websocket.DefaultDialer.Dial(
+		"ws://"+a.Addresses()[0],
+		nil,
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, conn)
+	defer conn.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		50*time.Millisecond,
+	)
+	defer cancel()
+
+	remainings = remainings[:0]
+	assert.Equal(t, context.DeadlineExceeded, a.DrainLongLived(
+		ctx,
+		func(remaining int) {
+			remainings = append(remainings, remaining)
+		},
+	))
+	assert.Equal(t, []int{1}, remainings)
+
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(
+		err,
+		websocket.CloseServiceRestart,
+	))
+
+	remainings = remainings[:0]
+	assert.NoError(t, a.DrainLongLived(
+		context.Background(),
+		func(remaining int) {
+			remainings = append(remainings, remaining)
+		},
+	))
+	assert.Equal(t, 0, remainings[len(remainings)-1])
+
+	<-wsClosed
+
+	assert.NoError(t, a.Close())
+
+	a = New()
+	a.Address = "localhost:0"
+
+	streamsDone := make(chan struct{}, 2)
+	a.GET("/stream", func(req *Request, res *Response) error {
+		defer func() { streamsDone <- struct{}{} }()
+		return res.StreamEvents(nil, make(chan *Event))
+	})
+
+	a.GET("/write", func(req *Request, res *Response) error {
+		defer func() { streamsDone <- struct{}{} }()
+		for {
+			if err := res.WriteEvent(&Event{Data: "foo"}); err != nil {
+				return nil
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	hijackOSStdout()
+
+	go a.Serve()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	for _, p := range []string{"/stream", "/write"} {
+		hrr, err := http.Get("http://" + a.Addresses()[0] + p)
+		assert.NoError(t, err)
+		defer hrr.Body.Close()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	remainings = remainings[:0]
+	assert.NoError(t, a.DrainLongLived(
+		ctx,
+		func(remaining int) {
+			remainings = append(remainings, remaining)
+		},
+	))
+	assert.Equal(t, 2, remainings[0])
+	assert.Equal(t, 0, remainings[len(remainings)-1])
+
+	<-streamsDone
+	<-streamsDone
+
+	assert.NoError(t, a.Close())
 }
 
 func TestAirAddShutdownJob(t *testing.T) {
@@ -1049,9 +1987,152 @@ func TestAirRemoveShutdownJob(t *testing.T) {
 	assert.Empty(t, foo)
 }
 
-func TestAirAddresses(t *testing.T) {
+func TestAirAddStatusObserver(t *testing.T) {
+	a := New()
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	})
+
+	a.GET("/error", func(req *Request, res *Response) error {
+		return errors.New("foobar")
+	})
+
+	var okStatuses, errorStatuses []int
+	assert.Equal(t, 0, a.AddStatusObserver(
+		200,
+		299,
+		func(req *Request, res *Response) {
+			okStatuses = append(okStatuses, res.Status)
+		},
+	))
+	assert.Equal(t, 1, a.AddStatusObserver(
+		500,
+		599,
+		func(req *Request, res *Response) {
+			assert.True(t, res.Written)
+			errorStatuses = append(errorStatuses, res.Status)
+		},
+	))
+
+	a.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(
+		http.MethodGet,
+		"/",
+		nil,
+	))
+	a.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(
+		http.MethodGet,
+		"/error",
+		nil,
+	))
+	a.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(
+		http.MethodGet,
+		"/404",
+		nil,
+	))
+
+	assert.Equal(t, []int{http.StatusOK}, okStatuses)
+	assert.Equal(t, []int{http.StatusInternalServerError}, errorStatuses)
+}
+
+func TestAirRemoveStatusObserver(t *testing.T) {
+	a := New()
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	})
+
+	count := 0
+	id := a.AddStatusObserver(200, 299, func(req *Request, res *Response) {
+		count++
+	})
+
+	a.RemoveStatusObserver(id)
+	a.RemoveStatusObserver(-1)
+	a.RemoveStatusObserver(1)
+
+	a.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(
+		http.MethodGet,
+		"/",
+		nil,
+	))
+
+	assert.Zero(t, count)
+}
+
+func TestAirRegisterBinder(t *testing.T) {
+	a := New()
+
+	a.RegisterBinder("Text/CSV", func(req *Request, v interface{}) error {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+
+		*v.(*[]string) = strings.Split(string(b), ",")
+
+		return nil
+	})
+
+	req, _, _ := fakeRRCycle(
+		a,
+		http.MethodPost,
+		"/",
+		strings.NewReader("foo,bar"),
+	)
+	req.Header.Set("Content-Type", "text/csv; charset=utf-8")
+
+	var ss []string
+	assert.NoError(t, req.Bind(&ss))
+	assert.Equal(t, []string{"foo", "bar"}, ss)
+
+	a.RegisterBinder("application/json", func(*Request, interface{}) error {
+		return errors.New("foobar")
+	})
+
+	req, _, _ = fakeRRCycle(
+		a,
+		http.MethodPost,
+		"/",
+		strings.NewReader(`{"foo":"bar"}`),
+	)
+	req.Header.Set("Content-Type", "application/json")
+
+	var m map[string]string
+	assert.EqualError(t, req.Bind(&m), "foobar")
+
+	a.RegisterBinder("application/json", nil)
+	a.RegisterBinder("text/csv", nil)
+
+	req, _, _ = fakeRRCycle(
+		a,
+		http.MethodPost,
+		"/",
+		strings.NewReader(`{"foo":"bar"}`),
+	)
+	req.Header.Set("Content-Type", "application/json")
+
+	assert.NoError(t, req.Bind(&m))
+	assert.Equal(t, map[string]string{"foo": "bar"}, m)
+
+	req, res, _ := fakeRRCycle(
+		a,
+		http.MethodPost,
+		"/",
+		strings.NewReader("foo,bar"),
+	)
+	req.Header.Set("Content-Type", "text/csv")
+
+	assert.Error(t, req.Bind(&ss))
+	assert.Equal(t, http.StatusUnsupportedMediaType, res.Status)
+}
+
+func TestAirServeDevTLS(t *testing.T) {
 	a := New()
 	a.Address = "localhost:0"
+	a.DebugMode = true
+	a.DevTLS = true
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	})
 
 	hijackOSStdout()
 
@@ -1060,32 +2141,687 @@ func TestAirAddresses(t *testing.T) {
 
 	revertOSStdout()
 
-	assert.Len(t, a.Addresses(), 1)
+	hc := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		},
+	}
+
+	hcr, err := hc.Get("https://" + a.Addresses()[0])
+	assert.NoError(t, err)
+	assert.NotNil(t, hcr)
+
+	hcrb, _ := ioutil.ReadAll(hcr.Body)
+	hcr.Body.Close()
+	assert.Equal(t, http.StatusOK, hcr.StatusCode)
+	assert.Equal(t, "Foobar", string(hcrb))
+	assert.NotNil(t, hcr.TLS)
+	assert.Equal(t, []string{"localhost"}, hcr.TLS.PeerCertificates[0].DNSNames)
 
 	assert.NoError(t, a.Close())
+
+	a = New()
+	a.Address = "localhost:0"
+	a.DevTLS = true
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	})
+
+	hijackOSStdout()
+
+	go a.Serve()
 	time.Sleep(100 * time.Millisecond)
 
-	assert.Len(t, a.Addresses(), 0)
+	revertOSStdout()
+
+	hcr, err = http.Get("http://" + a.Addresses()[0])
+	assert.NoError(t, err)
+	assert.NotNil(t, hcr)
+
+	hcrb, _ = ioutil.ReadAll(hcr.Body)
+	hcr.Body.Close()
+	assert.Equal(t, http.StatusOK, hcr.StatusCode)
+	assert.Equal(t, "Foobar", string(hcrb))
+	assert.Nil(t, hcr.TLS)
+
+	assert.NoError(t, a.Close())
 }
 
-func TestAirServeHTTP(t *testing.T) {
+func TestAirServeTLSNextProtos(t *testing.T) {
 	a := New()
-	a.Pregases = []Gas{func(next Handler) Handler {
-		return func(req *Request, res *Response) error {
-			req.SetValue("EasterEgg", easterEgg)
+	a.Address = "localhost:0"
+	a.DebugMode = true
+	a.DevTLS = true
+	a.TLSNextProtos = map[string]func(net.Conn){
+		"foobar/1": func(c net.Conn) {
+			c.Write([]byte("Foobar"))
+		},
+		"h2":       func(net.Conn) {},
+		"barfoo/1": nil,
+	}
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString(req.Protocol())
+	})
 
-			res.Defer(func() {
-				res.WriteString("Defer")
-			})
+	hijackOSStdout()
 
-			if err := res.WriteString("Pregas - "); err != nil {
-				return err
-			}
+	go a.Serve()
+	time.Sleep(100 * time.Millisecond)
 
-			return next(req, res)
-		}
-	}}
-	a.Gases = []Gas{func(next Handler) Handler {
+	revertOSStdout()
+
+	c, err := tls.Dial("tcp", a.Addresses()[0], &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"foobar/1"},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, c)
+	assert.Equal(t, "foobar/1", c.ConnectionState().NegotiatedProtocol)
+
+	b, err := ioutil.ReadAll(c)
+	assert.NoError(t, err)
+	assert.Equal(t, "Foobar", string(b))
+	assert.NoError(t, c.Close())
+
+	c, err = tls.Dial("tcp", a.Addresses()[0], &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"barfoo/1"},
+	})
+	if err == nil {
+		assert.Empty(t, c.ConnectionState().NegotiatedProtocol)
+		assert.NoError(t, c.Close())
+	}
+
+	hc := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+			ForceAttemptHTTP2: true,
+		},
+	}
+
+	hcr, err := hc.Get("https://" + a.Addresses()[0])
+	assert.NoError(t, err)
+	assert.NotNil(t, hcr)
+
+	hcrb, _ := ioutil.ReadAll(hcr.Body)
+	hcr.Body.Close()
+	assert.Equal(t, http.StatusOK, hcr.StatusCode)
+	assert.Equal(t, "h2", string(hcrb))
+
+	assert.NoError(t, a.Close())
+}
+
+func TestAirServeTLSVersionAndCipherSuites(t *testing.T) {
+	a := New()
+	a.Address = "localhost:0"
+	a.DebugMode = true
+	a.DevTLS = true
+	a.TLSMinVersion = tls.VersionTLS13
+
+	hijackOSStdout()
+
+	go a.Serve()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	c, err := tls.Dial("tcp", a.Addresses()[0], &tls.Config{
+		InsecureSkipVerify: true,
+		MaxVersion:         tls.VersionTLS12,
+	})
+	assert.Error(t, err)
+	assert.Nil(t, c)
+
+	c, err = tls.Dial("tcp", a.Addresses()[0], &tls.Config{
+		InsecureSkipVerify: true,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, c)
+	assert.Equal(
+		t,
+		uint16(tls.VersionTLS13),
+		c.ConnectionState().Version,
+	)
+	assert.NoError(t, c.Close())
+
+	assert.NoError(t, a.Close())
+
+	a = New()
+	a.Address = "localhost:0"
+	a.DebugMode = true
+	a.DevTLS = true
+	a.TLSConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	a.TLSMinVersion = tls.VersionTLS13
+	a.TLSCipherSuites = []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	}
+
+	hijackOSStdout()
+
+	go a.Serve()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	c, err = tls.Dial("tcp", a.Addresses()[0], &tls.Config{
+		InsecureSkipVerify: true,
+		MaxVersion:         tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+		},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, c)
+	assert.Equal(
+		t,
+		uint16(tls.VersionTLS12),
+		c.ConnectionState().Version,
+	)
+	assert.Equal(
+		t,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+		c.ConnectionState().CipherSuite,
+	)
+	assert.NoError(t, c.Close())
+
+	assert.Equal(t, uint16(tls.VersionTLS12), a.TLSConfig.MinVersion)
+	assert.Nil(t, a.TLSConfig.CipherSuites)
+
+	assert.NoError(t, a.Close())
+}
+
+func TestAirServeTLSClientAuth(t *testing.T) {
+	a := New()
+	a.Address = "localhost:0"
+	a.DebugMode = true
+	a.DevTLS = true
+	a.TLSClientAuth = tls.RequireAnyClientCert
+	a.GET("/", func(req *Request, res *Response) error {
+		ccs := req.ClientCertificates()
+		if len(ccs) == 0 {
+			return res.WriteString("")
+		}
+
+		return res.WriteString(ccs[0].Subject.CommonName)
+	})
+
+	hijackOSStdout()
+
+	go a.Serve()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	c, err := newDevTLSCertificate()
+	assert.NoError(t, err)
+
+	hc := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+				Certificates:       []tls.Certificate{c},
+			},
+		},
+	}
+
+	hcr, err := hc.Get("https://" + a.Addresses()[0])
+	assert.NoError(t, err)
+	assert.NotNil(t, hcr)
+
+	hcrb, _ := ioutil.ReadAll(hcr.Body)
+	hcr.Body.Close()
+	assert.Equal(t, http.StatusOK, hcr.StatusCode)
+	assert.Equal(t, c.Leaf.Subject.CommonName, string(hcrb))
+
+	hc = &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		},
+	}
+
+	_, err = hc.Get("https://" + a.Addresses()[0])
+	assert.Error(t, err)
+
+	assert.NoError(t, a.Close())
+
+	dir, err := ioutil.TempDir("", "air.TestAirServeTLSClientAuth")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, dir)
+	defer os.RemoveAll(dir)
+
+	a = New()
+	a.Address = "localhost:0"
+	a.DebugMode = true
+	a.DevTLS = true
+	a.TLSClientCAFile = filepath.Join(dir, "tls_client_ca.pem")
+	a.TLSClientAuth = tls.RequireAndVerifyClientCert
+
+	assert.Error(t, a.Serve())
+
+	assert.NoError(t, ioutil.WriteFile(
+		a.TLSClientCAFile,
+		[]byte("Foobar"),
+		os.ModePerm,
+	))
+
+	assert.Error(t, a.Serve())
+
+	assert.NoError(t, ioutil.WriteFile(
+		a.TLSClientCAFile,
+		pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: c.Leaf.Raw,
+		}),
+		os.ModePerm,
+	))
+
+	clientCAs := x509.NewCertPool()
+
+	a.Address = "localhost:0"
+	a.TLSConfig = &tls.Config{
+		ClientCAs: clientCAs,
+	}
+
+	hijackOSStdout()
+
+	go a.Serve()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	assert.Same(t, clientCAs, a.TLSConfig.ClientCAs)
+	assert.Len(t, clientCAs.Subjects(), 0)
+
+	_, err = hc.Get("https://" + a.Addresses()[0])
+	assert.Error(t, err)
+
+	assert.NoError(t, a.Close())
+}
+
+func TestAirNewACMEManager(t *testing.T) {
+	a := New()
+
+	acm := a.newACMEManager()
+	assert.Equal(t, autocert.DirCache("acme-certs"), acm.Cache)
+	assert.Equal(t, 30*24*time.Hour, acm.RenewBefore)
+	assert.Nil(t, acm.HostPolicy)
+
+	a.ACMECache = autocert.DirCache("foobar")
+	a.ACMEHostWhitelist = []string{"example.com"}
+
+	acm = a.newACMEManager()
+	assert.Equal(t, autocert.DirCache("foobar"), acm.Cache)
+	assert.NotNil(t, acm.HostPolicy)
+}
+
+func TestNewDevTLSCertificate(t *testing.T) {
+	c, err := newDevTLSCertificate()
+	assert.NoError(t, err)
+	assert.Len(t, c.Certificate, 1)
+	assert.NotNil(t, c.PrivateKey)
+	assert.NotNil(t, c.Leaf)
+	assert.NoError(t, c.Leaf.VerifyHostname("localhost"))
+	assert.NoError(t, c.Leaf.VerifyHostname("127.0.0.1"))
+	assert.NoError(t, c.Leaf.VerifyHostname("::1"))
+	assert.Error(t, c.Leaf.VerifyHostname("example.com"))
+}
+
+func TestAirServeH2C(t *testing.T) {
+	a := New()
+	a.Address = "localhost:0"
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString(req.Protocol())
+	})
+
+	hijackOSStdout()
+
+	go a.Serve()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	u := "http://" + a.Addresses()[0]
+
+	hcr, err := http.Get(u)
+	assert.NoError(t, err)
+	assert.NotNil(t, hcr)
+
+	hcrb, _ := ioutil.ReadAll(hcr.Body)
+	hcr.Body.Close()
+	assert.Equal(t, http.StatusOK, hcr.StatusCode)
+	assert.Equal(t, "HTTP/1.1", string(hcrb))
+
+	hc := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(
+				network string,
+				address string,
+				_ *tls.Config,
+			) (net.Conn, error) {
+				return net.Dial(network, address)
+			},
+		},
+	}
+
+	hcr, err = hc.Get(u)
+	assert.NoError(t, err)
+	assert.NotNil(t, hcr)
+
+	hcrb, _ = ioutil.ReadAll(hcr.Body)
+	hcr.Body.Close()
+	assert.Equal(t, http.StatusOK, hcr.StatusCode)
+	assert.Equal(t, 2, hcr.ProtoMajor)
+	assert.Equal(t, "h2c", string(hcrb))
+
+	assert.NoError(t, a.Close())
+
+	a = New()
+	a.Address = "localhost:0"
+	a.H2CUpgrade = false
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString(req.Protocol())
+	})
+
+	hijackOSStdout()
+
+	go a.Serve()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	hr, err := http.NewRequest(
+		http.MethodGet,
+		"http://"+a.Addresses()[0],
+		nil,
+	)
+	assert.NoError(t, err)
+
+	hr.Header.Set("Connection", "Upgrade, HTTP2-Settings")
+	hr.Header.Set("Upgrade", "h2c")
+	hr.Header.Set("HTTP2-Settings", "AAMAAABkAAQAAP__")
+
+	hcr, err = http.DefaultClient.Do(hr)
+	assert.NoError(t, err)
+	assert.NotNil(t, hcr)
+
+	hcrb, _ = ioutil.ReadAll(hcr.Body)
+	hcr.Body.Close()
+	assert.Equal(t, http.StatusOK, hcr.StatusCode)
+	assert.Equal(t, 1, hcr.ProtoMajor)
+	assert.Equal(t, "HTTP/1.1", string(hcrb))
+
+	assert.NoError(t, a.Close())
+}
+
+func TestAirConnectionStats(t *testing.T) {
+	a := New()
+
+	states := []http.ConnState{}
+	a.ConnStateHook = func(c net.Conn, state http.ConnState) {
+		states = append(states, state)
+	}
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	c3, c4 := net.Pipe()
+	defer c3.Close()
+	defer c4.Close()
+
+	active, idle, hijacked := a.ConnectionStats()
+	assert.Zero(t, active)
+	assert.Zero(t, idle)
+	assert.Zero(t, hijacked)
+
+	a.connState(c1, http.StateNew)
+	a.connState(c3, http.StateNew)
+
+	active, idle, hijacked = a.ConnectionStats()
+	assert.Zero(t, active)
+	assert.Zero(t, idle)
+	assert.Zero(t, hijacked)
+
+	a.connState(c1, http.StateActive)
+	a.connState(c3, http.StateActive)
+
+	active, idle, hijacked = a.ConnectionStats()
+	assert.Equal(t, int64(2), active)
+	assert.Zero(t, idle)
+	assert.Zero(t, hijacked)
+
+	a.connState(c1, http.StateIdle)
+
+	active, idle, hijacked = a.ConnectionStats()
+	assert.Equal(t, int64(1), active)
+	assert.Equal(t, int64(1), idle)
+	assert.Zero(t, hijacked)
+
+	a.connState(c3, http.StateHijacked)
+
+	active, idle, hijacked = a.ConnectionStats()
+	assert.Zero(t, active)
+	assert.Equal(t, int64(1), idle)
+	assert.Equal(t, int64(1), hijacked)
+
+	a.connState(c1, http.StateClosed)
+
+	active, idle, hijacked = a.ConnectionStats()
+	assert.Zero(t, active)
+	assert.Zero(t, idle)
+	assert.Equal(t, int64(1), hijacked)
+
+	assert.Equal(t, []http.ConnState{
+		http.StateNew,
+		http.StateNew,
+		http.StateActive,
+		http.StateActive,
+		http.StateIdle,
+		http.StateHijacked,
+		http.StateClosed,
+	}, states)
+
+	a = New()
+	a.Address = "localhost:0"
+
+	stateChan := make(chan http.ConnState, 8)
+	a.ConnStateHook = func(c net.Conn, state http.ConnState) {
+		stateChan <- state
+	}
+
+	a.GET("/", func(req *Request, res *Response) error {
+		active, idle, _ := a.ConnectionStats()
+		assert.Equal(t, int64(1), active)
+		assert.Zero(t, idle)
+		return res.WriteString("Foobar")
+	})
+
+	hijackOSStdout()
+
+	go a.Serve()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	hc := &http.Client{
+		Transport: &http.Transport{},
+	}
+
+	hcr, err := hc.Get("http://" + a.Addresses()[0])
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, hcr.StatusCode)
+	ioutil.ReadAll(hcr.Body)
+	hcr.Body.Close()
+
+	assert.Equal(t, http.StateNew, <-stateChan)
+	assert.Equal(t, http.StateActive, <-stateChan)
+	assert.Equal(t, http.StateIdle, <-stateChan)
+
+	active, idle, _ = a.ConnectionStats()
+	assert.Zero(t, active)
+	assert.Equal(t, int64(1), idle)
+
+	assert.NoError(t, a.Close())
+}
+
+func TestAirAddresses(t *testing.T) {
+	a := New()
+	a.Address = "localhost:0"
+
+	hijackOSStdout()
+
+	go a.Serve()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	assert.Len(t, a.Addresses(), 1)
+
+	assert.NoError(t, a.Close())
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Len(t, a.Addresses(), 0)
+
+	a = New()
+	a.Address = "localhost:0"
+	a.ExtraAddresses = []string{"localhost:0", "127.0.0.1:0"}
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	})
+
+	hijackOSStdout()
+
+	go a.Serve()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	assert.Len(t, a.Addresses(), 3)
+
+	addresses := a.Addresses()
+	for _, address := range addresses {
+		hcr, err := http.Get("http://" + address)
+		assert.NoError(t, err)
+		assert.NotNil(t, hcr)
+
+		hcrb, _ := ioutil.ReadAll(hcr.Body)
+		hcr.Body.Close()
+		assert.Equal(t, http.StatusOK, hcr.StatusCode)
+		assert.Equal(t, "Foobar", string(hcrb))
+	}
+
+	assert.NoError(t, a.Shutdown(context.Background()))
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Len(t, a.Addresses(), 0)
+
+	for _, address := range addresses {
+		_, err := net.Dial("tcp", address)
+		assert.Error(t, err)
+	}
+
+	a = New()
+	a.Address = "localhost:0"
+	a.ExtraAddresses = []string{":-1"}
+
+	assert.Error(t, a.Serve())
+	assert.Len(t, a.Addresses(), 0)
+
+	c, err := newDevTLSCertificate()
+	assert.NoError(t, err)
+
+	a = New()
+	a.Address = "localhost:0"
+	a.ExtraAddresses = []string{"localhost:0"}
+	a.ExtraListeners = []ExtraListener{
+		{
+			Address: "localhost:0",
+			TLSConfig: &tls.Config{
+				Certificates: []tls.Certificate{c},
+			},
+		},
+		{
+			Address: "localhost:0",
+		},
+	}
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString(req.Scheme)
+	})
+
+	hijackOSStdout()
+
+	go a.Serve()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	assert.Len(t, a.Addresses(), 4)
+
+	hc := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		},
+	}
+
+	for i, address := range a.Addresses() {
+		scheme := "http"
+		if i == 2 {
+			scheme = "https"
+		}
+
+		hcr, err := hc.Get(scheme + "://" + address)
+		assert.NoError(t, err)
+		assert.NotNil(t, hcr)
+
+		hcrb, _ := ioutil.ReadAll(hcr.Body)
+		hcr.Body.Close()
+		assert.Equal(t, http.StatusOK, hcr.StatusCode)
+		assert.Equal(t, scheme, string(hcrb))
+	}
+
+	assert.NoError(t, a.Close())
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Len(t, a.Addresses(), 0)
+
+	a = New()
+	a.Address = "localhost:0"
+	a.ExtraListeners = []ExtraListener{{Address: ":-1"}}
+
+	assert.Error(t, a.Serve())
+	assert.Len(t, a.Addresses(), 0)
+}
+
+func TestAirServeHTTP(t *testing.T) {
+	a := New()
+	a.Pregases = []Gas{func(next Handler) Handler {
+		return func(req *Request, res *Response) error {
+			req.SetValue("EasterEgg", easterEgg)
+
+			res.Defer(func() {
+				res.WriteString("Defer")
+			})
+
+			if err := res.WriteString("Pregas - "); err != nil {
+				return err
+			}
+
+			return next(req, res)
+		}
+	}}
+	a.Gases = []Gas{func(next Handler) Handler {
 		return func(req *Request, res *Response) error {
 			if err := res.WriteString("Gas - "); err != nil {
 				return err
@@ -1095,20 +2831,222 @@ func TestAirServeHTTP(t *testing.T) {
 		}
 	}}
 
-	a.GET("/hello/:Name", func(req *Request, res *Response) error {
-		if req.Value("EasterEgg") != easterEgg {
-			return errors.New("wrong easter egg")
-		}
+	a.GET("/hello/:Name", func(req *Request, res *Response) error {
+		if req.Value("EasterEgg") != easterEgg {
+			return errors.New("wrong easter egg")
+		}
+
+		return res.WriteString(
+			"Hello, " + req.Param("Name").Value().String() + " - ",
+		)
+	})
+
+	hr := httptest.NewRequest(http.MethodGet, "/hello/Air", nil)
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(
+		t,
+		"text/plain; charset=utf-8",
+		hrw.HeaderMap.Get("Content-Type"),
+	)
+	assert.Equal(t, "Pregas - Gas - Hello, Air - Defer", string(hrwrb))
+
+	a = New()
+
+	a.GET("/", func(req *Request, res *Response) error {
+		return errors.New("handler error")
+	})
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusInternalServerError, hrwr.StatusCode)
+	assert.Equal(
+		t,
+		"text/plain; charset=utf-8",
+		hrw.HeaderMap.Get("Content-Type"),
+	)
+	assert.Equal(t, "Internal Server Error", string(hrwrb))
+
+	a = New()
+	a.DebugMode = true
+
+	a.GET("/:Foo", func(req *Request, res *Response) error {
+		return errors.New("handler error")
+	})
+
+	hr = httptest.NewRequest(http.MethodGet, "/bar", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusInternalServerError, hrwr.StatusCode)
+	assert.Equal(
+		t,
+		"text/plain; charset=utf-8",
+		hrw.HeaderMap.Get("Content-Type"),
+	)
+	assert.Equal(t, "handler error", string(hrwrb))
+
+	a = New()
+
+	var postWriteError error
+	a.OnPostWriteError = func(err error, req *Request, res *Response) {
+		postWriteError = err
+		assert.True(t, res.Written)
+		assert.Equal(t, http.StatusOK, res.Status)
+	}
+
+	a.GET("/", func(req *Request, res *Response) error {
+		return errors.New("handler error")
+	})
+
+	a.GET("/written", func(req *Request, res *Response) error {
+		if err := res.WriteString("Foo"); err != nil {
+			return err
+		}
+
+		return errors.New("handler error after write")
+	})
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusInternalServerError, hrw.Code)
+	assert.Nil(t, postWriteError)
+
+	hr = httptest.NewRequest(http.MethodGet, "/written", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "Foo", string(hrwrb))
+	assert.EqualError(t, postWriteError, "handler error after write")
+
+	a = New()
+	a.ExpectContinueHandler = func(req *Request, res *Response) error {
+		if req.ContentLength > 3 {
+			res.Status = http.StatusRequestEntityTooLarge
+			return errors.New("request body too large")
+		}
+
+		if req.Header.Get("Authorization") == "" {
+			return errors.New("unauthorized")
+		}
+
+		return nil
+	}
+
+	a.POST("/", func(req *Request, res *Response) error {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+
+		return res.WriteString(string(b))
+	})
+
+	hr = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("foo"))
+	hr.Header.Set("Expect", "100-continue")
+	hr.Header.Set("Authorization", "foobar")
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "foo", string(hrwrb))
+
+	hr = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("foo"))
+	hr.Header.Set("Expect", "100-continue")
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusExpectationFailed, hrwr.StatusCode)
+	assert.Equal(t, "unauthorized", string(hrwrb))
+
+	hr = httptest.NewRequest(
+		http.MethodPost,
+		"/",
+		strings.NewReader("foobar"),
+	)
+	hr.Header.Set("Expect", "100-continue")
+	hr.Header.Set("Authorization", "foobar")
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, hrwr.StatusCode)
+	assert.Equal(t, "request body too large", string(hrwrb))
+
+	hr = httptest.NewRequest(
+		http.MethodPost,
+		"/",
+		strings.NewReader("foobar"),
+	)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "foobar", string(hrwrb))
+}
+
+func TestAirStripPrefixHandler(t *testing.T) {
+	a := New()
+
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString("Matched [GET /]")
+	})
 
-		return res.WriteString(
-			"Hello, " + req.Param("Name").Value().String() + " - ",
-		)
+	a.GET("/users/:UserID", func(req *Request, res *Response) error {
+		return res.WriteString(fmt.Sprintf(
+			"Matched [GET /users/:UserID] - %s - %s - %s",
+			req.Path,
+			req.Param("UserID").Value().String(),
+			req.Param("foo").Value().String(),
+		))
 	})
 
-	hr := httptest.NewRequest(http.MethodGet, "/hello/Air", nil)
+	mux := http.NewServeMux()
+	mux.Handle("/api/", a.StripPrefixHandler("/api"))
+
+	hr := httptest.NewRequest(http.MethodGet, "/api/users/1?foo=bar", nil)
 	hrw := httptest.NewRecorder()
 
-	a.ServeHTTP(hrw, hr)
+	mux.ServeHTTP(hrw, hr)
 
 	hrwr := hrw.Result()
 	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
@@ -1116,55 +3054,81 @@ func TestAirServeHTTP(t *testing.T) {
 	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
 	assert.Equal(
 		t,
-		"text/plain; charset=utf-8",
-		hrw.HeaderMap.Get("Content-Type"),
+		"Matched [GET /users/:UserID] - /users/1?foo=bar - 1 - bar",
+		string(hrwrb),
 	)
-	assert.Equal(t, "Pregas - Gas - Hello, Air - Defer", string(hrwrb))
 
-	a = New()
+	hr = httptest.NewRequest(http.MethodGet, "/api/", nil)
+	hrw = httptest.NewRecorder()
 
-	a.GET("/", func(req *Request, res *Response) error {
-		return errors.New("handler error")
-	})
+	mux.ServeHTTP(hrw, hr)
 
-	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "Matched [GET /]", string(hrwrb))
+
+	hr = httptest.NewRequest(http.MethodGet, "/api", nil)
 	hrw = httptest.NewRecorder()
 
-	a.ServeHTTP(hrw, hr)
+	a.StripPrefixHandler("/api").ServeHTTP(hrw, hr)
 
 	hrwr = hrw.Result()
 	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
 
-	assert.Equal(t, http.StatusInternalServerError, hrwr.StatusCode)
-	assert.Equal(
-		t,
-		"text/plain; charset=utf-8",
-		hrw.HeaderMap.Get("Content-Type"),
-	)
-	assert.Equal(t, "Internal Server Error", string(hrwrb))
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "Matched [GET /]", string(hrwrb))
+
+	hr = httptest.NewRequest(http.MethodGet, "/foobar", nil)
+	hrw = httptest.NewRecorder()
+
+	a.StripPrefixHandler("/api").ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusNotFound, hrw.Code)
+}
+
+func TestAirLogStartupf(t *testing.T) {
+	a := New()
+
+	hijackOSStdout()
+
+	a.logStartupf("air: listening on %v", []string{"localhost:8080"})
+
+	os.Stdout.Seek(0, io.SeekStart)
+	b, _ := ioutil.ReadAll(os.Stdout)
+
+	revertOSStdout()
+
+	assert.Equal(t, "air: listening on [localhost:8080]\n", string(b))
+
+	buf := bytes.Buffer{}
+
+	a.StartupLogWriter = &buf
+	a.logStartupf("air: serving in debug mode")
+	assert.Equal(t, "air: serving in debug mode\n", buf.String())
+
+	buf.Reset()
 
 	a = New()
+	a.Address = "localhost:0"
 	a.DebugMode = true
+	a.StartupLogWriter = &buf
 
-	a.GET("/:Foo", func(req *Request, res *Response) error {
-		return errors.New("handler error")
-	})
+	serveDone := make(chan struct{})
+	go func() {
+		a.Serve()
+		close(serveDone)
+	}()
 
-	hr = httptest.NewRequest(http.MethodGet, "/bar", nil)
-	hrw = httptest.NewRecorder()
+	time.Sleep(100 * time.Millisecond)
 
-	a.ServeHTTP(hrw, hr)
+	assert.NoError(t, a.Close())
 
-	hrwr = hrw.Result()
-	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+	<-serveDone
 
-	assert.Equal(t, http.StatusInternalServerError, hrwr.StatusCode)
-	assert.Equal(
-		t,
-		"text/plain; charset=utf-8",
-		hrw.HeaderMap.Get("Content-Type"),
-	)
-	assert.Equal(t, "handler error", string(hrwrb))
+	assert.Contains(t, buf.String(), "air: listening on [")
+	assert.Contains(t, buf.String(), "air: serving in debug mode\n")
 }
 
 func TestAirLogErrorf(t *testing.T) {
@@ -1186,6 +3150,51 @@ func TestAirLogErrorf(t *testing.T) {
 	assert.Equal(t, "air: some error: foobar\n", buf.String())
 }
 
+func TestAirSlowRequestThreshold(t *testing.T) {
+	a := New()
+
+	buf := bytes.Buffer{}
+	a.ErrorLogger = log.New(&buf, "", 0)
+	a.SlowRequestThreshold = 50 * time.Millisecond
+
+	a.GET("/foo/:Bar", func(req *Request, res *Response) error {
+		time.Sleep(100 * time.Millisecond)
+		return res.WriteString("Foobar")
+	})
+	a.GET("/bar", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	})
+
+	hr := httptest.NewRequest(http.MethodGet, "/foo/bar", nil)
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Regexp(
+		t,
+		`^air: slow request: GET /foo/:Bar took \d+(\.\d+)?ms\n$`,
+		buf.String(),
+	)
+
+	buf.Reset()
+
+	hr = httptest.NewRequest(http.MethodGet, "/bar", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Empty(t, buf.String())
+
+	a.SlowRequestThreshold = 0
+
+	hr = httptest.NewRequest(http.MethodGet, "/foo/bar", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Empty(t, buf.String())
+}
+
 func TestWrapHTTPHandler(t *testing.T) {
 	a := New()
 
@@ -1222,6 +3231,43 @@ func TestDefaultMethodNotAllowedHandler(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Equal(t, http.StatusMethodNotAllowed, res.Status)
 	assert.Equal(t, http.StatusText(res.Status), err.Error())
+	assert.Empty(t, res.Header.Get("Allow"))
+
+	a.GET("/", func(req *Request, res *Response) error {
+		return nil
+	})
+	a.POST("/", func(req *Request, res *Response) error {
+		return nil
+	})
+
+	hrw := httptest.NewRecorder()
+	a.ServeHTTP(hrw, httptest.NewRequest(http.MethodPut, "/", nil))
+
+	assert.Equal(t, http.StatusMethodNotAllowed, hrw.Code)
+	assert.Equal(t, "GET, POST", hrw.Header().Get("Allow"))
+}
+
+func TestAirFormatPanicStack(t *testing.T) {
+	a := New()
+
+	s := a.formatPanicStack("foobar")
+	assert.True(t, strings.HasPrefix(s, "foobar\ngoroutine "))
+	assert.Contains(t, s, "TestAirFormatPanicStack")
+
+	a.PanicStackFormatter = func(
+		recovered interface{},
+		stack []byte,
+	) string {
+		assert.NotEmpty(t, stack)
+		return fmt.Sprintf(`{"panic":%q}`, recovered)
+	}
+
+	assert.Equal(t, `{"panic":"foobar"}`, a.formatPanicStack("foobar"))
+
+	a.PanicStackFormatter = nil
+
+	s = a.formatPanicStack(errors.New("foobar"))
+	assert.True(t, strings.HasPrefix(s, "foobar\ngoroutine "))
 }
 
 func TestDefaultErrorHandler(t *testing.T) {
@@ -1247,6 +3293,35 @@ func TestDefaultErrorHandler(t *testing.T) {
 
 	assert.Equal(t, http.StatusText(res.Status), string(hrwrb))
 
+	req, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+	res.Status = http.StatusBadRequest
+	res.Header.Set("Content-Type", "application/octet-stream")
+
+	DefaultErrorHandler(errors.New("foobar"), req, res)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(
+		t,
+		"text/plain; charset=utf-8",
+		hrwr.Header.Get("Content-Type"),
+	)
+	assert.Equal(t, "foobar", string(hrwrb))
+
+	req, res, hrw = fakeRRCycle(a, http.MethodHead, "/", nil)
+	res.Status = http.StatusNotFound
+
+	DefaultErrorHandler(errors.New("foobar"), req, res)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.True(t, res.Written)
+	assert.Equal(t, http.StatusNotFound, hrwr.StatusCode)
+	assert.Equal(t, "0", hrwr.Header.Get("Content-Length"))
+	assert.Empty(t, hrwrb)
+
 	req, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
 	assert.NoError(t, res.WriteString("everything is fine"))
 
@@ -1256,6 +3331,178 @@ func TestDefaultErrorHandler(t *testing.T) {
 	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
 
 	assert.Equal(t, "everything is fine", string(hrwrb))
+
+	a = New()
+
+	dir, err := ioutil.TempDir("", "air.TestDefaultErrorHandler")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, dir)
+	defer os.RemoveAll(dir)
+
+	a.RendererTemplateRoot = dir
+	a.ErrorPages = map[int]string{
+		http.StatusNotFound:            "404.html",
+		http.StatusInternalServerError: "500.html",
+	}
+
+	assert.NoError(t, ioutil.WriteFile(
+		filepath.Join(a.RendererTemplateRoot, "404.html"),
+		[]byte(`<h1>{{.Status}} {{.StatusText}}</h1><p>{{.Message}}</p>`),
+		os.ModePerm,
+	))
+
+	req, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "text/html,*/*;q=0.8")
+	res.Status = http.StatusNotFound
+
+	DefaultErrorHandler(errors.New("foobar"), req, res)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusNotFound, hrwr.StatusCode)
+	assert.Equal(
+		t,
+		"text/html; charset=utf-8",
+		hrwr.Header.Get("Content-Type"),
+	)
+	assert.Equal(t, "<h1>404 Not Found</h1><p>foobar</p>", string(hrwrb))
+
+	req, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/json")
+	res.Status = http.StatusNotFound
+
+	DefaultErrorHandler(errors.New("foobar"), req, res)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(
+		t,
+		"application/json; charset=utf-8",
+		hrwr.Header.Get("Content-Type"),
+	)
+	assert.Equal(t, `{"message":"foobar","status":404}`, string(hrwrb))
+
+	req, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "text/html")
+	res.Status = http.StatusInternalServerError
+
+	DefaultErrorHandler(errors.New("foobar"), req, res)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusInternalServerError, hrwr.StatusCode)
+	assert.Equal(t, http.StatusText(res.Status), string(hrwrb))
+
+	a = New()
+	a.ErrorEnvelope = nil
+
+	req, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/json")
+	res.Status = http.StatusNotFound
+
+	DefaultErrorHandler(errors.New("foobar"), req, res)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusNotFound, hrwr.StatusCode)
+	assert.Equal(
+		t,
+		"text/plain; charset=utf-8",
+		hrwr.Header.Get("Content-Type"),
+	)
+	assert.Equal(t, "foobar", string(hrwrb))
+
+	a.ErrorEnvelope = DefaultErrorEnvelope
+
+	req, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "text/plain")
+	res.Status = http.StatusNotFound
+
+	DefaultErrorHandler(errors.New("foobar"), req, res)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(
+		t,
+		"text/plain; charset=utf-8",
+		hrwr.Header.Get("Content-Type"),
+	)
+	assert.Equal(t, "foobar", string(hrwrb))
+
+	a.ErrorEnvelope = func(
+		status int,
+		message string,
+		internal error,
+		debug bool,
+	) interface{} {
+		return map[string]interface{}{
+			"error": map[string]interface{}{
+				"code":     status,
+				"message":  message,
+				"internal": internal.Error(),
+				"debug":    debug,
+			},
+		}
+	}
+
+	req, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/problem+json")
+	res.Status = http.StatusInternalServerError
+
+	DefaultErrorHandler(errors.New("foobar"), req, res)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusInternalServerError, hrwr.StatusCode)
+	assert.Equal(
+		t,
+		`{"error":{"code":500,"debug":false,"internal":"foobar",`+
+			`"message":"Internal Server Error"}}`,
+		string(hrwrb),
+	)
+}
+
+func TestDefaultErrorEnvelope(t *testing.T) {
+	assert.Equal(
+		t,
+		map[string]interface{}{
+			"message": "Not Found",
+			"status":  http.StatusNotFound,
+		},
+		DefaultErrorEnvelope(
+			http.StatusNotFound,
+			"Not Found",
+			errors.New("foobar"),
+			false,
+		),
+	)
+}
+
+func TestAcceptsJSON(t *testing.T) {
+	assert.True(t, acceptsJSON("application/json"))
+	assert.True(t, acceptsJSON("text/html, application/json;q=0.9"))
+	assert.True(t, acceptsJSON("application/problem+json"))
+	assert.False(t, acceptsJSON(""))
+	assert.False(t, acceptsJSON("*/*"))
+	assert.False(t, acceptsJSON("text/html,*/*;q=0.8"))
+	assert.False(t, acceptsJSON("application/json;q=0"))
+}
+
+func TestDefaultPanicStackFormatter(t *testing.T) {
+	assert.Equal(
+		t,
+		"foobar\ngoroutine 1 [running]:\n",
+		DefaultPanicStackFormatter(
+			"foobar",
+			[]byte("goroutine 1 [running]:\n"),
+		),
+	)
 }
 
 func TestWrapHTTPMiddleWare(t *testing.T) {
@@ -1285,6 +3532,28 @@ func TestWrapHTTPMiddleWare(t *testing.T) {
 	assert.Equal(t, "Foobar", string(hrwrb))
 }
 
+func TestSplitAssetDigest(t *testing.T) {
+	p, digest := splitAssetDigest("/js/app.0123456789abcdef.js")
+	assert.Equal(t, "/js/app.js", p)
+	assert.Equal(t, "0123456789abcdef", digest)
+
+	p, digest = splitAssetDigest("/js/app.0123456789abcdef")
+	assert.Equal(t, "/js/app", p)
+	assert.Equal(t, "0123456789abcdef", digest)
+
+	p, digest = splitAssetDigest("/js/app.js")
+	assert.Equal(t, "/js/app.js", p)
+	assert.Empty(t, digest)
+
+	p, digest = splitAssetDigest("/js/app.0123456789abcdeg.js")
+	assert.Equal(t, "/js/app.0123456789abcdeg.js", p)
+	assert.Empty(t, digest)
+
+	p, digest = splitAssetDigest("/js.0123456789abcdef/app.js")
+	assert.Equal(t, "/js.0123456789abcdef/app.js", p)
+	assert.Empty(t, digest)
+}
+
 func TestStringSliceContains(t *testing.T) {
 	assert.True(t, stringSliceContains([]string{"foo"}, "foo", false))
 	assert.True(t, stringSliceContains([]string{"foo"}, "foo", true))
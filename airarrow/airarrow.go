@@ -0,0 +1,44 @@
+/*
+Package airarrow provides the Apache Arrow support for the Air.
+
+It lives in its own module so that the Apache Arrow dependency stays optional
+for the users of the Air who do not need it.
+*/
+package airarrow
+
+import (
+	"errors"
+
+	"github.com/aofei/air"
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/ipc"
+)
+
+// MIMEType is the MIME type of the Apache Arrow IPC streaming format.
+const MIMEType = "application/vnd.apache.arrow.stream"
+
+// WriteArrow writes an "application/vnd.apache.arrow.stream" content encoded
+// from the records in the Apache Arrow IPC streaming format to the client of
+// the res. All the records must share the same schema, and at least one of them
+// is required.
+//
+// The content is streamed to the `air.Response.Body` of the res, so it goes
+// through the gzip feature of the Air when the `MIMEType` is in the
+// `air.Air.GzipMIMETypes`.
+func WriteArrow(res *air.Response, records ...arrow.Record) error {
+	if len(records) == 0 {
+		return errors.New("airarrow: no records to write")
+	}
+
+	res.Header.Set("Content-Type", MIMEType)
+
+	w := ipc.NewWriter(res.Body, ipc.WithSchema(records[0].Schema()))
+	for _, r := range records {
+		if err := w.Write(r); err != nil {
+			w.Close()
+			return err
+		}
+	}
+
+	return w.Close()
+}
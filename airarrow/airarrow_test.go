@@ -0,0 +1,98 @@
+package airarrow
+
+import (
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aofei/air"
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/ipc"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteArrow(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+	}, nil)
+
+	rb := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+	defer rb.Release()
+
+	rb.Field(0).(*array.Int64Builder).AppendValues([]int64{1, 2, 3}, nil)
+	r1 := rb.NewRecord()
+	defer r1.Release()
+
+	rb.Field(0).(*array.Int64Builder).AppendValues([]int64{4, 5}, nil)
+	r2 := rb.NewRecord()
+	defer r2.Release()
+
+	a := air.New()
+	a.GzipEnabled = true
+	a.GzipMinContentLength = 0
+	a.GzipMIMETypes = append(a.GzipMIMETypes, MIMEType)
+
+	a.GET("/", func(req *air.Request, res *air.Response) error {
+		return WriteArrow(res, r1, r2)
+	})
+
+	a.GET("/empty", func(req *air.Request, res *air.Response) error {
+		return WriteArrow(res)
+	})
+
+	hr := httptest.NewRequest(http.MethodGet, "/", nil)
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+	assert.Equal(t, MIMEType, hrw.Header().Get("Content-Type"))
+
+	ir, err := ipc.NewReader(hrw.Body)
+	assert.NoError(t, err)
+	assert.True(t, ir.Schema().Equal(schema))
+
+	var ids []int64
+	for ir.Next() {
+		col := ir.Record().Column(0).(*array.Int64)
+		ids = append(ids, col.Int64Values()...)
+	}
+
+	assert.NoError(t, ir.Err())
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, ids)
+	ir.Release()
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.Header.Set("Accept-Encoding", "gzip")
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+	assert.Equal(t, "gzip", hrw.Header().Get("Content-Encoding"))
+
+	gr, err := gzip.NewReader(hrw.Body)
+	assert.NoError(t, err)
+
+	ir, err = ipc.NewReader(gr)
+	assert.NoError(t, err)
+
+	n := int64(0)
+	for ir.Next() {
+		n += ir.Record().NumRows()
+	}
+
+	assert.NoError(t, ir.Err())
+	assert.Equal(t, int64(5), n)
+	ir.Release()
+
+	hr = httptest.NewRequest(http.MethodGet, "/empty", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusInternalServerError, hrw.Code)
+}
@@ -0,0 +1,44 @@
+package air
+
+import (
+	"math/rand"
+	"sync/atomic"
+)
+
+// Balancer is used by the `ReverseProxy` to distribute the requests among its
+// `Targets`.
+type Balancer interface {
+	// Pick returns one of the targets for the req. The targets are never
+	// empty and only contain the healthy ones.
+	Pick(targets []string, req *Request) string
+}
+
+// NewRoundRobinBalancer returns a new `Balancer` that picks the targets in
+// turn.
+func NewRoundRobinBalancer() Balancer {
+	return &roundRobinBalancer{}
+}
+
+// roundRobinBalancer is the round-robin `Balancer`.
+type roundRobinBalancer struct {
+	n uint32
+}
+
+// Pick implements the `Balancer`.
+func (rrb *roundRobinBalancer) Pick(targets []string, _ *Request) string {
+	n := atomic.AddUint32(&rrb.n, 1) - 1
+	return targets[n%uint32(len(targets))]
+}
+
+// NewRandomBalancer returns a new `Balancer` that picks the targets at random.
+func NewRandomBalancer() Balancer {
+	return randomBalancer{}
+}
+
+// randomBalancer is the random `Balancer`.
+type randomBalancer struct{}
+
+// Pick implements the `Balancer`.
+func (randomBalancer) Pick(targets []string, _ *Request) string {
+	return targets[rand.Intn(len(targets))]
+}
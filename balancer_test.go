@@ -0,0 +1,31 @@
+package air
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRoundRobinBalancer(t *testing.T) {
+	b := NewRoundRobinBalancer()
+	assert.NotNil(t, b)
+
+	targets := []string{"foo", "bar", "foobar"}
+	assert.Equal(t, "foo", b.Pick(targets, nil))
+	assert.Equal(t, "bar", b.Pick(targets, nil))
+	assert.Equal(t, "foobar", b.Pick(targets, nil))
+	assert.Equal(t, "foo", b.Pick(targets, nil))
+	assert.Equal(t, "foo", b.Pick(targets[:1], nil))
+}
+
+func TestNewRandomBalancer(t *testing.T) {
+	b := NewRandomBalancer()
+	assert.NotNil(t, b)
+
+	targets := []string{"foo", "bar", "foobar"}
+	for i := 0; i < 10; i++ {
+		assert.Contains(t, targets, b.Pick(targets, nil))
+	}
+
+	assert.Equal(t, "foo", b.Pick(targets[:1], nil))
+}
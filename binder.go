@@ -8,7 +8,10 @@ import (
 	"mime"
 	"net/http"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/pelletier/go-toml"
 	"github.com/vmihailenco/msgpack/v5"
@@ -18,7 +21,9 @@ import (
 
 // binder is a binder that binds request based on the MIME types.
 type binder struct {
-	a *Air
+	a                 *Air
+	customBinders     map[string]func(*Request, interface{}) error
+	customBinderMutex sync.RWMutex
 }
 
 // newBinder returns a new instance of the `binder` with the a.
@@ -28,8 +33,17 @@ func newBinder(a *Air) *binder {
 	}
 }
 
-// bind binds the r into the v.
+// bind binds the r into the v and then validates the v.
 func (b *binder) bind(v interface{}, r *Request) error {
+	if err := b.decode(v, r); err != nil {
+		return err
+	}
+
+	return b.validate(v, r)
+}
+
+// decode decodes the r into the v based on the MIME type of the r.
+func (b *binder) decode(v interface{}, r *Request) error {
 	if r.ContentLength == 0 {
 		switch r.Method {
 		case http.MethodGet, http.MethodHead, http.MethodDelete:
@@ -46,6 +60,13 @@ func (b *binder) bind(v interface{}, r *Request) error {
 		return err
 	}
 
+	b.customBinderMutex.RLock()
+	cb := b.customBinders[mt]
+	b.customBinderMutex.RUnlock()
+	if cb != nil {
+		return cb(r, v)
+	}
+
 	switch mt {
 	case "application/json":
 		err = json.NewDecoder(r.Body).Decode(v)
@@ -62,7 +83,16 @@ func (b *binder) bind(v interface{}, r *Request) error {
 		err = toml.NewDecoder(r.Body).Decode(v)
 	case "application/yaml":
 		err = yaml.NewDecoder(r.Body).Decode(v)
-	case "application/x-www-form-urlencoded", "multipart/form-data":
+	case "application/x-www-form-urlencoded":
+		err = b.bindParams(v, r.Params())
+	case "multipart/form-data":
+		if r.multipartReaderUsed {
+			return errors.New(
+				"air: multipart body has been read by the " +
+					"multipart reader",
+			)
+		}
+
 		err = b.bindParams(v, r.Params())
 	default:
 		r.res.Status = http.StatusUnsupportedMediaType
@@ -72,6 +102,49 @@ func (b *binder) bind(v interface{}, r *Request) error {
 	return err
 }
 
+// register registers the fn as the binder for the mimeType. A nil fn
+// unregisters the binder of the mimeType.
+func (b *binder) register(
+	mimeType string,
+	fn func(*Request, interface{}) error,
+) {
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+
+	b.customBinderMutex.Lock()
+	defer b.customBinderMutex.Unlock()
+
+	if fn == nil {
+		delete(b.customBinders, mimeType)
+		return
+	}
+
+	if b.customBinders == nil {
+		b.customBinders = map[string]func(*Request, interface{}) error{}
+	}
+
+	b.customBinders[mimeType] = fn
+}
+
+// validate validates the v that has been bound from the r by its own
+// `Validate() error` method (if any) and the `Air.Validator` (if any).
+func (b *binder) validate(v interface{}, r *Request) error {
+	if vv, ok := v.(interface{ Validate() error }); ok {
+		if err := vv.Validate(); err != nil {
+			r.res.Status = http.StatusBadRequest
+			return err
+		}
+	}
+
+	if b.a.Validator != nil {
+		if err := b.a.Validator(v); err != nil {
+			r.res.Status = http.StatusBadRequest
+			return err
+		}
+	}
+
+	return nil
+}
+
 // bindParams binds the ps into the v.
 func (b *binder) bindParams(v interface{}, ps []*RequestParam) error {
 	t := reflect.TypeOf(v).Elem()
@@ -79,6 +152,15 @@ func (b *binder) bindParams(v interface{}, ps []*RequestParam) error {
 		return errors.New("air: binding element must be a struct")
 	}
 
+	if b.a.FormBindStyle == BracketFormBindStyle {
+		root := &formNode{}
+		for _, p := range ps {
+			root.insert(parseFormKeys(p.Name), p.Values)
+		}
+
+		return b.bindFormNode(reflect.ValueOf(v).Elem(), root)
+	}
+
 	val := reflect.ValueOf(v).Elem()
 	for i := 0; i < t.NumField(); i++ {
 		vf := val.Field(i)
@@ -103,63 +185,284 @@ func (b *binder) bindParams(v interface{}, ps []*RequestParam) error {
 
 		lpn := strings.ToLower(pn)
 
-		var pv *RequestParamValue
+		var param *RequestParam
 		for _, p := range ps {
 			if p.Name == pn {
-				pv = p.Value()
+				param = p
 				break
-			} else if p.Name == lpn && pv == nil {
-				pv = p.Value()
+			} else if p.Name == lpn && param == nil {
+				param = p
 			}
 		}
 
-		if pv == nil {
+		if param.Value() == nil {
 			continue
 		}
 
-		switch tf.Type.Kind() {
-		case reflect.Bool:
-			b, err := pv.Bool()
-			if err != nil {
-				return err
+		if vf.Kind() == reflect.Slice {
+			s := reflect.MakeSlice(
+				vf.Type(),
+				len(param.Values),
+				len(param.Values),
+			)
+			for j, pv := range param.Values {
+				if err := setParamValue(s.Index(j), pv); err != nil {
+					return err
+				}
 			}
 
-			vf.SetBool(b)
-		case reflect.Int,
-			reflect.Int8,
-			reflect.Int16,
-			reflect.Int32,
-			reflect.Int64:
-			i64, err := pv.Int64()
-			if err != nil {
-				return err
+			vf.Set(s)
+
+			continue
+		}
+
+		if err := setParamValue(vf, param.Value()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bindFormNode binds the fn into the v.
+func (b *binder) bindFormNode(v reflect.Value, fn *formNode) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+
+		return b.bindFormNode(v.Elem(), fn)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			vf := v.Field(i)
+			if !vf.CanSet() {
+				continue
 			}
 
-			vf.SetInt(i64)
-		case reflect.Uint,
-			reflect.Uint8,
-			reflect.Uint16,
-			reflect.Uint32,
-			reflect.Uint64:
-			ui64, err := pv.Uint64()
-			if err != nil {
-				return err
+			tf := t.Field(i)
+			pn := tf.Tag.Get("param")
+			if pn == "" {
+				pn = tf.Name
+				if vf.Kind() == reflect.Struct && fn.child(pn) == nil {
+					if err := b.bindFormNode(vf, fn); err != nil {
+						return err
+					}
+
+					continue
+				}
+			}
+
+			if c := fn.child(pn); c != nil {
+				if err := b.bindFormNode(vf, c); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	case reflect.Slice:
+		elems := make([]*formNode, 0, len(fn.values))
+		for _, pv := range fn.values {
+			elems = append(elems, &formNode{
+				values: []*RequestParamValue{pv},
+			})
+		}
+
+		indexes := make([]int, 0, len(fn.keys))
+		indexedElems := make(map[int]*formNode, len(fn.keys))
+		for _, k := range fn.keys {
+			if k == "" {
+				for _, pv := range fn.children[k].values {
+					elems = append(elems, &formNode{
+						values: []*RequestParamValue{pv},
+					})
+				}
+
+				continue
+			}
+
+			i, err := strconv.Atoi(k)
+			if err != nil || i < 0 {
+				return errors.New("air: invalid binding index: " + k)
+			} else if _, ok := indexedElems[i]; ok {
+				return errors.New("air: duplicate binding index: " + k)
 			}
 
-			vf.SetUint(ui64)
-		case reflect.Float32, reflect.Float64:
-			f64, err := pv.Float64()
-			if err != nil {
+			indexes = append(indexes, i)
+			indexedElems[i] = fn.children[k]
+		}
+
+		// Only the order of the indexes matters, so sparse indexes
+		// never cause large allocations.
+		sort.Ints(indexes)
+		for _, i := range indexes {
+			elems = append(elems, indexedElems[i])
+		}
+
+		s := reflect.MakeSlice(v.Type(), len(elems), len(elems))
+		for i, e := range elems {
+			if err := b.bindFormNode(s.Index(i), e); err != nil {
 				return err
 			}
+		}
 
-			vf.SetFloat(f64)
-		case reflect.String:
-			vf.SetString(pv.String())
-		default:
+		v.Set(s)
+
+		return nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
 			return errors.New("air: unknown binding type")
 		}
+
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+
+		for _, k := range fn.keys {
+			ev := reflect.New(v.Type().Elem()).Elem()
+			if err := b.bindFormNode(ev, fn.children[k]); err != nil {
+				return err
+			}
+
+			v.SetMapIndex(reflect.ValueOf(k).Convert(v.Type().Key()), ev)
+		}
+
+		return nil
+	}
+
+	if len(fn.values) == 0 {
+		return nil
+	}
+
+	return setParamValue(v, fn.values[0])
+}
+
+// setParamValue sets the pv into the v.
+func setParamValue(v reflect.Value, pv *RequestParamValue) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := pv.Bool()
+		if err != nil {
+			return err
+		}
+
+		v.SetBool(b)
+	case reflect.Int,
+		reflect.Int8,
+		reflect.Int16,
+		reflect.Int32,
+		reflect.Int64:
+		i64, err := pv.Int64()
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(i64)
+	case reflect.Uint,
+		reflect.Uint8,
+		reflect.Uint16,
+		reflect.Uint32,
+		reflect.Uint64:
+		ui64, err := pv.Uint64()
+		if err != nil {
+			return err
+		}
+
+		v.SetUint(ui64)
+	case reflect.Float32, reflect.Float64:
+		f64, err := pv.Float64()
+		if err != nil {
+			return err
+		}
+
+		v.SetFloat(f64)
+	case reflect.String:
+		v.SetString(pv.String())
+	default:
+		return errors.New("air: unknown binding type")
 	}
 
 	return nil
 }
+
+// formNode is a node of the tree built from the request params by the
+// `BracketFormBindStyle`.
+type formNode struct {
+	values   []*RequestParamValue
+	keys     []string
+	children map[string]*formNode
+}
+
+// insert inserts the values into the fn at the path of the keys.
+func (fn *formNode) insert(keys []string, values []*RequestParamValue) {
+	n := fn
+	for _, k := range keys {
+		if n.children == nil {
+			n.children = map[string]*formNode{}
+		}
+
+		c, ok := n.children[k]
+		if !ok {
+			c = &formNode{}
+			n.children[k] = c
+			n.keys = append(n.keys, k)
+		}
+
+		n = c
+	}
+
+	n.values = append(n.values, values...)
+}
+
+// child returns the child of the fn for the name. The lowercase name is tried
+// if the name itself is not found. It returns nil if not found.
+func (fn *formNode) child(name string) *formNode {
+	if c, ok := fn.children[name]; ok {
+		return c
+	}
+
+	return fn.children[strings.ToLower(name)]
+}
+
+// parseFormKeys parses the name in the bracket (and dot) notation into keys.
+// The name itself is the only key if it is malformed.
+//
+// E.g.: "items[0][name]" -> ["items", "0", "name"]
+func parseFormKeys(name string) []string {
+	i := strings.IndexAny(name, "[.")
+	if i <= 0 {
+		return []string{name}
+	}
+
+	keys := []string{name[:i]}
+	for rest := name[i:]; rest != ""; {
+		switch rest[0] {
+		case '[':
+			j := strings.IndexByte(rest, ']')
+			if j < 0 {
+				return []string{name}
+			}
+
+			keys = append(keys, rest[1:j])
+			rest = rest[j+1:]
+		case '.':
+			j := strings.IndexAny(rest[1:], "[.")
+			if j < 0 {
+				j = len(rest) - 1
+			}
+
+			if j == 0 {
+				return []string{name}
+			}
+
+			keys = append(keys, rest[1:j+1])
+			rest = rest[j+1:]
+		default:
+			return []string{name}
+		}
+	}
+
+	return keys
+}
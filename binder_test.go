@@ -2,6 +2,7 @@ package air
 
 import (
 	"bytes"
+	"errors"
 	"mime/multipart"
 	"net/http"
 	"net/url"
@@ -398,3 +399,190 @@ func TestBindFormData(t *testing.T) {
 	assert.Equal(t, "bar", f.Foo)
 	assert.Equal(t, "foo", f.Bar)
 }
+
+func TestBindBracketFormBindStyle(t *testing.T) {
+	a := New()
+	a.FormBindStyle = BracketFormBindStyle
+	b := a.binder
+
+	type item struct {
+		Name  string `param:"name"`
+		Count int    `param:"count"`
+	}
+
+	type foobar struct {
+		A   []string `param:"a"`
+		B   []int    `param:"b"`
+		Obj struct {
+			Field string `param:"field"`
+		} `param:"obj"`
+		Items []item            `param:"items"`
+		Ptr   *item             `param:"ptr"`
+		Map   map[string]string `param:"map"`
+		Foo   string
+	}
+
+	vs := url.Values{}
+	vs.Add("a[0]", "x")
+	vs.Add("a[1]", "y")
+	vs.Add("b[]", "1")
+	vs.Add("b[]", "2")
+	vs.Add("obj[field]", "v")
+	vs.Add("items[1][name]", "bar")
+	vs.Add("items[0].name", "foo")
+	vs.Add("items[0][count]", "2")
+	vs.Add("ptr.name", "baz")
+	vs.Add("map[foo]", "bar")
+	vs.Add("foo", "bar")
+
+	req, _, _ := fakeRRCycle(
+		a,
+		http.MethodPost,
+		"/foobar",
+		strings.NewReader(vs.Encode()),
+	)
+	req.Header.Set(
+		"Content-Type",
+		"application/x-www-form-urlencoded; charset=utf-8",
+	)
+
+	f := foobar{}
+	assert.NoError(t, b.bind(&f, req))
+	assert.Equal(t, []string{"x", "y"}, f.A)
+	assert.Equal(t, []int{1, 2}, f.B)
+	assert.Equal(t, "v", f.Obj.Field)
+	assert.Equal(t, []item{
+		{Name: "foo", Count: 2},
+		{Name: "bar"},
+	}, f.Items)
+	assert.Equal(t, &item{Name: "baz"}, f.Ptr)
+	assert.Equal(t, map[string]string{"foo": "bar"}, f.Map)
+	assert.Equal(t, "bar", f.Foo)
+
+	req, _, _ = fakeRRCycle(a, http.MethodGet, "/foobar?a[x]=y", nil)
+
+	f = foobar{}
+	assert.Error(t, b.bind(&f, req))
+
+	req, _, _ = fakeRRCycle(
+		a,
+		http.MethodGet,
+		"/foobar?items[0][count]=foo",
+		nil,
+	)
+
+	f = foobar{}
+	assert.Error(t, b.bind(&f, req))
+
+	a = New()
+	b = a.binder
+
+	req, _, _ = fakeRRCycle(a, http.MethodGet, "/foobar?obj[field]=v", nil)
+
+	f = foobar{}
+	assert.NoError(t, b.bind(&f, req))
+	assert.Empty(t, f.Obj.Field)
+}
+
+func TestBindValidation(t *testing.T) {
+	a := New()
+	b := a.binder
+
+	req, res, _ := fakeRRCycle(
+		a,
+		http.MethodPost,
+		"/foobar",
+		strings.NewReader(`{"foo": ""}`),
+	)
+	req.Header.Set("Content-Type", "application/json")
+
+	vf := validatableFoobar{}
+	assert.EqualError(t, b.bind(&vf, req), "foo cannot be empty")
+	assert.Equal(t, http.StatusBadRequest, res.Status)
+
+	a.Validator = func(v interface{}) error {
+		if v.(*validatableFoobar).Foo == "bar" {
+			return errors.New("foo cannot be bar")
+		}
+
+		return nil
+	}
+
+	req, res, _ = fakeRRCycle(
+		a,
+		http.MethodPost,
+		"/foobar",
+		strings.NewReader(`{"foo": "bar"}`),
+	)
+	req.Header.Set("Content-Type", "application/json")
+
+	vf = validatableFoobar{}
+	assert.EqualError(t, b.bind(&vf, req), "foo cannot be bar")
+	assert.Equal(t, http.StatusBadRequest, res.Status)
+
+	req, res, _ = fakeRRCycle(
+		a,
+		http.MethodPost,
+		"/foobar",
+		strings.NewReader(`{"foo": "foobar"}`),
+	)
+	req.Header.Set("Content-Type", "application/json")
+
+	vf = validatableFoobar{}
+	assert.NoError(t, b.bind(&vf, req))
+	assert.Equal(t, "foobar", vf.Foo)
+	assert.Equal(t, http.StatusOK, res.Status)
+
+	req, _, _ = fakeRRCycle(
+		a,
+		http.MethodPost,
+		"/foobar",
+		strings.NewReader(`{"foo": "bar"`),
+	)
+	req.Header.Set("Content-Type", "application/json")
+
+	validated := false
+	a.Validator = func(interface{}) error {
+		validated = true
+		return nil
+	}
+
+	vf = validatableFoobar{}
+	assert.Error(t, b.bind(&vf, req))
+	assert.False(t, validated)
+}
+
+func TestParseFormKeys(t *testing.T) {
+	assert.Equal(t, []string{"foo"}, parseFormKeys("foo"))
+	assert.Equal(t, []string{"a", "0"}, parseFormKeys("a[0]"))
+	assert.Equal(t, []string{"a", ""}, parseFormKeys("a[]"))
+	assert.Equal(t, []string{"obj", "field"}, parseFormKeys("obj[field]"))
+	assert.Equal(
+		t,
+		[]string{"items", "0", "name"},
+		parseFormKeys("items[0][name]"),
+	)
+	assert.Equal(
+		t,
+		[]string{"items", "0", "name"},
+		parseFormKeys("items[0].name"),
+	)
+	assert.Equal(t, []string{"a", "b", "c"}, parseFormKeys("a.b.c"))
+	assert.Equal(t, []string{"[0]"}, parseFormKeys("[0]"))
+	assert.Equal(t, []string{"a[0"}, parseFormKeys("a[0"))
+	assert.Equal(t, []string{"a."}, parseFormKeys("a."))
+	assert.Equal(t, []string{"a..b"}, parseFormKeys("a..b"))
+	assert.Equal(t, []string{"a[0]b"}, parseFormKeys("a[0]b"))
+}
+
+type validatableFoobar struct {
+	Foo string `json:"foo"`
+}
+
+func (vf *validatableFoobar) Validate() error {
+	if vf.Foo == "" {
+		return errors.New("foo cannot be empty")
+	}
+
+	return nil
+}
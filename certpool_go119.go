@@ -0,0 +1,11 @@
+//go:build go1.19
+// +build go1.19
+
+package air
+
+import "crypto/x509"
+
+// cloneCertPool returns a copy of the p.
+func cloneCertPool(p *x509.CertPool) *x509.CertPool {
+	return p.Clone()
+}
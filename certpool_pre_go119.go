@@ -0,0 +1,12 @@
+//go:build !go1.19
+// +build !go1.19
+
+package air
+
+import "crypto/x509"
+
+// cloneCertPool returns a copy of the p. It always returns nil since the
+// `x509.CertPool` cannot be copied before Go 1.19.
+func cloneCertPool(p *x509.CertPool) *x509.CertPool {
+	return nil
+}
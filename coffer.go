@@ -27,13 +27,20 @@ type coffer struct {
 	watcher   *fsnotify.Watcher
 	assets    sync.Map
 	cache     *fastcache.Cache
+
+	// generations records how many times each asset file has changed. It
+	// is used to prevent an asset file that has changed while being loaded
+	// from being stored with its stale content.
+	generations     map[string]uint64
+	generationMutex sync.Mutex
 }
 
 // newCoffer returns a new instance of the `coffer` with the a.
 func newCoffer(a *Air) *coffer {
 	return &coffer{
-		a:        a,
-		loadOnce: &sync.Once{},
+		a:           a,
+		loadOnce:    &sync.Once{},
+		generations: map[string]uint64{},
 	}
 }
 
@@ -45,7 +52,7 @@ func (c *coffer) load() {
 		}
 	}()
 
-	if c.watcher == nil {
+	if c.watcher == nil && c.a.CofferWatchEnabled && !c.a.TestMode {
 		c.watcher, c.loadError = fsnotify.NewWatcher()
 		if c.loadError != nil {
 			return
@@ -55,6 +62,10 @@ func (c *coffer) load() {
 			for {
 				select {
 				case e := <-c.watcher.Events:
+					c.generationMutex.Lock()
+					c.generations[e.Name]++
+					c.generationMutex.Unlock()
+
 					ai, ok := c.assets.Load(e.Name)
 					if !ok {
 						break
@@ -103,6 +114,17 @@ func (c *coffer) asset(name string) (*asset, error) {
 		return nil, err
 	}
 
+	// Watch the asset file before reading it so that no change is missed.
+	if c.watcher != nil {
+		if err := c.watcher.Add(name); err != nil {
+			return nil, err
+		}
+	}
+
+	c.generationMutex.Lock()
+	generation := c.generations[name]
+	c.generationMutex.Unlock()
+
 	b, err := ioutil.ReadFile(name)
 	if err != nil {
 		return nil, err
@@ -149,10 +171,6 @@ func (c *coffer) asset(name string) (*asset, error) {
 		gb = buf.Bytes()
 	}
 
-	if err := c.watcher.Add(name); err != nil {
-		return nil, err
-	}
-
 	a := &asset{
 		coffer:   c,
 		name:     name,
@@ -171,7 +189,12 @@ func (c *coffer) asset(name string) (*asset, error) {
 		c.cache.SetBig(a.gzippedDigest, gb)
 	}
 
-	c.assets.Store(name, a)
+	c.generationMutex.Lock()
+	if c.generations[name] == generation {
+		c.assets.Store(name, a)
+	}
+
+	c.generationMutex.Unlock()
 
 	return a, nil
 }
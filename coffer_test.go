@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/VictoriaMetrics/fastcache"
 	"github.com/stretchr/testify/assert"
@@ -19,6 +20,7 @@ func TestNewCoffer(t *testing.T) {
 	assert.NotNil(t, c.loadOnce)
 	assert.Nil(t, c.watcher)
 	assert.Nil(t, c.cache)
+	assert.NotNil(t, c.generations)
 }
 
 func TestCofferLoad(t *testing.T) {
@@ -29,6 +31,32 @@ func TestCofferLoad(t *testing.T) {
 	assert.Nil(t, c.loadError)
 	assert.NotNil(t, c.watcher)
 	assert.NotNil(t, c.cache)
+
+	a = New()
+	a.TestMode = true
+	c = a.coffer
+
+	c.load()
+	assert.Nil(t, c.loadError)
+	assert.Nil(t, c.watcher)
+	assert.NotNil(t, c.cache)
+
+	dir, err := ioutil.TempDir("", "air.TestCofferLoad")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, dir)
+	defer os.RemoveAll(dir)
+
+	a.CofferAssetRoot = dir
+
+	assert.NoError(t, ioutil.WriteFile(
+		filepath.Join(a.CofferAssetRoot, "test.css"),
+		[]byte("body{}"),
+		os.ModePerm,
+	))
+
+	ca, err := c.asset(filepath.Join(a.CofferAssetRoot, "test.css"))
+	assert.NoError(t, err)
+	assert.NotNil(t, ca)
 }
 
 func TestCofferAsset(t *testing.T) {
@@ -89,6 +117,66 @@ func TestCofferAsset(t *testing.T) {
 	assert.Nil(t, a6)
 }
 
+func TestCofferAssetReload(t *testing.T) {
+	a := New()
+
+	dir, err := ioutil.TempDir("", "air.TestCofferAssetReload")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, dir)
+	defer os.RemoveAll(dir)
+
+	a.CofferAssetRoot = dir
+
+	c := a.coffer
+	name := filepath.Join(a.CofferAssetRoot, "test.css")
+
+	assert.NoError(t, ioutil.WriteFile(name, []byte("a{}"), os.ModePerm))
+
+	a1, err := c.asset(name)
+	assert.NoError(t, err)
+	assert.NotNil(t, a1)
+	assert.Equal(t, "a{}", string(a1.content(false)))
+
+	assert.NoError(t, ioutil.WriteFile(name, []byte("b{}"), os.ModePerm))
+
+	var a2 *asset
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		a2, err = c.asset(name)
+		assert.NoError(t, err)
+		assert.NotNil(t, a2)
+		if a2 != a1 || time.Now().After(deadline) {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.NotEqual(t, a1.digest, a2.digest)
+	assert.Equal(t, "b{}", string(a2.content(false)))
+
+	a3, err := c.asset(name)
+	assert.NoError(t, err)
+	assert.Same(t, a2, a3)
+
+	a = New()
+	a.CofferAssetRoot = dir
+	a.CofferWatchEnabled = false
+
+	c = a.coffer
+
+	a1, err = c.asset(name)
+	assert.NoError(t, err)
+	assert.NotNil(t, a1)
+	assert.Nil(t, c.watcher)
+
+	assert.NoError(t, ioutil.WriteFile(name, []byte("c{}"), os.ModePerm))
+
+	a2, err = c.asset(name)
+	assert.NoError(t, err)
+	assert.Same(t, a1, a2)
+	assert.Equal(t, "b{}", string(a2.content(false)))
+}
+
 func TestAssetContent(t *testing.T) {
 	a := New()
 	a.MinifierEnabled = true
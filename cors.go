@@ -0,0 +1,200 @@
+package air
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// CORSConfig is the configuration of the `CORSGas`. See
+// https://fetch.spec.whatwg.org/#http-cors-protocol.
+type CORSConfig struct {
+	// AllowOrigins is the list of origins (such as "https://example.com")
+	// that are allowed to make cross-origin requests. The "*" allows all
+	// origins.
+	//
+	// If the `AllowOrigins` is empty and the `AllowOriginFunc` is nil, all
+	// origins are allowed.
+	AllowOrigins []string
+
+	// AllowOriginFunc is the function that reports whether the origin is
+	// allowed to make cross-origin requests. It is consulted for the
+	// origins that are not in the `AllowOrigins`.
+	AllowOriginFunc func(origin string) bool
+
+	// AllowMethods is the list of methods sent as the
+	// Access-Control-Allow-Methods header of the preflight responses.
+	//
+	// If the `AllowMethods` is empty, the GET, HEAD, POST, PUT, PATCH and
+	// DELETE are used.
+	AllowMethods []string
+
+	// AllowHeaders is the list of headers sent as the
+	// Access-Control-Allow-Headers header of the preflight responses.
+	//
+	// If the `AllowHeaders` is empty, the Access-Control-Request-Headers
+	// header of each preflight request is reflected.
+	AllowHeaders []string
+
+	// ExposeHeaders is the list of headers sent as the
+	// Access-Control-Expose-Headers header of the non-preflight responses.
+	ExposeHeaders []string
+
+	// MaxAge is how long the results of the preflight requests can be
+	// cached. It is sent as the Access-Control-Max-Age header in seconds. A
+	// non-positive `MaxAge` is not sent.
+	MaxAge time.Duration
+
+	// AllowCredentials indicates whether the cross-origin requests are
+	// allowed to include the credentials (such as cookies). It is sent as
+	// the Access-Control-Allow-Credentials header.
+	//
+	// Note that the Access-Control-Allow-Origin header is always the
+	// origin of the request (instead of the "*") when the
+	// `AllowCredentials` is true. So the `AllowCredentials` cannot be true
+	// when all origins are allowed, which means the allowed origins must be
+	// explicitly set via the `AllowOrigins` (without the "*") or the
+	// `AllowOriginFunc`.
+	AllowCredentials bool
+}
+
+// CORSGas returns a `Gas` that handles the cross-origin requests with the
+// policy of the config.
+//
+// The preflight requests (the OPTIONS requests with the
+// Access-Control-Request-Method header) are answered by the `CORSGas` itself
+// with the `http.StatusNoContent` and never reach the next `Handler`. It is
+// recommended to use it as a pregas so that the preflight requests are
+// answered before routing. When it is used in the `Air.Gases`, the preflight
+// requests to the routes without an OPTIONS method, which would otherwise be
+// handled by the `Air.MethodNotAllowedHandler`, are answered as well. But a
+// route-level `CORSGas` only sees the requests routed to its own route and
+// method, so it never answers the preflight requests to a route without an
+// OPTIONS method (not even when the `Air.AutoOptionsForCORS` is true).
+//
+// A Vary header with the Origin is always added to the responses, since they
+// depend on the Origin header of the requests.
+//
+// It panics if the `CORSConfig.AllowCredentials` is true while all origins are
+// allowed.
+func CORSGas(config CORSConfig) Gas {
+	allowAllOrigins := len(config.AllowOrigins) == 0 &&
+		config.AllowOriginFunc == nil
+	allowOrigins := make(map[string]bool, len(config.AllowOrigins))
+	for _, o := range config.AllowOrigins {
+		if o == "*" {
+			allowAllOrigins = true
+		}
+
+		allowOrigins[strings.ToLower(o)] = true
+	}
+
+	if allowAllOrigins && config.AllowCredentials {
+		panic("air: cors credentials cannot be allowed for all origins")
+	}
+
+	allowMethods := strings.Join(config.AllowMethods, ", ")
+	if allowMethods == "" {
+		allowMethods = strings.Join([]string{
+			http.MethodGet,
+			http.MethodHead,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+		}, ", ")
+	}
+
+	allowHeaders := strings.Join(config.AllowHeaders, ", ")
+	exposeHeaders := strings.Join(config.ExposeHeaders, ", ")
+
+	maxAge := ""
+	if config.MaxAge > 0 {
+		maxAge = strconv.FormatInt(int64(config.MaxAge/time.Second), 10)
+	}
+
+	allowed := func(origin string) bool {
+		return allowAllOrigins ||
+			allowOrigins[strings.ToLower(origin)] ||
+			config.AllowOriginFunc != nil &&
+				config.AllowOriginFunc(origin)
+	}
+
+	return func(next Handler) Handler {
+		return func(req *Request, res *Response) error {
+			addVary(res.Header, "Origin")
+
+			origin := req.Header.Get("Origin")
+			preflight := req.Method == http.MethodOptions &&
+				req.Header.Get("Access-Control-Request-Method") != ""
+			if preflight {
+				addVary(res.Header, "Access-Control-Request-Method")
+				addVary(res.Header, "Access-Control-Request-Headers")
+			}
+
+			if origin == "" || !allowed(origin) {
+				if preflight {
+					res.Status = http.StatusNoContent
+					return res.Write(nil)
+				}
+
+				return next(req, res)
+			}
+
+			if allowAllOrigins {
+				res.Header.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				res.Header.Set("Access-Control-Allow-Origin", origin)
+			}
+
+			if config.AllowCredentials {
+				res.Header.Set(
+					"Access-Control-Allow-Credentials",
+					"true",
+				)
+			}
+
+			if !preflight {
+				if exposeHeaders != "" {
+					res.Header.Set(
+						"Access-Control-Expose-Headers",
+						exposeHeaders,
+					)
+				}
+
+				return next(req, res)
+			}
+
+			res.Header.Set("Access-Control-Allow-Methods", allowMethods)
+
+			if allowHeaders != "" {
+				res.Header.Set(
+					"Access-Control-Allow-Headers",
+					allowHeaders,
+				)
+			} else if rh := req.Header.Get(
+				"Access-Control-Request-Headers",
+			); rh != "" {
+				res.Header.Set("Access-Control-Allow-Headers", rh)
+			}
+
+			if maxAge != "" {
+				res.Header.Set("Access-Control-Max-Age", maxAge)
+			}
+
+			res.Status = http.StatusNoContent
+
+			return res.Write(nil)
+		}
+	}
+}
+
+// addVary adds the name to the Vary header in the h if it is not there yet.
+func addVary(h http.Header, name string) {
+	if !httpguts.HeaderValuesContainsToken(h["Vary"], name) {
+		h.Add("Vary", name)
+	}
+}
@@ -0,0 +1,217 @@
+package air
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORSGas(t *testing.T) {
+	a := New()
+	a.Pregases = []Gas{CORSGas(CORSConfig{})}
+
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	})
+
+	hr := httptest.NewRequest(http.MethodGet, "/", nil)
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+	assert.Equal(t, "Origin", hrw.Header().Get("Vary"))
+	assert.Empty(t, hrw.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Foobar", hrw.Body.String())
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.Header.Set("Origin", "https://example.com")
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+	assert.Equal(t, "*", hrw.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Foobar", hrw.Body.String())
+
+	hr = httptest.NewRequest(http.MethodOptions, "/", nil)
+	hr.Header.Set("Origin", "https://example.com")
+	hr.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	hr.Header.Set("Access-Control-Request-Headers", "X-Foo")
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusNoContent, hrw.Code)
+	assert.Equal(t, "*", hrw.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(
+		t,
+		"GET, HEAD, POST, PUT, PATCH, DELETE",
+		hrw.Header().Get("Access-Control-Allow-Methods"),
+	)
+	assert.Equal(t, "X-Foo", hrw.Header().Get("Access-Control-Allow-Headers"))
+	assert.Empty(t, hrw.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(
+		t,
+		"Origin, Access-Control-Request-Method, "+
+			"Access-Control-Request-Headers",
+		strings.Join(hrw.Header()["Vary"], ", "),
+	)
+	assert.Empty(t, hrw.Body.String())
+
+	a = New()
+	a.Gases = []Gas{CORSGas(CORSConfig{
+		AllowOrigins: []string{"https://example.com"},
+		AllowOriginFunc: func(origin string) bool {
+			return strings.HasSuffix(origin, ".example.com")
+		},
+		AllowMethods:     []string{http.MethodGet, http.MethodPost},
+		AllowHeaders:     []string{"X-Foo", "X-Bar"},
+		ExposeHeaders:    []string{"X-Foobar"},
+		MaxAge:           time.Hour,
+		AllowCredentials: true,
+	})}
+
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	})
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.Header.Set("Origin", "https://EXAMPLE.com")
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+	assert.Equal(
+		t,
+		"https://EXAMPLE.com",
+		hrw.Header().Get("Access-Control-Allow-Origin"),
+	)
+	assert.Equal(
+		t,
+		"true",
+		hrw.Header().Get("Access-Control-Allow-Credentials"),
+	)
+	assert.Equal(
+		t,
+		"X-Foobar",
+		hrw.Header().Get("Access-Control-Expose-Headers"),
+	)
+
+	hr = httptest.NewRequest(http.MethodOptions, "/", nil)
+	hr.Header.Set("Origin", "https://foo.example.com")
+	hr.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusNoContent, hrw.Code)
+	assert.Equal(
+		t,
+		"https://foo.example.com",
+		hrw.Header().Get("Access-Control-Allow-Origin"),
+	)
+	assert.Equal(
+		t,
+		"GET, POST",
+		hrw.Header().Get("Access-Control-Allow-Methods"),
+	)
+	assert.Equal(
+		t,
+		"X-Foo, X-Bar",
+		hrw.Header().Get("Access-Control-Allow-Headers"),
+	)
+	assert.Equal(t, "3600", hrw.Header().Get("Access-Control-Max-Age"))
+	assert.Empty(t, hrw.Header().Get("Access-Control-Expose-Headers"))
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.Header.Set("Origin", "https://example.org")
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+	assert.Empty(t, hrw.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Foobar", hrw.Body.String())
+
+	hr = httptest.NewRequest(http.MethodOptions, "/", nil)
+	hr.Header.Set("Origin", "https://example.org")
+	hr.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusNoContent, hrw.Code)
+	assert.Empty(t, hrw.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, hrw.Header().Get("Access-Control-Allow-Methods"))
+
+	hr = httptest.NewRequest(http.MethodOptions, "/", nil)
+	hr.Header.Set("Origin", "https://example.com")
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, hrw.Code)
+
+	assert.Panics(t, func() {
+		CORSGas(CORSConfig{AllowCredentials: true})
+	})
+	assert.Panics(t, func() {
+		CORSGas(CORSConfig{
+			AllowOrigins:     []string{"https://example.com", "*"},
+			AllowCredentials: true,
+		})
+	})
+}
+
+func TestCORSGasRouteLevel(t *testing.T) {
+	cg := CORSGas(CORSConfig{
+		AllowOrigins: []string{"https://example.com"},
+	})
+
+	a := New()
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	}, cg)
+
+	hr := httptest.NewRequest(http.MethodOptions, "/", nil)
+	hr.Header.Set("Origin", "https://example.com")
+	hr.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, hrw.Code)
+	assert.Empty(t, hrw.Header().Get("Access-Control-Allow-Origin"))
+
+	a = New()
+	a.AutoOptionsForCORS = true
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	}, cg)
+
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusNoContent, hrw.Code)
+	assert.Empty(t, hrw.Header().Get("Access-Control-Allow-Origin"))
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.Header.Set("Origin", "https://example.com")
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+	assert.Equal(
+		t,
+		"https://example.com",
+		hrw.Header().Get("Access-Control-Allow-Origin"),
+	)
+}
@@ -0,0 +1,84 @@
+package air
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a server-sent event. See
+// https://html.spec.whatwg.org/multipage/server-sent-events.html.
+type Event struct {
+	// ID is the ID of the event. It is sent as the "id" field.
+	//
+	// The CR, LF and NUL characters are removed from the `ID` since they
+	// are not allowed in the "id" field.
+	ID string
+
+	// Type is the type of the event. It is sent as the "event" field.
+	//
+	// The CR and LF characters are removed from the `Type`.
+	Type string
+
+	// Data is the data of the event. It is sent as one "data" field per
+	// line.
+	Data string
+
+	// Retry is the reconnection time of the event. It is sent as the
+	// "retry" field in milliseconds. A non-positive `Retry` is not sent.
+	Retry time.Duration
+}
+
+// encode returns the wire format of the e.
+func (e *Event) encode() []byte {
+	buf := bytes.Buffer{}
+	if e.ID != "" {
+		buf.WriteString("id: ")
+		buf.WriteString(strings.Map(func(r rune) rune {
+			switch r {
+			case '\r', '\n', 0:
+				return -1
+			}
+
+			return r
+		}, e.ID))
+		buf.WriteByte('\n')
+	}
+
+	if e.Type != "" {
+		buf.WriteString("event: ")
+		buf.WriteString(strings.Map(func(r rune) rune {
+			switch r {
+			case '\r', '\n':
+				return -1
+			}
+
+			return r
+		}, e.Type))
+		buf.WriteByte('\n')
+	}
+
+	if e.Retry > 0 {
+		buf.WriteString("retry: ")
+		buf.WriteString(strconv.FormatInt(
+			int64(e.Retry/time.Millisecond),
+			10,
+		))
+		buf.WriteByte('\n')
+	}
+
+	if e.Data != "" || buf.Len() == 0 {
+		data := strings.Replace(e.Data, "\r\n", "\n", -1)
+		data = strings.Replace(data, "\r", "\n", -1)
+		for _, line := range strings.Split(data, "\n") {
+			buf.WriteString("data: ")
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+	}
+
+	buf.WriteByte('\n')
+
+	return buf.Bytes()
+}
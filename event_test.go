@@ -0,0 +1,35 @@
+package air
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventEncode(t *testing.T) {
+	assert.Equal(t, "data: \n\n", string((&Event{}).encode()))
+	assert.Equal(
+		t,
+		"data: foobar\n\n",
+		string((&Event{Data: "foobar"}).encode()),
+	)
+	assert.Equal(
+		t,
+		"id: 1\nevent: foo\nretry: 1500\ndata: foo\ndata: bar\ndata: \n\n",
+		string((&Event{
+			ID:    "1",
+			Type:  "foo",
+			Data:  "foo\r\nbar\r",
+			Retry: 1500 * time.Millisecond,
+		}).encode()),
+	)
+	assert.Equal(
+		t,
+		"id: foobar\nevent: foobar\n\n",
+		string((&Event{
+			ID:   "foo\r\n\x00bar",
+			Type: "foo\nbar",
+		}).encode()),
+	)
+}
@@ -0,0 +1,118 @@
+//go:build go1.16
+// +build go1.16
+
+package air
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// FILESFS registers some new GET and HEAD route pairs with the path prefix in
+// the router of the a to serve the static files from the fsys (such as an
+// `embed.FS`) with the optional route-level gases.
+//
+// The prefix may consit of STATIC and PARAM components, but it must not contain
+// ANY component.
+//
+// The gases is always FILO.
+func (a *Air) FILESFS(prefix string, fsys fs.FS, gases ...Gas) {
+	if strings.HasSuffix(prefix, "/") {
+		prefix += "*"
+	} else {
+		prefix += "/*"
+	}
+
+	h := func(req *Request, res *Response) error {
+		name := req.Param("*").Value().String()
+		name = strings.TrimPrefix(path.Clean(fmt.Sprint("/", name)), "/")
+		if name == "" {
+			name = "."
+		}
+
+		err := res.WriteFileFS(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return a.NotFoundHandler(req, res)
+		}
+
+		return err
+	}
+
+	a.router.registerFiles(prefix, h, gases...)
+}
+
+// FILESFS is just like the `Air.FILESFS`.
+func (g *Group) FILESFS(prefix string, fsys fs.FS, gases ...Gas) {
+	g.Air.FILESFS(g.Prefix+prefix, fsys, append(g.Gases, gases...)...)
+}
+
+// WriteFileFS writes a file content targeted by the name in the fsys (such as
+// an `embed.FS`) to the client. The name must be a valid path of the fsys (see
+// the `fs.ValidPath`).
+//
+// It behaves just like the `WriteFile` except that the coffer is never used.
+func (r *Response) WriteFileFS(fsys fs.FS, name string) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{
+			Op:   "open",
+			Path: name,
+			Err:  fs.ErrNotExist,
+		}
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if fi.IsDir() {
+		p := r.req.RawPath()
+		if !strings.HasSuffix(p, "/") {
+			p = fmt.Sprint(path.Base(p), "/")
+			if q := r.req.RawQuery(); q != "" {
+				p = fmt.Sprint(p, "?", q)
+			}
+
+			r.Status = http.StatusMovedPermanently
+
+			return r.Redirect(p)
+		}
+
+		f.Close()
+
+		name = path.Join(name, "index.html")
+		if f, err = fsys.Open(name); err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if fi, err = f.Stat(); err != nil {
+			return err
+		}
+	}
+
+	c, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := ioutil.ReadAll(f)
+		if err != nil {
+			return err
+		}
+
+		c = bytes.NewReader(b)
+	}
+
+	return r.writeFileContent(c, name, "", nil, fi.ModTime(), fi.Size())
+}
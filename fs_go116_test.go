@@ -0,0 +1,160 @@
+//go:build go1.16
+// +build go1.16
+
+package air
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAirFILESFS(t *testing.T) {
+	a := New()
+
+	a.FILESFS("/foobar", fstest.MapFS{
+		"foo.txt": &fstest.MapFile{
+			Data: []byte("Foobar"),
+		},
+		"bar/index.html": &fstest.MapFile{
+			Data: []byte("<p>Barfoo</p>"),
+		},
+	})
+
+	hr := httptest.NewRequest(http.MethodGet, "/foobar/foo.txt", nil)
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "Foobar", string(hrwrb))
+
+	hr = httptest.NewRequest(http.MethodHead, "/foobar/foo.txt", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Len(t, hrwrb, 0)
+
+	hr = httptest.NewRequest(http.MethodGet, "/foobar/bar/", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "<p>Barfoo</p>", string(hrwrb))
+
+	hr = httptest.NewRequest(http.MethodGet, "/foobar/../foo.txt", nil)
+	hr.URL.Path = "/foobar/../foo.txt"
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "Foobar", string(hrwrb))
+
+	hr = httptest.NewRequest(http.MethodGet, "/foobar/nowhere", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusNotFound, hrwr.StatusCode)
+	assert.Equal(t, http.StatusText(http.StatusNotFound), string(hrwrb))
+}
+
+func TestResponseWriteFileFS(t *testing.T) {
+	a := New()
+
+	mt := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"foo.html": &fstest.MapFile{
+			Data:    []byte("<p>Foobar</p>"),
+			ModTime: mt,
+		},
+		"bar.txt": &fstest.MapFile{
+			Data: []byte("Barfoo"),
+		},
+		"baz/index.html": &fstest.MapFile{
+			Data: []byte("<p>Baz</p>"),
+		},
+	}
+
+	_, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.NoError(t, res.WriteFileFS(fsys, "foo.html"))
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(
+		t,
+		"text/html; charset=utf-8",
+		hrwr.Header.Get("Content-Type"),
+	)
+	assert.NotEmpty(t, hrwr.Header.Get("ETag"))
+	assert.Equal(
+		t,
+		mt.Format(http.TimeFormat),
+		hrwr.Header.Get("Last-Modified"),
+	)
+	assert.Equal(t, "<p>Foobar</p>", string(hrwrb))
+
+	_, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.NoError(t, res.WriteFileFS(fsys, "bar.txt"))
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.NotEmpty(t, hrwr.Header.Get("ETag"))
+	assert.Empty(t, hrwr.Header.Get("Last-Modified"))
+	assert.Equal(t, "Barfoo", string(hrwrb))
+
+	_, res, hrw = fakeRRCycle(a, http.MethodGet, "/baz", nil)
+
+	assert.NoError(t, res.WriteFileFS(fsys, "baz"))
+
+	hrwr = hrw.Result()
+
+	assert.Equal(t, http.StatusMovedPermanently, hrwr.StatusCode)
+	assert.Equal(t, "/baz/", hrwr.Header.Get("Location"))
+
+	_, res, hrw = fakeRRCycle(a, http.MethodGet, "/baz/", nil)
+
+	assert.NoError(t, res.WriteFileFS(fsys, "baz"))
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "<p>Baz</p>", string(hrwrb))
+
+	_, res, _ = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.True(t, os.IsNotExist(res.WriteFileFS(fsys, "nowhere")))
+	assert.True(t, os.IsNotExist(res.WriteFileFS(fsys, "../foo.html")))
+}
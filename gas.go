@@ -0,0 +1,768 @@
+package air
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConcurrencyLimitGas returns a `Gas` that limits the number of requests being
+// served concurrently by the next `Handler` to the max, regardless of where
+// they come from. It is useful for protecting expensive endpoints (such as
+// report generation) from thundering herds.
+//
+// When the limit is reached, the request is rejected immediately with the
+// `http.StatusServiceUnavailable`, unless a queue timeout is set via the
+// `WithConcurrencyQueueTimeout`, in which case the request waits for a free
+// slot until the timeout expires.
+//
+// The slot is always released after the next `Handler` returns, even if it
+// panics.
+func ConcurrencyLimitGas(max int, opts ...ConcurrencyOption) Gas {
+	if max < 1 {
+		panic("air: concurrency limit must be greater than zero")
+	}
+
+	cl := &concurrencyLimiter{
+		slots: make(chan struct{}, max),
+	}
+
+	for _, opt := range opts {
+		opt(cl)
+	}
+
+	return func(next Handler) Handler {
+		return func(req *Request, res *Response) error {
+			if err := cl.acquire(req); err != nil {
+				if res.Status < http.StatusBadRequest {
+					res.Status = http.StatusServiceUnavailable
+				}
+
+				return err
+			}
+			defer cl.release()
+
+			return next(req, res)
+		}
+	}
+}
+
+// ConcurrencyOption defines a function to configure the `ConcurrencyLimitGas`.
+type ConcurrencyOption func(*concurrencyLimiter)
+
+// WithConcurrencyQueueTimeout returns a `ConcurrencyOption` that makes the
+// requests wait up to the d for a free slot instead of being rejected
+// immediately when the limit is reached.
+func WithConcurrencyQueueTimeout(d time.Duration) ConcurrencyOption {
+	return func(cl *concurrencyLimiter) {
+		cl.queueTimeout = d
+	}
+}
+
+// concurrencyLimiter is a semaphore used by the `ConcurrencyLimitGas`.
+type concurrencyLimiter struct {
+	slots        chan struct{}
+	queueTimeout time.Duration
+}
+
+// acquire acquires a slot from the cl for the req.
+func (cl *concurrencyLimiter) acquire(req *Request) error {
+	select {
+	case cl.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if cl.queueTimeout <= 0 {
+		return errors.New(
+			http.StatusText(http.StatusServiceUnavailable),
+		)
+	}
+
+	timer := time.NewTimer(cl.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case cl.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return errors.New(
+			http.StatusText(http.StatusServiceUnavailable),
+		)
+	case <-req.Context.Done():
+		return req.Context.Err()
+	}
+}
+
+// release releases a slot back to the cl.
+func (cl *concurrencyLimiter) release() {
+	<-cl.slots
+}
+
+// HeaderLimitsGas returns a `Gas` that rejects the requests that have more than
+// the maxHeaders distinct headers or have any header value longer than the
+// maxValueLen bytes with the `http.StatusRequestHeaderFieldsTooLarge`. A
+// non-positive limit means no limit.
+//
+// The `HeaderLimitsGas` complements the `Air.MaxHeaderBytes`, which only limits
+// the total size of the request headers at the transport level. It is
+// recommended to use it as a pregas so that the requests are rejected before
+// routing.
+func HeaderLimitsGas(
+	maxHeaders int,
+	maxValueLen int,
+	opts ...HeaderLimitsOption,
+) Gas {
+	hl := &headerLimiter{
+		maxHeaders:  maxHeaders,
+		maxValueLen: maxValueLen,
+		body: http.StatusText(
+			http.StatusRequestHeaderFieldsTooLarge,
+		),
+	}
+
+	for _, opt := range opts {
+		opt(hl)
+	}
+
+	return func(next Handler) Handler {
+		return func(req *Request, res *Response) error {
+			if !hl.allow(req.Header) {
+				res.Status = http.StatusRequestHeaderFieldsTooLarge
+				return errors.New(hl.body)
+			}
+
+			return next(req, res)
+		}
+	}
+}
+
+// HeaderLimitsOption defines a function to configure the `HeaderLimitsGas`.
+type HeaderLimitsOption func(*headerLimiter)
+
+// WithHeaderLimitsBody returns a `HeaderLimitsOption` that sets the body of the
+// responses to the rejected requests to the body.
+func WithHeaderLimitsBody(body string) HeaderLimitsOption {
+	return func(hl *headerLimiter) {
+		hl.body = body
+	}
+}
+
+// headerLimiter is the limiter used by the `HeaderLimitsGas`.
+type headerLimiter struct {
+	maxHeaders  int
+	maxValueLen int
+	body        string
+}
+
+// allow reports whether the h is within the limits of the hl.
+func (hl *headerLimiter) allow(h http.Header) bool {
+	if hl.maxHeaders > 0 && len(h) > hl.maxHeaders {
+		return false
+	}
+
+	if hl.maxValueLen > 0 {
+		for _, vs := range h {
+			for _, v := range vs {
+				if len(v) > hl.maxValueLen {
+					return false
+				}
+			}
+		}
+	}
+
+	return true
+}
+
+// QueryParamLimitGas returns a `Gas` that rejects the requests that have more
+// than the max query params with the `http.StatusBadRequest`. It is useful for
+// protecting against the param-flooding attacks that cause excessive
+// allocations when the params are parsed.
+//
+// The query params are counted from the `Request.RawQuery` without parsing
+// them (so neither the query nor the form is parsed). Both the "&" and ";" are
+// treated as separators, and the empty params are not counted.
+//
+// It is recommended to use it as a pregas so that the requests are rejected
+// before routing.
+func QueryParamLimitGas(max int) Gas {
+	if max < 0 {
+		panic("air: query param limit cannot be negative")
+	}
+
+	return func(next Handler) Handler {
+		return func(req *Request, res *Response) error {
+			if countQueryParams(req.RawQuery()) > max {
+				res.Status = http.StatusBadRequest
+				return errors.New(http.StatusText(res.Status))
+			}
+
+			return next(req, res)
+		}
+	}
+}
+
+// BodyLimitGas returns a `Gas` that limits the size of the request bodies to
+// the max bytes. It is useful for protecting against the large uploads that
+// exhaust the memory when the bodies are parsed (such as by the
+// `Request.Bind` and `Request.Params`).
+//
+// The `Request.Body` (which is also what the `Request.Params` and
+// `Request.Bind` parse) is limited so that reading beyond the max fails with an
+// error and sets the `Response.Status` to the
+// `http.StatusRequestEntityTooLarge`, which means that the error returned by
+// the next `Handler` is handled with it. The requests whose Content-Length
+// header exceeds the max fail on their first read, before any byte of their
+// bodies is consumed. Since the form parsing of the `Request.Params` does not
+// report errors, the request is also responded with the
+// `http.StatusRequestEntityTooLarge` when the next `Handler` returns nil
+// without writing the response after the max has been exceeded.
+//
+// The `BodyLimitGas` can be used as a pregas and then overridden (loosened or
+// tightened) for some routes via the route-level gases, since the last applied
+// limit (which is the innermost one) always wins. That is also why the
+// Content-Length header is not checked until the body is read.
+//
+// It panics if the max is negative.
+func BodyLimitGas(max int64) Gas {
+	if max < 0 {
+		panic("air: body limit cannot be negative")
+	}
+
+	return func(next Handler) Handler {
+		return func(req *Request, res *Response) error {
+			if req.Body == nil {
+				return next(req, res)
+			}
+
+			lb, ok := req.Body.(*limitedRequestBody)
+			if ok {
+				lb.max = max
+			} else {
+				lb = &limitedRequestBody{
+					rc:  req.Body,
+					res: res,
+					cl:  req.ContentLength,
+					max: max,
+				}
+
+				req.Body = lb
+
+				// The `Request.Params` parses the underlying
+				// `http.Request` directly, so it must be limited
+				// as well.
+				req.hr.Body = lb
+			}
+
+			if err := next(req, res); err != nil {
+				return err
+			} else if lb.exceeded() && !res.Written {
+				return lb.tooLarge()
+			}
+
+			return nil
+		}
+	}
+}
+
+// limitedRequestBody is the `Request.Body` limited by the `BodyLimitGas`.
+type limitedRequestBody struct {
+	rc  io.ReadCloser
+	res *Response
+	cl  int64
+	max int64
+	n   int64
+}
+
+// Read implements the `io.Reader`.
+func (lb *limitedRequestBody) Read(b []byte) (int, error) {
+	if lb.exceeded() {
+		return 0, lb.tooLarge()
+	}
+
+	if rl := lb.max - lb.n + 1; int64(len(b)) > rl {
+		b = b[:rl]
+	}
+
+	n, err := lb.rc.Read(b)
+	lb.n += int64(n)
+	if lb.n > lb.max {
+		return n - int(lb.n-lb.max), lb.tooLarge()
+	}
+
+	return n, err
+}
+
+// Close implements the `io.Closer`.
+func (lb *limitedRequestBody) Close() error {
+	return lb.rc.Close()
+}
+
+// exceeded reports whether the lb has exceeded its max, either by the bytes
+// read or by the Content-Length header.
+func (lb *limitedRequestBody) exceeded() bool {
+	return lb.n > lb.max || lb.cl > lb.max
+}
+
+// tooLarge sets the status of the response to the
+// `http.StatusRequestEntityTooLarge` and returns the corresponding error.
+func (lb *limitedRequestBody) tooLarge() error {
+	if lb.res.Status < http.StatusBadRequest {
+		lb.res.Status = http.StatusRequestEntityTooLarge
+	}
+
+	return errors.New(
+		http.StatusText(http.StatusRequestEntityTooLarge),
+	)
+}
+
+// TimeoutGas returns a `Gas` that bounds the time taken by the next `Handler`
+// to the d. The `Request.Context` seen by the next `Handler` is done when the d
+// elapses, and if the next `Handler` has not written the response by then, the
+// request is responded with the `http.StatusServiceUnavailable`.
+//
+// The next `Handler` is never abandoned, since the `Response` cannot be safely
+// written from two goroutines. Instead, it is expected to observe the
+// `Request.Context` and return as soon as it is done (as the `http.Client`,
+// database drivers and such usually do). The `TimeoutGas` only takes effect
+// after the next `Handler` returns.
+//
+// The streaming responses (such as the server-sent events started by the
+// `Response.StreamEvents`) also end when the d elapses, but since they have
+// already been written, their status cannot be changed. So the `TimeoutGas`
+// should not be used for the long-lived routes.
+//
+// It panics if the d is not positive.
+func TimeoutGas(d time.Duration) Gas {
+	if d <= 0 {
+		panic("air: timeout must be greater than zero")
+	}
+
+	return func(next Handler) Handler {
+		return func(req *Request, res *Response) error {
+			ctx, cancel := context.WithTimeout(req.Context, d)
+			defer cancel()
+
+			req.SetHTTPRequest(req.HTTPRequest().WithContext(ctx))
+
+			err := next(req, res)
+			if ctx.Err() != context.DeadlineExceeded || res.Written {
+				return err
+			}
+
+			res.Status = http.StatusServiceUnavailable
+
+			return errors.New(http.StatusText(res.Status))
+		}
+	}
+}
+
+// countQueryParams returns the number of the non-empty params in the rawQuery.
+func countQueryParams(rawQuery string) int {
+	n, empty := 0, true
+	for i := 0; i < len(rawQuery); i++ {
+		switch rawQuery[i] {
+		case '&', ';':
+			empty = true
+		default:
+			if empty {
+				n++
+				empty = false
+			}
+		}
+	}
+
+	return n
+}
+
+// MaintenanceConfig is the configuration of the `MaintenanceGas`.
+type MaintenanceConfig struct {
+	// Switch is the switch that turns the maintenance mode on and off at
+	// runtime.
+	//
+	// If the `Switch` is nil, the maintenance mode is always on.
+	Switch *MaintenanceSwitch
+
+	// AllowedPaths is the paths that are still served when the maintenance
+	// mode is on. A path ending with "*" matches all paths that have the
+	// part before the "*" as prefix.
+	AllowedPaths []string
+
+	// AllowedIPs is the client IPs (or CIDRs, such as "10.0.0.0/8") that
+	// are still served when the maintenance mode is on. The client IP of
+	// each request is the `Request.ClientHost`.
+	AllowedIPs []string
+
+	// RetryAfter is the value of the Retry-After header of the responses to
+	// the rejected requests. It is rounded up to seconds. A non-positive
+	// value means no Retry-After header.
+	RetryAfter time.Duration
+
+	// Body is the body of the responses to the rejected requests.
+	//
+	// If the `Body` is empty, the `http.StatusText` of the
+	// `http.StatusServiceUnavailable` is used.
+	Body string
+
+	// Template is the name of the template that is rendered (with nil
+	// data) as the body of the responses to the rejected requests.
+	//
+	// If the `Template` is not empty, the `Body` is ignored.
+	Template string
+}
+
+// MaintenanceSwitch is the switch of the `MaintenanceGas`. It is safe for
+// concurrent use. The zero value is a switch that is off.
+type MaintenanceSwitch struct {
+	on int32
+}
+
+// TurnOn turns the ms on.
+func (ms *MaintenanceSwitch) TurnOn() {
+	atomic.StoreInt32(&ms.on, 1)
+}
+
+// TurnOff turns the ms off.
+func (ms *MaintenanceSwitch) TurnOff() {
+	atomic.StoreInt32(&ms.on, 0)
+}
+
+// IsOn reports whether the ms is on.
+func (ms *MaintenanceSwitch) IsOn() bool {
+	return atomic.LoadInt32(&ms.on) == 1
+}
+
+// MaintenanceGas returns a `Gas` that rejects requests with the
+// `http.StatusServiceUnavailable` while the maintenance mode is on, except for
+// the requests matching the allow-lists of the config. It is recommended to use
+// it as a pregas so that all requests (including the unroutable ones) are
+// covered.
+//
+// It panics if any of the `MaintenanceConfig.AllowedIPs` is invalid.
+func MaintenanceGas(config MaintenanceConfig) Gas {
+	ips := []net.IP{}
+	ipNets := []*net.IPNet{}
+	for _, s := range config.AllowedIPs {
+		if strings.Contains(s, "/") {
+			_, ipNet, err := net.ParseCIDR(s)
+			if err != nil {
+				panic("air: invalid maintenance allowed ip: " + s)
+			}
+
+			ipNets = append(ipNets, ipNet)
+		} else if ip := net.ParseIP(s); ip != nil {
+			ips = append(ips, ip)
+		} else {
+			panic("air: invalid maintenance allowed ip: " + s)
+		}
+	}
+
+	retryAfter := ""
+	if config.RetryAfter > 0 {
+		retryAfter = strconv.FormatInt(
+			int64((config.RetryAfter+time.Second-1)/time.Second),
+			10,
+		)
+	}
+
+	body := config.Body
+	if body == "" {
+		body = http.StatusText(http.StatusServiceUnavailable)
+	}
+
+	allowed := func(req *Request) bool {
+		path := req.RawPath()
+		for _, ap := range config.AllowedPaths {
+			if strings.HasSuffix(ap, "*") {
+				if strings.HasPrefix(path, ap[:len(ap)-1]) {
+					return true
+				}
+			} else if path == ap {
+				return true
+			}
+		}
+
+		if len(ips) == 0 && len(ipNets) == 0 {
+			return false
+		}
+
+		ip := net.ParseIP(req.ClientHost())
+		if ip == nil {
+			return false
+		}
+
+		for _, aip := range ips {
+			if aip.Equal(ip) {
+				return true
+			}
+		}
+
+		for _, ipNet := range ipNets {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return func(next Handler) Handler {
+		return func(req *Request, res *Response) error {
+			if config.Switch != nil && !config.Switch.IsOn() ||
+				allowed(req) {
+				return next(req, res)
+			}
+
+			if retryAfter != "" {
+				res.Header.Set("Retry-After", retryAfter)
+			}
+
+			res.Status = http.StatusServiceUnavailable
+			if config.Template != "" {
+				return res.Render(nil, config.Template)
+			}
+
+			return res.WriteString(body)
+		}
+	}
+}
+
+// LoggerConfig is the configuration of the `LoggerGas`.
+type LoggerConfig struct {
+	// Writer is where the log lines are written to.
+	//
+	// If the `Writer` is nil, the log lines are logged via the
+	// `Air.ErrorLogger` (or the standard logger if it is nil).
+	Writer io.Writer
+
+	// Format is the format of each log line. The following tags are
+	// replaced with their values:
+	//   ${method}: the `Request.Method`
+	//   ${path}: the `Request.RawPath`
+	//   ${status}: the `Response.Status`
+	//   ${bytes}: the `Response.ContentLength` (or "-" if it is unknown)
+	//   ${latency}: the time taken to serve the request
+	//   ${client_address}: the `Request.ClientAddress`
+	//
+	// If the `Format` is empty, the `DefaultLoggerFormat` is used.
+	Format string
+}
+
+// DefaultLoggerFormat is the default `LoggerConfig.Format`.
+const DefaultLoggerFormat = "${client_address} ${method} ${path} ${status} " +
+	"${bytes} ${latency}"
+
+// LoggerGas returns a `Gas` that logs a line in the format of the config for
+// each request.
+//
+// The line is logged after the request has been completely served (that is,
+// after the `Air.ErrorHandler` has handled the error returned by the next
+// `Handler`, if any), so the status is always the final one, even for the
+// hijacked connections (such as the WebSocket connections, whose status is
+// the `http.StatusSwitchingProtocols`).
+//
+// It panics if the format of the config contains any unknown tag.
+func LoggerGas(config LoggerConfig) Gas {
+	format := config.Format
+	if format == "" {
+		format = DefaultLoggerFormat
+	}
+
+	l := &logger{
+		w: config.Writer,
+	}
+
+	for format != "" {
+		i := strings.Index(format, "${")
+		if i < 0 {
+			l.segments = append(l.segments, format)
+			break
+		}
+
+		j := strings.IndexByte(format[i:], '}')
+		if j < 0 {
+			l.segments = append(l.segments, format)
+			break
+		}
+
+		j += i
+
+		tag := format[i+2 : j]
+		switch tag {
+		case "method", "path", "status", "bytes", "latency",
+			"client_address":
+		default:
+			panic("air: unknown logger format tag: " + tag)
+		}
+
+		if i > 0 {
+			l.segments = append(l.segments, format[:i])
+		}
+
+		l.segments = append(l.segments, format[i:j+1])
+		format = format[j+1:]
+	}
+
+	return func(next Handler) Handler {
+		return func(req *Request, res *Response) error {
+			startTime := time.Now()
+			res.Defer(func() {
+				l.log(req, res, time.Since(startTime))
+			})
+
+			return next(req, res)
+		}
+	}
+}
+
+// logger is the logger used by the `LoggerGas`.
+type logger struct {
+	sync.Mutex
+
+	w        io.Writer
+	segments []string
+}
+
+// log logs a line for the req and res that took the latency to serve.
+func (l *logger) log(req *Request, res *Response, latency time.Duration) {
+	buf := bytes.Buffer{}
+	for _, s := range l.segments {
+		switch s {
+		case "${method}":
+			buf.WriteString(req.Method)
+		case "${path}":
+			buf.WriteString(req.RawPath())
+		case "${status}":
+			buf.WriteString(strconv.Itoa(res.Status))
+		case "${bytes}":
+			if res.ContentLength < 0 {
+				buf.WriteByte('-')
+			} else {
+				buf.WriteString(strconv.FormatInt(
+					res.ContentLength,
+					10,
+				))
+			}
+		case "${latency}":
+			buf.WriteString(latency.String())
+		case "${client_address}":
+			buf.WriteString(req.ClientAddress())
+		default:
+			buf.WriteString(s)
+		}
+	}
+
+	if l.w == nil {
+		if req.Air.ErrorLogger != nil {
+			req.Air.ErrorLogger.Print(buf.String())
+		} else {
+			log.Print(buf.String())
+		}
+
+		return
+	}
+
+	buf.WriteByte('\n')
+
+	l.Lock()
+	l.w.Write(buf.Bytes())
+	l.Unlock()
+}
+
+// RecoverGas returns a `Gas` that recovers from the panics of the next
+// `Handler`. The recovered value is logged via the `Air.ErrorLogger` and then
+// returned as an error, which means it is handled by the `Air.ErrorHandler`
+// with the `http.StatusInternalServerError` (if the response has not been
+// written).
+//
+// By default, the stack of the panic (formatted by the
+// `Air.PanicStackFormatter`) is included in the log and the error only in the
+// `Air.DebugMode`. It can be changed via the `WithRecoverStack`.
+//
+// The `http.ErrAbortHandler` is never recovered, since it is used to abort the
+// response on purpose.
+func RecoverGas(opts ...RecoverOption) Gas {
+	rc := &recoverer{}
+	for _, opt := range opts {
+		opt(rc)
+	}
+
+	return func(next Handler) Handler {
+		return func(req *Request, res *Response) (err error) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				} else if r == http.ErrAbortHandler {
+					panic(r)
+				}
+
+				m := fmt.Sprint(r)
+				if rc.includesStack(req.Air) {
+					m = req.Air.formatPanicStack(r)
+				}
+
+				req.Air.logErrorf("air: panic recovered: %s", m)
+
+				if !res.Written {
+					res.Status = http.StatusInternalServerError
+				}
+
+				err = errors.New(m)
+			}()
+
+			return next(req, res)
+		}
+	}
+}
+
+// RecoverOption defines a function to configure the `RecoverGas`.
+type RecoverOption func(*recoverer)
+
+// WithRecoverStack returns a `RecoverOption` that makes the stack of the
+// recovered panics always (or never) be included regardless of the
+// `Air.DebugMode`.
+func WithRecoverStack(include bool) RecoverOption {
+	return func(rc *recoverer) {
+		rc.stack = &include
+	}
+}
+
+// recoverer is the configuration of the `RecoverGas`.
+type recoverer struct {
+	stack *bool
+}
+
+// includesStack reports whether the rc includes the stacks of the recovered
+// panics for the a.
+func (rc *recoverer) includesStack(a *Air) bool {
+	if rc.stack != nil {
+		return *rc.stack
+	}
+
+	return a.DebugMode
+}
+
+// cacheControlGas returns a `Gas` that sets the Cache-Control header of the
+// responses to the cc if it has not been set.
+func cacheControlGas(cc string) Gas {
+	return func(next Handler) Handler {
+		return func(req *Request, res *Response) error {
+			if res.Header.Get("Cache-Control") == "" {
+				res.Header.Set("Cache-Control", cc)
+			}
+
+			return next(req, res)
+		}
+	}
+}
@@ -0,0 +1,800 @@
+package air
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrencyLimitGas(t *testing.T) {
+	assert.Panics(t, func() {
+		ConcurrencyLimitGas(0)
+	})
+
+	a := New()
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	a.GET("/foobar", func(req *Request, res *Response) error {
+		started <- struct{}{}
+		<-unblock
+		return res.WriteString("Foobar")
+	}, ConcurrencyLimitGas(2))
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			hr := httptest.NewRequest(http.MethodGet, "/foobar", nil)
+			hrw := httptest.NewRecorder()
+
+			a.ServeHTTP(hrw, hr)
+
+			assert.Equal(t, http.StatusOK, hrw.Code)
+		}()
+
+		<-started
+	}
+
+	for i := 0; i < 3; i++ {
+		hr := httptest.NewRequest(http.MethodGet, "/foobar", nil)
+		hrw := httptest.NewRecorder()
+
+		a.ServeHTTP(hrw, hr)
+
+		hrwr := hrw.Result()
+		hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+		assert.Equal(t, http.StatusServiceUnavailable, hrwr.StatusCode)
+		assert.Equal(t, "Service Unavailable", string(hrwrb))
+	}
+
+	close(unblock)
+	wg.Wait()
+
+	hr := httptest.NewRequest(http.MethodGet, "/foobar", nil)
+	hrw := httptest.NewRecorder()
+
+	go func() {
+		<-started
+	}()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+
+	a = New()
+
+	unblock = make(chan struct{})
+	a.GET("/foobar", func(req *Request, res *Response) error {
+		started <- struct{}{}
+		<-unblock
+		return res.WriteString("Foobar")
+	}, ConcurrencyLimitGas(1, WithConcurrencyQueueTimeout(time.Second)))
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		hr := httptest.NewRequest(http.MethodGet, "/foobar", nil)
+		hrw := httptest.NewRecorder()
+
+		a.ServeHTTP(hrw, hr)
+
+		assert.Equal(t, http.StatusOK, hrw.Code)
+	}()
+
+	<-started
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(unblock)
+		<-started
+	}()
+
+	hr = httptest.NewRequest(http.MethodGet, "/foobar", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+
+	wg.Wait()
+
+	a = New()
+
+	a.GET("/foobar", func(req *Request, res *Response) error {
+		panic("foobar")
+	}, ConcurrencyLimitGas(1))
+
+	for i := 0; i < 2; i++ {
+		hr := httptest.NewRequest(http.MethodGet, "/foobar", nil)
+		hrw := httptest.NewRecorder()
+
+		assert.Panics(t, func() {
+			a.ServeHTTP(hrw, hr)
+		})
+	}
+}
+
+func TestHeaderLimitsGas(t *testing.T) {
+	a := New()
+	a.Pregases = []Gas{HeaderLimitsGas(3, 8)}
+
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	})
+
+	hr := httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.Header.Set("Foo", "bar")
+	hr.Header.Set("Bar", "12345678")
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "Foobar", string(hrwrb))
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.Header.Set("Foo", "bar")
+	hr.Header.Set("Bar", "foo")
+	hr.Header.Set("Baz", "qux")
+	hr.Header.Set("Qux", "baz")
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, hrwr.StatusCode)
+	assert.Equal(t, "Request Header Fields Too Large", string(hrwrb))
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.Header.Add("Foo", "bar")
+	hr.Header.Add("Foo", "123456789")
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, hrwr.StatusCode)
+
+	a = New()
+	a.Pregases = []Gas{HeaderLimitsGas(
+		0,
+		4,
+		WithHeaderLimitsBody("Header value too long"),
+	)}
+
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	})
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.Header.Set("Foo", "bar")
+	hr.Header.Set("Bar", "foo")
+	hr.Header.Set("Baz", "qux")
+	hr.Header.Set("Qux", "baz")
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.Header.Set("Foo", "foobar")
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, hrwr.StatusCode)
+	assert.Equal(t, "Header value too long", string(hrwrb))
+}
+
+func TestQueryParamLimitGas(t *testing.T) {
+	assert.Panics(t, func() {
+		QueryParamLimitGas(-1)
+	})
+
+	a := New()
+	a.Pregases = []Gas{QueryParamLimitGas(2)}
+
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	})
+
+	for _, target := range []string{
+		"/",
+		"/?foo=bar",
+		"/?foo=bar&bar=foo",
+		"/?foo=bar&&bar=foo&",
+	} {
+		hr := httptest.NewRequest(http.MethodGet, target, nil)
+		hrw := httptest.NewRecorder()
+
+		a.ServeHTTP(hrw, hr)
+
+		assert.Equal(t, http.StatusOK, hrw.Code)
+	}
+
+	hr := httptest.NewRequest(http.MethodGet, "/?foo=bar&bar=foo&baz", nil)
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusBadRequest, hrwr.StatusCode)
+	assert.Equal(t, "Bad Request", string(hrwrb))
+
+	hr = httptest.NewRequest(http.MethodGet, "/nowhere?a&b&c", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusBadRequest, hrw.Code)
+}
+
+func TestBodyLimitGas(t *testing.T) {
+	assert.Panics(t, func() {
+		BodyLimitGas(-1)
+	})
+
+	a := New()
+	a.Pregases = []Gas{BodyLimitGas(4)}
+
+	h := func(req *Request, res *Response) error {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+
+		return res.Write(bytes.NewReader(b))
+	}
+
+	a.POST("/", h)
+	a.POST("/large", h, BodyLimitGas(8))
+
+	hr := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("Foo"))
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+	assert.Equal(t, "Foo", hrw.Body.String())
+
+	hr = httptest.NewRequest(
+		http.MethodPost,
+		"/",
+		strings.NewReader("Foobar"),
+	)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, hrw.Code)
+	assert.Equal(t, "Request Entity Too Large", hrw.Body.String())
+
+	hr = httptest.NewRequest(
+		http.MethodPost,
+		"/",
+		strings.NewReader("Foobar"),
+	)
+	hr.ContentLength = -1
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, hrw.Code)
+	assert.Equal(t, "Request Entity Too Large", hrw.Body.String())
+
+	hr = httptest.NewRequest(
+		http.MethodPost,
+		"/large",
+		strings.NewReader("Foobar"),
+	)
+	hr.ContentLength = -1
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+	assert.Equal(t, "Foobar", hrw.Body.String())
+
+	hr = httptest.NewRequest(
+		http.MethodPost,
+		"/large",
+		strings.NewReader("Foobarfoobar"),
+	)
+	hr.ContentLength = -1
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, hrw.Code)
+
+	hr = httptest.NewRequest(
+		http.MethodPost,
+		"/large",
+		strings.NewReader("Foobar"),
+	)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+	assert.Equal(t, "Foobar", hrw.Body.String())
+
+	hr = httptest.NewRequest(
+		http.MethodPost,
+		"/large",
+		strings.NewReader("Foobarfoobar"),
+	)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, hrw.Code)
+
+	a = New()
+	a.Pregases = []Gas{BodyLimitGas(8)}
+
+	a.POST("/", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	})
+	a.POST("/small", h, BodyLimitGas(4))
+
+	hr = httptest.NewRequest(
+		http.MethodPost,
+		"/small",
+		strings.NewReader("Foobar"),
+	)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, hrw.Code)
+
+	hr = httptest.NewRequest(
+		http.MethodPost,
+		"/",
+		strings.NewReader("Foobarfoobar"),
+	)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+	assert.Equal(t, "Foobar", hrw.Body.String())
+}
+
+func TestBodyLimitGasParams(t *testing.T) {
+	a := New()
+	a.Pregases = []Gas{BodyLimitGas(16)}
+
+	a.POST("/", func(req *Request, res *Response) error {
+		p := req.Param("foo")
+		if p == nil {
+			return res.WriteString("")
+		}
+
+		return res.WriteString(p.Value().String())
+	})
+
+	hr := httptest.NewRequest(
+		http.MethodPost,
+		"/",
+		strings.NewReader("foo=bar"),
+	)
+	hr.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	hr.ContentLength = -1
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+	assert.Equal(t, "bar", hrw.Body.String())
+
+	hr = httptest.NewRequest(
+		http.MethodPost,
+		"/",
+		strings.NewReader("foo="+strings.Repeat("bar", 1000)),
+	)
+	hr.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	hr.ContentLength = -1
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, hrw.Code)
+	assert.Equal(t, "Request Entity Too Large", hrw.Body.String())
+
+	buf := bytes.Buffer{}
+	mw := multipart.NewWriter(&buf)
+	assert.NoError(t, mw.WriteField("foo", strings.Repeat("bar", 1000)))
+	assert.NoError(t, mw.Close())
+
+	hr = httptest.NewRequest(http.MethodPost, "/", &buf)
+	hr.Header.Set("Content-Type", mw.FormDataContentType())
+	hr.ContentLength = -1
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, hrw.Code)
+	assert.Equal(t, "Request Entity Too Large", hrw.Body.String())
+}
+
+func TestTimeoutGas(t *testing.T) {
+	assert.Panics(t, func() {
+		TimeoutGas(0)
+	})
+
+	a := New()
+	a.Gases = []Gas{TimeoutGas(50 * time.Millisecond)}
+
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	})
+
+	a.GET("/slow", func(req *Request, res *Response) error {
+		select {
+		case <-req.Context.Done():
+			return req.Context.Err()
+		case <-time.After(time.Second):
+		}
+
+		return res.WriteString("Foobar")
+	})
+
+	a.GET("/stream", func(req *Request, res *Response) error {
+		if err := res.WriteString("Foo"); err != nil {
+			return err
+		}
+
+		<-req.Context.Done()
+
+		return req.Context.Err()
+	})
+
+	hr := httptest.NewRequest(http.MethodGet, "/", nil)
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+	assert.Equal(t, "Foobar", hrw.Body.String())
+
+	hr = httptest.NewRequest(http.MethodGet, "/slow", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusServiceUnavailable, hrw.Code)
+	assert.Equal(t, "Service Unavailable", hrw.Body.String())
+
+	hr = httptest.NewRequest(http.MethodGet, "/stream", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+	assert.Equal(t, "Foo", hrw.Body.String())
+}
+
+func TestCountQueryParams(t *testing.T) {
+	assert.Zero(t, countQueryParams(""))
+	assert.Zero(t, countQueryParams("&;&"))
+	assert.Equal(t, 1, countQueryParams("foo"))
+	assert.Equal(t, 1, countQueryParams("&foo=bar&"))
+	assert.Equal(t, 2, countQueryParams("foo=bar&bar=foo"))
+	assert.Equal(t, 3, countQueryParams("foo=bar;bar=foo&&baz"))
+}
+
+func TestLoggerGas(t *testing.T) {
+	assert.PanicsWithValue(
+		t,
+		"air: unknown logger format tag: foobar",
+		func() {
+			LoggerGas(LoggerConfig{
+				Format: "${method} ${foobar}",
+			})
+		},
+	)
+
+	a := New()
+
+	buf := bytes.Buffer{}
+	a.Gases = []Gas{LoggerGas(LoggerConfig{
+		Writer: &buf,
+		Format: "${method} ${path} ${status} ${bytes} ${client_address}",
+	})}
+
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	})
+
+	a.GET("/error", func(req *Request, res *Response) error {
+		res.Status = http.StatusBadRequest
+		return errors.New("Foobar!")
+	})
+
+	hr := httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.RemoteAddr = "127.0.0.1:8080"
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, "GET / 200 6 127.0.0.1:8080\n", buf.String())
+
+	buf.Reset()
+
+	hr = httptest.NewRequest(http.MethodGet, "/error", nil)
+	hr.RemoteAddr = "127.0.0.1:8080"
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, "GET /error 400 7 127.0.0.1:8080\n", buf.String())
+
+	a = New()
+
+	buf.Reset()
+	a.ErrorLogger = log.New(&buf, "", 0)
+	a.Gases = []Gas{LoggerGas(LoggerConfig{})}
+
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	})
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.RemoteAddr = "127.0.0.1:8080"
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Regexp(t, `^127\.0\.0\.1:8080 GET / 200 6 \S+\n$`, buf.String())
+
+	a = New()
+	a.Address = "localhost:0"
+
+	buf.Reset()
+	a.Gases = []Gas{LoggerGas(LoggerConfig{
+		Writer: &buf,
+		Format: "${method} ${path} ${status} ${bytes}",
+	})}
+
+	a.GET("/", func(req *Request, res *Response) error {
+		ws, err := res.WebSocket()
+		if err != nil {
+			return err
+		}
+
+		return ws.Close()
+	})
+
+	hijackOSStdout()
+
+	go a.Serve()
+	defer a.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	conn, _, err := websocket.DefaultDialer.Dial(
+		"ws://"+a.Addresses()[0],
+		nil,
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, conn)
+	defer conn.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(t, "GET / 101 -\n", buf.String())
+}
+
+func TestRecoverGas(t *testing.T) {
+	a := New()
+
+	buf := bytes.Buffer{}
+	a.ErrorLogger = log.New(&buf, "", 0)
+	a.Gases = []Gas{RecoverGas()}
+
+	a.GET("/", func(req *Request, res *Response) error {
+		panic("foobar")
+	})
+
+	a.GET("/abort", func(req *Request, res *Response) error {
+		panic(http.ErrAbortHandler)
+	})
+
+	hr := httptest.NewRequest(http.MethodGet, "/", nil)
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusInternalServerError, hrwr.StatusCode)
+	assert.Equal(t, "Internal Server Error", string(hrwrb))
+	assert.Equal(t, "air: panic recovered: foobar\n", buf.String())
+
+	buf.Reset()
+	a.DebugMode = true
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusInternalServerError, hrwr.StatusCode)
+	assert.Contains(t, string(hrwrb), "foobar\ngoroutine ")
+	assert.Contains(t, buf.String(), "air: panic recovered: foobar\n")
+	assert.Contains(t, buf.String(), "goroutine ")
+
+	buf.Reset()
+	a.Gases = []Gas{RecoverGas(WithRecoverStack(false))}
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusInternalServerError, hrwr.StatusCode)
+	assert.Equal(t, "foobar", string(hrwrb))
+	assert.Equal(t, "air: panic recovered: foobar\n", buf.String())
+
+	hr = httptest.NewRequest(http.MethodGet, "/abort", nil)
+	hrw = httptest.NewRecorder()
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		a.ServeHTTP(hrw, hr)
+	})
+}
+
+func TestMaintenanceGas(t *testing.T) {
+	assert.Panics(t, func() {
+		MaintenanceGas(MaintenanceConfig{
+			AllowedIPs: []string{"foobar"},
+		})
+	})
+	assert.Panics(t, func() {
+		MaintenanceGas(MaintenanceConfig{
+			AllowedIPs: []string{"10.0.0.0/33"},
+		})
+	})
+
+	a := New()
+
+	ms := &MaintenanceSwitch{}
+	a.Pregases = []Gas{MaintenanceGas(MaintenanceConfig{
+		Switch:       ms,
+		AllowedPaths: []string{"/health", "/admin/*"},
+		RetryAfter:   1500 * time.Millisecond,
+	})}
+	a.GET("/*", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	})
+
+	hr := httptest.NewRequest(http.MethodGet, "/", nil)
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.False(t, ms.IsOn())
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "Foobar", string(hrwrb))
+
+	ms.TurnOn()
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.True(t, ms.IsOn())
+	assert.Equal(t, http.StatusServiceUnavailable, hrwr.StatusCode)
+	assert.Equal(t, "2", hrwr.Header.Get("Retry-After"))
+	assert.Equal(t, "Service Unavailable", string(hrwrb))
+
+	for _, p := range []string{"/health", "/admin/", "/admin/foobar"} {
+		hr = httptest.NewRequest(http.MethodGet, p+"?foo=bar", nil)
+		hrw = httptest.NewRecorder()
+
+		a.ServeHTTP(hrw, hr)
+
+		assert.Equal(t, http.StatusOK, hrw.Code)
+	}
+
+	hr = httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusServiceUnavailable, hrw.Code)
+
+	ms.TurnOff()
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+
+	a = New()
+
+	a.Pregases = []Gas{MaintenanceGas(MaintenanceConfig{
+		AllowedIPs: []string{"127.0.0.1", "10.0.0.0/8"},
+		Body:       "Down for maintenance",
+	})}
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	})
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusServiceUnavailable, hrwr.StatusCode)
+	assert.Empty(t, hrwr.Header.Get("Retry-After"))
+	assert.Equal(t, "Down for maintenance", string(hrwrb))
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.RemoteAddr = "127.0.0.1:1234"
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.Header.Set("X-Forwarded-For", "10.1.2.3")
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+}
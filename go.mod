@@ -4,6 +4,7 @@ go 1.13
 
 require (
 	github.com/VictoriaMetrics/fastcache v1.5.8
+	github.com/andybalholm/brotli v1.0.5
 	github.com/aofei/mimesniffer v1.1.6
 	github.com/cespare/xxhash/v2 v2.1.1
 	github.com/fsnotify/fsnotify v1.4.9
@@ -38,7 +38,7 @@ func (i *i18n) load() {
 		}
 	}()
 
-	if i.watcher == nil {
+	if i.watcher == nil && !i.a.TestMode {
 		i.watcher, i.loadError = fsnotify.NewWatcher()
 		if i.loadError != nil {
 			return
@@ -99,8 +99,10 @@ func (i *i18n) load() {
 			return
 		} else if i.loadError = tt.Unmarshal(&l); i.loadError != nil {
 			return
-		} else if i.loadError = i.watcher.Add(n); i.loadError != nil {
-			return
+		} else if i.watcher != nil {
+			if i.loadError = i.watcher.Add(n); i.loadError != nil {
+				return
+			}
 		}
 
 		ts = append(ts, t)
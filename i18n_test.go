@@ -41,6 +41,25 @@ func TestI18nLoad(t *testing.T) {
 	assert.NotNil(t, i.watcher)
 	assert.NotNil(t, i.matcher)
 	assert.NotNil(t, i.locales)
+
+	assert.NoError(t, ioutil.WriteFile(
+		filepath.Join(a.I18nLocaleRoot, "en-US.toml"),
+		[]byte(`"Foobar" = "Foobar"`),
+		os.ModePerm,
+	))
+
+	a = New()
+	a.I18nEnabled = true
+	a.TestMode = true
+	a.I18nLocaleRoot = dir
+
+	i = a.i18n
+
+	i.load()
+	assert.Nil(t, i.loadError)
+	assert.Nil(t, i.watcher)
+	assert.NotNil(t, i.matcher)
+	assert.Len(t, i.locales, 1)
 }
 
 func TestI18nLocalize(t *testing.T) {
@@ -0,0 +1,331 @@
+package air
+
+import (
+	"bytes"
+	"errors"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IdempotencyStore is a store of the `IdempotencyRecord`s used by the
+// `IdempotencyGas`. It must be safe for concurrent use.
+type IdempotencyStore interface {
+	// Load returns the record for the key. It returns nil if the record
+	// is not found.
+	Load(key string) (*IdempotencyRecord, error)
+
+	// Store stores the record for the key.
+	Store(key string, record *IdempotencyRecord) error
+}
+
+// IdempotencyRecord is a response recorded by the `IdempotencyGas`.
+type IdempotencyRecord struct {
+	// Status is the status code.
+	Status int
+
+	// Header is the header map.
+	Header http.Header
+
+	// Body is the message body. It is never compressed.
+	Body []byte
+}
+
+// IdempotencyGas returns a `Gas` that makes the requests with unsafe methods
+// (POST, PUT, PATCH and DELETE) that carry an idempotency key (the
+// Idempotency-Key header by default) safe to retry.
+//
+// The response to the first request with a key is recorded into the store
+// keyed by the method, path and key of the request, and the same response is
+// replayed (with an Idempotent-Replayed header) for the repeated requests. A
+// repeated request that arrives while the first one is still being served is
+// rejected with the `http.StatusConflict`.
+//
+// Only complete responses are recorded. The responses with a server error
+// status, the streaming responses (such as the server-sent events), the
+// hijacked connections and the responses with a body larger than the limit
+// (see the `WithIdempotencyMaxBodySize`) are never recorded, so the repeated
+// requests are served again.
+//
+// It panics if the store is nil.
+func IdempotencyGas(store IdempotencyStore, opts ...IdempotencyOption) Gas {
+	if store == nil {
+		panic("air: idempotency store cannot be nil")
+	}
+
+	ik := &idempotencyKeeper{
+		store:       store,
+		header:      "Idempotency-Key",
+		maxBodySize: 1 << 20,
+		inFlight:    map[string]struct{}{},
+	}
+
+	for _, opt := range opts {
+		opt(ik)
+	}
+
+	return func(next Handler) Handler {
+		return func(req *Request, res *Response) error {
+			switch req.Method {
+			case http.MethodPost,
+				http.MethodPut,
+				http.MethodPatch,
+				http.MethodDelete:
+			default:
+				return next(req, res)
+			}
+
+			key := req.Header.Get(ik.header)
+			if key == "" {
+				return next(req, res)
+			}
+
+			key = req.Method + " " + req.Path + " " + key
+
+			record, err := store.Load(key)
+			if err != nil {
+				return err
+			} else if record != nil {
+				return ik.replay(res, record)
+			}
+
+			if !ik.begin(key) {
+				res.Status = http.StatusConflict
+				return errors.New(http.StatusText(res.Status))
+			}
+
+			// The first request may have been recorded between the
+			// `Load` above and the `begin`.
+			if record, err := store.Load(key); err != nil {
+				ik.end(key)
+				return err
+			} else if record != nil {
+				ik.end(key)
+				return ik.replay(res, record)
+			}
+
+			lb := &limitedBuffer{
+				max: ik.maxBodySize,
+			}
+
+			res.Tee(lb, false)
+			res.Defer(func() {
+				defer ik.end(key)
+				if !ik.recordable(res) || lb.overflowed {
+					return
+				}
+
+				if err := store.Store(key, &IdempotencyRecord{
+					Status: res.Status,
+					Header: ik.recordableHeader(res.Header),
+					Body:   lb.Bytes(),
+				}); err != nil {
+					res.Air.logErrorf(
+						"air: failed to store idempotency "+
+							"record: %v",
+						err,
+					)
+				}
+			})
+
+			return next(req, res)
+		}
+	}
+}
+
+// IdempotencyOption defines a function to configure the `IdempotencyGas`.
+type IdempotencyOption func(*idempotencyKeeper)
+
+// WithIdempotencyHeader returns an `IdempotencyOption` that makes the
+// idempotency keys to be read from the header with the name.
+func WithIdempotencyHeader(name string) IdempotencyOption {
+	return func(ik *idempotencyKeeper) {
+		ik.header = name
+	}
+}
+
+// WithIdempotencyMaxBodySize returns an `IdempotencyOption` that sets the
+// maximum body size in bytes of the recorded responses to the n. The default
+// is 1 MiB.
+func WithIdempotencyMaxBodySize(n int) IdempotencyOption {
+	return func(ik *idempotencyKeeper) {
+		ik.maxBodySize = n
+	}
+}
+
+// idempotencyKeeper is the keeper used by the `IdempotencyGas`.
+type idempotencyKeeper struct {
+	store         IdempotencyStore
+	header        string
+	maxBodySize   int
+	inFlight      map[string]struct{}
+	inFlightMutex sync.Mutex
+}
+
+// begin marks the key as in flight. It reports false if the key is already in
+// flight.
+func (ik *idempotencyKeeper) begin(key string) bool {
+	ik.inFlightMutex.Lock()
+	defer ik.inFlightMutex.Unlock()
+	if _, ok := ik.inFlight[key]; ok {
+		return false
+	}
+
+	ik.inFlight[key] = struct{}{}
+
+	return true
+}
+
+// end unmarks the key as in flight.
+func (ik *idempotencyKeeper) end(key string) {
+	ik.inFlightMutex.Lock()
+	delete(ik.inFlight, key)
+	ik.inFlightMutex.Unlock()
+}
+
+// recordable reports whether the res is recordable.
+func (ik *idempotencyKeeper) recordable(res *Response) bool {
+	if !res.Written ||
+		res.Status < http.StatusOK ||
+		res.Status >= http.StatusInternalServerError {
+		return false
+	}
+
+	mt, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+
+	return mt != "text/event-stream"
+}
+
+// recordableHeader returns a copy of the h without the headers that are
+// managed by the server or are bound to the encoding of the body.
+func (ik *idempotencyKeeper) recordableHeader(h http.Header) http.Header {
+	rh := make(http.Header, len(h))
+	for k, vs := range h {
+		switch k {
+		case "Content-Encoding", "Content-Length", "Date":
+			continue
+		}
+
+		if _, ok := hopByHopHeaders[k]; ok {
+			continue
+		}
+
+		rh[k] = append([]string(nil), vs...)
+	}
+
+	return rh
+}
+
+// replay writes the record to the res.
+func (ik *idempotencyKeeper) replay(
+	res *Response,
+	record *IdempotencyRecord,
+) error {
+	for k, vs := range record.Header {
+		res.Header[k] = append([]string(nil), vs...)
+	}
+
+	res.Header.Set("Idempotent-Replayed", "true")
+	res.Status = record.Status
+	if len(record.Body) == 0 {
+		return res.Write(nil)
+	}
+
+	return res.Write(bytes.NewReader(record.Body))
+}
+
+// NewMemoryIdempotencyStore returns a new in-memory `IdempotencyStore` whose
+// records expire after the ttl. A non-positive ttl means the records never
+// expire.
+func NewMemoryIdempotencyStore(ttl time.Duration) IdempotencyStore {
+	return &memoryIdempotencyStore{
+		ttl:     ttl,
+		records: map[string]*memoryIdempotencyRecord{},
+	}
+}
+
+// memoryIdempotencyStore is the in-memory `IdempotencyStore`.
+type memoryIdempotencyStore struct {
+	ttl       time.Duration
+	records   map[string]*memoryIdempotencyRecord
+	lastSweep time.Time
+	mutex     sync.Mutex
+}
+
+// memoryIdempotencyRecord is a record of the `memoryIdempotencyStore`.
+type memoryIdempotencyRecord struct {
+	record    *IdempotencyRecord
+	expiresAt time.Time
+}
+
+// Load implements the `IdempotencyStore`.
+func (mis *memoryIdempotencyStore) Load(
+	key string,
+) (*IdempotencyRecord, error) {
+	mis.mutex.Lock()
+	defer mis.mutex.Unlock()
+
+	mir, ok := mis.records[key]
+	if !ok {
+		return nil, nil
+	}
+
+	if mis.ttl > 0 && !time.Now().Before(mir.expiresAt) {
+		delete(mis.records, key)
+		return nil, nil
+	}
+
+	return mir.record, nil
+}
+
+// Store implements the `IdempotencyStore`.
+func (mis *memoryIdempotencyStore) Store(
+	key string,
+	record *IdempotencyRecord,
+) error {
+	mis.mutex.Lock()
+	defer mis.mutex.Unlock()
+
+	now := time.Now()
+	if mis.ttl > 0 && now.Sub(mis.lastSweep) >= mis.ttl {
+		for k, mir := range mis.records {
+			if !now.Before(mir.expiresAt) {
+				delete(mis.records, k)
+			}
+		}
+
+		mis.lastSweep = now
+	}
+
+	mis.records[key] = &memoryIdempotencyRecord{
+		record:    record,
+		expiresAt: now.Add(mis.ttl),
+	}
+
+	return nil
+}
+
+// limitedBuffer is a `bytes.Buffer` that stops buffering once more than the max
+// bytes have been written.
+type limitedBuffer struct {
+	bytes.Buffer
+
+	max        int
+	overflowed bool
+}
+
+// Write implements the `io.Writer`.
+func (lb *limitedBuffer) Write(b []byte) (int, error) {
+	if lb.overflowed {
+		return len(b), nil
+	}
+
+	if lb.Len()+len(b) > lb.max {
+		lb.overflowed = true
+		lb.Reset()
+		return len(b), nil
+	}
+
+	return lb.Buffer.Write(b)
+}
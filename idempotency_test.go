@@ -0,0 +1,281 @@
+package air
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyGas(t *testing.T) {
+	assert.Panics(t, func() {
+		IdempotencyGas(nil)
+	})
+
+	a := New()
+	a.GzipEnabled = true
+	a.GzipMinContentLength = 0
+
+	calls := 0
+	a.Gases = []Gas{IdempotencyGas(NewMemoryIdempotencyStore(time.Minute))}
+	a.POST("/foobar", func(req *Request, res *Response) error {
+		calls++
+		res.Status = http.StatusCreated
+		res.Header.Set("X-Calls", "1")
+		return res.WriteString("Foobar")
+	})
+
+	for i := 0; i < 2; i++ {
+		hr := httptest.NewRequest(http.MethodPost, "/foobar", nil)
+		hr.Header.Set("Idempotency-Key", "foo")
+		hr.Header.Set("Accept-Encoding", "gzip")
+		hrw := httptest.NewRecorder()
+
+		a.ServeHTTP(hrw, hr)
+
+		hrwr := hrw.Result()
+
+		assert.Equal(t, http.StatusCreated, hrwr.StatusCode)
+		assert.Equal(t, "1", hrwr.Header.Get("X-Calls"))
+		assert.Equal(t, "gzip", hrwr.Header.Get("Content-Encoding"))
+		if i == 0 {
+			assert.Empty(t, hrwr.Header.Get("Idempotent-Replayed"))
+		} else {
+			assert.Equal(
+				t,
+				"true",
+				hrwr.Header.Get("Idempotent-Replayed"),
+			)
+		}
+	}
+
+	hr := httptest.NewRequest(http.MethodPost, "/foobar", nil)
+	hr.Header.Set("Idempotency-Key", "foo")
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusCreated, hrwr.StatusCode)
+	assert.Equal(
+		t,
+		"text/plain; charset=utf-8",
+		hrwr.Header.Get("Content-Type"),
+	)
+	assert.Equal(t, "Foobar", string(hrwrb))
+	assert.Equal(t, 1, calls)
+
+	hr = httptest.NewRequest(http.MethodPost, "/foobar", nil)
+	hr.Header.Set("Idempotency-Key", "bar")
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusCreated, hrw.Code)
+	assert.Empty(t, hrw.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 2, calls)
+
+	hr = httptest.NewRequest(http.MethodPost, "/foobar", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hr = httptest.NewRequest(http.MethodPost, "/foobar", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Empty(t, hrw.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 4, calls)
+
+	a = New()
+
+	calls = 0
+	a.Gases = []Gas{IdempotencyGas(
+		NewMemoryIdempotencyStore(0),
+		WithIdempotencyHeader("X-Request-ID"),
+		WithIdempotencyMaxBodySize(3),
+	)}
+	a.POST("/error", func(req *Request, res *Response) error {
+		calls++
+		return errors.New("handler error")
+	})
+	a.POST("/large", func(req *Request, res *Response) error {
+		calls++
+		return res.WriteString("Foobar")
+	})
+	a.POST("/small", func(req *Request, res *Response) error {
+		calls++
+		return res.WriteString("Foo")
+	})
+
+	for _, p := range []string{"/error", "/large", "/small"} {
+		for i := 0; i < 2; i++ {
+			hr = httptest.NewRequest(http.MethodPost, p, nil)
+			hr.Header.Set("X-Request-ID", "foo")
+			hrw = httptest.NewRecorder()
+
+			a.ServeHTTP(hrw, hr)
+		}
+	}
+
+	assert.Equal(t, 5, calls)
+	assert.Equal(t, "true", hrw.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, "Foo", hrw.Body.String())
+
+	a = New()
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	a.Gases = []Gas{IdempotencyGas(NewMemoryIdempotencyStore(time.Minute))}
+	a.PUT("/foobar", func(req *Request, res *Response) error {
+		started <- struct{}{}
+		<-unblock
+		return res.WriteString("Foobar")
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		hr := httptest.NewRequest(http.MethodPut, "/foobar", nil)
+		hr.Header.Set("Idempotency-Key", "foo")
+		hrw := httptest.NewRecorder()
+
+		a.ServeHTTP(hrw, hr)
+
+		assert.Equal(t, http.StatusOK, hrw.Code)
+	}()
+
+	<-started
+
+	hr = httptest.NewRequest(http.MethodPut, "/foobar", nil)
+	hr.Header.Set("Idempotency-Key", "foo")
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusConflict, hrw.Code)
+
+	close(unblock)
+	<-done
+
+	hr = httptest.NewRequest(http.MethodPut, "/foobar", nil)
+	hr.Header.Set("Idempotency-Key", "foo")
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+	assert.Equal(t, "true", hrw.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, "Foobar", hrw.Body.String())
+}
+
+func TestIdempotencyGasRecheck(t *testing.T) {
+	a := New()
+
+	store := &racyIdempotencyStore{
+		IdempotencyStore: NewMemoryIdempotencyStore(time.Minute),
+	}
+
+	calls := 0
+	a.Gases = []Gas{IdempotencyGas(store)}
+	a.POST("/foobar", func(req *Request, res *Response) error {
+		calls++
+		return res.WriteString("Foobar")
+	})
+
+	assert.NoError(t, store.Store(
+		"POST /foobar foo",
+		&IdempotencyRecord{
+			Status: http.StatusOK,
+			Body:   []byte("Foobar"),
+		},
+	))
+
+	hr := httptest.NewRequest(http.MethodPost, "/foobar", nil)
+	hr.Header.Set("Idempotency-Key", "foo")
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, 0, calls)
+	assert.Equal(t, 2, store.loads)
+	assert.Equal(t, http.StatusOK, hrw.Code)
+	assert.Equal(t, "true", hrw.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, "Foobar", hrw.Body.String())
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	mis := NewMemoryIdempotencyStore(50 * time.Millisecond)
+
+	ir, err := mis.Load("foo")
+	assert.NoError(t, err)
+	assert.Nil(t, ir)
+
+	assert.NoError(t, mis.Store("foo", &IdempotencyRecord{
+		Status: http.StatusOK,
+		Body:   []byte("Foobar"),
+	}))
+
+	ir, err = mis.Load("foo")
+	assert.NoError(t, err)
+	assert.NotNil(t, ir)
+	assert.Equal(t, "Foobar", string(ir.Body))
+
+	time.Sleep(100 * time.Millisecond)
+
+	ir, err = mis.Load("foo")
+	assert.NoError(t, err)
+	assert.Nil(t, ir)
+
+	assert.NoError(t, mis.Store("bar", &IdempotencyRecord{}))
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, mis.Store("baz", &IdempotencyRecord{}))
+
+	assert.Len(t, mis.(*memoryIdempotencyStore).records, 1)
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	lb := &limitedBuffer{
+		max: 6,
+	}
+
+	n, err := lb.Write([]byte("Foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.False(t, lb.overflowed)
+
+	n, err = lb.Write([]byte("bar"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, "Foobar", lb.String())
+
+	n, err = lb.Write([]byte("!"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.True(t, lb.overflowed)
+	assert.Zero(t, lb.Len())
+}
+
+// racyIdempotencyStore is an `IdempotencyStore` whose first `Load` misses, as
+// if the record was stored right after it.
+type racyIdempotencyStore struct {
+	IdempotencyStore
+
+	loads int
+}
+
+func (ris *racyIdempotencyStore) Load(key string) (*IdempotencyRecord, error) {
+	if ris.loads++; ris.loads == 1 {
+		return nil, nil
+	}
+
+	return ris.IdempotencyStore.Load(key)
+}
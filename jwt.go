@@ -0,0 +1,327 @@
+package air
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" // Register the SHA-256 hash function
+	_ "crypto/sha512" // Register the SHA-384 and SHA-512 hash functions
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// jwtClaimsValueKey is the key of the request value used to store the claims
+// parsed by the `JWTGas`.
+const jwtClaimsValueKey = "air.jwt_claims"
+
+// JWTConfig is the configuration of the `JWTGas`.
+type JWTConfig struct {
+	// Algorithm is the algorithm that the tokens must be signed with.
+	//
+	// Supported algorithms:
+	//   * HS256
+	//   * HS384
+	//   * HS512
+	//   * RS256
+	//   * RS384
+	//   * RS512
+	//   * ES256
+	//   * ES384
+	//   * ES512
+	//
+	// Tokens signed with any other algorithm (including "none") are always
+	// rejected.
+	Algorithm string
+
+	// Key is the key used to verify the signatures of the tokens. It must
+	// be a `[]byte` for the HS algorithms, an `*rsa.PublicKey` for the RS
+	// algorithms and an `*ecdsa.PublicKey` for the ES algorithms.
+	Key interface{}
+
+	// KeyFunc returns the key used to verify the signature of a token for
+	// the kid (the "kid" header parameter of the token, which may be
+	// empty). It is useful for key rotation.
+	//
+	// If the `KeyFunc` is not nil, the `Key` is ignored.
+	KeyFunc func(kid string) (interface{}, error)
+
+	// Claims returns a new value that the claims of a token are unmarshaled
+	// into. It must return a pointer.
+	//
+	// If the `Claims` is nil, the claims are unmarshaled into a
+	// `map[string]interface{}`.
+	Claims func() interface{}
+
+	// TokenLookup is the place to look up the tokens. It is in the form of
+	// "<source>:<name>", where the source is one of the "header", "cookie"
+	// and "query".
+	//
+	// When the source is "header", the "Bearer " prefix of the value is
+	// trimmed if present, so both the "Bearer <token>" and the raw token
+	// are accepted.
+	//
+	// If the `TokenLookup` is empty, the "header:Authorization" is used.
+	TokenLookup string
+
+	// Leeway is the leeway allowed when validating the "exp" and "nbf"
+	// claims, to account for clock skew.
+	Leeway time.Duration
+}
+
+// JWTGas returns a `Gas` that authenticates requests with the JSON Web Tokens
+// (see RFC 7519) based on the config.
+//
+// The token of each request is looked up, and then its signature and its "exp"
+// and "nbf" claims are validated. The parsed claims of a valid token can be
+// accessed via the `Request.JWTClaims`. Requests with a missing or an invalid
+// token are rejected with the `http.StatusUnauthorized`.
+func JWTGas(config JWTConfig) Gas {
+	jv := newJWTValidator(config)
+	return func(next Handler) Handler {
+		return func(req *Request, res *Response) error {
+			claims, err := jv.validate(jv.lookup(req))
+			if err != nil {
+				res.Header.Set("WWW-Authenticate", "Bearer")
+				res.Status = http.StatusUnauthorized
+				return errors.New(http.StatusText(res.Status))
+			}
+
+			req.SetValue(jwtClaimsValueKey, claims)
+
+			return next(req, res)
+		}
+	}
+}
+
+// jwtValidator is used by the `JWTGas` to validate tokens.
+type jwtValidator struct {
+	config       JWTConfig
+	hash         crypto.Hash
+	lookupSource string
+	lookupName   string
+}
+
+// newJWTValidator returns a new instance of the `jwtValidator` with the config.
+func newJWTValidator(config JWTConfig) *jwtValidator {
+	jv := &jwtValidator{
+		config: config,
+	}
+
+	if len(config.Algorithm) != 5 {
+		panic("air: unsupported jwt algorithm: " + config.Algorithm)
+	}
+
+	switch config.Algorithm[:2] {
+	case "HS", "RS", "ES":
+	default:
+		panic("air: unsupported jwt algorithm: " + config.Algorithm)
+	}
+
+	switch config.Algorithm[2:] {
+	case "256":
+		jv.hash = crypto.SHA256
+	case "384":
+		jv.hash = crypto.SHA384
+	case "512":
+		jv.hash = crypto.SHA512
+	default:
+		panic("air: unsupported jwt algorithm: " + config.Algorithm)
+	}
+
+	if config.Key == nil && config.KeyFunc == nil {
+		panic("air: jwt key is required")
+	}
+
+	tl := config.TokenLookup
+	if tl == "" {
+		tl = "header:Authorization"
+	}
+
+	tlps := strings.SplitN(tl, ":", 2)
+	if len(tlps) != 2 || tlps[1] == "" {
+		panic("air: invalid jwt token lookup: " + tl)
+	}
+
+	switch tlps[0] {
+	case "header", "cookie", "query":
+	default:
+		panic("air: invalid jwt token lookup: " + tl)
+	}
+
+	jv.lookupSource, jv.lookupName = tlps[0], tlps[1]
+
+	return jv
+}
+
+// lookup returns the token of the req. It returns an empty string if not
+// found.
+func (jv *jwtValidator) lookup(req *Request) string {
+	switch jv.lookupSource {
+	case "header":
+		v := req.Header.Get(jv.lookupName)
+		if len(v) > 7 && strings.EqualFold(v[:7], "Bearer ") {
+			v = v[7:]
+		}
+
+		return strings.TrimSpace(v)
+	case "cookie":
+		if c, err := req.HTTPRequest().Cookie(jv.lookupName); err == nil {
+			return c.Value
+		}
+
+		return ""
+	}
+
+	return req.HTTPRequest().URL.Query().Get(jv.lookupName)
+}
+
+// validate validates the token and returns its claims.
+func (jv *jwtValidator) validate(token string) (interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("air: malformed jwt")
+	}
+
+	hb, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+
+	if err := json.Unmarshal(hb, &header); err != nil {
+		return nil, err
+	} else if header.Alg != jv.config.Algorithm {
+		return nil, errors.New("air: unexpected jwt algorithm")
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+
+	key := jv.config.Key
+	if jv.config.KeyFunc != nil {
+		if key, err = jv.config.KeyFunc(header.Kid); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := jv.verify(parts[0]+"."+parts[1], sig, key); err != nil {
+		return nil, err
+	}
+
+	pb, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	var registeredClaims struct {
+		Exp *float64 `json:"exp"`
+		Nbf *float64 `json:"nbf"`
+	}
+
+	if err := json.Unmarshal(pb, &registeredClaims); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if exp := registeredClaims.Exp; exp != nil &&
+		!now.Before(jwtTime(*exp).Add(jv.config.Leeway)) {
+		return nil, errors.New("air: jwt is expired")
+	}
+
+	if nbf := registeredClaims.Nbf; nbf != nil &&
+		now.Before(jwtTime(*nbf).Add(-jv.config.Leeway)) {
+		return nil, errors.New("air: jwt is not valid yet")
+	}
+
+	var claims interface{}
+	if jv.config.Claims != nil {
+		claims = jv.config.Claims()
+	} else {
+		claims = &map[string]interface{}{}
+	}
+
+	if err := json.Unmarshal(pb, claims); err != nil {
+		return nil, err
+	}
+
+	if m, ok := claims.(*map[string]interface{}); ok &&
+		jv.config.Claims == nil {
+		return *m, nil
+	}
+
+	return claims, nil
+}
+
+// verify verifies the sig of the signingInput with the key.
+func (jv *jwtValidator) verify(
+	signingInput string,
+	sig []byte,
+	key interface{},
+) error {
+	if jv.config.Algorithm[:2] == "HS" {
+		k, ok := key.([]byte)
+		if !ok {
+			return errors.New("air: invalid jwt key")
+		}
+
+		h := hmac.New(jv.hash.New, k)
+		h.Write([]byte(signingInput))
+		if !hmac.Equal(h.Sum(nil), sig) {
+			return errors.New("air: invalid jwt signature")
+		}
+
+		return nil
+	}
+
+	h := jv.hash.New()
+	h.Write([]byte(signingInput))
+	hashed := h.Sum(nil)
+
+	switch jv.config.Algorithm[:2] {
+	case "RS":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("air: invalid jwt key")
+		}
+
+		return rsa.VerifyPKCS1v15(k, jv.hash, hashed, sig)
+	case "ES":
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("air: invalid jwt key")
+		}
+
+		kl := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*kl {
+			return errors.New("air: invalid jwt signature")
+		}
+
+		r := new(big.Int).SetBytes(sig[:kl])
+		s := new(big.Int).SetBytes(sig[kl:])
+		if !ecdsa.Verify(k, hashed, r, s) {
+			return errors.New("air: invalid jwt signature")
+		}
+
+		return nil
+	}
+
+	return errors.New("air: unsupported jwt algorithm")
+}
+
+// jwtTime returns a `time.Time` from the NumericDate v.
+func jwtTime(v float64) time.Time {
+	sec := int64(v)
+	return time.Unix(sec, int64((v-float64(sec))*float64(time.Second)))
+}
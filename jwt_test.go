@@ -0,0 +1,282 @@
+package air
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWTGas(t *testing.T) {
+	key := []byte("foobar")
+	token := fakeJWT(t, "HS256", "", map[string]interface{}{
+		"sub": "foo",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}, key)
+
+	a := New()
+	jg := JWTGas(JWTConfig{
+		Algorithm: "HS256",
+		Key:       key,
+	})
+
+	req, res, _ := fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	assert.NoError(t, jg(func(req *Request, res *Response) error {
+		claims, ok := req.JWTClaims().(map[string]interface{})
+		assert.True(t, ok)
+		assert.Equal(t, "foo", claims["sub"])
+		return nil
+	})(req, res))
+
+	req, res, _ = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.Error(t, jg(func(req *Request, res *Response) error {
+		return nil
+	})(req, res))
+	assert.Equal(t, http.StatusUnauthorized, res.Status)
+	assert.Equal(t, "Bearer", res.Header.Get("WWW-Authenticate"))
+	assert.Nil(t, req.JWTClaims())
+
+	req, res, _ = fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token+"x")
+
+	assert.Error(t, jg(func(req *Request, res *Response) error {
+		return nil
+	})(req, res))
+	assert.Equal(t, http.StatusUnauthorized, res.Status)
+
+	a = New()
+	jg = JWTGas(JWTConfig{
+		Algorithm: "HS256",
+		Key:       key,
+		Claims: func() interface{} {
+			return &struct {
+				Subject string `json:"sub"`
+			}{}
+		},
+		TokenLookup: "query:token",
+	})
+
+	req, res, _ = fakeRRCycle(a, http.MethodGet, "/?token="+token, nil)
+
+	assert.NoError(t, jg(func(req *Request, res *Response) error {
+		claims, ok := req.JWTClaims().(*struct {
+			Subject string `json:"sub"`
+		})
+		assert.True(t, ok)
+		assert.Equal(t, "foo", claims.Subject)
+		return nil
+	})(req, res))
+
+	a = New()
+	jg = JWTGas(JWTConfig{
+		Algorithm:   "HS256",
+		Key:         key,
+		TokenLookup: "header:X-Token",
+	})
+
+	req, res, _ = fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Set("X-Token", token)
+
+	assert.NoError(t, jg(func(req *Request, res *Response) error {
+		assert.NotNil(t, req.JWTClaims())
+		return nil
+	})(req, res))
+
+	req, res, _ = fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Set("X-Token", "Bearer "+token)
+
+	assert.NoError(t, jg(func(req *Request, res *Response) error {
+		assert.NotNil(t, req.JWTClaims())
+		return nil
+	})(req, res))
+
+	a = New()
+	jg = JWTGas(JWTConfig{
+		Algorithm:   "HS256",
+		Key:         key,
+		TokenLookup: "cookie:token",
+	})
+
+	req, res, _ = fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Set("Cookie", "token="+token)
+
+	assert.NoError(t, jg(func(req *Request, res *Response) error {
+		assert.NotNil(t, req.JWTClaims())
+		return nil
+	})(req, res))
+
+	assert.Panics(t, func() {
+		JWTGas(JWTConfig{Algorithm: "none", Key: key})
+	})
+	assert.Panics(t, func() {
+		JWTGas(JWTConfig{Algorithm: "HS257", Key: key})
+	})
+	assert.Panics(t, func() {
+		JWTGas(JWTConfig{Algorithm: "HS256"})
+	})
+	assert.Panics(t, func() {
+		JWTGas(JWTConfig{
+			Algorithm:   "HS256",
+			Key:         key,
+			TokenLookup: "body:token",
+		})
+	})
+}
+
+func TestJWTValidatorValidate(t *testing.T) {
+	key := []byte("foobar")
+	jv := newJWTValidator(JWTConfig{
+		Algorithm: "HS256",
+		Key:       key,
+		Leeway:    time.Minute,
+	})
+
+	_, err := jv.validate("")
+	assert.Error(t, err)
+
+	_, err = jv.validate(fakeJWT(t, "HS512", "", nil, key))
+	assert.Error(t, err)
+
+	_, err = jv.validate(fakeJWT(t, "HS256", "", nil, []byte("barfoo")))
+	assert.Error(t, err)
+
+	_, err = jv.validate(fakeJWT(t, "HS256", "", map[string]interface{}{
+		"exp": time.Now().Add(-2 * time.Minute).Unix(),
+	}, key))
+	assert.Error(t, err)
+
+	_, err = jv.validate(fakeJWT(t, "HS256", "", map[string]interface{}{
+		"exp": time.Now().Add(-30 * time.Second).Unix(),
+	}, key))
+	assert.NoError(t, err)
+
+	_, err = jv.validate(fakeJWT(t, "HS256", "", map[string]interface{}{
+		"nbf": time.Now().Add(2 * time.Minute).Unix(),
+	}, key))
+	assert.Error(t, err)
+
+	_, err = jv.validate(fakeJWT(t, "HS256", "", map[string]interface{}{
+		"nbf": time.Now().Add(30 * time.Second).Unix(),
+	}, key))
+	assert.NoError(t, err)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	jv = newJWTValidator(JWTConfig{
+		Algorithm: "RS256",
+		KeyFunc: func(kid string) (interface{}, error) {
+			if kid != "foo" {
+				return nil, errors.New("unknown kid")
+			}
+
+			return &rsaKey.PublicKey, nil
+		},
+	})
+
+	claims, err := jv.validate(fakeJWT(
+		t,
+		"RS256",
+		"foo",
+		map[string]interface{}{
+			"sub": "bar",
+		},
+		rsaKey,
+	))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"sub": "bar"}, claims)
+
+	_, err = jv.validate(fakeJWT(t, "RS256", "bar", nil, rsaKey))
+	assert.Error(t, err)
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	jv = newJWTValidator(JWTConfig{
+		Algorithm: "ES256",
+		Key:       &ecdsaKey.PublicKey,
+	})
+
+	_, err = jv.validate(fakeJWT(t, "ES256", "", nil, ecdsaKey))
+	assert.NoError(t, err)
+
+	jv = newJWTValidator(JWTConfig{
+		Algorithm: "ES256",
+		Key:       key,
+	})
+
+	_, err = jv.validate(fakeJWT(t, "ES256", "", nil, ecdsaKey))
+	assert.Error(t, err)
+}
+
+func fakeJWT(
+	t *testing.T,
+	alg string,
+	kid string,
+	claims map[string]interface{},
+	key interface{},
+) string {
+	header := map[string]interface{}{
+		"alg": alg,
+		"typ": "JWT",
+	}
+
+	if kid != "" {
+		header["kid"] = kid
+	}
+
+	if claims == nil {
+		claims = map[string]interface{}{}
+	}
+
+	hb, err := json.Marshal(header)
+	assert.NoError(t, err)
+
+	cb, err := json.Marshal(claims)
+	assert.NoError(t, err)
+
+	si := base64.RawURLEncoding.EncodeToString(hb) + "." +
+		base64.RawURLEncoding.EncodeToString(cb)
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		h := hmac.New(sha256.New, k)
+		h.Write([]byte(si))
+		sig = h.Sum(nil)
+	case *rsa.PrivateKey:
+		hashed := sha256.Sum256([]byte(si))
+		sig, err = rsa.SignPKCS1v15(
+			rand.Reader,
+			k,
+			crypto.SHA256,
+			hashed[:],
+		)
+		assert.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		hashed := sha256.Sum256([]byte(si))
+		r, s, err := ecdsa.Sign(rand.Reader, k, hashed[:])
+		assert.NoError(t, err)
+
+		rb, sb := r.Bytes(), s.Bytes()
+		sig = make([]byte, 64)
+		copy(sig[32-len(rb):32], rb)
+		copy(sig[64-len(sb):], sb)
+	}
+
+	return si + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
@@ -7,9 +7,11 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,14 +23,22 @@ var proxyProtocolSign = []byte{
 }
 
 // listener implements the `net.Listener`. It supports the TCP keep-alive and
-// PROXY protocol.
+// PROXY protocol. It may also listen on a Unix domain socket, in which case the
+// `unixListener` is used instead of the `TCPListener`.
 type listener struct {
 	*net.TCPListener
 
+	unixListener              *net.UnixListener
 	a                         *Air
 	allowedPROXYRelayerIPNets []*net.IPNet
+	acceptTCP                 func() (*net.TCPConn, error)
+	closed                    int32
 }
 
+// maxAcceptRetryDelay is the maximum delay between the retries of accepting
+// after temporary errors.
+const maxAcceptRetryDelay = time.Second
+
 // newListener returns a new instance of the `listener` with the a.
 func newListener(a *Air) *listener {
 	var ipNets []*net.IPNet
@@ -50,16 +60,64 @@ func newListener(a *Air) *listener {
 		}
 	}
 
-	return &listener{
+	l := &listener{
 		a:                         a,
 		allowedPROXYRelayerIPNets: ipNets,
 	}
+
+	l.acceptTCP = func() (*net.TCPConn, error) {
+		return l.AcceptTCP()
+	}
+
+	return l
 }
 
 // listen listens on the TCP network address.
+//
+// If the port of the address is "0" and the `Air.PortRange` is not zero, the
+// ports within the `Air.PortRange` are tried sequentially.
+//
+// If the address has the "unix:" prefix (such as "unix:/run/air.sock"), it
+// listens on the Unix domain socket of the path after the prefix instead. See
+// the `listenUnix`.
 func (l *listener) listen(address string) error {
-	nl, err := net.Listen("tcp", address)
-	if err != nil {
+	if path, ok := unixSocketPath(address); ok {
+		return l.listenUnix(path)
+	}
+
+	var (
+		nl  net.Listener
+		err error
+	)
+
+	host, port, _ := net.SplitHostPort(address)
+	if pr := l.a.PortRange; port == "0" && pr != [2]int{} {
+		if pr[0] < 1 || pr[1] < pr[0] || pr[1] > 65535 {
+			return fmt.Errorf(
+				"air: invalid port range: [%d, %d]",
+				pr[0],
+				pr[1],
+			)
+		}
+
+		for p := pr[0]; p <= pr[1]; p++ {
+			nl, err = net.Listen(
+				"tcp",
+				net.JoinHostPort(host, strconv.Itoa(p)),
+			)
+			if err == nil {
+				break
+			}
+		}
+
+		if err != nil {
+			return fmt.Errorf(
+				"air: no free port in range: [%d, %d]",
+				pr[0],
+				pr[1],
+			)
+		}
+	} else if nl, err = net.Listen("tcp", address); err != nil {
 		return err
 	}
 
@@ -68,41 +126,237 @@ func (l *listener) listen(address string) error {
 	return nil
 }
 
+// listenUnix listens on the Unix domain socket of the path.
+//
+// A stale socket file left by a previous process that did not exit cleanly is
+// removed before listening. But if the socket is still being listened on by
+// another process, an error is returned. The socket file is removed when the l
+// is closed.
+//
+// ATTENTION: Whether the socket is still being listened on is probed by
+// connecting to it, so the other process will see a connection that is closed
+// immediately without sending anything.
+func (l *listener) listenUnix(path string) error {
+	if fi, err := os.Lstat(path); err == nil &&
+		fi.Mode()&os.ModeSocket != 0 {
+		if c, err := net.Dial("unix", path); err == nil {
+			c.Close()
+			return fmt.Errorf("air: unix socket in use: %s", path)
+		}
+
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	ul, err := net.ListenUnix("unix", &net.UnixAddr{
+		Name: path,
+		Net:  "unix",
+	})
+	if err != nil {
+		return err
+	}
+
+	l.unixListener = ul
+
+	return nil
+}
+
+// unixSocketPath returns the path of the Unix domain socket of the address if
+// it has the "unix:" prefix.
+func unixSocketPath(address string) (string, bool) {
+	if !strings.HasPrefix(address, "unix:") {
+		return "", false
+	}
+
+	return address[len("unix:"):], true
+}
+
+// listenFDEnvKey is the key of the environment variable that carries the file
+// descriptor of the listener inherited from the parent process. See the
+// `Air.HandOff`.
+const listenFDEnvKey = "AIR_LISTEN_FD"
+
+// inheritedListenerFD returns the file descriptor of the listener inherited
+// from the parent process (if any).
+func inheritedListenerFD() (fd uintptr, inherited bool, err error) {
+	s := os.Getenv(listenFDEnvKey)
+	if s == "" {
+		return 0, false, nil
+	}
+
+	n, err := strconv.ParseUint(s, 10, 0)
+	if err != nil {
+		return 0, false, fmt.Errorf(
+			"air: invalid %s: %s",
+			listenFDEnvKey,
+			s,
+		)
+	}
+
+	return uintptr(n), true, nil
+}
+
+// inherit adopts the TCP listener of the fd inherited from the parent process
+// instead of listening on a new one.
+func (l *listener) inherit(fd uintptr) error {
+	f := os.NewFile(fd, "air-listener")
+	if f == nil {
+		return fmt.Errorf("air: invalid inherited listener fd: %d", fd)
+	}
+	defer f.Close()
+
+	nl, err := net.FileListener(f)
+	if err != nil {
+		return err
+	}
+
+	switch nl := nl.(type) {
+	case *net.TCPListener:
+		l.TCPListener = nl
+	case *net.UnixListener:
+		l.unixListener = nl
+	default:
+		nl.Close()
+		return errors.New(
+			"air: inherited listener is neither a tcp nor a unix " +
+				"listener",
+		)
+	}
+
+	return nil
+}
+
+// file returns a duplicate `os.File` of the underlying listener of the l, which
+// can be inherited by a child process.
+func (l *listener) file() (*os.File, error) {
+	if l.unixListener != nil {
+		// The socket file is still being used by the child process.
+		l.unixListener.SetUnlinkOnClose(false)
+		return l.unixListener.File()
+	}
+
+	return l.TCPListener.File()
+}
+
 // Accept implements the `net.Listener`.
+//
+// The temporary errors are retried with an exponential backoff capped at
+// the `maxAcceptRetryDelay`. The `Air.OnAcceptError` is called when the backoff
+// reaches its cap or a permanent error occurs before the l is closed.
 func (l *listener) Accept() (net.Conn, error) {
-	tc, err := l.AcceptTCP()
-	if err != nil {
+	var (
+		c         net.Conn
+		err       error
+		tempDelay time.Duration
+	)
+
+	for {
+		if l.unixListener != nil {
+			c, err = l.unixListener.Accept()
+		} else {
+			var tc *net.TCPConn
+			if tc, err = l.acceptTCP(); err == nil {
+				tc.SetKeepAlive(true)
+				tc.SetKeepAlivePeriod(3 * time.Minute)
+				c = tc
+			}
+		}
+
+		if err == nil {
+			break
+		}
+
+		if ne, ok := err.(net.Error); ok && ne.Temporary() {
+			if tempDelay == 0 {
+				tempDelay = 5 * time.Millisecond
+			} else {
+				tempDelay *= 2
+			}
+
+			if tempDelay >= maxAcceptRetryDelay {
+				tempDelay = maxAcceptRetryDelay
+				l.onAcceptError(err)
+			}
+
+			time.Sleep(tempDelay)
+
+			continue
+		}
+
+		if atomic.LoadInt32(&l.closed) == 0 {
+			l.onAcceptError(err)
+		}
+
 		return nil, err
 	}
 
-	tc.SetKeepAlive(true)
-	tc.SetKeepAlivePeriod(3 * time.Minute)
-
 	if !l.a.PROXYEnabled {
-		return tc, nil
+		return c, nil
 	}
 
 	proxyable := len(l.allowedPROXYRelayerIPNets) == 0
 	if !proxyable {
-		host, _, _ := net.SplitHostPort(tc.RemoteAddr().String())
-		ip := net.ParseIP(host)
+		var ips []net.IP
+		if l.unixListener != nil {
+			// The relayers connecting via the Unix domain socket
+			// are always on the local machine, so they are
+			// treated as the loopback ones.
+			ips = []net.IP{
+				net.IPv4(127, 0, 0, 1),
+				net.IPv6loopback,
+			}
+		} else {
+			host, _, _ := net.SplitHostPort(c.RemoteAddr().String())
+			ips = []net.IP{net.ParseIP(host)}
+		}
+
+	IPNetLoop:
 		for _, ipNet := range l.allowedPROXYRelayerIPNets {
-			if ipNet.Contains(ip) {
-				proxyable = true
-				break
+			for _, ip := range ips {
+				if ipNet.Contains(ip) {
+					proxyable = true
+					break IPNetLoop
+				}
 			}
 		}
 	}
 
 	if proxyable {
 		return &proxyConn{
-			Conn:              tc,
-			bufReader:         bufio.NewReader(tc),
+			Conn:              c,
+			bufReader:         bufio.NewReader(c),
 			readHeaderTimeout: l.a.PROXYReadHeaderTimeout,
 		}, nil
 	}
 
-	return tc, nil
+	return c, nil
+}
+
+// Close implements the `net.Listener`.
+func (l *listener) Close() error {
+	atomic.StoreInt32(&l.closed, 1)
+	if l.unixListener != nil {
+		return l.unixListener.Close()
+	}
+
+	return l.TCPListener.Close()
+}
+
+// Addr implements the `net.Listener`.
+func (l *listener) Addr() net.Addr {
+	if l.unixListener != nil {
+		return l.unixListener.Addr()
+	}
+
+	return l.TCPListener.Addr()
+}
+
+// onAcceptError calls the `Air.OnAcceptError` with the err if it is not nil.
+func (l *listener) onAcceptError(err error) {
+	if l.a.OnAcceptError != nil {
+		l.a.OnAcceptError(err)
+	}
 }
 
 // proxyConn implements the `net.Conn`. It is used to wrap a `net.Conn` which
@@ -148,6 +402,22 @@ func (pc *proxyConn) RemoteAddr() net.Addr {
 	return pc.Conn.RemoteAddr()
 }
 
+// addrs reports whether the connection of the pc is speaking the PROXY
+// protocol. If so, it also returns the source and destination addresses carried
+// by the PROXY protocol header.
+func (pc *proxyConn) addrs() (used bool, srcAddr, dstAddr net.Addr) {
+	pc.readHeaderOnce.Do(pc.readHeader)
+	if pc.srcAddr == nil {
+		return false, nil, nil
+	}
+
+	return true, pc.srcAddr, pc.dstAddr
+}
+
+// proxyConnContextKey is the key of the `proxyConn` in the context of each
+// request received over it.
+type proxyConnContextKey struct{}
+
 // readHeader reads the PROXY protocol header. It does nothing if the connection
 // of the pc is not speaking the PROXY protocol.
 func (pc *proxyConn) readHeader() {
@@ -0,0 +1,19 @@
+//go:build go1.18
+// +build go1.18
+
+package air
+
+import (
+	"crypto/tls"
+	"net"
+)
+
+// underlyingConn returns the underlying `net.Conn` of the c if it is a
+// `tls.Conn`, otherwise it returns the c.
+func underlyingConn(c net.Conn) net.Conn {
+	if tc, ok := c.(*tls.Conn); ok {
+		return tc.NetConn()
+	}
+
+	return c
+}
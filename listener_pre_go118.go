@@ -0,0 +1,15 @@
+//go:build !go1.18
+// +build !go1.18
+
+package air
+
+import "net"
+
+// underlyingConn returns the underlying `net.Conn` of the c if it is a
+// `tls.Conn`, otherwise it returns the c.
+//
+// The underlying `net.Conn` of a `tls.Conn` is not accessible before Go 1.18,
+// so the c is always returned as is.
+func underlyingConn(c net.Conn) net.Conn {
+	return c
+}
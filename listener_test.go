@@ -1,7 +1,12 @@
 package air
 
 import (
+	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 
@@ -49,6 +54,204 @@ func TestListenerListen(t *testing.T) {
 	l = newListener(a)
 
 	assert.Error(t, l.listen(":-1"))
+
+	a = New()
+	a.PortRange = [2]int{1, 0}
+	l = newListener(a)
+
+	assert.EqualError(
+		t,
+		l.listen("localhost:0"),
+		"air: invalid port range: [1, 0]",
+	)
+
+	ol := newListener(New())
+	assert.NoError(t, ol.listen("localhost:0"))
+
+	_, ps, _ := net.SplitHostPort(ol.Addr().String())
+	p, _ := strconv.Atoi(ps)
+
+	a = New()
+	a.PortRange = [2]int{p, p}
+	l = newListener(a)
+
+	assert.EqualError(
+		t,
+		l.listen("localhost:0"),
+		fmt.Sprintf("air: no free port in range: [%d, %d]", p, p),
+	)
+
+	assert.NoError(t, ol.Close())
+
+	a = New()
+	a.PortRange = [2]int{p, p}
+	l = newListener(a)
+
+	assert.NoError(t, l.listen("localhost:0"))
+	assert.Equal(t, p, l.Addr().(*net.TCPAddr).Port)
+	assert.NoError(t, l.Close())
+}
+
+func TestListenerListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "air.TestListenerListenUnix")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sp := filepath.Join(dir, "air.sock")
+
+	a := New()
+	a.PROXYEnabled = true
+	l := newListener(a)
+
+	assert.NoError(t, l.listen("unix:"+sp))
+	assert.Nil(t, l.TCPListener)
+	assert.Equal(t, sp, l.Addr().String())
+
+	go func() {
+		c, err := net.Dial("unix", sp)
+		if err == nil {
+			c.Write([]byte("PROXY TCP4 1.1.1.1 2.2.2.2 1000 2000\r\n"))
+			c.Close()
+		}
+	}()
+
+	c, err := l.Accept()
+	assert.NoError(t, err)
+	assert.IsType(t, &proxyConn{}, c)
+	assert.Equal(t, "1.1.1.1:1000", c.RemoteAddr().String())
+	c.Close()
+
+	ol := newListener(New())
+	assert.EqualError(
+		t,
+		ol.listen("unix:"+sp),
+		"air: unix socket in use: "+sp,
+	)
+
+	assert.NoError(t, l.Close())
+
+	_, err = os.Stat(sp)
+	assert.True(t, os.IsNotExist(err))
+
+	ul, err := net.ListenUnix("unix", &net.UnixAddr{
+		Name: sp,
+		Net:  "unix",
+	})
+	assert.NoError(t, err)
+	ul.SetUnlinkOnClose(false)
+	assert.NoError(t, ul.Close())
+
+	_, err = os.Stat(sp)
+	assert.NoError(t, err)
+
+	l = newListener(New())
+	assert.NoError(t, l.listen("unix:"+sp))
+	assert.NoError(t, l.Close())
+
+	assert.NoError(t, ioutil.WriteFile(sp, []byte("Foobar"), 0600))
+
+	l = newListener(New())
+	assert.Error(t, l.listen("unix:"+sp))
+}
+
+func TestListenerAcceptUnixPROXYRelayer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "air.TestListenerAcceptUnixPROXYRelayer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sp := filepath.Join(dir, "air.sock")
+
+	for _, tt := range []struct {
+		whitelist []string
+		proxyable bool
+	}{
+		{[]string{"127.0.0.1"}, true},
+		{[]string{"::1"}, true},
+		{[]string{"1.1.1.1"}, false},
+	} {
+		a := New()
+		a.PROXYEnabled = true
+		a.PROXYRelayerIPWhitelist = tt.whitelist
+		l := newListener(a)
+
+		assert.NoError(t, l.listen("unix:"+sp))
+
+		go func() {
+			c, err := net.Dial("unix", sp)
+			if err == nil {
+				c.Write([]byte(
+					"PROXY TCP4 1.1.1.1 2.2.2.2 1000 2000\r\n",
+				))
+				c.Close()
+			}
+		}()
+
+		c, err := l.Accept()
+		assert.NoError(t, err)
+		if tt.proxyable {
+			assert.IsType(t, &proxyConn{}, c)
+			assert.Equal(t, "1.1.1.1:1000", c.RemoteAddr().String())
+		} else {
+			assert.IsType(t, &net.UnixConn{}, c)
+		}
+
+		c.Close()
+		assert.NoError(t, l.Close())
+	}
+}
+
+func TestInheritedListenerFD(t *testing.T) {
+	defer os.Unsetenv(listenFDEnvKey)
+
+	os.Unsetenv(listenFDEnvKey)
+
+	fd, inherited, err := inheritedListenerFD()
+	assert.NoError(t, err)
+	assert.False(t, inherited)
+	assert.Zero(t, fd)
+
+	os.Setenv(listenFDEnvKey, "3")
+
+	fd, inherited, err = inheritedListenerFD()
+	assert.NoError(t, err)
+	assert.True(t, inherited)
+	assert.Equal(t, uintptr(3), fd)
+
+	os.Setenv(listenFDEnvKey, "foobar")
+
+	fd, inherited, err = inheritedListenerFD()
+	assert.EqualError(t, err, "air: invalid AIR_LISTEN_FD: foobar")
+	assert.False(t, inherited)
+	assert.Zero(t, fd)
+}
+
+func TestListenerInherit(t *testing.T) {
+	nl, err := net.Listen("tcp", "localhost:0")
+	assert.NoError(t, err)
+	defer nl.Close()
+
+	f, err := nl.(*net.TCPListener).File()
+	assert.NoError(t, err)
+
+	l := newListener(New())
+	assert.NoError(t, l.inherit(f.Fd()))
+	f.Close()
+
+	assert.Equal(t, nl.Addr().String(), l.Addr().String())
+
+	go func() {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err == nil {
+			c.Close()
+		}
+	}()
+
+	c, err := l.Accept()
+	assert.NoError(t, err)
+	assert.NotNil(t, c)
+	c.Close()
+
+	assert.NoError(t, l.Close())
 }
 
 func TestListenerAccept(t *testing.T) {
@@ -142,6 +345,60 @@ func TestListenerAccept(t *testing.T) {
 	assert.NoError(t, l.Close())
 }
 
+func TestListenerAcceptErrors(t *testing.T) {
+	a := New()
+
+	var acceptErrors []error
+	a.OnAcceptError = func(err error) {
+		acceptErrors = append(acceptErrors, err)
+	}
+
+	l := newListener(a)
+
+	assert.NoError(t, l.listen("localhost:0"))
+
+	cc, err := net.Dial("tcp", l.Addr().String())
+	assert.NotNil(t, cc)
+	assert.NoError(t, err)
+	assert.NoError(t, cc.SetDeadline(time.Now().Add(100*time.Millisecond)))
+
+	tempErrors := 2
+	l.acceptTCP = func() (*net.TCPConn, error) {
+		if tempErrors > 0 {
+			tempErrors--
+			return nil, &fakeNetError{temporary: true}
+		}
+
+		return l.AcceptTCP()
+	}
+
+	c, err := l.Accept()
+	assert.NotNil(t, c)
+	assert.NoError(t, err)
+	assert.Zero(t, tempErrors)
+	assert.Empty(t, acceptErrors)
+
+	l.acceptTCP = func() (*net.TCPConn, error) {
+		return nil, &fakeNetError{}
+	}
+
+	c, err = l.Accept()
+	assert.Nil(t, c)
+	assert.Error(t, err)
+	assert.Equal(t, []error{err}, acceptErrors)
+
+	l.acceptTCP = func() (*net.TCPConn, error) {
+		return l.AcceptTCP()
+	}
+
+	assert.NoError(t, l.Close())
+
+	c, err = l.Accept()
+	assert.Nil(t, c)
+	assert.Error(t, err)
+	assert.Len(t, acceptErrors, 1)
+}
+
 func TestPROXYConnRead(t *testing.T) {
 	a := New()
 	a.PROXYEnabled = true
@@ -758,3 +1015,19 @@ func TestPROXYConnReadHeader(t *testing.T) {
 
 	assert.NoError(t, l.Close())
 }
+
+type fakeNetError struct {
+	temporary bool
+}
+
+func (fne *fakeNetError) Error() string {
+	return "fake net error"
+}
+
+func (fne *fakeNetError) Timeout() bool {
+	return false
+}
+
+func (fne *fakeNetError) Temporary() bool {
+	return fne.temporary
+}
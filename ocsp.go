@@ -0,0 +1,231 @@
+package air
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// ocspRetryInterval is the interval between the retries of fetching an OCSP
+// response after a failure.
+const ocspRetryInterval = 10 * time.Minute
+
+// errNoOCSPServer is returned when a TLS certificate does not specify any OCSP
+// server. Such a certificate is never stapled.
+var errNoOCSPServer = errors.New("no ocsp server in certificate")
+
+// ocspStapler is used to staple the OCSP responses to the TLS certificates.
+type ocspStapler struct {
+	a       *Air
+	client  *http.Client
+	staples map[string]*ocspStaple
+	mutex   sync.Mutex
+}
+
+// ocspStaple is a cached OCSP response of a TLS certificate.
+type ocspStaple struct {
+	raw        []byte
+	nextUpdate time.Time
+	refreshAt  time.Time
+	fetching   bool
+}
+
+// newOCSPStapler returns a new instance of the `ocspStapler` with the a.
+func newOCSPStapler(a *Air) *ocspStapler {
+	return &ocspStapler{
+		a: a,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		staples: map[string]*ocspStaple{},
+	}
+}
+
+// staple returns a copy of the c with the cached OCSP response stapled. If the
+// cached OCSP response is missing or needs to be refreshed, a new one will be
+// fetched in the background and stapled to the later copies of the c.
+//
+// If the `Air.TestMode` is true, the new OCSP response is fetched synchronously
+// and stapled to the returned copy of the c.
+func (st *ocspStapler) staple(c *tls.Certificate) *tls.Certificate {
+	if c == nil || len(c.Certificate) < 2 {
+		return c
+	}
+
+	key := string(c.Certificate[0])
+	now := time.Now()
+
+	st.mutex.Lock()
+	s := st.staples[key]
+	if s == nil {
+		s = &ocspStaple{}
+		st.staples[key] = s
+	}
+
+	if !s.fetching && !now.Before(s.refreshAt) {
+		s.fetching = true
+		if st.a.TestMode {
+			st.mutex.Unlock()
+			st.refresh(c)
+			st.mutex.Lock()
+		} else {
+			go st.refresh(c)
+		}
+	}
+
+	raw := s.raw
+	if now.After(s.nextUpdate) {
+		raw = nil
+	}
+
+	st.mutex.Unlock()
+
+	if raw == nil {
+		return c
+	}
+
+	cc := *c
+	cc.OCSPStaple = raw
+
+	return &cc
+}
+
+// refresh fetches a new OCSP response for the c and caches it.
+func (st *ocspStapler) refresh(c *tls.Certificate) error {
+	raw, res, err := st.fetch(c)
+
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	s := st.staples[string(c.Certificate[0])]
+	if s == nil {
+		s = &ocspStaple{}
+		st.staples[string(c.Certificate[0])] = s
+	}
+
+	s.fetching = false
+	if err == errNoOCSPServer {
+		s.refreshAt = time.Unix(1<<62, 0)
+		return err
+	} else if err != nil {
+		s.refreshAt = time.Now().Add(ocspRetryInterval)
+		st.a.logErrorf("air: failed to fetch ocsp response: %v", err)
+		return err
+	}
+
+	s.raw = raw
+	if res.NextUpdate.IsZero() {
+		s.nextUpdate = time.Now().Add(time.Hour)
+		s.refreshAt = s.nextUpdate
+	} else {
+		s.nextUpdate = res.NextUpdate
+		s.refreshAt = res.ThisUpdate.Add(
+			res.NextUpdate.Sub(res.ThisUpdate) / 2,
+		)
+	}
+
+	return nil
+}
+
+// fetch fetches an OCSP response for the c from the OCSP server of its issuer.
+func (st *ocspStapler) fetch(
+	c *tls.Certificate,
+) ([]byte, *ocsp.Response, error) {
+	leaf, err := x509.ParseCertificate(c.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(leaf.OCSPServer) == 0 {
+		return nil, nil, errNoOCSPServer
+	}
+
+	issuer, err := x509.ParseCertificate(c.Certificate[1])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hr, err := http.NewRequest(
+		http.MethodPost,
+		leaf.OCSPServer[0],
+		bytes.NewReader(b),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hr.Header.Set("Content-Type", "application/ocsp-request")
+	hr.Header.Set("Accept", "application/ocsp-response")
+
+	hrr, err := st.client.Do(hr.WithContext(st.a.context))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer hrr.Body.Close()
+
+	if hrr.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf(
+			"unexpected ocsp server response status: %d",
+			hrr.StatusCode,
+		)
+	}
+
+	raw, err := ioutil.ReadAll(io.LimitReader(hrr.Body, 1<<20))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if res.Status == ocsp.Unknown {
+		return nil, nil, errors.New("unknown ocsp certificate status")
+	}
+
+	return raw, res, nil
+}
+
+// matchTLSCertificate returns the certificate in the cs that matches the
+// serverName. The first one of the cs is returned if none of them matches. It
+// returns nil if the cs is empty.
+func matchTLSCertificate(
+	cs []tls.Certificate,
+	serverName string,
+) *tls.Certificate {
+	if len(cs) == 0 {
+		return nil
+	}
+
+	if serverName != "" && len(cs) > 1 {
+		for i := range cs {
+			leaf := cs[i].Leaf
+			if leaf == nil && len(cs[i].Certificate) > 0 {
+				leaf, _ = x509.ParseCertificate(
+					cs[i].Certificate[0],
+				)
+			}
+
+			if leaf != nil && leaf.VerifyHostname(serverName) == nil {
+				return &cs[i]
+			}
+		}
+	}
+
+	return &cs[0]
+}
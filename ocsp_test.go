@@ -0,0 +1,155 @@
+package air
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestOCSPStaplerStaple(t *testing.T) {
+	a := New()
+
+	var buf bytes.Buffer
+	a.ErrorLogger = log.New(&buf, "", 0)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Air Test CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDER, err := x509.CreateCertificate(
+		rand.Reader,
+		ca,
+		ca,
+		&caKey.PublicKey,
+		caKey,
+	)
+	assert.NoError(t, err)
+
+	ca, err = x509.ParseCertificate(caDER)
+	assert.NoError(t, err)
+
+	requests := int32(0)
+	s := httptest.NewServer(http.HandlerFunc(func(
+		rw http.ResponseWriter,
+		r *http.Request,
+	) {
+		atomic.AddInt32(&requests, 1)
+
+		b, _ := ioutil.ReadAll(r.Body)
+		or, err := ocsp.ParseRequest(b)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		raw, _ := ocsp.CreateResponse(ca, ca, ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: or.SerialNumber,
+			ThisUpdate:   now.Add(-time.Minute),
+			NextUpdate:   now.Add(time.Hour),
+		}, caKey)
+		rw.Write(raw)
+	}))
+	defer s.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		OCSPServer:   []string{s.URL},
+	}, ca, &key.PublicKey, caKey)
+	assert.NoError(t, err)
+
+	c := &tls.Certificate{
+		Certificate: [][]byte{der, caDER},
+		PrivateKey:  key,
+	}
+
+	st := a.ocspStapler
+
+	assert.Nil(t, st.staple(nil))
+	assert.Equal(t, c, st.staple(c))
+
+	time.Sleep(100 * time.Millisecond)
+
+	sc := st.staple(c)
+	assert.NotEqual(t, c, sc)
+	assert.Nil(t, c.OCSPStaple)
+	assert.NotEmpty(t, sc.OCSPStaple)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	or, err := ocsp.ParseResponseForCert(sc.OCSPStaple, nil, ca)
+	assert.NoError(t, err)
+	assert.Equal(t, ocsp.Good, or.Status)
+	assert.Equal(t, big.NewInt(2), or.SerialNumber)
+
+	a.TestMode = true
+	st.staples = map[string]*ocspStaple{}
+
+	sc = st.staple(c)
+	assert.NotEqual(t, c, sc)
+	assert.NotEmpty(t, sc.OCSPStaple)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	a.TestMode = false
+
+	dc, err := newDevTLSCertificate()
+	assert.NoError(t, err)
+	assert.Equal(t, &dc, st.staple(&dc))
+
+	c = &tls.Certificate{
+		Certificate: [][]byte{dc.Certificate[0], caDER},
+		PrivateKey:  dc.PrivateKey,
+	}
+
+	assert.Equal(t, errNoOCSPServer, st.refresh(c))
+	assert.Equal(t, c, st.staple(c))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	assert.Empty(t, buf.String())
+}
+
+func TestMatchTLSCertificate(t *testing.T) {
+	assert.Nil(t, matchTLSCertificate(nil, "localhost"))
+
+	c1, err := newDevTLSCertificate()
+	assert.NoError(t, err)
+
+	c2 := c1
+	c2.Leaf = &x509.Certificate{DNSNames: []string{"example.com"}}
+
+	cs := []tls.Certificate{c2, c1}
+	assert.Same(t, &cs[0], matchTLSCertificate(cs, ""))
+	assert.Same(t, &cs[0], matchTLSCertificate(cs, "example.com"))
+	assert.Same(t, &cs[1], matchTLSCertificate(cs, "localhost"))
+	assert.Same(t, &cs[0], matchTLSCertificate(cs, "example.org"))
+}
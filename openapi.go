@@ -0,0 +1,256 @@
+package air
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// OpenAPIInfo is the metadata about the API described by the OpenAPI document
+// generated by the `Air.EnableOpenAPI`.
+type OpenAPIInfo struct {
+	// Title is the title of the API.
+	Title string `json:"title"`
+
+	// Description is the description of the API.
+	Description string `json:"description,omitempty"`
+
+	// Version is the version of the API.
+	Version string `json:"version"`
+}
+
+// OpenAPIOperation is the OpenAPI metadata of a route.
+//
+// All of the schemas are declared by users and assembled as is. No schema
+// inference is performed.
+type OpenAPIOperation struct {
+	// OperationID is the unique ID of the operation.
+	//
+	// If the `OperationID` is empty, the `Route.Name` will be used.
+	OperationID string
+
+	// Summary is the short summary of the operation.
+	Summary string
+
+	// Description is the description of the operation.
+	Description string
+
+	// Tags is the tags of the operation.
+	Tags []string
+
+	// Parameters is the parameters of the operation.
+	//
+	// The path parameters that are not declared in the `Parameters` will
+	// be added automatically as strings.
+	Parameters []OpenAPIParameter
+
+	// RequestBody is the schema of the request body of the operation.
+	//
+	// The `RequestBody` will be declared as "application/json" if it is
+	// not nil.
+	RequestBody interface{}
+
+	// Responses is the response schemas of the operation, keyed by status
+	// code.
+	//
+	// A nil schema means the response has no body. A zero key means the
+	// default response.
+	Responses map[int]interface{}
+
+	// Deprecated indicates whether the operation is deprecated.
+	Deprecated bool
+}
+
+// OpenAPIParameter is a parameter of an `OpenAPIOperation`.
+type OpenAPIParameter struct {
+	// Name is the name of the parameter.
+	Name string `json:"name"`
+
+	// In is the location of the parameter.
+	//
+	// The `In` must be one of the "query", "header", "path" and "cookie".
+	In string `json:"in"`
+
+	// Description is the description of the parameter.
+	Description string `json:"description,omitempty"`
+
+	// Required indicates whether the parameter is required.
+	//
+	// The `Required` is always treated as true when the `In` is "path".
+	Required bool `json:"required,omitempty"`
+
+	// Schema is the schema of the parameter.
+	//
+	// The `Schema` defaults to the string type if it is nil.
+	Schema interface{} `json:"schema"`
+}
+
+// EnableOpenAPI registers a new GET route for the path in the router of the a
+// that serves a minimal OpenAPI 3 JSON document with the info.
+//
+// The document is assembled from all routes registered in the router of the a
+// at the time each request is served, with the `Route.OpenAPI` of each route
+// describing its operation. The CONNECT routes and the route of the document
+// itself are not included.
+func (a *Air) EnableOpenAPI(path string, info OpenAPIInfo) {
+	a.GET(path, func(req *Request, res *Response) error {
+		return res.WriteJSON(a.openAPIDocument(req.Route(), info))
+	})
+}
+
+// openAPIDocument returns the OpenAPI document of all routes registered in the
+// router of the a except the self with the info.
+func (a *Air) openAPIDocument(self *Route, info OpenAPIInfo) interface{} {
+	paths := map[string]map[string]interface{}{}
+	for _, rt := range a.router.snapshotRoutes() {
+		if rt == self || rt.Method == http.MethodConnect {
+			continue
+		}
+
+		path, paramNames := openAPIPath(rt.Path)
+
+		pi := paths[path]
+		if pi == nil {
+			pi = map[string]interface{}{}
+			paths[path] = pi
+		}
+
+		pi[strings.ToLower(rt.Method)] = openAPIOperation(rt, paramNames)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    info,
+		"paths":   paths,
+	}
+}
+
+// openAPIPath converts the path of a route into the OpenAPI path template and
+// returns it with the names of the path parameters.
+func openAPIPath(path string) (string, []string) {
+	var paramNames []string
+
+	ps := strings.Split(path, "/")
+	for i, p := range ps {
+		if p == "*" {
+			paramNames = append(paramNames, "*")
+			ps[i] = "{*}"
+		} else if ci := strings.IndexByte(p, ':'); ci >= 0 {
+			paramNames = append(paramNames, p[ci+1:])
+			ps[i] = p[:ci] + "{" + p[ci+1:] + "}"
+		}
+	}
+
+	return strings.Join(ps, "/"), paramNames
+}
+
+// openAPIOperation returns the OpenAPI operation object of the rt with the
+// paramNames.
+func openAPIOperation(rt *Route, paramNames []string) interface{} {
+	op := rt.OpenAPI
+	if op == nil {
+		op = &OpenAPIOperation{}
+	}
+
+	o := map[string]interface{}{}
+
+	if op.OperationID != "" {
+		o["operationId"] = op.OperationID
+	} else if rt.Name != "" {
+		o["operationId"] = rt.Name
+	}
+
+	if op.Summary != "" {
+		o["summary"] = op.Summary
+	}
+
+	if op.Description != "" {
+		o["description"] = op.Description
+	}
+
+	if len(op.Tags) > 0 {
+		o["tags"] = op.Tags
+	}
+
+	if op.Deprecated {
+		o["deprecated"] = true
+	}
+
+	params := make([]OpenAPIParameter, 0, len(op.Parameters))
+	declaredPathParams := map[string]bool{}
+	for _, p := range op.Parameters {
+		if p.In == "path" {
+			p.Required = true
+			declaredPathParams[p.Name] = true
+		}
+
+		if p.Schema == nil {
+			p.Schema = map[string]interface{}{"type": "string"}
+		}
+
+		params = append(params, p)
+	}
+
+	for _, pn := range paramNames {
+		if !declaredPathParams[pn] {
+			params = append(params, OpenAPIParameter{
+				Name:     pn,
+				In:       "path",
+				Required: true,
+				Schema: map[string]interface{}{
+					"type": "string",
+				},
+			})
+		}
+	}
+
+	if len(params) > 0 {
+		o["parameters"] = params
+	}
+
+	if op.RequestBody != nil {
+		o["requestBody"] = map[string]interface{}{
+			"content": openAPIContent(op.RequestBody),
+		}
+	}
+
+	responses := map[string]interface{}{}
+	for code, schema := range op.Responses {
+		key, desc := "default", "Default response"
+		if code != 0 {
+			key = strconv.Itoa(code)
+			if desc = http.StatusText(code); desc == "" {
+				desc = key
+			}
+		}
+
+		r := map[string]interface{}{
+			"description": desc,
+		}
+
+		if schema != nil {
+			r["content"] = openAPIContent(schema)
+		}
+
+		responses[key] = r
+	}
+
+	if len(responses) == 0 {
+		responses["default"] = map[string]interface{}{
+			"description": "Default response",
+		}
+	}
+
+	o["responses"] = responses
+
+	return o
+}
+
+// openAPIContent returns the OpenAPI content object of the schema.
+func openAPIContent(schema interface{}) interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{
+			"schema": schema,
+		},
+	}
+}
@@ -0,0 +1,153 @@
+package air
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAirEnableOpenAPI(t *testing.T) {
+	a := New()
+
+	h := func(req *Request, res *Response) error {
+		return nil
+	}
+
+	a.RegisterRoutes([]Route{
+		{
+			Method:  http.MethodGet,
+			Path:    "/users/:ID",
+			Handler: h,
+			Name:    "getUser",
+			OpenAPI: &OpenAPIOperation{
+				Summary: "Get a user",
+				Tags:    []string{"users"},
+				Parameters: []OpenAPIParameter{
+					{
+						Name: "fields",
+						In:   "query",
+					},
+				},
+				Responses: map[int]interface{}{
+					http.StatusOK: map[string]interface{}{
+						"type": "object",
+					},
+					http.StatusNotFound: nil,
+				},
+			},
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/users",
+			Handler: h,
+			OpenAPI: &OpenAPIOperation{
+				OperationID: "createUser",
+				RequestBody: map[string]interface{}{
+					"type": "object",
+				},
+			},
+		},
+	})
+	a.CONNECT("/foobar", h)
+	a.EnableOpenAPI("/openapi.json", OpenAPIInfo{
+		Title:   "Foobar",
+		Version: "1.0.0",
+	})
+
+	hr := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(
+		t,
+		"application/json; charset=utf-8",
+		hrwr.Header.Get("Content-Type"),
+	)
+
+	doc := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(hrwrb, &doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+	assert.Equal(t, map[string]interface{}{
+		"title":   "Foobar",
+		"version": "1.0.0",
+	}, doc["info"])
+	assert.Equal(t, map[string]interface{}{
+		"/users/{ID}": map[string]interface{}{
+			"get": map[string]interface{}{
+				"operationId": "getUser",
+				"summary":     "Get a user",
+				"tags":        []interface{}{"users"},
+				"parameters": []interface{}{
+					map[string]interface{}{
+						"name": "fields",
+						"in":   "query",
+						"schema": map[string]interface{}{
+							"type": "string",
+						},
+					},
+					map[string]interface{}{
+						"name":     "ID",
+						"in":       "path",
+						"required": true,
+						"schema": map[string]interface{}{
+							"type": "string",
+						},
+					},
+				},
+				"responses": map[string]interface{}{
+					"200": map[string]interface{}{
+						"description": "OK",
+						"content": map[string]interface{}{
+							"application/json": map[string]interface{}{
+								"schema": map[string]interface{}{
+									"type": "object",
+								},
+							},
+						},
+					},
+					"404": map[string]interface{}{
+						"description": "Not Found",
+					},
+				},
+			},
+		},
+		"/users": map[string]interface{}{
+			"post": map[string]interface{}{
+				"operationId": "createUser",
+				"requestBody": map[string]interface{}{
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{
+							"schema": map[string]interface{}{
+								"type": "object",
+							},
+						},
+					},
+				},
+				"responses": map[string]interface{}{
+					"default": map[string]interface{}{
+						"description": "Default response",
+					},
+				},
+			},
+		},
+	}, doc["paths"])
+}
+
+func TestOpenAPIPath(t *testing.T) {
+	path, paramNames := openAPIPath("/")
+	assert.Equal(t, "/", path)
+	assert.Nil(t, paramNames)
+
+	path, paramNames = openAPIPath("/foo/:Bar/v:Version/*")
+	assert.Equal(t, "/foo/{Bar}/v{Version}/{*}", path)
+	assert.Equal(t, []string{"Bar", "Version", "*"}, paramNames)
+}
@@ -0,0 +1,159 @@
+package air
+
+import (
+	"compress/gzip"
+	"errors"
+	"time"
+)
+
+// Option defines a function to configure the `Air` created by the
+// `NewWithOptions`.
+type Option func(*Air)
+
+// NewWithOptions returns a new instance of the `Air` with default field values
+// and then configured by the opts in order.
+//
+// The `NewWithOptions` is an alternative to the `New` followed by setting the
+// fields directly. It validates the combination of the configured fields and
+// returns an error if they do not make sense together.
+func NewWithOptions(opts ...Option) (*Air, error) {
+	a := New()
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	if err := a.validateOptions(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// WithAppName returns an `Option` that sets the `Air.AppName` to the appName.
+func WithAppName(appName string) Option {
+	return func(a *Air) {
+		a.AppName = appName
+	}
+}
+
+// WithDebugMode returns an `Option` that sets the `Air.DebugMode` to the
+// debugMode.
+func WithDebugMode(debugMode bool) Option {
+	return func(a *Air) {
+		a.DebugMode = debugMode
+	}
+}
+
+// WithAddress returns an `Option` that sets the `Air.Address` to the address
+// and the `Air.ExtraAddresses` to the extraAddresses.
+func WithAddress(address string, extraAddresses ...string) Option {
+	return func(a *Air) {
+		a.Address = address
+		a.ExtraAddresses = extraAddresses
+	}
+}
+
+// WithTimeouts returns an `Option` that sets the `Air.ReadTimeout`, the
+// `Air.WriteTimeout` and the `Air.IdleTimeout` to the read, write and idle.
+func WithTimeouts(read, write, idle time.Duration) Option {
+	return func(a *Air) {
+		a.ReadTimeout = read
+		a.WriteTimeout = write
+		a.IdleTimeout = idle
+	}
+}
+
+// WithTLS returns an `Option` that sets the `Air.TLSCertFile` and the
+// `Air.TLSKeyFile` to the certFile and keyFile.
+func WithTLS(certFile, keyFile string) Option {
+	return func(a *Air) {
+		a.TLSCertFile = certFile
+		a.TLSKeyFile = keyFile
+	}
+}
+
+// WithACME returns an `Option` that enables the ACME feature and sets the
+// `Air.ACMEHostWhitelist` to the hostWhitelist.
+func WithACME(hostWhitelist ...string) Option {
+	return func(a *Air) {
+		a.ACMEEnabled = true
+		a.ACMEHostWhitelist = hostWhitelist
+	}
+}
+
+// WithHTTPSEnforced returns an `Option` that enforces HTTPS and sets the
+// `Air.HTTPSEnforcedPort` to the port.
+func WithHTTPSEnforced(port string) Option {
+	return func(a *Air) {
+		a.HTTPSEnforced = true
+		a.HTTPSEnforcedPort = port
+	}
+}
+
+// WithGzip returns an `Option` that enables the gzip feature and sets the
+// `Air.GzipCompressionLevel` to the level. If the mimeTypes is not empty, it
+// also sets the `Air.GzipMIMETypes` to the mimeTypes.
+func WithGzip(level int, mimeTypes ...string) Option {
+	return func(a *Air) {
+		a.GzipEnabled = true
+		a.GzipCompressionLevel = level
+		if len(mimeTypes) > 0 {
+			a.GzipMIMETypes = mimeTypes
+		}
+	}
+}
+
+// WithPregases returns an `Option` that appends the pregases to the
+// `Air.Pregases`.
+func WithPregases(pregases ...Gas) Option {
+	return func(a *Air) {
+		a.Pregases = append(a.Pregases, pregases...)
+	}
+}
+
+// WithGases returns an `Option` that appends the gases to the `Air.Gases`.
+func WithGases(gases ...Gas) Option {
+	return func(a *Air) {
+		a.Gases = append(a.Gases, gases...)
+	}
+}
+
+// WithConfigFile returns an `Option` that sets the `Air.ConfigFile` to the
+// configFile.
+func WithConfigFile(configFile string) Option {
+	return func(a *Air) {
+		a.ConfigFile = configFile
+	}
+}
+
+// validateOptions validates the combination of the fields of the a.
+func (a *Air) validateOptions() error {
+	if a.Address == "" {
+		return errors.New("air: empty address")
+	}
+
+	if (a.TLSCertFile == "") != (a.TLSKeyFile == "") {
+		return errors.New(
+			"air: tls cert file and tls key file must be set " +
+				"together",
+		)
+	}
+
+	if a.ACMEEnabled && a.ACMEDirectoryURL == "" {
+		return errors.New("air: acme requires an acme directory url")
+	}
+
+	if a.HTTPSEnforced &&
+		!a.ACMEEnabled &&
+		a.TLSConfig == nil &&
+		a.TLSCertFile == "" {
+		return errors.New("air: https enforcement requires tls")
+	}
+
+	if a.GzipEnabled && (a.GzipCompressionLevel < gzip.HuffmanOnly ||
+		a.GzipCompressionLevel > gzip.BestCompression) {
+		return errors.New("air: invalid gzip compression level")
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package air
+
+import (
+	"compress/gzip"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	a, err := NewWithOptions()
+	assert.NoError(t, err)
+	assert.NotNil(t, a)
+	assert.Equal(t, "air", a.AppName)
+	assert.Equal(t, "localhost:8080", a.Address)
+
+	gas := func(next Handler) Handler {
+		return next
+	}
+
+	a, err = NewWithOptions(
+		WithAppName("foobar"),
+		WithDebugMode(true),
+		WithAddress("localhost:0", "127.0.0.1:0"),
+		WithTimeouts(time.Second, 2*time.Second, 3*time.Second),
+		WithTLS("foo.crt", "foo.key"),
+		WithACME("example.com"),
+		WithHTTPSEnforced("80"),
+		WithGzip(gzip.BestSpeed, "text/plain"),
+		WithPregases(gas),
+		WithGases(gas, gas),
+		WithConfigFile("config.toml"),
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, a)
+	assert.Equal(t, "foobar", a.AppName)
+	assert.True(t, a.DebugMode)
+	assert.Equal(t, "localhost:0", a.Address)
+	assert.Equal(t, []string{"127.0.0.1:0"}, a.ExtraAddresses)
+	assert.Equal(t, time.Second, a.ReadTimeout)
+	assert.Equal(t, 2*time.Second, a.WriteTimeout)
+	assert.Equal(t, 3*time.Second, a.IdleTimeout)
+	assert.Equal(t, "foo.crt", a.TLSCertFile)
+	assert.Equal(t, "foo.key", a.TLSKeyFile)
+	assert.True(t, a.ACMEEnabled)
+	assert.Equal(t, []string{"example.com"}, a.ACMEHostWhitelist)
+	assert.True(t, a.HTTPSEnforced)
+	assert.Equal(t, "80", a.HTTPSEnforcedPort)
+	assert.True(t, a.GzipEnabled)
+	assert.Equal(t, gzip.BestSpeed, a.GzipCompressionLevel)
+	assert.Equal(t, []string{"text/plain"}, a.GzipMIMETypes)
+	assert.Len(t, a.Pregases, 1)
+	assert.Len(t, a.Gases, 2)
+	assert.Equal(t, "config.toml", a.ConfigFile)
+
+	a, err = NewWithOptions(WithGzip(gzip.BestSpeed))
+	assert.NoError(t, err)
+	assert.NotNil(t, a)
+	assert.Equal(t, New().GzipMIMETypes, a.GzipMIMETypes)
+
+	a, err = NewWithOptions(WithHTTPSEnforced("80"), func(a *Air) {
+		a.TLSConfig = &tls.Config{}
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, a)
+
+	a, err = NewWithOptions(WithAddress(""))
+	assert.Error(t, err)
+	assert.Nil(t, a)
+
+	a, err = NewWithOptions(WithTLS("foo.crt", ""))
+	assert.Error(t, err)
+	assert.Nil(t, a)
+
+	a, err = NewWithOptions(WithACME(), func(a *Air) {
+		a.ACMEDirectoryURL = ""
+	})
+	assert.Error(t, err)
+	assert.Nil(t, a)
+
+	a, err = NewWithOptions(WithHTTPSEnforced("80"))
+	assert.Error(t, err)
+	assert.Nil(t, a)
+
+	a, err = NewWithOptions(WithGzip(10))
+	assert.Error(t, err)
+	assert.Nil(t, a)
+}
@@ -1,12 +1,14 @@
 package air
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sync"
 	"time"
 
@@ -38,7 +40,7 @@ func (r *renderer) load() {
 		}
 	}()
 
-	if r.watcher == nil {
+	if r.watcher == nil && !r.a.TestMode {
 		r.watcher, r.loadError = fsnotify.NewWatcher()
 		if r.loadError != nil {
 			return
@@ -80,8 +82,21 @@ func (r *renderer) load() {
 			"strlen":   strlen,
 			"substr":   substr,
 			"timefmt":  timefmt,
-		}).
-		Funcs(r.a.RendererTemplateFuncMap)
+		})
+
+	if r.a.RendererBuiltinFuncs {
+		t.Funcs(template.FuncMap{
+			"dict":     dict,
+			"default":  defaultValue,
+			"safeHTML": str2html,
+			"safeURL":  safeURL,
+			"T":        locstr,
+			"asset":    r.a.AssetURL,
+		})
+	}
+
+	t.Funcs(r.a.RendererTemplateFuncMap)
+
 	if r.loadError = filepath.Walk(
 		tr,
 		func(p string, fi os.FileInfo, err error) error {
@@ -104,6 +119,10 @@ func (r *renderer) load() {
 				return err
 			}
 
+			if r.watcher == nil {
+				return nil
+			}
+
 			return r.watcher.Add(p)
 		},
 	); r.loadError != nil {
@@ -138,9 +157,14 @@ func (r *renderer) render(
 		return err
 	}
 
-	return t.Funcs(template.FuncMap{
+	fm := template.FuncMap{
 		"locstr": locstr,
-	}).Execute(w, v)
+	}
+	if r.a.RendererBuiltinFuncs && r.a.RendererTemplateFuncMap["T"] == nil {
+		fm["T"] = locstr
+	}
+
+	return t.Funcs(fm).Execute(w, v)
 }
 
 // locstr returns the key without any changes.
@@ -169,3 +193,52 @@ func substr(s string, i, j int) string {
 func timefmt(t time.Time, layout string) string {
 	return t.Format(layout)
 }
+
+// dict returns a map built from the kvs, which are key-value pairs with string
+// keys.
+func dict(kvs ...interface{}) (map[string]interface{}, error) {
+	if len(kvs)%2 != 0 {
+		return nil, errors.New("air: odd number of dict arguments")
+	}
+
+	m := make(map[string]interface{}, len(kvs)/2)
+	for i := 0; i < len(kvs); i += 2 {
+		k, ok := kvs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf(
+				"air: non-string dict key: %v",
+				kvs[i],
+			)
+		}
+
+		m[k] = kvs[i+1]
+	}
+
+	return m, nil
+}
+
+// defaultValue returns the v if it is not empty, otherwise returns the d.
+func defaultValue(d interface{}, v ...interface{}) interface{} {
+	if len(v) == 0 || v[0] == nil {
+		return d
+	}
+
+	rv := reflect.ValueOf(v[0])
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		if rv.Len() == 0 {
+			return d
+		}
+	default:
+		if rv.IsZero() {
+			return d
+		}
+	}
+
+	return v[0]
+}
+
+// safeURL returns a `template.URL` for the s.
+func safeURL(s string) template.URL {
+	return template.URL(s)
+}
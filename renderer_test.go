@@ -1,10 +1,12 @@
 package air
 
 import (
+	"bytes"
 	"html/template"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -38,6 +40,24 @@ func TestRendererLoad(t *testing.T) {
 	assert.Nil(t, r.loadError)
 	assert.NotNil(t, r.watcher)
 	assert.NotNil(t, r.template)
+
+	assert.NoError(t, ioutil.WriteFile(
+		filepath.Join(a.RendererTemplateRoot, "test.html"),
+		[]byte(`<a href="/">Go Home</a>`),
+		os.ModePerm,
+	))
+
+	a = New()
+	a.TestMode = true
+	a.RendererTemplateRoot = dir
+
+	r = a.renderer
+
+	r.load()
+	assert.Nil(t, r.loadError)
+	assert.Nil(t, r.watcher)
+	assert.NotNil(t, r.template)
+	assert.NotNil(t, r.template.Lookup("test.html"))
 }
 
 func TestRendererRender(t *testing.T) {
@@ -77,6 +97,72 @@ func TestRendererRender(t *testing.T) {
 	r = a.renderer
 
 	assert.NoError(t, r.render(ioutil.Discard, "test.html", nil, locstr))
+
+	a = New()
+	a.RendererTemplateRoot = dir
+
+	r = a.renderer
+
+	assert.NoError(t, ioutil.WriteFile(
+		filepath.Join(a.RendererTemplateRoot, "builtin.html"),
+		[]byte(`{{template "sub.html" dict "Foo" .Foo "Bar" "bar"}}`+
+			`{{default "qux" .Baz}}{{safeHTML "<b>"}}{{T "Foobar"}}`),
+		os.ModePerm,
+	))
+
+	assert.NoError(t, ioutil.WriteFile(
+		filepath.Join(a.RendererTemplateRoot, "sub.html"),
+		[]byte(`{{.Foo}}{{.Bar}}`),
+		os.ModePerm,
+	))
+
+	buf := bytes.Buffer{}
+	assert.Error(t, r.render(&buf, "builtin.html", map[string]interface{}{
+		"Foo": "foo",
+	}, locstr))
+
+	a = New()
+	a.RendererTemplateRoot = dir
+	a.RendererBuiltinFuncs = true
+
+	r = a.renderer
+
+	buf.Reset()
+	assert.NoError(t, r.render(&buf, "builtin.html", map[string]interface{}{
+		"Foo": "foo",
+	}, locstr))
+	assert.Equal(t, "foobarqux<b>Foobar", buf.String())
+
+	a = New()
+	a.RendererTemplateRoot = dir
+	a.RendererBuiltinFuncs = true
+	a.RendererTemplateFuncMap = template.FuncMap{
+		"T": strings.ToUpper,
+	}
+
+	r = a.renderer
+
+	buf.Reset()
+	assert.NoError(t, r.render(&buf, "builtin.html", map[string]interface{}{
+		"Foo": "foo",
+		"Baz": "baz",
+	}, locstr))
+	assert.Equal(t, "foobarbaz<b>FOOBAR", buf.String())
+
+	a = New()
+	a.RendererTemplateRoot = dir
+	a.RendererBuiltinFuncs = true
+	a.I18nEnabled = true
+
+	r = a.renderer
+
+	buf.Reset()
+	assert.NoError(t, r.render(&buf, "builtin.html", map[string]interface{}{
+		"Foo": "foo",
+	}, func(key string) string {
+		return "Localized " + key
+	}))
+	assert.Equal(t, "foobarqux<b>Localized Foobar", buf.String())
 }
 
 func TestLocstr(t *testing.T) {
@@ -104,3 +190,37 @@ func TestTimefmt(t *testing.T) {
 		timefmt(time.Unix(0, 0).UTC(), time.RFC3339),
 	)
 }
+
+func TestDict(t *testing.T) {
+	m, err := dict("Foo", "bar", "Bar", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"Foo": "bar", "Bar": 1}, m)
+
+	m, err = dict("Foo")
+	assert.Error(t, err)
+	assert.Nil(t, m)
+
+	m, err = dict(1, "Foo")
+	assert.Error(t, err)
+	assert.Nil(t, m)
+}
+
+func TestDefaultValue(t *testing.T) {
+	assert.Equal(t, "foo", defaultValue("foo"))
+	assert.Equal(t, "foo", defaultValue("foo", nil))
+	assert.Equal(t, "foo", defaultValue("foo", ""))
+	assert.Equal(t, "foo", defaultValue("foo", 0))
+	assert.Equal(t, "foo", defaultValue("foo", []string{}))
+	assert.Equal(t, "foo", defaultValue("foo", false))
+	assert.Equal(t, "bar", defaultValue("foo", "bar"))
+	assert.Equal(t, 1, defaultValue("foo", 1))
+	assert.Equal(t, true, defaultValue("foo", true))
+}
+
+func TestSafeURL(t *testing.T) {
+	assert.Equal(
+		t,
+		template.URL("javascript:void(0)"),
+		safeURL("javascript:void(0)"),
+	)
+}
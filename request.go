@@ -2,12 +2,16 @@ package air
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"mime/multipart"
 	"net"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -100,10 +104,17 @@ type Request struct {
 	hr                   *http.Request
 	res                  *Response
 	params               []*RequestParam
+	route                *Route
+	routeHandlers        map[string]Handler
 	routeParamNames      []string
 	routeParamValues     []string
+	routeParamCount      int
 	parseRouteParamsOnce sync.Once
 	parseOtherParamsOnce sync.Once
+	multipartCleanedUp   bool
+	multipartReaderUsed  bool
+	queryValues          url.Values
+	queryValuesRawQuery  string
 	values               map[string]interface{}
 	localizedString      func(string) string
 }
@@ -113,10 +124,17 @@ func (r *Request) reset(a *Air, hr *http.Request, res *Response) {
 	r.Air = a
 	r.res = res
 	r.params = r.params[:0]
+	r.route = nil
+	r.routeHandlers = nil
 	r.routeParamNames = nil
 	r.routeParamValues = nil
+	r.routeParamCount = 0
 	r.parseRouteParamsOnce = sync.Once{}
 	r.parseOtherParamsOnce = sync.Once{}
+	r.multipartCleanedUp = false
+	r.multipartReaderUsed = false
+	r.queryValues = nil
+	r.queryValuesRawQuery = ""
 	for key := range r.values {
 		delete(r.values, key)
 	}
@@ -203,6 +221,61 @@ func (r *Request) RemoteHost() string {
 	return r.RemoteAddress()
 }
 
+// ClientCertificates returns the certificates presented by the client of the
+// r over TLS, the first one is the leaf certificate. It returns nil if the r
+// was not received over TLS or the client presented no certificate.
+//
+// The certificates have been verified only when the `Air.TLSClientAuth` is
+// the `tls.VerifyClientCertIfGiven` or the `tls.RequireAndVerifyClientCert`.
+func (r *Request) ClientCertificates() []*x509.Certificate {
+	if r.hr.TLS == nil {
+		return nil
+	}
+
+	return r.hr.TLS.PeerCertificates
+}
+
+// ProxyProtocol reports whether the r was received over a connection speaking
+// the PROXY protocol (see the `Air.PROXYEnabled`). If so, it also returns the
+// source and destination addresses carried by the PROXY protocol header, and
+// the `RemoteAddress` is the source address.
+//
+// The connections over TLS are only recognized by the server built with Go
+// 1.18 or later.
+func (r *Request) ProxyProtocol() (used bool, srcAddr, dstAddr net.Addr) {
+	if pc, ok := r.proxyConn(); ok {
+		return pc.addrs()
+	}
+
+	return false, nil, nil
+}
+
+// ProxyRelayerAddress returns the network address of the relayer that
+// forwarded the r over the PROXY protocol. It returns "" if the r was not
+// received over the PROXY protocol. See the `ProxyProtocol`.
+//
+// It is useful for deciding whether to trust the relayer.
+func (r *Request) ProxyRelayerAddress() string {
+	if pc, ok := r.proxyConn(); ok {
+		if used, _, _ := pc.addrs(); used {
+			return pc.Conn.RemoteAddr().String()
+		}
+	}
+
+	return ""
+}
+
+// proxyConn returns the `proxyConn` that the r was received over.
+func (r *Request) proxyConn() (*proxyConn, bool) {
+	if r.Context == nil {
+		return nil, false
+	}
+
+	pc, ok := r.Context.Value(proxyConnContextKey{}).(*proxyConn)
+
+	return pc, ok
+}
+
 // ClientAddress returns the original network address that sent the r.
 //
 // Usually, the original network address is the same as the last network address
@@ -263,6 +336,38 @@ func (r *Request) RawQuery() string {
 	return ""
 }
 
+// QueryValues returns the values parsed from the `RawQuery` of the r. Unlike
+// the `Params`, it never contains the route params or the form params, and it
+// never triggers the parsing of the `Body`.
+//
+// The values are parsed once and cached until the query part of the `Path`
+// changes. The returned `url.Values` should not be modified.
+func (r *Request) QueryValues() url.Values {
+	rq := r.RawQuery()
+	if r.queryValues == nil || r.queryValuesRawQuery != rq {
+		r.queryValues, _ = url.ParseQuery(rq)
+		r.queryValuesRawQuery = rq
+	}
+
+	return r.queryValues
+}
+
+// Protocol returns the protocol that the r is actually transferred over. It is
+// one of the "HTTP/1.0", "HTTP/1.1", "h2" (HTTP/2 over TLS) and "h2c" (HTTP/2
+// over cleartext TCP).
+func (r *Request) Protocol() string {
+	if r.hr.ProtoMajor == 2 {
+		if r.hr.TLS == nil {
+			return "h2c"
+		}
+
+		return "h2"
+	}
+
+	return "HTTP/" + strconv.Itoa(r.hr.ProtoMajor) + "." +
+		strconv.Itoa(r.hr.ProtoMinor)
+}
+
 // Cookies returns all `http.Cookie` in the r.
 func (r *Request) Cookies() []*http.Cookie {
 	return r.hr.Cookies()
@@ -275,6 +380,35 @@ func (r *Request) Cookie(name string) *http.Cookie {
 	return c
 }
 
+// Route returns the `Route` that matches the r. It returns nil if not found.
+//
+// The returned `Route` is shared by all requests that match it, so it should
+// never be modified.
+func (r *Request) Route() *Route {
+	return r.route
+}
+
+// AllowedMethods returns the sorted methods registered for the route path that
+// matches the r. It returns nil if no route path matches the r.
+//
+// The `AllowedMethods` is available even if the method of the r is not
+// registered for the matched route path, so it is useful for the
+// `Air.MethodNotAllowedHandler` to make informed decisions.
+func (r *Request) AllowedMethods() []string {
+	if len(r.routeHandlers) == 0 {
+		return nil
+	}
+
+	ms := make([]string, 0, len(r.routeHandlers))
+	for m := range r.routeHandlers {
+		ms = append(ms, m)
+	}
+
+	sort.Strings(ms)
+
+	return ms
+}
+
 // Params returns all `RequestParam` in the r.
 func (r *Request) Params() []*RequestParam {
 	r.parseRouteParamsOnce.Do(r.parseRouteParams)
@@ -282,6 +416,30 @@ func (r *Request) Params() []*RequestParam {
 	return r.params
 }
 
+// ParamMap returns all `RequestParam` in the r as a map of names to values.
+// The values of each name are in the access order of the
+// `RequestParam.Values`. The multipart form file values are not included.
+//
+// Note that the returned map is always non-nil.
+func (r *Request) ParamMap() map[string][]string {
+	ps := r.Params()
+	pm := make(map[string][]string, len(ps))
+	for _, p := range ps {
+		vs := make([]string, 0, len(p.Values))
+		for _, pv := range p.Values {
+			if s, ok := pv.i.(string); ok {
+				vs = append(vs, s)
+			}
+		}
+
+		if len(vs) > 0 {
+			pm[p.Name] = vs
+		}
+	}
+
+	return pm
+}
+
 // Param returns the matched `RequestParam` for the name. It returns nil if not
 // found.
 func (r *Request) Param(name string) *RequestParam {
@@ -296,6 +454,16 @@ func (r *Request) Param(name string) *RequestParam {
 	return nil
 }
 
+// Wildcard returns the value of the wildcard route param (the "*") of the r. It
+// returns an empty string if not found.
+func (r *Request) Wildcard() string {
+	if pv := r.ParamValue("*"); pv != nil {
+		return pv.String()
+	}
+
+	return ""
+}
+
 // ParamValue returns the first value of the matched `RequestParam` for the
 // name. It returns nil if not found or there are no values.
 func (r *Request) ParamValue(name string) *RequestParamValue {
@@ -324,7 +492,8 @@ RouteParamLoop:
 
 			pvs := make([]*RequestParamValue, len(p.Values)+1)
 			pvs[0] = &RequestParamValue{
-				i: pv,
+				i:   pv,
+				raw: r.routeParamValues[i],
 			}
 
 			copy(pvs[1:], p.Values)
@@ -337,7 +506,8 @@ RouteParamLoop:
 			Name: pn,
 			Values: []*RequestParamValue{
 				{
-					i: pv,
+					i:   pv,
+					raw: r.routeParamValues[i],
 				},
 			},
 		})
@@ -345,6 +515,7 @@ RouteParamLoop:
 
 	r.Air.router.routeParamValuesPool.Put(r.routeParamValues)
 
+	r.routeParamCount = len(r.params)
 	r.routeParamNames = nil
 	r.routeParamValues = nil
 }
@@ -383,6 +554,12 @@ FormLoop:
 		})
 	}
 
+	if r.multipartReaderUsed {
+		// The body has been consumed by the `MultipartReader`, so
+		// there are no multipart form params to parse.
+		return
+	}
+
 	if r.hr.MultipartForm == nil {
 		r.hr.ParseMultipartForm(32 << 20)
 	}
@@ -448,6 +625,23 @@ MultipartFormFileLoop:
 	}
 }
 
+// CleanupMultipart removes all temporary files associated with the multipart
+// form of the r. It is called automatically when the request-response cycle is
+// finished, so there is no need to call it unless you want to free those files
+// early.
+//
+// Note that the file params of the r are no longer accessible after the
+// `CleanupMultipart` is called.
+func (r *Request) CleanupMultipart() error {
+	if r.multipartCleanedUp || r.hr.MultipartForm == nil {
+		return nil
+	}
+
+	r.multipartCleanedUp = true
+
+	return r.hr.MultipartForm.RemoveAll()
+}
+
 // growParams grows the capacity of the `r.params`, if necessary, to guarantee
 // space for another n.
 func (r *Request) growParams(n int) {
@@ -483,6 +677,36 @@ func (r *Request) SetValue(key string, value interface{}) {
 	r.Values()[key] = value
 }
 
+// JWTClaims returns the claims of the JSON Web Token of the r parsed by the
+// `JWTGas`. It returns nil if not found.
+//
+// The type of the returned value is the type returned by the
+// `JWTConfig.Claims`, or the `map[string]interface{}` if it is nil.
+func (r *Request) JWTClaims() interface{} {
+	return r.Value(jwtClaimsValueKey)
+}
+
+// MultipartReader returns a `multipart.Reader` that reads the parts of the
+// multipart body (such as the "multipart/form-data") of the r one by one as
+// they arrive, which is useful for streaming large uploads straight to storage
+// without buffering them in memory or on disk.
+//
+// It returns an error if the body of the r is not multipart, has been parsed
+// as a multipart form (such as by the `Params`, `Param` and `Bind`) or has been
+// read by a previous call to it. After calling it, the form params in the body
+// are no longer available to the `Params` and `Param`, but the route params and
+// the query params still are. And the `Bind` returns an error for the body.
+func (r *Request) MultipartReader() (*multipart.Reader, error) {
+	mr, err := r.HTTPRequest().MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	r.multipartReaderUsed = true
+
+	return mr, nil
+}
+
 // Bind binds the r into the v based on the Content-Type header.
 //
 // Supported MIME types:
@@ -494,10 +718,124 @@ func (r *Request) SetValue(key string, value interface{}) {
 //   * application/yaml
 //   * application/x-www-form-urlencoded
 //   * multipart/form-data
+//
+// More MIME types can be supported by the `Air.RegisterBinder`.
+//
+// After the r has been bound, the v is validated by its own `Validate() error`
+// method (if any) and the `Air.Validator` (if any).
 func (r *Request) Bind(v interface{}) error {
 	return r.Air.binder.bind(v, r)
 }
 
+// BindParams binds the route params and the query params of the r into the v,
+// which must be a pointer to a struct. Unlike the `Bind`, it never reads the
+// body of the r, so the form params are not bound.
+//
+// The params are bound in the same way as the `Bind` binds the form params
+// (see the `Air.FormBindStyle`), and the slice fields receive all values of
+// the repeated params. The values of a route param come before the query
+// params with the same name. After the r has been bound, the v is validated
+// just like the `Bind`.
+func (r *Request) BindParams(v interface{}) error {
+	r.parseRouteParamsOnce.Do(r.parseRouteParams)
+
+	qvs := r.QueryValues()
+	ps := make([]*RequestParam, 0, r.routeParamCount+len(qvs))
+	for _, p := range r.params[:r.routeParamCount] {
+		pvs := make([]*RequestParamValue, 1, 1+len(qvs[p.Name]))
+		pvs[0] = p.Values[0]
+		for _, qv := range qvs[p.Name] {
+			pvs = append(pvs, &RequestParamValue{
+				i: qv,
+			})
+		}
+
+		ps = append(ps, &RequestParam{
+			Name:   p.Name,
+			Values: pvs,
+		})
+	}
+
+QueryValueLoop:
+	for n, vs := range qvs {
+		if len(vs) == 0 {
+			continue
+		}
+
+		for _, p := range ps[:r.routeParamCount] {
+			if p.Name == n {
+				continue QueryValueLoop
+			}
+		}
+
+		pvs := make([]*RequestParamValue, len(vs))
+		for i, qv := range vs {
+			pvs[i] = &RequestParamValue{
+				i: qv,
+			}
+		}
+
+		ps = append(ps, &RequestParam{
+			Name:   n,
+			Values: pvs,
+		})
+	}
+
+	if err := r.Air.binder.bindParams(v, ps); err != nil {
+		return err
+	}
+
+	return r.Air.binder.validate(v, r)
+}
+
+// DecodeJSONStream decodes the successive JSON values (such as the ND-JSON) in
+// the body of the r one by one without loading the entire body into memory.
+//
+// The fn is called once for each value with a decode function, which decodes
+// the current value into the v. If the fn does not call the decode function,
+// the current value is skipped. The decoding stops when the body is exhausted
+// or an error occurs, and that error (if any) is returned.
+//
+// Any limit on the size of the body (such as the one set by the
+// `http.MaxBytesReader`) is honored since the body is read as is.
+func (r *Request) DecodeJSONStream(
+	fn func(decode func(v interface{}) error) error,
+) error {
+	if r.Body == nil {
+		return nil
+	}
+
+	d := json.NewDecoder(&eofReader{r: r.Body})
+	for d.More() {
+		decoded := false
+		if err := fn(func(v interface{}) error {
+			if decoded {
+				return errors.New("air: json value already decoded")
+			}
+
+			decoded = true
+
+			return d.Decode(v)
+		}); err != nil {
+			return err
+		}
+
+		if !decoded {
+			if err := d.Decode(&json.RawMessage{}); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The `json.Decoder.More` swallows errors, so make sure the body is
+	// really exhausted.
+	if err := d.Decode(&json.RawMessage{}); !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return nil
+}
+
 // LocalizedString returns a localized string for the key based on the
 // Accept-Language header. It returns the key without any changes if the
 // `I18nEnabled` of the `Air` of the r is false or something goes wrong.
@@ -542,6 +880,193 @@ func (rp *RequestParam) Value() *RequestParamValue {
 	return rp.Values[0]
 }
 
+// Bools returns a `[]bool` from the underlying values of the rp. It returns
+// an error aggregating all conversion errors if any of the values fails to
+// convert.
+func (rp *RequestParam) Bools() ([]bool, error) {
+	if rp == nil {
+		return nil, nil
+	}
+
+	bs := make([]bool, len(rp.Values))
+	if err := rp.eachValue(func(i int, rpv *RequestParamValue) (err error) {
+		bs[i], err = rpv.Bool()
+		return
+	}); err != nil {
+		return nil, err
+	}
+
+	return bs, nil
+}
+
+// Ints returns an `[]int` from the underlying values of the rp. It returns an
+// error aggregating all conversion errors if any of the values fails to
+// convert.
+func (rp *RequestParam) Ints() ([]int, error) {
+	if rp == nil {
+		return nil, nil
+	}
+
+	is := make([]int, len(rp.Values))
+	if err := rp.eachValue(func(i int, rpv *RequestParamValue) (err error) {
+		is[i], err = rpv.Int()
+		return
+	}); err != nil {
+		return nil, err
+	}
+
+	return is, nil
+}
+
+// Int64s returns an `[]int64` from the underlying values of the rp. It returns
+// an error aggregating all conversion errors if any of the values fails to
+// convert.
+func (rp *RequestParam) Int64s() ([]int64, error) {
+	if rp == nil {
+		return nil, nil
+	}
+
+	i64s := make([]int64, len(rp.Values))
+	if err := rp.eachValue(func(i int, rpv *RequestParamValue) (err error) {
+		i64s[i], err = rpv.Int64()
+		return
+	}); err != nil {
+		return nil, err
+	}
+
+	return i64s, nil
+}
+
+// Uints returns an `[]uint` from the underlying values of the rp. It returns
+// an error aggregating all conversion errors if any of the values fails to
+// convert.
+func (rp *RequestParam) Uints() ([]uint, error) {
+	if rp == nil {
+		return nil, nil
+	}
+
+	uis := make([]uint, len(rp.Values))
+	if err := rp.eachValue(func(i int, rpv *RequestParamValue) (err error) {
+		uis[i], err = rpv.Uint()
+		return
+	}); err != nil {
+		return nil, err
+	}
+
+	return uis, nil
+}
+
+// Uint64s returns an `[]uint64` from the underlying values of the rp. It
+// returns an error aggregating all conversion errors if any of the values fails
+// to convert.
+func (rp *RequestParam) Uint64s() ([]uint64, error) {
+	if rp == nil {
+		return nil, nil
+	}
+
+	ui64s := make([]uint64, len(rp.Values))
+	if err := rp.eachValue(func(i int, rpv *RequestParamValue) (err error) {
+		ui64s[i], err = rpv.Uint64()
+		return
+	}); err != nil {
+		return nil, err
+	}
+
+	return ui64s, nil
+}
+
+// Float64s returns a `[]float64` from the underlying values of the rp. It
+// returns an error aggregating all conversion errors if any of the values fails
+// to convert.
+func (rp *RequestParam) Float64s() ([]float64, error) {
+	if rp == nil {
+		return nil, nil
+	}
+
+	f64s := make([]float64, len(rp.Values))
+	if err := rp.eachValue(func(i int, rpv *RequestParamValue) (err error) {
+		f64s[i], err = rpv.Float64()
+		return
+	}); err != nil {
+		return nil, err
+	}
+
+	return f64s, nil
+}
+
+// Segments returns the path segments of the first value of the rp, which is
+// usually the value of the wildcard route param (the "*"). The value is split
+// on "/" and then each segment is URL-decoded, so an encoded "/" (the "%2F")
+// within a segment is preserved. Values not from the route params have already
+// been decoded, so they are split as is. Empty segments are dropped.
+func (rp *RequestParam) Segments() []string {
+	rpv := rp.Value()
+	if rpv == nil {
+		return nil
+	}
+
+	decode := true
+	v := rpv.raw
+	if v == "" {
+		decode = false
+		v = rpv.String()
+	}
+
+	ss := make([]string, 0, strings.Count(v, "/")+1)
+	for _, s := range strings.Split(v, "/") {
+		if s == "" {
+			continue
+		}
+
+		if decode {
+			if us, err := url.PathUnescape(s); err == nil {
+				s = us
+			}
+		}
+
+		ss = append(ss, s)
+	}
+
+	return ss
+}
+
+// Strings returns a `[]string` from the underlying values of the rp.
+func (rp *RequestParam) Strings() []string {
+	if rp == nil {
+		return nil
+	}
+
+	ss := make([]string, len(rp.Values))
+	for i, rpv := range rp.Values {
+		ss[i] = rpv.String()
+	}
+
+	return ss
+}
+
+// eachValue calls the f for each value of the rp and aggregates all errors
+// returned by the f into one.
+func (rp *RequestParam) eachValue(
+	f func(i int, rpv *RequestParamValue) error,
+) error {
+	var es []string
+	for i, rpv := range rp.Values {
+		if err := f(i, rpv); err != nil {
+			es = append(es, fmt.Sprintf("value %d: %v", i, err))
+		}
+	}
+
+	if len(es) > 0 {
+		return fmt.Errorf(
+			"air: invalid request param %s: %s",
+			rp.Name,
+			strings.Join(es, "; "),
+		)
+	}
+
+	return nil
+}
+
 // RequestParamValue is an HTTP request param value.
 //
 // The `RequestParamValue` may represent a route param value, request query
@@ -549,6 +1074,7 @@ func (rp *RequestParam) Value() *RequestParamValue {
 // form file value.
 type RequestParamValue struct {
 	i    interface{}
+	raw  string
 	b    *bool
 	i64  *int64
 	ui64 *uint64
@@ -842,3 +1368,25 @@ func (rb *requestBody) Close() error {
 	rb.closed = true
 	return rb.rc.Close()
 }
+
+// eofReader is used to make the `io.EOF` of the underlying `io.Reader` sticky,
+// since the `requestBody` closes itself once it is exhausted and then rejects
+// any further reads.
+type eofReader struct {
+	r      io.Reader
+	sawEOF bool
+}
+
+// Read implements the `io.Reader`.
+func (er *eofReader) Read(b []byte) (int, error) {
+	if er.sawEOF {
+		return 0, io.EOF
+	}
+
+	n, err := er.r.Read(b)
+	if errors.Is(err, io.EOF) {
+		er.sawEOF = true
+	}
+
+	return n, err
+}
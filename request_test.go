@@ -1,18 +1,24 @@
 package air
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -132,6 +138,90 @@ func TestRequestClientHost(t *testing.T) {
 	assert.Equal(t, "2001:Db8:CaFe::17", req.ClientHost())
 }
 
+func TestRequestClientCertificates(t *testing.T) {
+	a := New()
+
+	req, _, _ := fakeRRCycle(a, http.MethodGet, "/", nil)
+	assert.Nil(t, req.ClientCertificates())
+
+	c, err := newDevTLSCertificate()
+	assert.NoError(t, err)
+
+	req.hr.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{c.Leaf},
+	}
+	assert.Equal(t, []*x509.Certificate{c.Leaf}, req.ClientCertificates())
+}
+
+func TestRequestProxyProtocol(t *testing.T) {
+	a := New()
+
+	req, _, _ := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	used, srcAddr, dstAddr := req.ProxyProtocol()
+	assert.False(t, used)
+	assert.Nil(t, srcAddr)
+	assert.Nil(t, dstAddr)
+	assert.Empty(t, req.ProxyRelayerAddress())
+
+	a = New()
+	a.Address = "localhost:0"
+	a.PROXYEnabled = true
+	a.GET("/", func(req *Request, res *Response) error {
+		used, srcAddr, dstAddr := req.ProxyProtocol()
+		if !used {
+			return res.WriteString("unused")
+		}
+
+		return res.WriteString(fmt.Sprint(
+			srcAddr,
+			" ",
+			dstAddr,
+			" ",
+			req.ProxyRelayerAddress() != "",
+		))
+	})
+
+	hijackOSStdout()
+
+	go a.Serve()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	for _, header := range []string{
+		"PROXY TCP4 127.0.0.2 127.0.0.3 8081 8082\r\n",
+		"",
+	} {
+		cc, err := net.Dial("tcp", a.Addresses()[0])
+		assert.NoError(t, err)
+		assert.NotNil(t, cc)
+
+		cc.Write([]byte(header))
+		cc.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+
+		hr, err := http.ReadResponse(bufio.NewReader(cc), nil)
+		assert.NoError(t, err)
+		assert.NotNil(t, hr)
+
+		hrb, _ := ioutil.ReadAll(hr.Body)
+		hr.Body.Close()
+		cc.Close()
+
+		if header == "" {
+			assert.Equal(t, "unused", string(hrb))
+		} else {
+			assert.Equal(
+				t,
+				"127.0.0.2:8081 127.0.0.3:8082 true",
+				string(hrb),
+			)
+		}
+	}
+
+	assert.NoError(t, a.Close())
+}
+
 func TestRequestRawPath(t *testing.T) {
 	a := New()
 
@@ -158,6 +248,51 @@ func TestRequestRawQuery(t *testing.T) {
 	assert.Equal(t, "foo=bar", req.RawQuery())
 }
 
+func TestRequestQueryValues(t *testing.T) {
+	a := New()
+
+	req, _, _ := fakeRRCycle(a, http.MethodGet, "/foo/bar", nil)
+	assert.NotNil(t, req.QueryValues())
+	assert.Empty(t, req.QueryValues())
+
+	req, _, _ = fakeRRCycle(
+		a,
+		http.MethodPost,
+		"/foo/bar?foo=bar&foo=baz&bar=%20qux",
+		strings.NewReader("foo=foobar"),
+	)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	assert.Equal(t, url.Values{
+		"foo": {"bar", "baz"},
+		"bar": {" qux"},
+	}, req.QueryValues())
+
+	b, err := ioutil.ReadAll(req.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo=foobar", string(b))
+
+	req.Path = "/foo/bar?baz=qux"
+	assert.Equal(t, url.Values{"baz": {"qux"}}, req.QueryValues())
+}
+
+func TestRequestProtocol(t *testing.T) {
+	a := New()
+
+	req, _, _ := fakeRRCycle(a, http.MethodGet, "/", nil)
+	assert.Equal(t, "HTTP/1.1", req.Protocol())
+
+	req.HTTPRequest().ProtoMajor = 1
+	req.HTTPRequest().ProtoMinor = 0
+	assert.Equal(t, "HTTP/1.0", req.Protocol())
+
+	req.HTTPRequest().ProtoMajor = 2
+	req.HTTPRequest().ProtoMinor = 0
+	assert.Equal(t, "h2c", req.Protocol())
+
+	req.HTTPRequest().TLS = &tls.ConnectionState{}
+	assert.Equal(t, "h2", req.Protocol())
+}
+
 func TestRequestCookies(t *testing.T) {
 	a := New()
 
@@ -205,6 +340,75 @@ func TestRequestCookie(t *testing.T) {
 	assert.Nil(t, c)
 }
 
+func TestRequestRoute(t *testing.T) {
+	a := New()
+
+	req, _, _ := fakeRRCycle(a, http.MethodGet, "/", nil)
+	assert.Nil(t, req.Route())
+
+	a.GET("/:Foo", func(req *Request, res *Response) error {
+		return nil
+	})
+
+	req, _, _ = fakeRRCycle(a, http.MethodGet, "/bar", nil)
+	a.router.route(req)
+	assert.NotNil(t, req.Route())
+	assert.Equal(t, http.MethodGet, req.Route().Method)
+	assert.Equal(t, "/:Foo", req.Route().Path)
+
+	req, _, _ = fakeRRCycle(a, http.MethodPost, "/bar", nil)
+	a.router.route(req)
+	assert.Nil(t, req.Route())
+}
+
+func TestRequestAllowedMethods(t *testing.T) {
+	a := New()
+
+	req, _, _ := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.Nil(t, req.AllowedMethods())
+
+	var allowedMethods []string
+	a.MethodNotAllowedHandler = func(req *Request, res *Response) error {
+		allowedMethods = req.AllowedMethods()
+		return res.WriteString("Foobar")
+	}
+
+	h := func(req *Request, res *Response) error {
+		allowedMethods = req.AllowedMethods()
+		return nil
+	}
+
+	a.GET("/foo", h)
+	a.POST("/foo", h)
+	a.DELETE("/foo", h)
+
+	a.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(
+		http.MethodGet,
+		"/foo",
+		nil,
+	))
+
+	assert.Equal(t, []string{
+		http.MethodDelete,
+		http.MethodGet,
+		http.MethodPost,
+	}, allowedMethods)
+
+	allowedMethods = nil
+
+	hrw := httptest.NewRecorder()
+	a.ServeHTTP(hrw, httptest.NewRequest(http.MethodPut, "/foo", nil))
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+	assert.Equal(t, "Foobar", hrw.Body.String())
+	assert.Equal(t, []string{
+		http.MethodDelete,
+		http.MethodGet,
+		http.MethodPost,
+	}, allowedMethods)
+}
+
 func TestRequestParams(t *testing.T) {
 	a := New()
 
@@ -258,6 +462,58 @@ func TestRequestParam(t *testing.T) {
 	assert.Equal(t, "bar2", p.Values[2].String())
 }
 
+func TestRequestParamMap(t *testing.T) {
+	a := New()
+
+	req, _, _ := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.NotNil(t, req.ParamMap())
+	assert.Empty(t, req.ParamMap())
+
+	var paramMap map[string][]string
+	a.POST("/:foo", func(req *Request, res *Response) error {
+		paramMap = req.ParamMap()
+		return nil
+	})
+
+	hr := httptest.NewRequest(
+		http.MethodPost,
+		"/bar?foo=bar2&bar=foo",
+		strings.NewReader("foo=bar3&foobar=barfoo"),
+	)
+	hr.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	a.ServeHTTP(httptest.NewRecorder(), hr)
+
+	assert.Equal(t, map[string][]string{
+		"foo":    {"bar", "bar3", "bar2"},
+		"bar":    {"foo"},
+		"foobar": {"barfoo"},
+	}, paramMap)
+}
+
+func TestRequestWildcard(t *testing.T) {
+	a := New()
+
+	req, _, _ := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.Empty(t, req.Wildcard())
+
+	wildcard := ""
+	a.GET("/files/*", func(req *Request, res *Response) error {
+		wildcard = req.Wildcard()
+		return nil
+	})
+
+	a.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(
+		http.MethodGet,
+		"/files/foo/bar%2Fbaz",
+		nil,
+	))
+
+	assert.Equal(t, "foo/bar/baz", wildcard)
+}
+
 func TestRequestParamValue(t *testing.T) {
 	a := New()
 
@@ -416,6 +672,172 @@ func TestRequestGrowParams(t *testing.T) {
 	assert.Equal(t, 1, cap(req.params))
 }
 
+func TestRequestMultipartReader(t *testing.T) {
+	newBody := func() (*bytes.Buffer, string) {
+		buf := &bytes.Buffer{}
+		writer := multipart.NewWriter(buf)
+
+		assert.NoError(t, writer.WriteField("foo", "bar"))
+
+		w, err := writer.CreateFormFile("file", "foo.bar")
+		assert.NoError(t, err)
+		assert.NotNil(t, w)
+
+		_, err = w.Write([]byte("Foobar"))
+		assert.NoError(t, err)
+
+		assert.NoError(t, writer.Close())
+
+		return buf, writer.FormDataContentType()
+	}
+
+	a := New()
+
+	body, ct := newBody()
+	req, _, _ := fakeRRCycle(a, http.MethodPost, "/?bar=foo", body)
+	req.Header.Set("Content-Type", ct)
+
+	mr, err := req.MultipartReader()
+	assert.NoError(t, err)
+	assert.NotNil(t, mr)
+
+	p, err := mr.NextPart()
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", p.FormName())
+
+	b, err := ioutil.ReadAll(p)
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", string(b))
+
+	p, err = mr.NextPart()
+	assert.NoError(t, err)
+	assert.Equal(t, "file", p.FormName())
+	assert.Equal(t, "foo.bar", p.FileName())
+
+	b, err = ioutil.ReadAll(p)
+	assert.NoError(t, err)
+	assert.Equal(t, "Foobar", string(b))
+
+	_, err = mr.NextPart()
+	assert.Equal(t, io.EOF, err)
+
+	mr, err = req.MultipartReader()
+	assert.Error(t, err)
+	assert.Nil(t, mr)
+
+	assert.Nil(t, req.Param("foo"))
+	assert.Equal(t, "foo", req.Param("bar").Value().String())
+	assert.Len(t, req.Params(), 1)
+
+	var s struct {
+		Foo string
+		Bar string
+	}
+
+	assert.Error(t, req.Bind(&s))
+	assert.Empty(t, s.Foo)
+
+	body, ct = newBody()
+	req, _, _ = fakeRRCycle(a, http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", ct)
+
+	assert.Equal(t, "bar", req.Param("foo").Value().String())
+
+	mr, err = req.MultipartReader()
+	assert.Error(t, err)
+	assert.Nil(t, mr)
+
+	req, _, _ = fakeRRCycle(
+		a,
+		http.MethodPost,
+		"/",
+		strings.NewReader("foo=bar"),
+	)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	mr, err = req.MultipartReader()
+	assert.Error(t, err)
+	assert.Nil(t, mr)
+}
+
+func TestRequestCleanupMultipart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "air.TestRequestCleanupMultipart")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, dir)
+	defer os.RemoveAll(dir)
+
+	tmpdir := os.Getenv("TMPDIR")
+	os.Setenv("TMPDIR", dir)
+	defer os.Setenv("TMPDIR", tmpdir)
+
+	newBody := func() (*bytes.Buffer, string) {
+		buf := &bytes.Buffer{}
+		writer := multipart.NewWriter(buf)
+
+		w, err := writer.CreateFormFile("foo", "foo.bar")
+		assert.NoError(t, err)
+		assert.NotNil(t, w)
+
+		_, err = w.Write([]byte("foobar"))
+		assert.NoError(t, err)
+
+		assert.NoError(t, writer.Close())
+
+		return buf, writer.FormDataContentType()
+	}
+
+	tempFiles := func() []os.FileInfo {
+		fis, err := ioutil.ReadDir(dir)
+		assert.NoError(t, err)
+		return fis
+	}
+
+	a := New()
+	a.POST("/", func(req *Request, res *Response) error {
+		assert.NoError(t, req.HTTPRequest().ParseMultipartForm(1))
+		assert.NotNil(t, req.Param("foo"))
+		assert.Len(t, tempFiles(), 1)
+		return res.WriteString("Foobar")
+	})
+
+	a.POST("/early", func(req *Request, res *Response) error {
+		assert.NoError(t, req.HTTPRequest().ParseMultipartForm(1))
+		assert.Len(t, tempFiles(), 1)
+		assert.NoError(t, req.CleanupMultipart())
+		assert.Len(t, tempFiles(), 0)
+		assert.NoError(t, req.CleanupMultipart())
+		return res.WriteString("Foobar")
+	})
+
+	a.GET("/", func(req *Request, res *Response) error {
+		assert.NoError(t, req.CleanupMultipart())
+		return res.WriteString("Foobar")
+	})
+
+	body, contentType := newBody()
+	hr := httptest.NewRequest(http.MethodPost, "/", body)
+	hr.Header.Set("Content-Type", contentType)
+	hrw := httptest.NewRecorder()
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+	assert.Len(t, tempFiles(), 0)
+
+	body, contentType = newBody()
+	hr = httptest.NewRequest(http.MethodPost, "/early", body)
+	hr.Header.Set("Content-Type", contentType)
+	hrw = httptest.NewRecorder()
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+	assert.Len(t, tempFiles(), 0)
+
+	hrw = httptest.NewRecorder()
+	a.ServeHTTP(hrw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+}
+
 func TestRequestValues(t *testing.T) {
 	a := New()
 
@@ -466,6 +888,194 @@ func TestRequestBind(t *testing.T) {
 	assert.Equal(t, "bar", foobar.Foo)
 }
 
+func TestRequestBindParams(t *testing.T) {
+	a := New()
+
+	type foobar struct {
+		ID    int64    `param:"id"`
+		Page  int      `param:"page"`
+		Tags  []string `param:"tag"`
+		Flags []bool   `param:"flag"`
+		Body  string   `param:"body"`
+	}
+
+	var (
+		f   foobar
+		err error
+	)
+
+	a.POST("/users/:id", func(req *Request, res *Response) error {
+		f = foobar{}
+		err = req.BindParams(&f)
+		if p := req.Param("body"); p != nil {
+			return res.WriteString(p.Value().String())
+		}
+
+		return res.WriteString("")
+	})
+
+	hr := httptest.NewRequest(
+		http.MethodPost,
+		"/users/1?page=2&tag=foo&tag=bar&flag=true&flag=false&id=3",
+		strings.NewReader("body=foobar"),
+	)
+	hr.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), f.ID)
+	assert.Equal(t, 2, f.Page)
+	assert.Equal(t, []string{"foo", "bar"}, f.Tags)
+	assert.Equal(t, []bool{true, false}, f.Flags)
+	assert.Empty(t, f.Body)
+	assert.Equal(t, "foobar", hrw.Body.String())
+
+	hr = httptest.NewRequest(http.MethodPost, "/users/1?page=foo", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Error(t, err)
+
+	a.Validator = func(v interface{}) error {
+		if v.(*foobar).Page < 1 {
+			return errors.New("invalid page")
+		}
+
+		return nil
+	}
+
+	hr = httptest.NewRequest(http.MethodPost, "/users/1", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.EqualError(t, err, "invalid page")
+	assert.Equal(t, int64(1), f.ID)
+
+	req, _, _ := fakeRRCycle(a, http.MethodGet, "/?page=1", nil)
+
+	f = foobar{}
+	assert.NoError(t, req.BindParams(&f))
+	assert.Equal(t, 1, f.Page)
+
+	var s string
+	assert.Error(t, req.BindParams(&s))
+}
+
+func TestRequestDecodeJSONStream(t *testing.T) {
+	a := New()
+
+	req, _, _ := fakeRRCycle(
+		a,
+		http.MethodPost,
+		"/",
+		strings.NewReader("{\"foo\":\"bar\"}\n{\"foo\":\"baz\"}\n\n{\"foo\":\"qux\"}\n"),
+	)
+
+	type foobar struct {
+		Foo string `json:"foo"`
+	}
+
+	var foobars []foobar
+	assert.NoError(t, req.DecodeJSONStream(func(
+		decode func(v interface{}) error,
+	) error {
+		var fb foobar
+		if err := decode(&fb); err != nil {
+			return err
+		}
+
+		foobars = append(foobars, fb)
+
+		return nil
+	}))
+	assert.Equal(t, []foobar{{"bar"}, {"baz"}, {"qux"}}, foobars)
+
+	req, _, _ = fakeRRCycle(
+		a,
+		http.MethodPost,
+		"/",
+		strings.NewReader(`{"foo":"bar"} {"foo":"baz"}`),
+	)
+
+	count := 0
+	assert.NoError(t, req.DecodeJSONStream(func(
+		decode func(v interface{}) error,
+	) error {
+		count++
+		return nil
+	}))
+	assert.Equal(t, 2, count)
+
+	req, _, _ = fakeRRCycle(
+		a,
+		http.MethodPost,
+		"/",
+		strings.NewReader(`{"foo":"bar"} {"foo":`),
+	)
+
+	foobars = nil
+	assert.Error(t, req.DecodeJSONStream(func(
+		decode func(v interface{}) error,
+	) error {
+		var fb foobar
+		if err := decode(&fb); err != nil {
+			return err
+		}
+
+		foobars = append(foobars, fb)
+
+		return nil
+	}))
+	assert.Equal(t, []foobar{{"bar"}}, foobars)
+
+	req, _, _ = fakeRRCycle(
+		a,
+		http.MethodPost,
+		"/",
+		strings.NewReader(`{"foo":"bar"}]`),
+	)
+
+	assert.Error(t, req.DecodeJSONStream(func(
+		decode func(v interface{}) error,
+	) error {
+		return decode(&foobar{})
+	}))
+
+	req, _, _ = fakeRRCycle(
+		a,
+		http.MethodPost,
+		"/",
+		strings.NewReader(`{"foo":"bar"}`),
+	)
+
+	assert.EqualError(t, req.DecodeJSONStream(func(
+		decode func(v interface{}) error,
+	) error {
+		return errors.New("foobar")
+	}), "foobar")
+
+	req, _, _ = fakeRRCycle(
+		a,
+		http.MethodPost,
+		"/",
+		strings.NewReader(`{"foo":"bar"}`),
+	)
+
+	assert.Error(t, req.DecodeJSONStream(func(
+		decode func(v interface{}) error,
+	) error {
+		if err := decode(&foobar{}); err != nil {
+			return err
+		}
+
+		return decode(&foobar{})
+	}))
+}
+
 func TestRequestLocalizedString(t *testing.T) {
 	a := New()
 
@@ -485,6 +1095,208 @@ func TestRequestLocalizedString(t *testing.T) {
 	assert.Equal(t, "foo", req.LocalizedString("foo"))
 }
 
+func TestRequestParamBools(t *testing.T) {
+	var rp *RequestParam
+
+	vs, err := rp.Bools()
+	assert.NoError(t, err)
+	assert.Nil(t, vs)
+
+	a := New()
+
+	req, _, _ := fakeRRCycle(a, http.MethodGet, "/?foo=true&foo=0", nil)
+
+	vs, err = req.Param("foo").Bools()
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, false}, vs)
+
+	req, _, _ = fakeRRCycle(a, http.MethodGet, "/?foo=true&foo=bar&foo=baz", nil)
+
+	vs, err = req.Param("foo").Bools()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "air: invalid request param foo")
+	assert.NotContains(t, err.Error(), "value 0")
+	assert.Contains(t, err.Error(), "value 1")
+	assert.Contains(t, err.Error(), "value 2")
+	assert.Nil(t, vs)
+}
+
+func TestRequestParamInts(t *testing.T) {
+	var rp *RequestParam
+
+	vs, err := rp.Ints()
+	assert.NoError(t, err)
+	assert.Nil(t, vs)
+
+	a := New()
+
+	req, _, _ := fakeRRCycle(a, http.MethodGet, "/?foo=1&foo=-2&foo=3", nil)
+
+	vs, err = req.Param("foo").Ints()
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, -2, 3}, vs)
+
+	req, _, _ = fakeRRCycle(a, http.MethodGet, "/?foo=1&foo=bar&foo=baz", nil)
+
+	vs, err = req.Param("foo").Ints()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "air: invalid request param foo")
+	assert.NotContains(t, err.Error(), "value 0")
+	assert.Contains(t, err.Error(), "value 1")
+	assert.Contains(t, err.Error(), "value 2")
+	assert.Nil(t, vs)
+}
+
+func TestRequestParamInt64s(t *testing.T) {
+	var rp *RequestParam
+
+	vs, err := rp.Int64s()
+	assert.NoError(t, err)
+	assert.Nil(t, vs)
+
+	a := New()
+
+	req, _, _ := fakeRRCycle(a, http.MethodGet, "/?foo=1&foo=-2&foo=3", nil)
+
+	vs, err = req.Param("foo").Int64s()
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, -2, 3}, vs)
+
+	req, _, _ = fakeRRCycle(a, http.MethodGet, "/?foo=1&foo=bar&foo=baz", nil)
+
+	vs, err = req.Param("foo").Int64s()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "air: invalid request param foo")
+	assert.NotContains(t, err.Error(), "value 0")
+	assert.Contains(t, err.Error(), "value 1")
+	assert.Contains(t, err.Error(), "value 2")
+	assert.Nil(t, vs)
+}
+
+func TestRequestParamUints(t *testing.T) {
+	var rp *RequestParam
+
+	vs, err := rp.Uints()
+	assert.NoError(t, err)
+	assert.Nil(t, vs)
+
+	a := New()
+
+	req, _, _ := fakeRRCycle(a, http.MethodGet, "/?foo=1&foo=2&foo=3", nil)
+
+	vs, err = req.Param("foo").Uints()
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{1, 2, 3}, vs)
+
+	req, _, _ = fakeRRCycle(a, http.MethodGet, "/?foo=1&foo=-2&foo=bar", nil)
+
+	vs, err = req.Param("foo").Uints()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "air: invalid request param foo")
+	assert.NotContains(t, err.Error(), "value 0")
+	assert.Contains(t, err.Error(), "value 1")
+	assert.Contains(t, err.Error(), "value 2")
+	assert.Nil(t, vs)
+}
+
+func TestRequestParamUint64s(t *testing.T) {
+	var rp *RequestParam
+
+	vs, err := rp.Uint64s()
+	assert.NoError(t, err)
+	assert.Nil(t, vs)
+
+	a := New()
+
+	req, _, _ := fakeRRCycle(a, http.MethodGet, "/?foo=1&foo=2&foo=3", nil)
+
+	vs, err = req.Param("foo").Uint64s()
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{1, 2, 3}, vs)
+
+	req, _, _ = fakeRRCycle(a, http.MethodGet, "/?foo=1&foo=-2&foo=bar", nil)
+
+	vs, err = req.Param("foo").Uint64s()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "air: invalid request param foo")
+	assert.NotContains(t, err.Error(), "value 0")
+	assert.Contains(t, err.Error(), "value 1")
+	assert.Contains(t, err.Error(), "value 2")
+	assert.Nil(t, vs)
+}
+
+func TestRequestParamFloat64s(t *testing.T) {
+	var rp *RequestParam
+
+	vs, err := rp.Float64s()
+	assert.NoError(t, err)
+	assert.Nil(t, vs)
+
+	a := New()
+
+	req, _, _ := fakeRRCycle(a, http.MethodGet, "/?foo=1.5&foo=-2&foo=3", nil)
+
+	vs, err = req.Param("foo").Float64s()
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{1.5, -2, 3}, vs)
+
+	req, _, _ = fakeRRCycle(a, http.MethodGet, "/?foo=1.5&foo=bar&foo=baz", nil)
+
+	vs, err = req.Param("foo").Float64s()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "air: invalid request param foo")
+	assert.NotContains(t, err.Error(), "value 0")
+	assert.Contains(t, err.Error(), "value 1")
+	assert.Contains(t, err.Error(), "value 2")
+	assert.Nil(t, vs)
+}
+
+func TestRequestParamStrings(t *testing.T) {
+	var rp *RequestParam
+
+	assert.Nil(t, rp.Strings())
+
+	a := New()
+
+	req, _, _ := fakeRRCycle(a, http.MethodGet, "/?foo=bar&foo=1", nil)
+
+	assert.Equal(t, []string{"bar", "1"}, req.Param("foo").Strings())
+}
+
+func TestRequestParamSegments(t *testing.T) {
+	var rp *RequestParam
+
+	assert.Nil(t, rp.Segments())
+
+	a := New()
+
+	var segments []string
+	a.GET("/files/*", func(req *Request, res *Response) error {
+		segments = req.Param("*").Segments()
+		return nil
+	})
+
+	a.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(
+		http.MethodGet,
+		"/files/foo/bar%2Fbaz//qux%20",
+		nil,
+	))
+
+	assert.Equal(t, []string{"foo", "bar/baz", "qux "}, segments)
+
+	a.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(
+		http.MethodGet,
+		"/files/",
+		nil,
+	))
+
+	assert.Empty(t, segments)
+
+	req, _, _ := fakeRRCycle(a, http.MethodGet, "/?foo=bar/foo%2Fbar", nil)
+
+	assert.Equal(t, []string{"bar", "foo", "bar"}, req.Param("foo").Segments())
+}
+
 func TestRequestParamValueBool(t *testing.T) {
 	rpv := &RequestParamValue{
 		i: "true",
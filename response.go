@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/tls"
 	"encoding/base64"
+	"encoding/csv"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
@@ -17,6 +19,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/httputil"
+	"net/textproto"
 	"net/url"
 	"os"
 	"path"
@@ -26,6 +29,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/aofei/mimesniffer"
 	"github.com/cespare/xxhash/v2"
 	"github.com/gorilla/websocket"
@@ -92,11 +96,23 @@ type Response struct {
 	// Gzipped indicates whether the `Body` has been gzipped.
 	Gzipped bool
 
+	// Brotlied indicates whether the `Body` has been compressed with the
+	// brotli.
+	Brotlied bool
+
 	req               *Request
 	hrw               http.ResponseWriter
+	rw                *responseWriter
 	servingContent    bool
 	serveContentError error
 	deferredFuncs     []func()
+	tees              []io.Writer
+	compressedTees    []io.Writer
+	gzipETagTrimmed   bool
+	brotliETagTrimmed bool
+	gzipLevel         int
+	gzipLevelSet      bool
+	eventStream       *eventStream
 }
 
 // reset resets the r with the a, hrw and req.
@@ -107,16 +123,26 @@ func (r *Response) reset(a *Air, hrw http.ResponseWriter, req *Request) {
 	r.Written = false
 	r.Minified = false
 	r.Gzipped = false
+	r.Brotlied = false
 	r.req = req
 	r.servingContent = false
 	r.serveContentError = nil
 	r.deferredFuncs = r.deferredFuncs[:0]
+	r.tees = r.tees[:0]
+	r.compressedTees = r.compressedTees[:0]
+	r.gzipETagTrimmed = false
+	r.brotliETagTrimmed = false
+	r.gzipLevel = 0
+	r.gzipLevelSet = false
+	r.eventStream = nil
 
 	rw := &responseWriter{
 		r:   r,
 		hrw: hrw,
 	}
 
+	r.rw = rw
+
 	hijacker, isHijacker := hrw.(http.Hijacker)
 	pusher, isPusher := hrw.(http.Pusher)
 	switch {
@@ -161,6 +187,19 @@ func (r *Response) reset(a *Air, hrw http.ResponseWriter, req *Request) {
 	default:
 		r.SetHTTPResponseWriter(rw)
 	}
+
+	for k, vs := range a.DefaultResponseHeaders {
+		k = textproto.CanonicalMIMEHeaderKey(k)
+		if _, ok := hopByHopHeaders[k]; ok {
+			continue
+		}
+
+		if _, ok := r.Header[k]; !ok {
+			// Limit the capacity so that appending to the values
+			// never touches the shared backing array.
+			r.Header[k] = vs[:len(vs):len(vs)]
+		}
+	}
 }
 
 // HTTPResponseWriter returns the underlying `http.ResponseWriter` of the r.
@@ -191,14 +230,32 @@ func (r *Response) SetCookie(c *http.Cookie) {
 	}
 }
 
+// SetStatus sets the `Status` of the r to the status and returns the r, which
+// is useful for chaining, such as `res.SetStatus(201).WriteJSON(v)`.
+func (r *Response) SetStatus(status int) *Response {
+	r.Status = status
+	return r
+}
+
+// NoContent responds to the client with the `http.StatusNoContent` and without
+// content.
+func (r *Response) NoContent() error {
+	r.Status = http.StatusNoContent
+	return r.Write(nil)
+}
+
 // Write writes the content to the client.
 //
 // The main benefit of the `Write` over the `io.Copy` with the `Body` of the r
 // is that it handles range requests properly, sets the Content-Type response
 // header, and handles the If-Match, If-Unmodified-Since, If-None-Match,
 // If-Modified-Since and If-Range request headers.
+//
+// The content is always discarded when the `Status` of the r does not allow a
+// body (such as the `http.StatusNoContent` and `http.StatusNotModified`).
 func (r *Response) Write(content io.ReadSeeker) error {
-	if content == nil { // No content, no benefit
+	// No content, no benefit.
+	if content == nil || !bodyAllowedForStatus(r.Status) {
 		if !r.Written {
 			r.hrw.WriteHeader(r.Status)
 		}
@@ -215,8 +272,13 @@ func (r *Response) Write(content io.ReadSeeker) error {
 	}
 
 	if r.Header.Get("Content-Type") == "" {
-		b := r.Air.contentTypeSnifferBufferPool.Get().([]byte)
-		defer r.Air.contentTypeSnifferBufferPool.Put(b)
+		bp := r.Air.ContentTypeSnifferBufferPool
+		if bp == nil {
+			bp = &r.Air.contentTypeSnifferBufferPool
+		}
+
+		b := bp.Get().([]byte)
+		defer bp.Put(b)
 
 		n, err := io.ReadFull(content, b)
 		if err != nil &&
@@ -261,11 +323,54 @@ func (r *Response) Write(content io.ReadSeeker) error {
 			lm, _ = http.ParseTime(lmh)
 		}
 
+		// The ETag may have been suffixed by the gzip or brotli feature,
+		// so the suffix must be trimmed before evaluating the
+		// preconditions.
+		if r.Air.GzipEnabled || r.Air.BrotliEnabled {
+			for _, name := range []string{
+				"If-Match",
+				"If-None-Match",
+			} {
+				v := r.req.Header.Get(name)
+				if v == "" {
+					continue
+				}
+
+				tv := v
+				if r.Air.GzipEnabled {
+					var ok bool
+					if tv, ok = trimGzipETagSuffixes(tv); ok {
+						r.gzipETagTrimmed = true
+					}
+				}
+
+				if r.Air.BrotliEnabled {
+					var ok bool
+					if tv, ok = trimBrotliETagSuffixes(tv); ok {
+						r.brotliETagTrimmed = true
+					}
+				}
+
+				if tv != v {
+					r.req.Header.Set(name, tv)
+					defer r.req.Header.Set(name, v)
+				}
+			}
+		}
+
 		r.servingContent = true
 		r.serveContentError = nil
 		http.ServeContent(r.hrw, r.req.HTTPRequest(), "", lm, content)
 		r.servingContent = false
 
+		// The `http.ServeContent` responds to the failed If-Match and
+		// If-Unmodified-Since without any body, so the status must be
+		// written here.
+		if r.serveContentError == nil && !r.Written &&
+			r.Status == http.StatusPreconditionFailed {
+			r.hrw.WriteHeader(r.Status)
+		}
+
 		return r.serveContentError
 	}
 
@@ -294,18 +399,60 @@ func (r *Response) Write(content io.ReadSeeker) error {
 	return nil
 }
 
+// WriteBytes writes the b as a content of the contentType to the client. If the
+// contentType is empty, the Content-Type response header will be sniffed from
+// the b.
+//
+// The `WriteBytes` routes through the `Write`, so range requests and
+// conditional requests are handled properly. The ETag response header is set
+// from the hash of the b if it has not been set.
+func (r *Response) WriteBytes(contentType string, b []byte) error {
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+
+	if !r.omittableHeader("ETag") && r.Header.Get("ETag") == "" {
+		h := xxhash.New()
+		h.Write(b)
+		r.Header.Set("ETag", fmt.Sprintf(
+			"%q",
+			base64.StdEncoding.EncodeToString(h.Sum(nil)),
+		))
+	}
+
+	return r.Write(NewSeekableBytes(b))
+}
+
 // WriteString writes the s as a "text/plain" content to the client.
+//
+// The "Content-Type" header will not be overridden if it has already been set.
 func (r *Response) WriteString(s string) error {
-	r.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	r.setDefaultContentType("text/plain")
 	return r.Write(strings.NewReader(s))
 }
 
 // WriteHTML writes the h as a "text/html" content to the client.
+//
+// The "Content-Type" header will not be overridden if it has already been set.
 func (r *Response) WriteHTML(h string) error {
-	r.Header.Set("Content-Type", "text/html; charset=utf-8")
+	r.setDefaultContentType("text/html")
 	return r.Write(strings.NewReader(h))
 }
 
+// setDefaultContentType sets the "Content-Type" header of the r to the
+// mimeType with the `Air.DefaultCharset` if it has not been set.
+func (r *Response) setDefaultContentType(mimeType string) {
+	if r.Header.Get("Content-Type") != "" {
+		return
+	}
+
+	if r.Air.DefaultCharset != "" {
+		mimeType = fmt.Sprint(mimeType, "; charset=", r.Air.DefaultCharset)
+	}
+
+	r.Header.Set("Content-Type", mimeType)
+}
+
 // WriteJSON writes an "application/json" content encoded from the v to the
 // client.
 func (r *Response) WriteJSON(v interface{}) error {
@@ -404,6 +551,46 @@ func (r *Response) WriteYAML(v interface{}) error {
 	return r.Write(bytes.NewReader(b))
 }
 
+// WriteCSV writes a "text/csv" content encoded from the records to the client.
+func (r *Response) WriteCSV(records [][]string) error {
+	buf := bytes.Buffer{}
+	if err := csv.NewWriter(&buf).WriteAll(records); err != nil {
+		return err
+	}
+
+	r.Header.Set("Content-Type", "text/csv; charset=utf-8")
+
+	return r.Write(bytes.NewReader(buf.Bytes()))
+}
+
+// CSVWriter returns a `csv.Writer` that streams a "text/csv" content to the
+// client, which is useful for writing large tables without buffering them.
+//
+// The records written to the returned `csv.Writer` are buffered until its
+// `csv.Writer.Flush` is called, so it must be called before the handler
+// returns. Since the length of the content is unknown in advance, the gzip
+// feature (if enabled) is only applied when the `Air.GzipMinContentLength` is
+// not positive.
+func (r *Response) CSVWriter() *csv.Writer {
+	if !r.Written {
+		r.Header.Set("Content-Type", "text/csv; charset=utf-8")
+		r.Header.Del("Content-Length")
+	}
+
+	return csv.NewWriter(r.Body)
+}
+
+// SetAttachment sets the Content-Disposition header of the r to make the client
+// save the content as a file with the filename instead of displaying it.
+func (r *Response) SetAttachment(filename string) {
+	r.Header.Set("Content-Disposition", mime.FormatMediaType(
+		"attachment",
+		map[string]string{
+			"filename": filename,
+		},
+	))
+}
+
 // WriteFile writes a file content targeted by the filename to the client.
 func (r *Response) WriteFile(filename string) error {
 	filename, err := filepath.Abs(filename)
@@ -432,6 +619,7 @@ func (r *Response) WriteFile(filename string) error {
 		ct string
 		et []byte
 		mt time.Time
+		fs int64
 	)
 
 	if r.Air.CofferEnabled {
@@ -481,38 +669,64 @@ func (r *Response) WriteFile(filename string) error {
 
 		c = f
 		mt = fi.ModTime()
+		fs = fi.Size()
 	}
 
+	return r.writeFileContent(c, filename, ct, et, mt, fs)
+}
+
+// writeFileContent writes the c of a file with the name to the client. The ct,
+// et, mt and size are the MIME type, digest, modification time and size of the
+// c, and the ct and et will be figured out from the name and c when empty.
+func (r *Response) writeFileContent(
+	c io.ReadSeeker,
+	name string,
+	ct string,
+	et []byte,
+	mt time.Time,
+	size int64,
+) error {
 	if r.Header.Get("Content-Type") == "" {
 		if ct == "" {
-			ct = mime.TypeByExtension(filepath.Ext(filename))
+			ct = mime.TypeByExtension(filepath.Ext(name))
 		}
 
 		r.Header.Set("Content-Type", ct)
 	}
 
 	if !r.omittableHeader("ETag") && r.Header.Get("ETag") == "" {
-		if et == nil {
-			h := xxhash.New()
-			if _, err := io.Copy(h, c); err != nil {
-				return err
-			}
+		if et == nil && (r.Air.ETagStrategy == WeakSizeModTime ||
+			(r.Air.ETagHashMaxFileSize > 0 &&
+				size > r.Air.ETagHashMaxFileSize)) {
+			r.Header.Set("ETag", fmt.Sprintf(
+				`W/"%x-%x"`,
+				size,
+				mt.UnixNano(),
+			))
+		} else {
+			if et == nil {
+				h := xxhash.New()
+				if _, err := io.Copy(h, c); err != nil {
+					return err
+				}
 
-			if _, err := c.Seek(0, io.SeekStart); err != nil {
-				return err
+				_, err := c.Seek(0, io.SeekStart)
+				if err != nil {
+					return err
+				}
+
+				et = h.Sum(nil)
 			}
 
-			et = h.Sum(nil)
+			r.Header.Set("ETag", fmt.Sprintf(
+				"%q",
+				base64.StdEncoding.EncodeToString(et),
+			))
 		}
-
-		r.Header.Set("ETag", fmt.Sprintf(
-			"%q",
-			base64.StdEncoding.EncodeToString(et),
-		))
 	}
 
 	if !r.omittableHeader("Last-Modified") &&
-		r.Header.Get("Last-Modified") == "" {
+		r.Header.Get("Last-Modified") == "" && !mt.IsZero() {
 		r.Header.Set("Last-Modified", mt.UTC().Format(http.TimeFormat))
 	}
 
@@ -523,7 +737,43 @@ func (r *Response) WriteFile(filename string) error {
 // as a "text/html" content to the client. The results rendered by the former
 // can be inherited by accessing the `m["InheritedHTML"]`.
 func (r *Response) Render(m map[string]interface{}, templates ...string) error {
-	buf := bytes.Buffer{}
+	buf, err := r.render(m, templates...)
+	if err != nil {
+		return err
+	}
+
+	return r.WriteHTML(buf.String())
+}
+
+// RenderCached is just like the `Render`, except that the ETag response header
+// is set from the hash of the results if it has not been set, so the
+// conditional requests (such as those with the If-None-Match header) can be
+// answered with the `http.StatusNotModified` without sending the results
+// again.
+//
+// The `RenderCached` is opt-in since hashing the results costs extra CPU time.
+// It is useful for the semi-static pages that are rendered from stable data.
+func (r *Response) RenderCached(
+	m map[string]interface{},
+	templates ...string,
+) error {
+	buf, err := r.render(m, templates...)
+	if err != nil {
+		return err
+	}
+
+	r.setDefaultContentType("text/html")
+
+	return r.WriteBytes("", buf.Bytes())
+}
+
+// render renders the templates with the m into a buffer. The results rendered
+// by the former can be inherited by accessing the `m["InheritedHTML"]`.
+func (r *Response) render(
+	m map[string]interface{},
+	templates ...string,
+) (*bytes.Buffer, error) {
+	buf := &bytes.Buffer{}
 	for _, t := range templates {
 		if buf.Len() > 0 {
 			if m == nil {
@@ -535,13 +785,64 @@ func (r *Response) Render(m map[string]interface{}, templates ...string) error {
 
 		buf.Reset()
 
+		err := r.Air.renderer.render(buf, t, m, r.req.LocalizedString)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buf, nil
+}
+
+// RenderStream is just like the `Render`, except that the last template is
+// executed directly into the `Body` of the r instead of being buffered, which
+// consumes much less memory for large renders. The results rendered by the
+// former templates are still buffered since they need to be inherited.
+//
+// The tradeoff is that if the last template fails during execution, whatever
+// has been rendered before the failure is already sent to the client, so the
+// client will receive a partial response and the error can no longer be
+// written. Besides, the streamed results are never minified, and they are only
+// gzipped if the `Air.GzipMinContentLength` is not greater than zero since the
+// length of them is unknown in advance.
+func (r *Response) RenderStream(
+	m map[string]interface{},
+	templates ...string,
+) error {
+	if len(templates) == 0 {
+		return r.WriteHTML("")
+	}
+
+	buf := bytes.Buffer{}
+	for i, t := range templates {
+		if buf.Len() > 0 {
+			if m == nil {
+				m = make(map[string]interface{}, 1)
+			}
+
+			m["InheritedHTML"] = template.HTML(buf.String())
+		}
+
+		if i == len(templates)-1 {
+			break
+		}
+
+		buf.Reset()
+
 		err := r.Air.renderer.render(&buf, t, m, r.req.LocalizedString)
 		if err != nil {
 			return err
 		}
 	}
 
-	return r.WriteHTML(buf.String())
+	r.setDefaultContentType("text/html")
+
+	return r.Air.renderer.render(
+		r.Body,
+		templates[len(templates)-1],
+		m,
+		r.req.LocalizedString,
+	)
 }
 
 // Redirect writes the url as a redirection to the client.
@@ -573,6 +874,173 @@ func (r *Response) Flush() {
 	}
 }
 
+// StreamEvents writes the events received from the events to the client as a
+// stream of server-sent events until the events is closed or the ctx is done.
+// Each event is flushed to the client right after it is written.
+//
+// The events that have no `Event.ID` are assigned incrementing IDs, so that
+// the client can resume the stream via the Last-Event-ID header after
+// reconnection. The IDs start after the Last-Event-ID of the request if it is
+// an integer, otherwise they start from 1. An `Event.ID` that is an integer
+// also makes the subsequent IDs continue after it.
+//
+// A comment line is sent every `Air.EventStreamKeepAliveInterval` to keep the
+// stream alive.
+//
+// The `StreamEvents` returns nil when the events is closed, the ctx is done or
+// the client has gone away (the `Request.Context` is done). It only returns
+// the errors that occur while writing.
+//
+// The stream is drained by the `Air.DrainLongLived`.
+func (r *Response) StreamEvents(
+	ctx context.Context,
+	events <-chan *Event,
+) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	r.prepareEventStream()
+	r.trackEventStream()
+	r.Flush()
+
+	id, _ := strconv.ParseUint(r.req.Header.Get("Last-Event-ID"), 10, 64)
+
+	var keepAlive <-chan time.Time
+	if r.Air.EventStreamKeepAliveInterval > 0 {
+		ticker := time.NewTicker(r.Air.EventStreamKeepAliveInterval)
+		defer ticker.Stop()
+		keepAlive = ticker.C
+	}
+
+	for {
+		var b []byte
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			} else if e == nil {
+				continue
+			}
+
+			if e.ID == "" {
+				id++
+				ec := *e
+				ec.ID = strconv.FormatUint(id, 10)
+				e = &ec
+			} else if eid, err := strconv.ParseUint(
+				e.ID,
+				10,
+				64,
+			); err == nil {
+				id = eid
+			}
+
+			b = e.encode()
+		case <-keepAlive:
+			b = []byte(":\n\n")
+		case <-ctx.Done():
+			return nil
+		case <-r.req.Context.Done():
+			return nil
+		}
+
+		if _, err := r.Body.Write(b); err != nil {
+			return err
+		}
+
+		r.Flush()
+	}
+}
+
+// WriteEvent writes the e to the client as a server-sent event and flushes it
+// right away. The first call also sets the Content-Type header to
+// "text/event-stream" and the Cache-Control header to "no-cache" (if it has not
+// been set), so the `WriteEvent` can be called repeatedly to push a stream of
+// events. Nil events will be silently dropped.
+//
+// The event is flushed through the gzip feature (if it is applied), so the
+// client always receives each event as soon as it is written.
+//
+// The `WriteEvent` returns the error of the `Request.Context` if the client
+// has gone away or the stream has been drained by the `Air.DrainLongLived`, so
+// that the callers can end the stream.
+func (r *Response) WriteEvent(e *Event) error {
+	if err := r.req.Context.Err(); err != nil {
+		return err
+	}
+
+	r.prepareEventStream()
+	r.trackEventStream()
+
+	if e != nil {
+		if _, err := r.Body.Write(e.encode()); err != nil {
+			return err
+		}
+	}
+
+	r.Flush()
+
+	return nil
+}
+
+// prepareEventStream prepares the headers of the r for a stream of
+// server-sent events if the r has not been written.
+func (r *Response) prepareEventStream() {
+	if r.Written {
+		return
+	}
+
+	r.Header.Set("Content-Type", "text/event-stream")
+	if r.Header.Get("Cache-Control") == "" {
+		r.Header.Set("Cache-Control", "no-cache")
+	}
+
+	r.Header.Del("Content-Length")
+}
+
+// trackEventStream registers the stream of server-sent events of the r so that
+// it can be drained by the `Air.DrainLongLived`. The stream is deregistered
+// when the request-response cycle of the r ends.
+func (r *Response) trackEventStream() {
+	if r.eventStream != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.req.Context)
+	r.req.Context = ctx
+
+	es := &eventStream{
+		cancel: cancel,
+	}
+
+	r.eventStream = es
+
+	r.Air.eventStreamMutex.Lock()
+	r.Air.eventStreams[es] = struct{}{}
+	r.Air.eventStreamMutex.Unlock()
+
+	a := r.Air
+	r.Defer(func() {
+		a.eventStreamMutex.Lock()
+		delete(a.eventStreams, es)
+		a.eventStreamMutex.Unlock()
+
+		cancel()
+	})
+}
+
+// eventStream is a stream of server-sent events.
+type eventStream struct {
+	cancel context.CancelFunc
+}
+
+// notifyShutdown implements the `longLivedConn`.
+func (es *eventStream) notifyShutdown() error {
+	es.cancel()
+	return nil
+}
+
 // Push initiates an HTTP/2 server push. This constructs a synthetic request
 // using the target and pos, serializes that request into a "PUSH_PROMISE"
 // frame, then dispatches that request using the server's request handler. If
@@ -593,8 +1061,43 @@ func (r *Response) Push(target string, pos *http.PushOptions) error {
 	return http.ErrNotSupported
 }
 
+// WriteEarlyHints writes an interim response with the
+// `http.StatusEarlyHints` (see RFC 8297) to the client with the links as the
+// Link headers, so that the client can start preloading the linked resources
+// before the final response is ready. The r is not committed, so the final
+// response can still be written as usual.
+//
+// The links are added to the `Header` of the r, so they are also sent with the
+// final response. Note that the interim response carries all of the headers
+// that have been set in the `Header` of the r at the time.
+//
+// The interim responses are only supported by the server built with Go 1.19
+// or later. The `WriteEarlyHints` silently does nothing if they are not
+// supported or the links are empty.
+func (r *Response) WriteEarlyHints(links []string) error {
+	if r.Written {
+		return errors.New("air: response has already been written")
+	}
+
+	if !interimResponsesSupported || len(links) == 0 || r.rw == nil {
+		return nil
+	}
+
+	for _, l := range links {
+		r.Header.Add("Link", l)
+	}
+
+	r.rw.writeInterimHeader(http.StatusEarlyHints)
+
+	return nil
+}
+
 // WebSocket switches the connection of the r to the WebSocket protocol. See RFC
 // 6455.
+//
+// The returned `WebSocket` is waited for by the `Air.Shutdown` and
+// `Air.DrainLongLived` until it is closed by either side or the current
+// `Handler` returns, whichever comes first.
 func (r *Response) WebSocket() (*WebSocket, error) {
 	if r.Written {
 		return nil, errors.New("air: response has already been written")
@@ -603,8 +1106,9 @@ func (r *Response) WebSocket() (*WebSocket, error) {
 	r.Status = http.StatusSwitchingProtocols
 
 	conn, err := (&websocket.Upgrader{
-		HandshakeTimeout: r.Air.WebSocketHandshakeTimeout,
-		Subprotocols:     r.Air.WebSocketSubprotocols,
+		HandshakeTimeout:  r.Air.WebSocketHandshakeTimeout,
+		Subprotocols:      r.Air.WebSocketSubprotocols,
+		EnableCompression: r.Air.WebSocketCompressionEnabled,
 		Error: func(
 			_ http.ResponseWriter,
 			_ *http.Request,
@@ -621,12 +1125,28 @@ func (r *Response) WebSocket() (*WebSocket, error) {
 		return nil, err
 	}
 
+	if r.Air.WebSocketCompressionEnabled {
+		conn.EnableWriteCompression(true)
+		conn.SetCompressionLevel(r.Air.WebSocketCompressionLevel)
+	}
+
 	ws := &WebSocket{
-		conn: conn,
+		a:         r.Air,
+		conn:      conn,
+		closed:    make(chan struct{}),
+		untracked: make(chan struct{}),
+		pongs:     make(chan struct{}, 1),
 	}
 
+	r.Air.webSocketMutex.Lock()
+	r.Air.webSockets[ws] = struct{}{}
+	r.Air.webSocketMutex.Unlock()
+
+	r.Defer(ws.untrack)
+
 	conn.SetCloseHandler(func(status int, reason string) error {
-		ws.Closed = true
+		ws.setClosed()
+		ws.untrack()
 
 		if ws.ConnectionCloseHandler != nil {
 			return ws.ConnectionCloseHandler(status, reason)
@@ -664,6 +1184,11 @@ func (r *Response) WebSocket() (*WebSocket, error) {
 	})
 
 	conn.SetPongHandler(func(appData string) error {
+		select {
+		case ws.pongs <- struct{}{}:
+		default:
+		}
+
 		if ws.PongHandler != nil {
 			return ws.PongHandler(appData)
 		}
@@ -680,7 +1205,8 @@ func (r *Response) WebSocket() (*WebSocket, error) {
 //
 // The target must be based on the HTTP protocol (such as HTTP, WebSocket and
 // gRPC). So, the scheme of the target must be "http", "https", "ws", "wss",
-// "grpc" or "grpcs".
+// "grpc" or "grpcs". If the target is empty, one of the `ReverseProxy.Targets`
+// of the rp will be used.
 func (r *Response) ProxyPass(target string, rp *ReverseProxy) error {
 	if r.Written {
 		return errors.New("air: response has already been written")
@@ -690,6 +1216,41 @@ func (r *Response) ProxyPass(target string, rp *ReverseProxy) error {
 		rp = &ReverseProxy{}
 	}
 
+	return r.proxyPass(target, rp, nil)
+}
+
+// proxyPass implements the `ProxyPass`. The tried is the list of the targets
+// picked from the `ReverseProxy.Targets` of the rp that have been tried, the
+// last one of which is the target.
+func (r *Response) proxyPass(
+	target string,
+	rp *ReverseProxy,
+	tried []string,
+) error {
+	if target == "" && len(rp.Targets) > 0 {
+		target = rp.pickTarget(r.req, nil)
+		if target == "" {
+			r.Status = http.StatusBadGateway
+			return errors.New(
+				"air: no healthy reverse proxy targets",
+			)
+		}
+
+		tried = []string{target}
+	}
+
+	picked := target
+	status := r.Status
+
+	if mrt := rp.ModifyRequestTarget; mrt != nil {
+		t, err := mrt(target)
+		if err != nil {
+			return err
+		}
+
+		target = t
+	}
+
 	targetMethod := r.req.Method
 	if mrm := rp.ModifyRequestMethod; mrm != nil {
 		m, err := mrm(targetMethod)
@@ -700,23 +1261,11 @@ func (r *Response) ProxyPass(target string, rp *ReverseProxy) error {
 		targetMethod = m
 	}
 
-	targetURL, err := url.Parse(target)
+	targetURL, err := parseReverseProxyTarget(target)
 	if err != nil {
 		return err
 	}
 
-	targetURL.Scheme = strings.ToLower(targetURL.Scheme)
-	switch targetURL.Scheme {
-	case "http", "https", "ws", "wss", "grpc", "grpcs":
-	default:
-		return fmt.Errorf(
-			"air: unsupported reverse proxy scheme: %s",
-			targetURL.Scheme,
-		)
-	}
-
-	targetURL.Host = strings.ToLower(targetURL.Host)
-
 	reqPath := r.req.Path
 	if mrp := rp.ModifyRequestPath; mrp != nil {
 		p, err := mrp(reqPath)
@@ -761,13 +1310,28 @@ func (r *Response) ProxyPass(target string, rp *ReverseProxy) error {
 		targetHeader = h
 	}
 
+	transportUserAgent := false
 	if _, ok := targetHeader["User-Agent"]; !ok {
-		// Explicitly disable the User-Agent header so it's not set to
-		// default value.
-		targetHeader.Set("User-Agent", "")
+		switch rp.DefaultUserAgent {
+		case "":
+			// Explicitly disable the User-Agent header so it's not
+			// set to default value.
+			targetHeader.Set("User-Agent", "")
+		case "-":
+			// Leave it to the transport.
+			transportUserAgent = true
+		default:
+			targetHeader.Set("User-Agent", rp.DefaultUserAgent)
+		}
 	}
 
 	targetBody := r.req.Body
+	if r.req.ContentLength == 0 {
+		// The body may have been closed by a previous try of the
+		// retries.
+		targetBody = http.NoBody
+	}
+
 	if mrb := rp.ModifyRequestBody; mrb != nil {
 		b, err := mrb(targetBody)
 		if err != nil {
@@ -777,7 +1341,31 @@ func (r *Response) ProxyPass(target string, rp *ReverseProxy) error {
 		targetBody = b
 	}
 
-	var reverseProxyError error
+	bufferPool := r.Air.ReverseProxyBufferPool
+	if bufferPool == nil {
+		bufferPool = r.Air.reverseProxyBufferPool
+	}
+
+	hr := r.req.HTTPRequest()
+
+	var deadlineContext context.Context
+	if rp.Deadline > 0 {
+		var cancel context.CancelFunc
+		deadlineContext, cancel = context.WithTimeout(
+			hr.Context(),
+			rp.Deadline,
+		)
+		defer cancel()
+
+		hr = hr.WithContext(deadlineContext)
+	}
+
+	var (
+		reverseProxyError error
+		responded         bool
+		retryable         bool
+	)
+
 	hrp := &httputil.ReverseProxy{
 		Director: func(req *http.Request) {
 			req.Method = targetMethod
@@ -785,16 +1373,22 @@ func (r *Response) ProxyPass(target string, rp *ReverseProxy) error {
 			req.Header = targetHeader
 			req.Body = targetBody
 
-			// TODO: Remove the following line when the
-			// "net/http/httputil" of the minimum supported Go
-			// version of Air has fixed this bug.
-			req.Host = ""
+			if rp.PreserveHost {
+				req.Host = r.req.Authority
+			} else {
+				// TODO: Remove the following line when the
+				// "net/http/httputil" of the minimum supported
+				// Go version of Air has fixed this bug.
+				req.Host = ""
+			}
 		},
 		Transport:     rp.Transport,
 		FlushInterval: rp.FlushInterval,
 		ErrorLog:      r.Air.ErrorLogger,
-		BufferPool:    r.Air.reverseProxyBufferPool,
+		BufferPool:    bufferPool,
 		ModifyResponse: func(res *http.Response) error {
+			responded = true
+
 			if mrs := rp.ModifyResponseStatus; mrs != nil {
 				s, err := mrs(res.StatusCode)
 				if err != nil {
@@ -827,6 +1421,10 @@ func (r *Response) ProxyPass(target string, rp *ReverseProxy) error {
 				res.Header["Content-Encoding"],
 				"gzip",
 			)
+			r.Brotlied = httpguts.HeaderValuesContainsToken(
+				res.Header["Content-Encoding"],
+				"br",
+			)
 
 			return nil
 		},
@@ -837,13 +1435,45 @@ func (r *Response) ProxyPass(target string, rp *ReverseProxy) error {
 		) {
 			if r.Status < http.StatusBadRequest {
 				r.Status = http.StatusBadGateway
+				if deadlineContext != nil &&
+					deadlineContext.Err() ==
+						context.DeadlineExceeded {
+					r.Status = rp.DeadlineStatus
+					if r.Status == 0 {
+						r.Status = http.StatusGatewayTimeout
+					}
+				}
 			}
 
 			if !r.Written {
 				r.Gzipped = false
+				r.Brotlied = false
 			}
 
 			reverseProxyError = err
+
+			retryable = !responded &&
+				!r.Written &&
+				tried != nil &&
+				len(tried) <= rp.MaxRetries &&
+				r.req.ContentLength == 0 &&
+				r.req.Context.Err() == nil &&
+				(deadlineContext == nil ||
+					deadlineContext.Err() == nil)
+			switch targetMethod {
+			case http.MethodGet,
+				http.MethodHead,
+				http.MethodOptions,
+				http.MethodTrace,
+				http.MethodPut,
+				http.MethodDelete:
+			default:
+				retryable = false
+			}
+
+			if !responded && tried != nil {
+				rp.markTargetFailed(picked)
+			}
 		},
 	}
 
@@ -851,6 +1481,12 @@ func (r *Response) ProxyPass(target string, rp *ReverseProxy) error {
 		hrp.Transport = r.Air.reverseProxyTransport
 	}
 
+	if transportUserAgent {
+		hrp.Transport = &userAgentTransport{
+			rt: hrp.Transport,
+		}
+	}
+
 	defer func() {
 		r := recover()
 		if r == nil || r == http.ErrAbortHandler {
@@ -860,7 +1496,14 @@ func (r *Response) ProxyPass(target string, rp *ReverseProxy) error {
 		panic(r)
 	}()
 
-	hrp.ServeHTTP(r.hrw, r.req.HTTPRequest())
+	hrp.ServeHTTP(r.hrw, hr)
+
+	if retryable {
+		if next := rp.pickTarget(r.req, tried); next != "" {
+			r.Status = status
+			return r.proxyPass(next, rp, append(tried, next))
+		}
+	}
 
 	return reverseProxyError
 }
@@ -873,31 +1516,155 @@ func (r *Response) Defer(f func()) {
 	}
 }
 
-// omittableHeader reports whether the header targeted by the key is omittable.
-func (r *Response) omittableHeader(key string) bool {
-	vs, ok := r.Header[http.CanonicalHeaderKey(key)]
+// Tee duplicates all bytes written to the client into the w, which is useful
+// for auditing response bodies without buffering them.
+//
+// If the compressed is true, the w receives the bytes exactly as they are sent
+// to the client (after the gzip feature has been applied). Otherwise, the w
+// receives the bytes as they are written to the r (before the gzip feature has
+// been applied). They are the same if the response is not gzipped.
+//
+// The `Tee` must be called before the r is written, so it is usually called by
+// a gas before calling the next `Handler`. The w may still receive bytes while
+// the deferred functions (see the `Defer`) are running, since the gzip feature
+// flushes the remaining compressed bytes at that time. Errors returned by the
+// w are ignored, and bytes written to the w are never counted into the
+// `ContentLength` of the r. Bytes written after the connection has been
+// hijacked are never duplicated.
+func (r *Response) Tee(w io.Writer, compressed bool) {
+	if w == nil {
+		return
+	}
+
+	if compressed {
+		r.compressedTees = append(r.compressedTees, w)
+	} else {
+		r.tees = append(r.tees, w)
+	}
+}
+
+// SetGzipLevel sets the gzip compression level of the r to the level, which
+// overrides the `Air.GzipCompressionLevel` for the r. Invalid levels are
+// ignored.
+//
+// The `SetGzipLevel` must be called before the r is written.
+func (r *Response) SetGzipLevel(level int) {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return
+	}
+
+	r.gzipLevel = level
+	r.gzipLevelSet = true
+}
+
+// omittableHeader reports whether the header targeted by the key is omittable.
+func (r *Response) omittableHeader(key string) bool {
+	vs, ok := r.Header[http.CanonicalHeaderKey(key)]
 	return ok && vs == nil
 }
 
-// gzippable reports whether the r is gzippable.
+// gzippable reports whether the r is gzippable. It is gzippable if the client
+// accepts the "gzip" content coding with a non-zero q-value that is not lower
+// than the q-value of the "identity" content coding.
 func (r *Response) gzippable() bool {
-	for _, ae := range strings.Split(
-		strings.Join(r.req.Header["Accept-Encoding"], ","),
-		",",
-	) {
-		ae = strings.TrimSpace(ae)
-		ae = strings.Split(ae, ";")[0]
-		ae = strings.ToLower(ae)
-		if ae == "gzip" {
-			return true
+	qs := acceptEncodingQValues(r.req.Header["Accept-Encoding"])
+	gq := acceptEncodingQValue(qs, "gzip")
+	if gq <= 0 {
+		return false
+	}
+
+	if iq, ok := qs["identity"]; ok && iq > gq {
+		return false
+	}
+
+	return true
+}
+
+// brotliable reports whether the r is brotliable. It is brotliable if the
+// client accepts the "br" content coding like the `gzippable` and, when the
+// gzip feature is enabled, does not prefer the "gzip" content coding over it.
+func (r *Response) brotliable() bool {
+	qs := acceptEncodingQValues(r.req.Header["Accept-Encoding"])
+	brq := acceptEncodingQValue(qs, "br")
+	if brq <= 0 {
+		return false
+	}
+
+	if iq, ok := qs["identity"]; ok && iq > brq {
+		return false
+	}
+
+	if r.Air.GzipEnabled && acceptEncodingQValue(qs, "gzip") > brq {
+		return false
+	}
+
+	return true
+}
+
+// bodyAllowedForStatus reports whether the status allows a response body. See
+// RFC 7230, section 3.3.
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent:
+		return false
+	case status == http.StatusNotModified:
+		return false
+	}
+
+	return true
+}
+
+// acceptEncodingQValues parses the values of the Accept-Encoding headers into a
+// map of the lowercase content codings to their q-values. See RFC 7231, section
+// 5.3.4.
+func acceptEncodingQValues(values []string) map[string]float64 {
+	qs := map[string]float64{}
+	for _, ae := range strings.Split(strings.Join(values, ","), ",") {
+		params := strings.Split(ae, ";")
+
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding == "" {
+			continue
 		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if len(param) > 2 && strings.EqualFold(param[:2], "q=") {
+				if f, err := strconv.ParseFloat(
+					param[2:],
+					64,
+				); err == nil {
+					q = f
+				}
+			}
+		}
+
+		qs[coding] = q
+	}
+
+	return qs
+}
+
+// acceptEncodingQValue returns the q-value of the coding in the qs (as returned
+// by the `acceptEncodingQValues`). The q-value of the "*" is used if the coding
+// is not listed, and zero is returned if neither of them is listed.
+func acceptEncodingQValue(qs map[string]float64, coding string) float64 {
+	if q, ok := qs[coding]; ok {
+		return q
 	}
 
-	return false
+	return qs["*"]
 }
 
 // ReverseProxy is used by the `Response.ProxyPass` to achieve the reverse proxy
 // technique.
+//
+// A `ReverseProxy` with the `Targets` should be reused across the requests so
+// that the `Balancer` and the `UnhealthyDuration` work as expected. It must not
+// be copied after first use.
 type ReverseProxy struct {
 	// Transport is used to perform the request to the target.
 	//
@@ -906,6 +1673,48 @@ type ReverseProxy struct {
 	// is responsible for keeping the `Response.ProxyPass` working properly.
 	Transport http.RoundTripper
 
+	// Targets is the pool of the targets (upstreams) among which the
+	// requests are distributed.
+	//
+	// If the `Targets` is not empty and the target passed to the
+	// `Response.ProxyPass` is empty, a target will be picked from the
+	// healthy ones of the `Targets` for each request by the `Balancer`.
+	Targets []string
+
+	// Balancer is used to pick a target from the `Targets`.
+	//
+	// If the `Balancer` is nil, the targets are picked at random.
+	Balancer Balancer
+
+	// TargetHealthy reports whether the target in the `Targets` is healthy.
+	// The unhealthy targets are never picked, and the
+	// `http.StatusBadGateway` is responded if none of the `Targets` is
+	// healthy.
+	//
+	// If the `TargetHealthy` is nil, all targets are healthy.
+	TargetHealthy func(target string) bool
+
+	// MaxRetries is the maximum number of the retries against the other
+	// healthy ones of the `Targets` when the request to the picked target
+	// fails with a transport error (such as a refused connection). The
+	// valid responses from the targets (even with error statuses) are
+	// never retried.
+	//
+	// Since the body of the request cannot be replayed, only the requests
+	// with idempotent methods (GET, HEAD, OPTIONS, TRACE, PUT and DELETE,
+	// see RFC 7231, section 4.2.2) and without bodies are retried. The
+	// requests are also not retried once the `Deadline` is exceeded or the
+	// client has gone away.
+	MaxRetries int
+
+	// UnhealthyDuration is how long a target in the `Targets` is treated
+	// as unhealthy (that is, never picked unless all of the `Targets` are
+	// unhealthy) after the request to it fails with a transport error.
+	//
+	// If the `UnhealthyDuration` is zero, the failed targets are not
+	// treated as unhealthy.
+	UnhealthyDuration time.Duration
+
 	// FlushInterval is the flush interval to flush to the client while
 	// copying the body of the response from the target.
 	//
@@ -918,6 +1727,46 @@ type ReverseProxy struct {
 	// response from the target is recognized as a streaming response.
 	FlushInterval time.Duration
 
+	// DefaultUserAgent is the User-Agent header value of the request to
+	// the target when the client did not send one.
+	//
+	// If the `DefaultUserAgent` is empty, the User-Agent header will be
+	// explicitly disabled.
+	//
+	// If the `DefaultUserAgent` is "-", the User-Agent header will be left
+	// to the transport, which means that the default one of the transport
+	// (if any) will be used.
+	//
+	// Otherwise the `DefaultUserAgent` will be used as is.
+	//
+	// Note that the User-Agent header from the client is always forwarded
+	// as is.
+	DefaultUserAgent string
+
+	// PreserveHost indicates whether the Host header of the request to the
+	// target is the original `Request.Authority` instead of the host of
+	// the target. It is useful for the virtual-hosted targets.
+	PreserveHost bool
+
+	// Deadline is the maximum duration allowed for the whole request to
+	// the target, regardless of how long the client is willing to wait.
+	//
+	// If the `Deadline` is zero, there is no deadline.
+	Deadline time.Duration
+
+	// DeadlineStatus is the status of the response when the `Deadline` is
+	// exceeded.
+	//
+	// If the `DeadlineStatus` is zero, the `http.StatusGatewayTimeout` is
+	// used.
+	DeadlineStatus int
+
+	// ModifyRequestTarget modifies the target of the request, which is
+	// the one picked from the `Targets` or the one passed to the
+	// `Response.ProxyPass`. It is also useful for observing which target
+	// was picked.
+	ModifyRequestTarget func(target string) (string, error)
+
 	// ModifyRequestMethod modifies the method of the request to the target.
 	ModifyRequestMethod func(method string) (string, error)
 
@@ -951,6 +1800,188 @@ type ReverseProxy struct {
 	// `io.ReadCloser`, which means that the `Response.ProxyPass` will be
 	// responsible for closing it.
 	ModifyResponseBody func(body io.ReadCloser) (io.ReadCloser, error)
+
+	target            string
+	failedTargets     map[string]time.Time
+	failedTargetMutex sync.Mutex
+}
+
+// ProxyOption is an option of the `NewReverseProxy`.
+type ProxyOption func(*reverseProxyTransport)
+
+// WithProxyMaxIdleConns returns a `ProxyOption` that sets the maximum number of
+// idle (keep-alive) connections to keep per host. The default is 200.
+func WithProxyMaxIdleConns(n int) ProxyOption {
+	return func(rpt *reverseProxyTransport) {
+		rpt.maxIdleConnsPerHost = n
+	}
+}
+
+// WithProxyMaxConns returns a `ProxyOption` that sets the maximum number of
+// connections per host. The default is zero, which means no limit.
+func WithProxyMaxConns(n int) ProxyOption {
+	return func(rpt *reverseProxyTransport) {
+		rpt.maxConnsPerHost = n
+	}
+}
+
+// WithProxyIdleConnTimeout returns a `ProxyOption` that sets the maximum amount
+// of time an idle (keep-alive) connection will remain idle before closing
+// itself. The default is 90 seconds.
+func WithProxyIdleConnTimeout(d time.Duration) ProxyOption {
+	return func(rpt *reverseProxyTransport) {
+		rpt.idleConnTimeout = d
+	}
+}
+
+// WithProxyResponseHeaderTimeout returns a `ProxyOption` that sets the amount
+// of time to wait for the response headers of the target after fully writing
+// the request. The default is zero, which means no timeout.
+func WithProxyResponseHeaderTimeout(d time.Duration) ProxyOption {
+	return func(rpt *reverseProxyTransport) {
+		rpt.responseHeaderTimeout = d
+	}
+}
+
+// WithProxyTLSConfig returns a `ProxyOption` that sets the TLS configuration
+// used to connect to the target over TLS.
+func WithProxyTLSConfig(c *tls.Config) ProxyOption {
+	return func(rpt *reverseProxyTransport) {
+		rpt.tlsConfig = c
+	}
+}
+
+// NewReverseProxy returns a new instance of the `ReverseProxy` bound to the
+// target with its own `Transport` tuned by the opts. See the
+// `Response.ProxyPass` for the supported targets.
+//
+// Unlike the `Response.ProxyPass` with a nil `ReverseProxy`, which shares the
+// connections to all targets of the `Air`, the returned `ReverseProxy` keeps
+// its own idle connections and HTTP/2 streams for the target. So it should be
+// created once and reused across the requests (see the `ReverseProxy.Serve`).
+func NewReverseProxy(
+	target string,
+	opts ...ProxyOption,
+) (*ReverseProxy, error) {
+	if _, err := parseReverseProxyTarget(target); err != nil {
+		return nil, err
+	}
+
+	rpt := &reverseProxyTransport{
+		maxIdleConnsPerHost: 200,
+		idleConnTimeout:     90 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(rpt)
+	}
+
+	return &ReverseProxy{
+		Transport: rpt,
+		target:    target,
+	}, nil
+}
+
+// Serve passes the req to the target that the rp is bound to (see the
+// `NewReverseProxy`) and writes the response from the target to the res. It is
+// equivalent to the `Response.ProxyPass` with the target and the rp.
+//
+// If the rp is not bound to a target, one of the `Targets` is used.
+func (rp *ReverseProxy) Serve(req *Request, res *Response) error {
+	return res.ProxyPass(rp.target, rp)
+}
+
+// parseReverseProxyTarget parses the target of the `Response.ProxyPass` into a
+// `url.URL` with the lowercase scheme and host.
+func parseReverseProxyTarget(target string) (*url.URL, error) {
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	targetURL.Scheme = strings.ToLower(targetURL.Scheme)
+	switch targetURL.Scheme {
+	case "http", "https", "ws", "wss", "grpc", "grpcs":
+	default:
+		return nil, fmt.Errorf(
+			"air: unsupported reverse proxy scheme: %s",
+			targetURL.Scheme,
+		)
+	}
+
+	targetURL.Host = strings.ToLower(targetURL.Host)
+
+	return targetURL, nil
+}
+
+// pickTarget picks a target from the healthy ones of the `Targets` of the rp
+// that are not in the excluded for the req. The targets that recently failed
+// (see the `UnhealthyDuration`) are only picked if all the others are
+// unhealthy. It returns "" if none of them can be picked.
+func (rp *ReverseProxy) pickTarget(req *Request, excluded []string) string {
+	var failedTargets map[string]bool
+	if rp.UnhealthyDuration > 0 {
+		now := time.Now()
+
+		rp.failedTargetMutex.Lock()
+		for t, ft := range rp.failedTargets {
+			if now.Sub(ft) < rp.UnhealthyDuration {
+				if failedTargets == nil {
+					failedTargets = map[string]bool{}
+				}
+
+				failedTargets[t] = true
+			} else {
+				delete(rp.failedTargets, t)
+			}
+		}
+
+		rp.failedTargetMutex.Unlock()
+	}
+
+	targets := make([]string, 0, len(rp.Targets))
+	fallbackTargets := []string{}
+	for _, t := range rp.Targets {
+		if stringSliceContains(excluded, t, false) ||
+			(rp.TargetHealthy != nil && !rp.TargetHealthy(t)) {
+			continue
+		}
+
+		if failedTargets[t] {
+			fallbackTargets = append(fallbackTargets, t)
+		} else {
+			targets = append(targets, t)
+		}
+	}
+
+	if len(targets) == 0 {
+		targets = fallbackTargets
+	}
+
+	if len(targets) == 0 {
+		return ""
+	}
+
+	if rp.Balancer == nil {
+		return randomBalancer{}.Pick(targets, req)
+	}
+
+	return rp.Balancer.Pick(targets, req)
+}
+
+// markTargetFailed marks the target in the `Targets` of the rp as failed. See
+// the `UnhealthyDuration`.
+func (rp *ReverseProxy) markTargetFailed(target string) {
+	if rp.UnhealthyDuration <= 0 {
+		return
+	}
+
+	rp.failedTargetMutex.Lock()
+	if rp.failedTargets == nil {
+		rp.failedTargets = map[string]time.Time{}
+	}
+
+	rp.failedTargets[target] = time.Now()
+	rp.failedTargetMutex.Unlock()
 }
 
 // responseWriter is used to tie the `Response` and `http.ResponseWriter`
@@ -962,6 +1993,8 @@ type responseWriter struct {
 	hrw http.ResponseWriter
 	cw  *countWriter
 	gw  *gzip.Writer
+	bw  *brotli.Writer
+	bwn int64
 }
 
 // Header implements the `http.ResponseWriter`.
@@ -989,12 +2022,48 @@ func (rw *responseWriter) WriteHeader(status int) {
 		}
 	}
 
+	if rw.r.Air.BeforeWriteHeader != nil {
+		rw.r.Status = status
+		rw.r.Air.BeforeWriteHeader(rw.r)
+		status = rw.r.Status
+	}
+
+	if rw.r.Air.CanonicalizeResponseHeaders {
+		canonicalizeHeader(rw.r.Header)
+	}
+
 	rw.cw = &countWriter{
 		w: rw.hrw,
 		c: &rw.r.ContentLength,
 	}
 
+	if len(rw.r.compressedTees) > 0 {
+		rw.cw.w = &teeWriter{
+			w:    rw.hrw,
+			tees: rw.r.compressedTees,
+		}
+	}
+
+	rw.handleBrotli()
 	rw.handleGzip()
+
+	// See RFC 7232, section 4.1.
+	if status == http.StatusNotModified && rw.r.gzipETagTrimmed {
+		et := rw.r.Header.Get("ETag")
+		if et != "" && !strings.HasSuffix(et, `-gzip"`) {
+			et = strings.TrimSuffix(et, `"`)
+			et = fmt.Sprint(et, `-gzip"`)
+			rw.r.Header.Set("ETag", et)
+		}
+	} else if status == http.StatusNotModified && rw.r.brotliETagTrimmed {
+		et := rw.r.Header.Get("ETag")
+		if et != "" && !strings.HasSuffix(et, `-br"`) {
+			et = strings.TrimSuffix(et, `"`)
+			et = fmt.Sprint(et, `-br"`)
+			rw.r.Header.Set("ETag", et)
+		}
+	}
+
 	rw.hrw.WriteHeader(status)
 
 	rw.r.Status = status
@@ -1002,6 +2071,19 @@ func (rw *responseWriter) WriteHeader(status int) {
 	rw.r.Written = true
 }
 
+// writeInterimHeader writes an interim response with the status to the
+// client without committing the final response.
+func (rw *responseWriter) writeInterimHeader(status int) {
+	rw.Lock()
+	defer rw.Unlock()
+
+	if rw.r.Written {
+		return
+	}
+
+	rw.hrw.WriteHeader(status)
+}
+
 // Write implements the `http.ResponseWriter`.
 func (rw *responseWriter) Write(b []byte) (int, error) {
 	if !rw.r.Written {
@@ -1016,18 +2098,41 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 		return 0, nil
 	}
 
+	if !bodyAllowedForStatus(rw.r.Status) {
+		return len(b), nil
+	}
+
 	w := io.Writer(rw.cw)
 	if rw.gw != nil {
 		w = rw.gw
+	} else if rw.bw != nil {
+		w = rw.bw
+	}
+
+	n, err := w.Write(b)
+	if w == rw.bw {
+		// The bw buffers the written bytes, so the cw may have not
+		// counted any of them yet.
+		rw.bwn += int64(n)
 	}
 
-	return w.Write(b)
+	for _, tee := range rw.r.tees {
+		tee.Write(b[:n])
+	}
+
+	return n, err
 }
 
 // Flush implements the `http.Flusher`.
 func (rw *responseWriter) Flush() {
+	if !rw.r.Written {
+		rw.WriteHeader(rw.r.Status)
+	}
+
 	if rw.gw != nil {
 		rw.gw.Flush()
+	} else if rw.bw != nil {
+		rw.bw.Flush()
 	}
 
 	if flusher, ok := rw.hrw.(http.Flusher); ok {
@@ -1035,9 +2140,79 @@ func (rw *responseWriter) Flush() {
 	}
 }
 
+// handleBrotli handles the brotli feature for the rw.
+func (rw *responseWriter) handleBrotli() {
+	if !rw.r.Air.BrotliEnabled {
+		return
+	}
+
+	if !rw.r.Brotlied && !rw.r.Gzipped {
+		if cl, _ := strconv.ParseInt(
+			rw.r.Header.Get("Content-Length"),
+			10,
+			64,
+		); cl < rw.r.Air.BrotliMinContentLength {
+			return
+		}
+
+		if mt, _, _ := mime.ParseMediaType(
+			rw.r.Header.Get("Content-Type"),
+		); !stringSliceContains(rw.r.Air.BrotliMIMETypes, mt, true) {
+			return
+		}
+
+		if rw.r.brotliable() {
+			bwp := &rw.r.Air.brotliWriterPool
+			if rw.bw, _ = bwp.Get().(*brotli.Writer); rw.bw == nil {
+				return
+			}
+
+			rw.bw.Reset(rw.cw)
+			rw.r.Defer(func() {
+				if rw.bwn == 0 {
+					rw.bw.Reset(ioutil.Discard)
+				}
+
+				rw.bw.Close()
+
+				bwp.Put(rw.bw)
+				rw.bw = nil
+				rw.bwn = 0
+			})
+
+			rw.r.Brotlied = true
+		}
+	}
+
+	if rw.r.Brotlied {
+		if !httpguts.HeaderValuesContainsToken(
+			rw.r.Header["Content-Encoding"],
+			"br",
+		) {
+			rw.r.Header.Add("Content-Encoding", "br")
+		}
+
+		rw.r.Header.Del("Content-Length")
+
+		// See RFC 7232, section 2.3.3.
+		if et := rw.r.Header.Get("ETag"); et != "" {
+			et = strings.TrimSuffix(et, `"`)
+			et = fmt.Sprint(et, `-br"`)
+			rw.r.Header.Set("ETag", et)
+		}
+	}
+
+	if !httpguts.HeaderValuesContainsToken(
+		rw.r.Header["Vary"],
+		"Accept-Encoding",
+	) {
+		rw.r.Header.Add("Vary", "Accept-Encoding")
+	}
+}
+
 // handleGzip handles the gzip feature for the rw.
 func (rw *responseWriter) handleGzip() {
-	if !rw.r.Air.GzipEnabled {
+	if !rw.r.Air.GzipEnabled || rw.r.Brotlied {
 		return
 	}
 
@@ -1057,7 +2232,23 @@ func (rw *responseWriter) handleGzip() {
 		}
 
 		if rw.r.gzippable() {
-			rw.gw, _ = rw.r.Air.gzipWriterPool.Get().(*gzip.Writer)
+			var gwp *sync.Pool
+			if l := rw.r.gzipLevel; rw.r.gzipLevelSet &&
+				l != rw.r.Air.GzipCompressionLevel {
+				gwps := &rw.r.Air.gzipLevelWriterPools
+				gwp = &gwps[l-gzip.HuffmanOnly]
+				if rw.gw, _ = gwp.Get().(*gzip.Writer); rw.gw == nil {
+					rw.gw, _ = gzip.NewWriterLevel(nil, l)
+				}
+			} else {
+				gwp = rw.r.Air.GzipWriterPool
+				if gwp == nil {
+					gwp = &rw.r.Air.gzipWriterPool
+				}
+
+				rw.gw, _ = gwp.Get().(*gzip.Writer)
+			}
+
 			if rw.gw == nil {
 				return
 			}
@@ -1070,7 +2261,7 @@ func (rw *responseWriter) handleGzip() {
 
 				rw.gw.Close()
 
-				rw.r.Air.gzipWriterPool.Put(rw.gw)
+				gwp.Put(rw.gw)
 				rw.gw = nil
 			})
 
@@ -1104,6 +2295,49 @@ func (rw *responseWriter) handleGzip() {
 	}
 }
 
+// trimGzipETagSuffixes trims the "-gzip" suffixes appended by the gzip feature
+// from the entity tags in the ets (the value of an If-Match or If-None-Match
+// header) and reports whether any of them has been trimmed.
+func trimGzipETagSuffixes(ets string) (string, bool) {
+	return trimETagSuffixes(ets, "-gzip")
+}
+
+// trimBrotliETagSuffixes is like the `trimGzipETagSuffixes`, but trims the
+// "-br" suffixes appended by the brotli feature.
+func trimBrotliETagSuffixes(ets string) (string, bool) {
+	return trimETagSuffixes(ets, "-br")
+}
+
+// trimETagSuffixes trims the suffix from the entity tags in the ets and
+// reports whether any of them has been trimmed.
+func trimETagSuffixes(ets, suffix string) (string, bool) {
+	trimmed := false
+	tets := strings.Split(ets, ",")
+	for i, et := range tets {
+		et = strings.TrimSpace(et)
+		if strings.HasSuffix(et, suffix+`"`) {
+			et = fmt.Sprint(strings.TrimSuffix(et, suffix+`"`), `"`)
+			trimmed = true
+		}
+
+		tets[i] = et
+	}
+
+	if !trimmed {
+		return ets, false
+	}
+
+	return strings.Join(tets, ", "), true
+}
+
+// NewSeekableBytes returns an `io.ReadSeeker` that reads from the b.
+//
+// Passing the result to the `Response.Write` yields full support of range
+// requests for the in-memory contents (such as the generated PDF files).
+func NewSeekableBytes(b []byte) io.ReadSeeker {
+	return bytes.NewReader(b)
+}
+
 // responseHijacker is used to tie the `Response` and `http.Hijacker` together.
 type responseHijacker struct {
 	r *Response
@@ -1134,59 +2368,109 @@ func (cw *countWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// teeWriter is used to duplicate the bytes written to the underlying
+// `io.Writer` into the tees.
+type teeWriter struct {
+	w    io.Writer
+	tees []io.Writer
+}
+
+// Write implements the `io.Writer`.
+func (tw *teeWriter) Write(b []byte) (int, error) {
+	n, err := tw.w.Write(b)
+	for _, tee := range tw.tees {
+		tee.Write(b[:n])
+	}
+
+	return n, err
+}
+
 // reverseProxyTransport is a transport with the reverse proxy support.
+//
+// If the `a` is not nil, the configuration of the transports is taken from it
+// at initialization. Otherwise the configuration fields are used as is.
 type reverseProxyTransport struct {
-	hTransport   *http.Transport
-	h2Transport  *http2.Transport
-	h2cTransport *http2.Transport
+	a                     *Air
+	maxIdleConnsPerHost   int
+	maxConnsPerHost       int
+	idleConnTimeout       time.Duration
+	responseHeaderTimeout time.Duration
+	tlsConfig             *tls.Config
+	initOnce              sync.Once
+	hTransport            *http.Transport
+	h2Transport           *http2.Transport
+	h2cTransport          *http2.Transport
 }
 
 // newReverseProxyTransport returns a new instance of the
-// `reverseProxyTransport`.
-func newReverseProxyTransport() *reverseProxyTransport {
+// `reverseProxyTransport` with the a.
+func newReverseProxyTransport(a *Air) *reverseProxyTransport {
+	return &reverseProxyTransport{
+		a: a,
+	}
+}
+
+// init initializes the transports of the rpt with the configuration of the
+// `rpt.a` (if any).
+func (rpt *reverseProxyTransport) init() {
+	if rpt.a != nil {
+		rpt.maxIdleConnsPerHost = rpt.a.ReverseProxyMaxIdleConnsPerHost
+		rpt.maxConnsPerHost = rpt.a.ReverseProxyMaxConnsPerHost
+		rpt.idleConnTimeout = rpt.a.ReverseProxyIdleConnTimeout
+	}
+
+	var tlsConfig *tls.Config
+	if rpt.tlsConfig != nil {
+		tlsConfig = rpt.tlsConfig.Clone()
+	}
+
 	dialer := &net.Dialer{
 		Timeout:   30 * time.Second,
 		KeepAlive: 30 * time.Second,
 		DualStack: true,
 	}
 
-	return &reverseProxyTransport{
-		hTransport: &http.Transport{
-			Proxy:                 http.ProxyFromEnvironment,
-			DialContext:           dialer.DialContext,
-			DisableCompression:    true,
-			MaxIdleConnsPerHost:   200,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-			ForceAttemptHTTP2:     true,
-		},
-		h2Transport: &http2.Transport{
-			DialTLS: func(
-				network string,
-				address string,
-				tlsConfig *tls.Config,
-			) (net.Conn, error) {
-				return tls.DialWithDialer(
-					dialer,
-					network,
-					address,
-					tlsConfig,
-				)
-			},
-			DisableCompression: true,
+	rpt.hTransport = &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		DisableCompression:    true,
+		MaxIdleConnsPerHost:   rpt.maxIdleConnsPerHost,
+		MaxConnsPerHost:       rpt.maxConnsPerHost,
+		IdleConnTimeout:       rpt.idleConnTimeout,
+		ResponseHeaderTimeout: rpt.responseHeaderTimeout,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		ForceAttemptHTTP2:     true,
+	}
+
+	rpt.h2Transport = &http2.Transport{
+		DialTLS: func(
+			network string,
+			address string,
+			tlsConfig *tls.Config,
+		) (net.Conn, error) {
+			return tls.DialWithDialer(
+				dialer,
+				network,
+				address,
+				tlsConfig,
+			)
 		},
-		h2cTransport: &http2.Transport{
-			DialTLS: func(
-				network string,
-				address string,
-				_ *tls.Config,
-			) (net.Conn, error) {
-				return dialer.Dial(network, address)
-			},
-			DisableCompression: true,
-			AllowHTTP:          true,
+		TLSClientConfig:    tlsConfig,
+		DisableCompression: true,
+	}
+
+	rpt.h2cTransport = &http2.Transport{
+		DialTLS: func(
+			network string,
+			address string,
+			_ *tls.Config,
+		) (net.Conn, error) {
+			return dialer.Dial(network, address)
 		},
+		DisableCompression: true,
+		AllowHTTP:          true,
 	}
 }
 
@@ -1194,6 +2478,8 @@ func newReverseProxyTransport() *reverseProxyTransport {
 func (rpt *reverseProxyTransport) RoundTrip(
 	req *http.Request,
 ) (*http.Response, error) {
+	rpt.initOnce.Do(rpt.init)
+
 	var transport http.RoundTripper
 	switch req.URL.Scheme {
 	case "ws":
@@ -1215,18 +2501,36 @@ func (rpt *reverseProxyTransport) RoundTrip(
 	return transport.RoundTrip(req)
 }
 
+// userAgentTransport is used to leave the User-Agent header to the underlying
+// `http.RoundTripper`, since the `httputil.ReverseProxy` always disables it
+// when it is missing.
+type userAgentTransport struct {
+	rt http.RoundTripper
+}
+
+// RoundTrip implements the `http.RoundTripper`.
+func (uat *userAgentTransport) RoundTrip(
+	req *http.Request,
+) (*http.Response, error) {
+	if vs := req.Header["User-Agent"]; len(vs) == 1 && vs[0] == "" {
+		req.Header.Del("User-Agent")
+	}
+
+	return uat.rt.RoundTrip(req)
+}
+
 // reverseProxyBufferPool is a buffer pool for the reverse proxy.
 type reverseProxyBufferPool struct {
 	pool sync.Pool
 }
 
 // newReverseProxyBufferPool returns a new instance of the
-// `reverseProxyBufferPool`.
-func newReverseProxyBufferPool() *reverseProxyBufferPool {
+// `reverseProxyBufferPool` with the a.
+func newReverseProxyBufferPool(a *Air) *reverseProxyBufferPool {
 	return &reverseProxyBufferPool{
 		pool: sync.Pool{
 			New: func() interface{} {
-				return make([]byte, 32<<20)
+				return make([]byte, a.ReverseProxyBufferSize)
 			},
 		},
 	}
@@ -1241,3 +2545,31 @@ func (rpbp *reverseProxyBufferPool) Get() []byte {
 func (rpbp *reverseProxyBufferPool) Put(bytes []byte) {
 	rpbp.pool.Put(bytes)
 }
+
+// canonicalizeHeader canonicalizes the names of the h in place. The values of
+// the names that are canonicalized into the same one are merged.
+func canonicalizeHeader(h http.Header) {
+	for k, vs := range h {
+		ck := textproto.CanonicalMIMEHeaderKey(k)
+		if ck == k {
+			continue
+		}
+
+		delete(h, k)
+		h[ck] = append(h[ck], vs...)
+	}
+}
+
+// hopByHopHeaders is the set of the hop-by-hop headers (see RFC 7230, section
+// 6.1) that are never applied from the `Air.DefaultResponseHeaders`.
+var hopByHopHeaders = map[string]struct{}{
+	"Connection":          {},
+	"Keep-Alive":          {},
+	"Proxy-Authenticate":  {},
+	"Proxy-Authorization": {},
+	"Proxy-Connection":    {},
+	"Te":                  {},
+	"Trailer":             {},
+	"Transfer-Encoding":   {},
+	"Upgrade":             {},
+}
@@ -0,0 +1,8 @@
+//go:build go1.19
+// +build go1.19
+
+package air
+
+// interimResponsesSupported indicates whether the interim responses (1xx
+// except 101) are supported by the `net/http`.
+const interimResponsesSupported = true
@@ -1,22 +1,125 @@
 package air
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
 	"encoding/xml"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
+func TestResponseDefaultHeaders(t *testing.T) {
+	a := New()
+	a.DefaultResponseHeaders = http.Header{
+		"Server":     {"Foobar"},
+		"x-foo":      {"bar"},
+		"Connection": {"close"},
+	}
+
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString("Foobar")
+	})
+
+	a.GET("/override", func(req *Request, res *Response) error {
+		res.Header.Set("Server", "Barfoo")
+		res.Header.Add("X-Foo", "baz")
+		return res.WriteString("Foobar")
+	})
+
+	hr := httptest.NewRequest(http.MethodGet, "/", nil)
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr := hrw.Result()
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "Foobar", hrwr.Header.Get("Server"))
+	assert.Equal(t, "bar", hrwr.Header.Get("X-Foo"))
+	assert.Empty(t, hrwr.Header.Get("Connection"))
+
+	hr = httptest.NewRequest(http.MethodGet, "/override", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "Barfoo", hrwr.Header.Get("Server"))
+	assert.Equal(t, []string{"bar", "baz"}, hrwr.Header["X-Foo"])
+
+	assert.Equal(t, []string{"Foobar"}, a.DefaultResponseHeaders["Server"])
+	assert.Equal(t, []string{"bar"}, a.DefaultResponseHeaders["x-foo"])
+
+	hr = httptest.NewRequest(http.MethodGet, "/404", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+
+	assert.Equal(t, http.StatusNotFound, hrwr.StatusCode)
+	assert.Equal(t, "Foobar", hrwr.Header.Get("Server"))
+}
+
+func TestResponseCanonicalizeHeaders(t *testing.T) {
+	a := New()
+	a.CanonicalizeResponseHeaders = true
+
+	a.GET("/", func(req *Request, res *Response) error {
+		res.Header["x-foo-ID"] = []string{"bar"}
+		res.Header["X-Bar"] = []string{"foo"}
+		res.Header["x-bar"] = []string{"baz"}
+		return res.WriteString("Foobar")
+	})
+
+	hr := httptest.NewRequest(http.MethodGet, "/", nil)
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr := hrw.Result()
+
+	assert.Equal(t, []string{"bar"}, hrwr.Header["X-Foo-Id"])
+	assert.Nil(t, hrwr.Header["x-foo-ID"])
+	assert.ElementsMatch(t, []string{"foo", "baz"}, hrwr.Header["X-Bar"])
+	assert.Nil(t, hrwr.Header["x-bar"])
+
+	a.CanonicalizeResponseHeaders = false
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+
+	assert.Equal(t, []string{"bar"}, hrwr.Header["x-foo-ID"])
+	assert.Nil(t, hrwr.Header["X-Foo-Id"])
+	assert.Equal(t, []string{"foo"}, hrwr.Header["X-Bar"])
+	assert.Equal(t, []string{"baz"}, hrwr.Header["x-bar"])
+}
+
 func TestResponseHTTPResponseWriter(t *testing.T) {
 	a := New()
 
@@ -58,6 +161,65 @@ func TestResponseSetCookie(t *testing.T) {
 	assert.Equal(t, "foo=bar", res.Header.Get("Set-Cookie"))
 }
 
+func TestResponseSetStatus(t *testing.T) {
+	a := New()
+
+	_, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.Same(t, res, res.SetStatus(http.StatusCreated))
+	assert.Equal(t, http.StatusCreated, res.Status)
+
+	assert.NoError(
+		t,
+		res.SetStatus(http.StatusAccepted).WriteString("foo"),
+	)
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusAccepted, hrwr.StatusCode)
+	assert.Equal(t, "foo", string(hrwrb))
+}
+
+func TestResponseNoContent(t *testing.T) {
+	a := New()
+
+	_, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.NoError(t, res.NoContent())
+	assert.True(t, res.Written)
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusNoContent, hrwr.StatusCode)
+	assert.Empty(t, hrwrb)
+
+	_, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	res.Status = http.StatusNotModified
+	assert.NoError(t, res.WriteString("foobar"))
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusNotModified, hrwr.StatusCode)
+	assert.Empty(t, hrwrb)
+
+	_, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	res.Status = http.StatusNoContent
+	n, err := res.Body.Write([]byte("foobar"))
+	assert.Equal(t, 6, n)
+	assert.NoError(t, err)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusNoContent, hrwr.StatusCode)
+	assert.Empty(t, hrwrb)
+}
+
 func TestResponseWrite(t *testing.T) {
 	a := New()
 
@@ -155,6 +317,187 @@ func TestResponseWrite(t *testing.T) {
 	assert.NoError(t, res.Write(strings.NewReader("foobar")))
 }
 
+func TestResponseWriteGzippedETag(t *testing.T) {
+	a := New()
+	a.GzipEnabled = true
+
+	a.GET("/", func(req *Request, res *Response) error {
+		res.Header.Set("ETag", `"foobar"`)
+		return res.WriteString(strings.Repeat("foobar", 1000))
+	})
+
+	hr := httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.Header.Set("Accept-Encoding", "gzip")
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr := hrw.Result()
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "gzip", hrwr.Header.Get("Content-Encoding"))
+	assert.Equal(t, `"foobar-gzip"`, hrwr.Header.Get("ETag"))
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.Header.Set("Accept-Encoding", "gzip")
+	hr.Header.Set("If-None-Match", `"foobar-gzip"`)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusNotModified, hrwr.StatusCode)
+	assert.Equal(t, `"foobar-gzip"`, hrwr.Header.Get("ETag"))
+	assert.Empty(t, hrwrb)
+	assert.Equal(t, `"foobar-gzip"`, hr.Header.Get("If-None-Match"))
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.Header.Set("Accept-Encoding", "gzip")
+	hr.Header.Set("If-None-Match", `"barfoo-gzip"`)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.Header.Set("If-Match", `"foobar-gzip"`)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, http.StatusOK, hrw.Code)
+}
+
+func TestResponseWriteBrotli(t *testing.T) {
+	a := New()
+	a.GzipEnabled = true
+	a.BrotliEnabled = true
+
+	a.GET("/", func(req *Request, res *Response) error {
+		res.Header.Set("ETag", `"foobar"`)
+		return res.WriteString(strings.Repeat("foobar", 1000))
+	})
+
+	hr := httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.Header.Set("Accept-Encoding", "gzip, br")
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(brotli.NewReader(hrwr.Body))
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "br", hrwr.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", hrwr.Header.Get("Vary"))
+	assert.Equal(t, `"foobar-br"`, hrwr.Header.Get("ETag"))
+	assert.Equal(t, strings.Repeat("foobar", 1000), string(hrwrb))
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.Header.Set("Accept-Encoding", "gzip;q=1.0, br;q=0.5")
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "gzip", hrwr.Header.Get("Content-Encoding"))
+	assert.Equal(t, `"foobar-gzip"`, hrwr.Header.Get("ETag"))
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.Header.Set("Accept-Encoding", "br")
+	hr.Header.Set("If-None-Match", `"foobar-br"`)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusNotModified, hrwr.StatusCode)
+	assert.Equal(t, `"foobar-br"`, hrwr.Header.Get("ETag"))
+	assert.Empty(t, hrwrb)
+
+	a.GzipEnabled = false
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.Header.Set("Accept-Encoding", "gzip;q=1.0, br;q=0.5")
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Equal(t, "br", hrw.Header().Get("Content-Encoding"))
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.Header.Set("Accept-Encoding", "br;q=0")
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	assert.Empty(t, hrw.Header().Get("Content-Encoding"))
+	assert.Equal(t, strings.Repeat("foobar", 1000), hrw.Body.String())
+}
+
+func TestResponseWriteBytes(t *testing.T) {
+	a := New()
+
+	_, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.NoError(t, res.WriteBytes("application/pdf", []byte("%PDF-1.4")))
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "application/pdf", hrwr.Header.Get("Content-Type"))
+	assert.Equal(t, "bytes", hrwr.Header.Get("Accept-Ranges"))
+	assert.Equal(t, "8", hrwr.Header.Get("Content-Length"))
+	assert.Equal(t, "%PDF-1.4", string(hrwrb))
+
+	et := hrwr.Header.Get("ETag")
+	assert.NotEmpty(t, et)
+
+	req, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Set("Range", "bytes=1-3")
+
+	assert.NoError(t, res.WriteBytes("application/pdf", []byte("%PDF-1.4")))
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusPartialContent, hrwr.StatusCode)
+	assert.Equal(t, "bytes 1-3/8", hrwr.Header.Get("Content-Range"))
+	assert.Equal(t, et, hrwr.Header.Get("ETag"))
+	assert.Equal(t, "PDF", string(hrwrb))
+
+	req, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", et)
+
+	assert.NoError(t, res.WriteBytes("application/pdf", []byte("%PDF-1.4")))
+
+	hrwr = hrw.Result()
+
+	assert.Equal(t, http.StatusNotModified, hrwr.StatusCode)
+
+	_, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+	res.Header["Etag"] = nil
+
+	assert.NoError(t, res.WriteBytes("", []byte("<!DOCTYPE html>")))
+
+	hrwr = hrw.Result()
+
+	assert.Equal(
+		t,
+		"text/html; charset=utf-8",
+		hrwr.Header.Get("Content-Type"),
+	)
+	assert.Empty(t, hrwr.Header.Get("ETag"))
+}
+
 func TestResponseWriteString(t *testing.T) {
 	a := New()
 
@@ -172,6 +515,34 @@ func TestResponseWriteString(t *testing.T) {
 		hrw.HeaderMap.Get("Content-Type"),
 	)
 	assert.Equal(t, "foobar", string(hrwrb))
+
+	a = New()
+	a.DefaultCharset = "iso-8859-1"
+
+	_, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.NoError(t, res.WriteString("foobar"))
+	assert.Equal(
+		t,
+		"text/plain; charset=iso-8859-1",
+		hrw.HeaderMap.Get("Content-Type"),
+	)
+
+	a = New()
+	a.DefaultCharset = ""
+
+	_, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.NoError(t, res.WriteString("foobar"))
+	assert.Equal(t, "text/plain", hrw.HeaderMap.Get("Content-Type"))
+
+	a = New()
+
+	_, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+	res.Header.Set("Content-Type", "text/csv")
+
+	assert.NoError(t, res.WriteString("foo,bar"))
+	assert.Equal(t, "text/csv", hrw.HeaderMap.Get("Content-Type"))
 }
 
 func TestResponseWriteHTML(t *testing.T) {
@@ -191,6 +562,18 @@ func TestResponseWriteHTML(t *testing.T) {
 		hrw.HeaderMap.Get("Content-Type"),
 	)
 	assert.Equal(t, "<!DOCTYPE html>", string(hrwrb))
+
+	a = New()
+	a.DefaultCharset = "shift_jis"
+
+	_, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.NoError(t, res.WriteHTML("<!DOCTYPE html>"))
+	assert.Equal(
+		t,
+		"text/html; charset=shift_jis",
+		hrw.HeaderMap.Get("Content-Type"),
+	)
 }
 
 func TestResponseWriteJSON(t *testing.T) {
@@ -386,26 +769,15 @@ func TestResponseWriteYAML(t *testing.T) {
 	assert.Equal(t, "foo: bar\n", string(hrwrb))
 }
 
-func TestResponseRender(t *testing.T) {
+func TestResponseWriteCSV(t *testing.T) {
 	a := New()
 
-	dir, err := ioutil.TempDir("", "air.TestResponseRender")
-	assert.NoError(t, err)
-	assert.NotEmpty(t, dir)
-	defer os.RemoveAll(dir)
-
-	a.RendererTemplateRoot = dir
-
-	assert.NoError(t, ioutil.WriteFile(
-		filepath.Join(a.RendererTemplateRoot, "test.html"),
-		[]byte(`<a href="/">Go Home</a>`),
-		os.ModePerm,
-	))
-
 	_, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
 
-	assert.Error(t, res.Render(nil, "foobar.html"))
-	assert.NoError(t, res.Render(nil, "test.html"))
+	assert.NoError(t, res.WriteCSV([][]string{
+		{"foo", "bar"},
+		{"foo,bar", `"foobar"`},
+	}))
 
 	hrwr := hrw.Result()
 	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
@@ -413,55 +785,1014 @@ func TestResponseRender(t *testing.T) {
 	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
 	assert.Equal(
 		t,
-		"text/html; charset=utf-8",
+		"text/csv; charset=utf-8",
 		hrw.HeaderMap.Get("Content-Type"),
 	)
-	assert.Equal(t, `<a href="/">Go Home</a>`, string(hrwrb))
+	assert.Equal(
+		t,
+		"foo,bar\n\"foo,bar\",\"\"\"foobar\"\"\"\n",
+		string(hrwrb),
+	)
 }
 
-func TestResponseRedihrwt(t *testing.T) {
+func TestResponseCSVWriter(t *testing.T) {
 	a := New()
 
 	_, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
 
-	assert.NoError(t, res.Redirect("http://example.com/foo/bar"))
+	res.SetAttachment("foo bar.csv")
+
+	cw := res.CSVWriter()
+	assert.NoError(t, cw.Write([]string{"foo", "bar"}))
+	assert.NoError(t, cw.Write([]string{"bar", "foo"}))
+	cw.Flush()
+	assert.NoError(t, cw.Error())
 
 	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
 
-	assert.Equal(t, http.StatusFound, hrwr.StatusCode)
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
 	assert.Equal(
 		t,
-		"http://example.com/foo/bar",
-		hrw.HeaderMap.Get("Location"),
+		"text/csv; charset=utf-8",
+		hrw.HeaderMap.Get("Content-Type"),
+	)
+	assert.Equal(
+		t,
+		`attachment; filename="foo bar.csv"`,
+		hrw.HeaderMap.Get("Content-Disposition"),
 	)
+	assert.Equal(t, "foo,bar\nbar,foo\n", string(hrwrb))
 }
 
-func TestResponseDefer(t *testing.T) {
+func TestResponseWriteFile(t *testing.T) {
 	a := New()
 
-	_, res, _ := fakeRRCycle(a, http.MethodGet, "/", nil)
+	f, err := ioutil.TempFile("", "air.TestResponseWriteFile.*.txt")
+	assert.NoError(t, err)
+	assert.NotNil(t, f)
+	defer os.Remove(f.Name())
 
-	res.Defer(nil)
-	assert.Len(t, res.deferredFuncs, 0)
+	_, err = f.WriteString("Foobar")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
 
-	res.Defer(func() {})
-	assert.Len(t, res.deferredFuncs, 1)
-}
+	fi, err := os.Stat(f.Name())
+	assert.NoError(t, err)
 
-func TestResponseOmittableHeader(t *testing.T) {
-	a := New()
+	_, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
 
-	_, res, _ := fakeRRCycle(a, http.MethodGet, "/", nil)
+	assert.NoError(t, res.WriteFile(f.Name()))
 
-	assert.False(t, res.omittableHeader("Foobar"))
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
 
-	res.Header.Set("Foobar", "")
-	assert.False(t, res.omittableHeader("Foobar"))
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.NotEmpty(t, hrwr.Header.Get("ETag"))
+	assert.False(t, strings.HasPrefix(hrwr.Header.Get("ETag"), "W/"))
+	assert.Equal(t, "Foobar", string(hrwrb))
 
-	res.Header.Set("Foobar", "foobar")
-	assert.False(t, res.omittableHeader("Foobar"))
+	a = New()
+	a.ETagStrategy = WeakSizeModTime
 
-	res.Header["Foobar"] = nil
+	et := fmt.Sprintf(`W/"%x-%x"`, fi.Size(), fi.ModTime().UnixNano())
+
+	_, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.NoError(t, res.WriteFile(f.Name()))
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, et, hrwr.Header.Get("ETag"))
+	assert.Equal(t, "Foobar", string(hrwrb))
+
+	req, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", et)
+
+	assert.NoError(t, res.WriteFile(f.Name()))
+
+	hrwr = hrw.Result()
+
+	assert.Equal(t, http.StatusNotModified, hrwr.StatusCode)
+
+	req, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Set("If-Match", et)
+
+	assert.NoError(t, res.WriteFile(f.Name()))
+
+	hrwr = hrw.Result()
+
+	assert.Equal(t, http.StatusPreconditionFailed, hrwr.StatusCode)
+
+	a = New()
+	a.ETagHashMaxFileSize = 6
+
+	_, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.NoError(t, res.WriteFile(f.Name()))
+
+	hrwr = hrw.Result()
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.NotEqual(t, et, hrwr.Header.Get("ETag"))
+	assert.False(t, strings.HasPrefix(hrwr.Header.Get("ETag"), "W/"))
+
+	a.ETagHashMaxFileSize = 5
+
+	_, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.NoError(t, res.WriteFile(f.Name()))
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, et, hrwr.Header.Get("ETag"))
+	assert.Equal(t, "Foobar", string(hrwrb))
+}
+
+func TestResponseRender(t *testing.T) {
+	a := New()
+
+	dir, err := ioutil.TempDir("", "air.TestResponseRender")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, dir)
+	defer os.RemoveAll(dir)
+
+	a.RendererTemplateRoot = dir
+
+	assert.NoError(t, ioutil.WriteFile(
+		filepath.Join(a.RendererTemplateRoot, "test.html"),
+		[]byte(`<a href="/">Go Home</a>`),
+		os.ModePerm,
+	))
+
+	_, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.Error(t, res.Render(nil, "foobar.html"))
+	assert.NoError(t, res.Render(nil, "test.html"))
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(
+		t,
+		"text/html; charset=utf-8",
+		hrw.HeaderMap.Get("Content-Type"),
+	)
+	assert.Equal(t, `<a href="/">Go Home</a>`, string(hrwrb))
+}
+
+func TestResponseRenderCached(t *testing.T) {
+	a := New()
+
+	dir, err := ioutil.TempDir("", "air.TestResponseRenderCached")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, dir)
+	defer os.RemoveAll(dir)
+
+	a.RendererTemplateRoot = dir
+
+	assert.NoError(t, ioutil.WriteFile(
+		filepath.Join(a.RendererTemplateRoot, "test.html"),
+		[]byte(`<a href="/">{{.Foo}}</a>`),
+		os.ModePerm,
+	))
+
+	_, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.Error(t, res.RenderCached(nil, "foobar.html"))
+	assert.False(t, res.Written)
+	assert.NoError(t, res.RenderCached(map[string]interface{}{
+		"Foo": "Go Home",
+	}, "test.html"))
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	et := hrwr.Header.Get("ETag")
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(
+		t,
+		"text/html; charset=utf-8",
+		hrwr.Header.Get("Content-Type"),
+	)
+	assert.NotEmpty(t, et)
+	assert.Equal(t, `<a href="/">Go Home</a>`, string(hrwrb))
+
+	req, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", et)
+
+	assert.NoError(t, res.RenderCached(map[string]interface{}{
+		"Foo": "Go Home",
+	}, "test.html"))
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusNotModified, hrwr.StatusCode)
+	assert.Equal(t, et, hrwr.Header.Get("ETag"))
+	assert.Empty(t, hrwrb)
+
+	req, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", et)
+
+	assert.NoError(t, res.RenderCached(map[string]interface{}{
+		"Foo": "Go Back",
+	}, "test.html"))
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.NotEqual(t, et, hrwr.Header.Get("ETag"))
+	assert.Equal(t, `<a href="/">Go Back</a>`, string(hrwrb))
+}
+
+func TestResponseRenderStream(t *testing.T) {
+	a := New()
+
+	dir, err := ioutil.TempDir("", "air.TestResponseRenderStream")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, dir)
+	defer os.RemoveAll(dir)
+
+	a.RendererTemplateRoot = dir
+
+	assert.NoError(t, ioutil.WriteFile(
+		filepath.Join(a.RendererTemplateRoot, "content.html"),
+		[]byte(`<p>{{.Foo}}</p>`),
+		os.ModePerm,
+	))
+	assert.NoError(t, ioutil.WriteFile(
+		filepath.Join(a.RendererTemplateRoot, "layout.html"),
+		[]byte(`<body>{{.InheritedHTML}}</body>`),
+		os.ModePerm,
+	))
+	assert.NoError(t, ioutil.WriteFile(
+		filepath.Join(a.RendererTemplateRoot, "broken.html"),
+		[]byte(`<p>Foo</p>{{index .Bar 1}}`),
+		os.ModePerm,
+	))
+
+	_, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.Error(t, res.RenderStream(nil, "foobar.html"))
+	assert.False(t, res.Written)
+	assert.NoError(t, res.RenderStream(map[string]interface{}{
+		"Foo": "bar",
+	}, "content.html", "layout.html"))
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(
+		t,
+		"text/html; charset=utf-8",
+		hrw.HeaderMap.Get("Content-Type"),
+	)
+	assert.Equal(t, "<body><p>bar</p></body>", string(hrwrb))
+
+	_, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.NoError(t, res.RenderStream(nil))
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Empty(t, hrwrb)
+
+	_, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.Error(t, res.RenderStream(map[string]interface{}{
+		"Bar": []int{},
+	}, "broken.html"))
+	assert.True(t, res.Written)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, "<p>Foo</p>", string(hrwrb))
+}
+
+func TestResponseRedihrwt(t *testing.T) {
+	a := New()
+
+	_, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.NoError(t, res.Redirect("http://example.com/foo/bar"))
+
+	hrwr := hrw.Result()
+
+	assert.Equal(t, http.StatusFound, hrwr.StatusCode)
+	assert.Equal(
+		t,
+		"http://example.com/foo/bar",
+		hrw.HeaderMap.Get("Location"),
+	)
+}
+
+func TestResponseStreamEvents(t *testing.T) {
+	a := New()
+
+	req, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Set("Last-Event-ID", "5")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan *Event)
+	go func() {
+		events <- &Event{Data: "foo"}
+		events <- nil
+		events <- &Event{ID: "10", Type: "bar", Data: "bar"}
+		events <- &Event{Data: "foo\nbar"}
+		cancel()
+	}()
+
+	assert.NoError(t, res.StreamEvents(ctx, events))
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "text/event-stream", hrwr.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", hrwr.Header.Get("Cache-Control"))
+	assert.True(t, hrw.Flushed)
+	assert.Equal(
+		t,
+		"id: 6\ndata: foo\n\n"+
+			"id: 10\nevent: bar\ndata: bar\n\n"+
+			"id: 11\ndata: foo\ndata: bar\n\n",
+		string(hrwrb),
+	)
+
+	a = New()
+	a.EventStreamKeepAliveInterval = 10 * time.Millisecond
+
+	_, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	e := &Event{Data: "foobar"}
+	events = make(chan *Event, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		events <- e
+		close(events)
+	}()
+
+	assert.NoError(t, res.StreamEvents(context.Background(), events))
+	assert.Empty(t, e.ID)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.True(t, strings.HasPrefix(string(hrwrb), ":\n\n"))
+	assert.True(t, strings.HasSuffix(
+		string(hrwrb),
+		"id: 1\ndata: foobar\n\n",
+	))
+
+	a = New()
+
+	req, res, _ = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	reqCtx, reqCancel := context.WithCancel(context.Background())
+	req.Context = reqCtx
+	reqCancel()
+
+	assert.NoError(t, res.StreamEvents(context.Background(), nil))
+}
+
+func TestResponseWriteEvent(t *testing.T) {
+	a := New()
+
+	req, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.NoError(t, res.WriteEvent(&Event{ID: "1", Data: "foo"}))
+	assert.NoError(t, res.WriteEvent(nil))
+	assert.NoError(t, res.WriteEvent(&Event{Type: "bar", Data: "foo\nbar"}))
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "text/event-stream", hrwr.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", hrwr.Header.Get("Cache-Control"))
+	assert.True(t, hrw.Flushed)
+	assert.Equal(
+		t,
+		"id: 1\ndata: foo\n\n"+
+			"event: bar\ndata: foo\ndata: bar\n\n",
+		string(hrwrb),
+	)
+
+	reqCtx, reqCancel := context.WithCancel(context.Background())
+	req.Context = reqCtx
+	reqCancel()
+
+	assert.Equal(t, context.Canceled, res.WriteEvent(&Event{Data: "foo"}))
+
+	a = New()
+	a.GzipEnabled = true
+	a.GzipMIMETypes = append(a.GzipMIMETypes, "text/event-stream")
+	a.GzipMinContentLength = 0
+
+	req, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	assert.NoError(t, res.WriteEvent(&Event{Data: "foobar"}))
+	assert.True(t, res.Gzipped)
+
+	gr, err := gzip.NewReader(bytes.NewReader(hrw.Body.Bytes()))
+	assert.NoError(t, err)
+
+	b := make([]byte, 64)
+	n, _ := io.ReadAtLeast(gr, b, len("data: foobar\n\n"))
+	assert.Equal(t, "data: foobar\n\n", string(b[:n]))
+}
+
+func TestResponseWriteEarlyHints(t *testing.T) {
+	a := New()
+	a.Address = "localhost:0"
+
+	a.GET("/", func(req *Request, res *Response) error {
+		if err := res.WriteEarlyHints(nil); err != nil {
+			return err
+		}
+
+		if err := res.WriteEarlyHints([]string{
+			"</style.css>; rel=preload; as=style",
+			"</script.js>; rel=preload; as=script",
+		}); err != nil {
+			return err
+		}
+
+		assert.False(t, res.Written)
+
+		return res.WriteString("Foobar")
+	})
+
+	hijackOSStdout()
+
+	go a.Serve()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	c, err := net.Dial("tcp", a.Addresses()[0])
+	assert.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	assert.NoError(t, err)
+
+	br := bufio.NewReader(c)
+
+	hr, _ := http.NewRequest(http.MethodGet, "/", nil)
+	if interimResponsesSupported {
+		hcr, err := http.ReadResponse(br, hr)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusEarlyHints, hcr.StatusCode)
+		assert.Equal(t, []string{
+			"</style.css>; rel=preload; as=style",
+			"</script.js>; rel=preload; as=script",
+		}, hcr.Header["Link"])
+	}
+
+	hcr, err := http.ReadResponse(br, hr)
+	assert.NoError(t, err)
+
+	hcrb, _ := ioutil.ReadAll(hcr.Body)
+
+	assert.Equal(t, http.StatusOK, hcr.StatusCode)
+	assert.Len(t, hcr.Header["Link"], 2)
+	assert.Equal(t, "Foobar", string(hcrb))
+
+	assert.NoError(t, a.Close())
+
+	a = New()
+
+	_, res, _ := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.NoError(t, res.WriteString("Foobar"))
+	assert.Error(t, res.WriteEarlyHints([]string{"</style.css>"}))
+}
+
+func TestResponseDefer(t *testing.T) {
+	a := New()
+
+	_, res, _ := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	res.Defer(nil)
+	assert.Len(t, res.deferredFuncs, 0)
+
+	res.Defer(func() {})
+	assert.Len(t, res.deferredFuncs, 1)
+}
+
+func TestResponseTee(t *testing.T) {
+	a := New()
+	a.GzipEnabled = true
+
+	tee := bytes.Buffer{}
+	compressedTee := bytes.Buffer{}
+	contentLength := int64(0)
+	a.GET("/", func(req *Request, res *Response) error {
+		return res.WriteString(strings.Repeat("foobar", 1000))
+	}, func(next Handler) Handler {
+		return func(req *Request, res *Response) error {
+			res.Tee(nil, false)
+			res.Tee(&tee, false)
+			res.Tee(&compressedTee, true)
+			res.Defer(func() {
+				contentLength = res.ContentLength
+			})
+
+			return next(req, res)
+		}
+	})
+
+	hr := httptest.NewRequest(http.MethodGet, "/", nil)
+	hr.Header.Set("Accept-Encoding", "gzip")
+	hrw := httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "gzip", hrwr.Header.Get("Content-Encoding"))
+	assert.Equal(t, strings.Repeat("foobar", 1000), tee.String())
+	assert.Equal(t, hrwrb, compressedTee.Bytes())
+	assert.Equal(t, int64(len(hrwrb)), contentLength)
+
+	tee.Reset()
+	compressedTee.Reset()
+
+	hr = httptest.NewRequest(http.MethodGet, "/", nil)
+	hrw = httptest.NewRecorder()
+
+	a.ServeHTTP(hrw, hr)
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Empty(t, hrwr.Header.Get("Content-Encoding"))
+	assert.Equal(t, strings.Repeat("foobar", 1000), string(hrwrb))
+	assert.Equal(t, hrwrb, tee.Bytes())
+	assert.Equal(t, hrwrb, compressedTee.Bytes())
+	assert.Equal(t, int64(len(hrwrb)), contentLength)
+}
+
+func TestResponseBeforeWriteHeader(t *testing.T) {
+	a := New()
+
+	calls := 0
+	a.BeforeWriteHeader = func(res *Response) {
+		calls++
+		res.Header.Del("Server")
+		res.Header.Set("X-Foo", "bar")
+		if res.Status == http.StatusCreated {
+			res.Status = http.StatusAccepted
+		}
+	}
+
+	_, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+	res.Header.Set("Server", "foobar")
+	res.Status = http.StatusCreated
+
+	assert.NoError(t, res.WriteString("foo"))
+	assert.NoError(t, res.WriteString("bar"))
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusAccepted, hrwr.StatusCode)
+	assert.Equal(t, http.StatusAccepted, res.Status)
+	assert.Empty(t, hrwr.Header.Get("Server"))
+	assert.Equal(t, "bar", hrwr.Header.Get("X-Foo"))
+	assert.Equal(t, "foobar", string(hrwrb))
+
+	calls = 0
+
+	_, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	res.Flush()
+	assert.True(t, res.Written)
+	assert.NoError(t, res.WriteString("foobar"))
+
+	hrwr = hrw.Result()
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "bar", hrwr.Header.Get("X-Foo"))
+}
+
+func TestResponseCustomPools(t *testing.T) {
+	a := New()
+	a.GzipEnabled = true
+	a.GzipMinContentLength = 0
+
+	sniffs, gzips := 0, 0
+	a.ContentTypeSnifferBufferPool = &sync.Pool{
+		New: func() interface{} {
+			sniffs++
+			return make([]byte, 512)
+		},
+	}
+	a.GzipWriterPool = &sync.Pool{
+		New: func() interface{} {
+			gzips++
+			return gzip.NewWriter(nil)
+		},
+	}
+
+	req, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	assert.NoError(t, res.Write(strings.NewReader("<!DOCTYPE html>")))
+	for _, f := range res.deferredFuncs {
+		f()
+	}
+
+	hrwr := hrw.Result()
+
+	assert.Equal(t, 1, sniffs)
+	assert.Equal(t, 1, gzips)
+	assert.Equal(t, "gzip", hrwr.Header.Get("Content-Encoding"))
+
+	gr, err := gzip.NewReader(hrwr.Body)
+	assert.NoError(t, err)
+
+	b, _ := ioutil.ReadAll(gr)
+	assert.Equal(t, "<!DOCTYPE html>", string(b))
+}
+
+func TestResponseProxyPassDefaultUserAgent(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(
+		rw http.ResponseWriter,
+		r *http.Request,
+	) {
+		rw.Write([]byte(r.UserAgent()))
+	}))
+	defer s.Close()
+
+	a := New()
+
+	req, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Del("User-Agent")
+
+	assert.NoError(t, res.ProxyPass(s.URL, nil))
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Empty(t, string(hrwrb))
+
+	a = New()
+
+	req, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Del("User-Agent")
+
+	assert.NoError(t, res.ProxyPass(s.URL, &ReverseProxy{
+		DefaultUserAgent: "-",
+	}))
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "Go-http-client/1.1", string(hrwrb))
+
+	a = New()
+
+	req, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Del("User-Agent")
+
+	assert.NoError(t, res.ProxyPass(s.URL, &ReverseProxy{
+		DefaultUserAgent: "air",
+	}))
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "air", string(hrwrb))
+
+	a = New()
+
+	req, res, hrw = fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Header.Set("User-Agent", "foobar")
+
+	assert.NoError(t, res.ProxyPass(s.URL, &ReverseProxy{
+		DefaultUserAgent: "air",
+	}))
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "foobar", string(hrwrb))
+}
+
+func TestResponseProxyPassPreserveHost(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(
+		rw http.ResponseWriter,
+		r *http.Request,
+	) {
+		rw.Write([]byte(r.Host))
+	}))
+	defer s.Close()
+
+	a := New()
+
+	_, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.NoError(t, res.ProxyPass(s.URL, nil))
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, strings.TrimPrefix(s.URL, "http://"), string(hrwrb))
+
+	a = New()
+
+	req, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+	req.Authority = "foo.example.com"
+
+	assert.NoError(t, res.ProxyPass(s.URL, &ReverseProxy{
+		PreserveHost: true,
+	}))
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "foo.example.com", string(hrwrb))
+}
+
+func TestResponseProxyPassDeadline(t *testing.T) {
+	done := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(
+		rw http.ResponseWriter,
+		r *http.Request,
+	) {
+		select {
+		case <-time.After(time.Second):
+		case <-done:
+		}
+
+		rw.Write([]byte("Foobar"))
+	}))
+	defer s.Close()
+	defer close(done)
+
+	a := New()
+
+	_, res, _ := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	startTime := time.Now()
+	err := res.ProxyPass(s.URL, &ReverseProxy{
+		Deadline: 100 * time.Millisecond,
+	})
+	assert.Error(t, err)
+	assert.Less(t, int64(time.Since(startTime)), int64(time.Second))
+	assert.Equal(t, http.StatusGatewayTimeout, res.Status)
+	assert.False(t, res.Written)
+
+	a = New()
+
+	_, res, _ = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	err = res.ProxyPass(s.URL, &ReverseProxy{
+		Deadline:       100 * time.Millisecond,
+		DeadlineStatus: http.StatusServiceUnavailable,
+	})
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, res.Status)
+
+	a = New()
+
+	_, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.NoError(t, res.ProxyPass(s.URL, &ReverseProxy{
+		Deadline: 5 * time.Second,
+	}))
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "Foobar", string(hrwrb))
+}
+
+func TestResponseProxyPassTargets(t *testing.T) {
+	s1 := httptest.NewServer(http.HandlerFunc(func(
+		rw http.ResponseWriter,
+		r *http.Request,
+	) {
+		rw.Write([]byte("s1"))
+	}))
+	defer s1.Close()
+
+	s2 := httptest.NewServer(http.HandlerFunc(func(
+		rw http.ResponseWriter,
+		r *http.Request,
+	) {
+		rw.Write([]byte("s2"))
+	}))
+	defer s2.Close()
+
+	unhealthy := map[string]bool{}
+	picked := []string{}
+	rp := &ReverseProxy{
+		Targets:  []string{s1.URL, s2.URL},
+		Balancer: NewRoundRobinBalancer(),
+		TargetHealthy: func(target string) bool {
+			return !unhealthy[target]
+		},
+		ModifyRequestTarget: func(target string) (string, error) {
+			picked = append(picked, target)
+			return target, nil
+		},
+	}
+
+	a := New()
+
+	for _, want := range []string{"s1", "s2", "s1"} {
+		_, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+		assert.NoError(t, res.ProxyPass("", rp))
+
+		hrwr := hrw.Result()
+		hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+		assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+		assert.Equal(t, want, string(hrwrb))
+	}
+
+	assert.Equal(t, []string{s1.URL, s2.URL, s1.URL}, picked)
+
+	unhealthy[s2.URL] = true
+
+	for i := 0; i < 2; i++ {
+		_, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+		assert.NoError(t, res.ProxyPass("", rp))
+
+		hrwr := hrw.Result()
+		hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+		assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+		assert.Equal(t, "s1", string(hrwrb))
+	}
+
+	_, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.NoError(t, res.ProxyPass(s2.URL, rp))
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "s2", string(hrwrb))
+
+	unhealthy[s1.URL] = true
+
+	_, res, _ = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.Error(t, res.ProxyPass("", rp))
+	assert.Equal(t, http.StatusBadGateway, res.Status)
+	assert.False(t, res.Written)
+
+	_, res, _ = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.Error(t, res.ProxyPass("", &ReverseProxy{
+		Targets: []string{s1.URL},
+		ModifyRequestTarget: func(target string) (string, error) {
+			return "", errors.New("foobar")
+		},
+	}))
+}
+
+func TestResponseProxyPassRetries(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(
+		rw http.ResponseWriter,
+		r *http.Request,
+	) {
+		rw.Write([]byte("Foobar"))
+	}))
+	defer s.Close()
+
+	ds := httptest.NewServer(http.HandlerFunc(func(
+		rw http.ResponseWriter,
+		r *http.Request,
+	) {
+	}))
+	ds.Close()
+
+	picked := []string{}
+	rp := &ReverseProxy{
+		Targets:           []string{ds.URL, s.URL},
+		Balancer:          NewRoundRobinBalancer(),
+		MaxRetries:        1,
+		UnhealthyDuration: time.Hour,
+		ModifyRequestTarget: func(target string) (string, error) {
+			picked = append(picked, target)
+			return target, nil
+		},
+	}
+
+	a := New()
+	a.ErrorLogger = log.New(ioutil.Discard, "", 0)
+
+	_, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.NoError(t, res.ProxyPass("", rp))
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "Foobar", string(hrwrb))
+	assert.Equal(t, []string{ds.URL, s.URL}, picked)
+
+	picked = nil
+	for i := 0; i < 2; i++ {
+		_, res, _ = fakeRRCycle(a, http.MethodGet, "/", nil)
+		assert.NoError(t, res.ProxyPass("", rp))
+	}
+
+	assert.Equal(t, []string{s.URL, s.URL}, picked)
+
+	picked = nil
+	rp.Targets = []string{ds.URL}
+
+	_, res, _ = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.Error(t, res.ProxyPass("", rp))
+	assert.Equal(t, http.StatusBadGateway, res.Status)
+	assert.Equal(t, []string{ds.URL}, picked)
+
+	picked = nil
+	rp.Targets = []string{ds.URL, ds.URL + "/foo", ds.URL + "/bar"}
+	rp.UnhealthyDuration = 0
+
+	_, res, _ = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.Error(t, res.ProxyPass("", rp))
+	assert.Equal(t, http.StatusBadGateway, res.Status)
+	assert.Len(t, picked, 2)
+
+	picked = nil
+	rp.Targets = []string{ds.URL, s.URL}
+	rp.Balancer = NewRoundRobinBalancer()
+
+	_, res, _ = fakeRRCycle(
+		a,
+		http.MethodPost,
+		"/",
+		strings.NewReader("Foobar"),
+	)
+
+	assert.Error(t, res.ProxyPass("", rp))
+	assert.Equal(t, http.StatusBadGateway, res.Status)
+	assert.Equal(t, []string{ds.URL}, picked)
+
+	picked = nil
+
+	_, res, _ = fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.Error(t, res.ProxyPass(ds.URL, rp))
+	assert.Equal(t, http.StatusBadGateway, res.Status)
+	assert.Equal(t, []string{ds.URL}, picked)
+}
+
+func TestResponseOmittableHeader(t *testing.T) {
+	a := New()
+
+	_, res, _ := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.False(t, res.omittableHeader("Foobar"))
+
+	res.Header.Set("Foobar", "")
+	assert.False(t, res.omittableHeader("Foobar"))
+
+	res.Header.Set("Foobar", "foobar")
+	assert.False(t, res.omittableHeader("Foobar"))
+
+	res.Header["Foobar"] = nil
 	assert.True(t, res.omittableHeader("Foobar"))
 	assert.True(t, res.omittableHeader("FooBar"))
 
@@ -469,6 +1800,61 @@ func TestResponseOmittableHeader(t *testing.T) {
 	assert.False(t, res.omittableHeader("Foobar"))
 }
 
+func TestResponseSetGzipLevel(t *testing.T) {
+	a := New()
+	a.GzipEnabled = true
+
+	content := strings.Repeat("foobar", 1000)
+	a.GET("/:level", func(req *Request, res *Response) error {
+		if l, err := req.Param("level").Value().Int(); err == nil {
+			res.SetGzipLevel(l)
+		}
+
+		return res.WriteString(content)
+	})
+
+	sizes := map[string]int{}
+	for _, level := range []string{"none", "0", "9", "10", "0"} {
+		hr := httptest.NewRequest(http.MethodGet, "/"+level, nil)
+		hr.Header.Set("Accept-Encoding", "gzip")
+		hrw := httptest.NewRecorder()
+
+		a.ServeHTTP(hrw, hr)
+
+		hrwr := hrw.Result()
+		hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+		assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+		assert.Equal(t, "gzip", hrwr.Header.Get("Content-Encoding"))
+
+		gr, err := gzip.NewReader(bytes.NewReader(hrwrb))
+		assert.NoError(t, err)
+
+		b, err := ioutil.ReadAll(gr)
+		assert.NoError(t, err)
+		assert.Equal(t, content, string(b))
+
+		if s, ok := sizes[level]; ok {
+			assert.Equal(t, s, len(hrwrb))
+		}
+
+		sizes[level] = len(hrwrb)
+	}
+
+	assert.Greater(t, sizes["0"], len(content))
+	assert.Less(t, sizes["9"], sizes["0"])
+	assert.Equal(t, sizes["none"], sizes["10"])
+
+	_, res, _ := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	res.SetGzipLevel(gzip.HuffmanOnly - 1)
+	assert.False(t, res.gzipLevelSet)
+
+	res.SetGzipLevel(gzip.BestSpeed)
+	assert.True(t, res.gzipLevelSet)
+	assert.Equal(t, gzip.BestSpeed, res.gzipLevel)
+}
+
 func TestResponseGzippable(t *testing.T) {
 	a := New()
 
@@ -490,20 +1876,233 @@ func TestResponseGzippable(t *testing.T) {
 
 	req.Header.Set("Accept-Encoding", "br;q=1.0, gzip;q=0.8, *;q=0.1")
 	assert.True(t, res.gzippable())
+
+	req.Header.Set("Accept-Encoding", "gzip;q=0, identity")
+	assert.False(t, res.gzippable())
+
+	req.Header.Set("Accept-Encoding", "GZIP;Q=0.000")
+	assert.False(t, res.gzippable())
+
+	req.Header.Set("Accept-Encoding", "gzip;q=0.5, identity;q=0.8")
+	assert.False(t, res.gzippable())
+
+	req.Header.Set("Accept-Encoding", "gzip;q=0.8, identity;q=0.5")
+	assert.True(t, res.gzippable())
+
+	req.Header.Set("Accept-Encoding", "*")
+	assert.True(t, res.gzippable())
+
+	req.Header.Set("Accept-Encoding", "br, *;q=0")
+	assert.False(t, res.gzippable())
+}
+
+func TestResponseBrotliable(t *testing.T) {
+	a := New()
+
+	req, res, _ := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.False(t, res.brotliable())
+
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	assert.True(t, res.brotliable())
+
+	req.Header.Set("Accept-Encoding", "gzip, br;q=0")
+	assert.False(t, res.brotliable())
+
+	req.Header.Set("Accept-Encoding", "gzip, br;q=0.5")
+	assert.True(t, res.brotliable())
+
+	a.GzipEnabled = true
+	assert.False(t, res.brotliable())
+
+	req.Header.Set("Accept-Encoding", "br;q=0.5, identity")
+	assert.False(t, res.brotliable())
+}
+
+func TestAcceptEncodingQValues(t *testing.T) {
+	assert.Empty(t, acceptEncodingQValues(nil))
+	assert.Equal(
+		t,
+		map[string]float64{
+			"gzip":     1,
+			"br":       0.5,
+			"identity": 0,
+			"*":        0.1,
+		},
+		acceptEncodingQValues([]string{
+			"GZIP, br;q=0.5",
+			"identity;q=0, *;Q=0.1, ;q=1",
+		}),
+	)
+}
+
+func TestTrimGzipETagSuffixes(t *testing.T) {
+	ets, ok := trimGzipETagSuffixes(`"foobar"`)
+	assert.False(t, ok)
+	assert.Equal(t, `"foobar"`, ets)
+
+	ets, ok = trimGzipETagSuffixes(`"foobar-gzip"`)
+	assert.True(t, ok)
+	assert.Equal(t, `"foobar"`, ets)
+
+	ets, ok = trimGzipETagSuffixes(`W/"foo-gzip", "bar","foobar-gzip"`)
+	assert.True(t, ok)
+	assert.Equal(t, `W/"foo", "bar", "foobar"`, ets)
+}
+
+func TestTrimBrotliETagSuffixes(t *testing.T) {
+	ets, ok := trimBrotliETagSuffixes(`"foobar-gzip"`)
+	assert.False(t, ok)
+	assert.Equal(t, `"foobar-gzip"`, ets)
+
+	ets, ok = trimBrotliETagSuffixes(`W/"foo-br", "bar","foobar-br"`)
+	assert.True(t, ok)
+	assert.Equal(t, `W/"foo", "bar", "foobar"`, ets)
+}
+
+func TestNewSeekableBytes(t *testing.T) {
+	rs := NewSeekableBytes([]byte("Foobar"))
+
+	n, err := rs.Seek(3, io.SeekStart)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+
+	b, err := ioutil.ReadAll(rs)
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", string(b))
+}
+
+func TestNewReverseProxy(t *testing.T) {
+	rp, err := NewReverseProxy("foobar://example.com")
+	assert.Error(t, err)
+	assert.Nil(t, rp)
+
+	rp, err = NewReverseProxy("http://example.com")
+	assert.NoError(t, err)
+	assert.NotNil(t, rp)
+	assert.Equal(t, "http://example.com", rp.target)
+
+	rpt, ok := rp.Transport.(*reverseProxyTransport)
+	assert.True(t, ok)
+	assert.Nil(t, rpt.a)
+	assert.Equal(t, 200, rpt.maxIdleConnsPerHost)
+	assert.Zero(t, rpt.maxConnsPerHost)
+	assert.Equal(t, 90*time.Second, rpt.idleConnTimeout)
+	assert.Zero(t, rpt.responseHeaderTimeout)
+	assert.Nil(t, rpt.tlsConfig)
+
+	tlsConfig := &tls.Config{ServerName: "example.com"}
+	rp, err = NewReverseProxy(
+		"grpcs://example.com",
+		WithProxyMaxIdleConns(10),
+		WithProxyMaxConns(20),
+		WithProxyIdleConnTimeout(time.Minute),
+		WithProxyResponseHeaderTimeout(time.Second),
+		WithProxyTLSConfig(tlsConfig),
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, rp)
+
+	rpt = rp.Transport.(*reverseProxyTransport)
+	rpt.initOnce.Do(rpt.init)
+	assert.Equal(t, 10, rpt.hTransport.MaxIdleConnsPerHost)
+	assert.Equal(t, 20, rpt.hTransport.MaxConnsPerHost)
+	assert.Equal(t, time.Minute, rpt.hTransport.IdleConnTimeout)
+	assert.Equal(t, time.Second, rpt.hTransport.ResponseHeaderTimeout)
+	assert.Equal(
+		t,
+		"example.com",
+		rpt.hTransport.TLSClientConfig.ServerName,
+	)
+	assert.Equal(
+		t,
+		"example.com",
+		rpt.h2Transport.TLSClientConfig.ServerName,
+	)
+}
+
+func TestReverseProxyServe(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(
+		rw http.ResponseWriter,
+		r *http.Request,
+	) {
+		rw.Write([]byte(r.URL.Path))
+	}))
+	defer s.Close()
+
+	rp, err := NewReverseProxy(s.URL + "/foo")
+	assert.NoError(t, err)
+
+	a := New()
+
+	for _, p := range []string{"/bar", "/foobar"} {
+		req, res, hrw := fakeRRCycle(a, http.MethodGet, p, nil)
+
+		assert.NoError(t, rp.Serve(req, res))
+
+		hrwr := hrw.Result()
+		hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+		assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+		assert.Equal(t, "/foo"+p, string(hrwrb))
+	}
+
+	rpt := rp.Transport.(*reverseProxyTransport)
+	assert.NotNil(t, rpt.hTransport)
+	assert.NotSame(t, a.reverseProxyTransport, rpt)
+
+	rp = &ReverseProxy{
+		Targets: []string{s.URL},
+	}
+
+	req, res, hrw := fakeRRCycle(a, http.MethodGet, "/", nil)
+
+	assert.NoError(t, rp.Serve(req, res))
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "/", string(hrwrb))
+}
+
+func TestNewReverseProxyTransport(t *testing.T) {
+	a := New()
+	rpt := newReverseProxyTransport(a)
+	assert.NotNil(t, rpt)
+	assert.Nil(t, rpt.hTransport)
+
+	a.ReverseProxyMaxIdleConnsPerHost = 10
+	a.ReverseProxyIdleConnTimeout = time.Minute
+	a.ReverseProxyMaxConnsPerHost = 20
+
+	rpt.initOnce.Do(rpt.init)
+	assert.NotNil(t, rpt.hTransport)
+	assert.NotNil(t, rpt.h2Transport)
+	assert.NotNil(t, rpt.h2cTransport)
+	assert.Equal(t, 10, rpt.hTransport.MaxIdleConnsPerHost)
+	assert.Equal(t, time.Minute, rpt.hTransport.IdleConnTimeout)
+	assert.Equal(t, 20, rpt.hTransport.MaxConnsPerHost)
 }
 
 func TestNewReverseProxyBufferPool(t *testing.T) {
-	assert.NotNil(t, newReverseProxyBufferPool())
+	assert.NotNil(t, newReverseProxyBufferPool(New()))
 }
 
 func TestReverseProxyBufferPoolGet(t *testing.T) {
-	rpbp := newReverseProxyBufferPool()
+	rpbp := newReverseProxyBufferPool(New())
 
 	assert.Len(t, rpbp.Get(), 32<<20)
+
+	a := New()
+	a.ReverseProxyBufferSize = 1 << 10
+	rpbp = newReverseProxyBufferPool(a)
+
+	assert.Len(t, rpbp.Get(), 1<<10)
 }
 
 func TestReverseProxyBufferPoolPut(t *testing.T) {
-	rpbp := newReverseProxyBufferPool()
+	rpbp := newReverseProxyBufferPool(New())
 
 	rpbp.Put(make([]byte, 32<<20))
 }
@@ -1,7 +1,11 @@
 package air
 
 import (
+	"net/http"
+	"net/url"
 	ppath "path"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -13,6 +17,8 @@ type router struct {
 	a                    *Air
 	routeTree            *routeNode
 	registeredRoutes     map[string]bool
+	namedRoutes          map[string]*Route
+	routes               []*Route
 	maxRouteParams       int
 	routeParamValuesPool sync.Pool
 }
@@ -23,8 +29,10 @@ func newRouter(a *Air) *router {
 		a: a,
 		routeTree: &routeNode{
 			handlers: map[string]Handler{},
+			routes:   map[string]*Route{},
 		},
 		registeredRoutes: map[string]bool{},
+		namedRoutes:      map[string]*Route{},
 	}
 
 	r.routeParamValuesPool.New = func() interface{} {
@@ -37,13 +45,53 @@ func newRouter(a *Air) *router {
 // register registers a new route for the method and path with the matching h in
 // the r with the optional route-level gases.
 func (r *router) register(method, path string, h Handler, gases ...Gas) {
+	r.registerRoute(&Route{
+		Method:  method,
+		Path:    path,
+		Handler: h,
+		Gases:   gases,
+	})
+}
+
+// registerFiles registers a new GET and HEAD route pair for the path with the
+// matching h that serves files in the r with the optional route-level gases.
+func (r *router) registerFiles(path string, h Handler, gases ...Gas) {
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		r.registerRoute(&Route{
+			Method:      method,
+			Path:        path,
+			Handler:     h,
+			Gases:       gases,
+			servesFiles: true,
+		})
+	}
+}
+
+// snapshotRoutes returns a snapshot of all routes registered in the r in the
+// order of registration.
+func (r *router) snapshotRoutes() []*Route {
+	r.Lock()
+	defer r.Unlock()
+
+	routes := make([]*Route, len(r.routes))
+	copy(routes, r.routes)
+
+	return routes
+}
+
+// registerRoute registers the rt in the r.
+func (r *router) registerRoute(rt *Route) {
 	r.Lock()
 	defer r.Unlock()
 
+	method, path, h, gases := rt.Method, rt.Path, rt.Handler, rt.Gases
+	priority := rt.Priority
 	if path == "" {
 		panic("air: route path cannot be empty")
 	} else if h == nil {
 		panic("air: route handler cannot be nil")
+	} else if rt.Name != "" && r.namedRoutes[rt.Name] != nil {
+		panic("air: route name already exists")
 	}
 
 	hasTrailingSlash := path[len(path)-1] == '/'
@@ -53,6 +101,8 @@ func (r *router) register(method, path string, h Handler, gases ...Gas) {
 		path += "/"
 	}
 
+	path, paramConstraints := parseRouteParamConstraints(path)
+
 	if path[0] != '/' {
 		panic("air: route path must start with /")
 	} else if strings.Count(path, ":") > 1 {
@@ -77,6 +127,9 @@ func (r *router) register(method, path string, h Handler, gases ...Gas) {
 		}
 	}
 
+	rt.Path = path
+	rt.paramConstraints = paramConstraints
+
 	routeName := method + path
 	for i, l := len(method), len(routeName); i < l; i++ {
 		if routeName[i] == ':' {
@@ -100,6 +153,11 @@ func (r *router) register(method, path string, h Handler, gases ...Gas) {
 		r.registeredRoutes[routeName] = true
 	}
 
+	r.routes = append(r.routes, rt)
+	if rt.Name != "" {
+		r.namedRoutes[rt.Name] = rt
+	}
+
 	rh := func(req *Request, res *Response) error {
 		h := h
 		for i := len(gases) - 1; i >= 0; i-- {
@@ -118,7 +176,9 @@ func (r *router) register(method, path string, h Handler, gases ...Gas) {
 				method,
 				path[:i],
 				nil,
+				nil,
 				routeNodeTypeSTATIC,
+				priority,
 				nil,
 			)
 
@@ -142,9 +202,11 @@ func (r *router) register(method, path string, h Handler, gases ...Gas) {
 					method,
 					path,
 					rh,
+					rt,
 					routeNodeTypePARAM,
+					priority,
 					paramNames,
-				)
+				).constrainParam(paramConstraints[paramName])
 				return
 			}
 
@@ -152,15 +214,19 @@ func (r *router) register(method, path string, h Handler, gases ...Gas) {
 				method,
 				path[:i],
 				nil,
+				nil,
 				routeNodeTypePARAM,
+				priority,
 				paramNames,
-			)
+			).constrainParam(paramConstraints[paramName])
 		} else if path[i] == '*' {
 			r.insert(
 				method,
 				path[:i],
 				nil,
+				nil,
 				routeNodeTypeSTATIC,
+				priority,
 				nil,
 			)
 			paramNames = append(paramNames, "*")
@@ -168,24 +234,88 @@ func (r *router) register(method, path string, h Handler, gases ...Gas) {
 				method,
 				path[:i+1],
 				rh,
+				rt,
 				routeNodeTypeANY,
+				priority,
 				paramNames,
 			)
 			return
 		}
 	}
 
-	r.insert(method, path, rh, routeNodeTypeSTATIC, paramNames)
+	r.insert(
+		method,
+		path,
+		rh,
+		rt,
+		routeNodeTypeSTATIC,
+		priority,
+		paramNames,
+	)
+}
+
+// parseRouteParamConstraints parses the constraints of the PARAM components in
+// the path and returns the path without the constraints and a map of the param
+// names to the compiled constraints. It panics if any constraint is invalid.
+//
+// A constraint is a regular expression that follows the param name and a "|",
+// such as ":UserID|[0-9]+". It is anchored to match the whole param value, and
+// it cannot contain "/".
+func parseRouteParamConstraints(
+	path string,
+) (string, map[string]*regexp.Regexp) {
+	if !strings.Contains(path, "|") {
+		return path, nil
+	}
+
+	var constraints map[string]*regexp.Regexp
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		j := strings.IndexByte(segment, ':')
+		if j < 0 {
+			continue
+		}
+
+		k := strings.IndexByte(segment[j:], '|')
+		if k < 0 {
+			continue
+		}
+
+		k += j
+
+		pattern := segment[k+1:]
+		if pattern == "" {
+			panic("air: route param constraint cannot be empty")
+		}
+
+		c, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			panic("air: invalid route param constraint: " +
+				pattern)
+		}
+
+		if constraints == nil {
+			constraints = map[string]*regexp.Regexp{}
+		}
+
+		constraints[segment[j+1:k]] = c
+		segments[i] = segment[:k]
+	}
+
+	return strings.Join(segments, "/"), constraints
 }
 
-// insert inserts a new route into the `r.routeTree`.
+// insert inserts a new route into the `r.routeTree` and returns the node of the
+// path.
 func (r *router) insert(
 	method string,
 	path string,
 	h Handler,
+	rt *Route,
 	nt routeNodeType,
+	priority int,
 	paramNames []string,
-) {
+) *routeNode {
 	if l := len(paramNames); l > r.maxRouteParams {
 		r.maxRouteParams = l
 	}
@@ -198,6 +328,7 @@ func (r *router) insert(
 		pl int           // Prefix length
 		ll int           // LCP length
 		ml int           // Minimum length of sl and pl
+		tn *routeNode    // Target node
 	)
 
 	for {
@@ -217,10 +348,14 @@ func (r *router) insert(
 			cn.label = s[0]
 			cn.nType = nt
 			cn.prefix = s
+			cn.priority = priority
 			cn.paramNames = paramNames
 			if h != nil {
 				cn.handlers[method] = h
+				cn.routes[method] = rt
 			}
+
+			tn = cn
 		} else if ll < pl { // Split node
 			nn = &routeNode{
 				label:      cn.prefix[ll],
@@ -228,7 +363,12 @@ func (r *router) insert(
 				prefix:     cn.prefix[ll:],
 				children:   cn.children,
 				paramNames: cn.paramNames,
+				priority:   cn.priority,
 				handlers:   cn.handlers,
+				routes:     cn.routes,
+
+				paramConstraint:  cn.paramConstraint,
+				paramConstrained: cn.paramConstrained,
 			}
 
 			// Reset current node.
@@ -237,29 +377,46 @@ func (r *router) insert(
 			cn.prefix = cn.prefix[:ll]
 			cn.children = []*routeNode{nn}
 			cn.paramNames = nil
+			cn.paramConstraint = nil
+			cn.paramConstrained = false
 			cn.handlers = map[string]Handler{}
+			cn.routes = map[string]*Route{}
+			if priority > cn.priority {
+				cn.priority = priority
+			}
 
 			if ll == sl { // At current node
 				cn.nType = nt
 				cn.paramNames = paramNames
 				if h != nil {
 					cn.handlers[method] = h
+					cn.routes[method] = rt
 				}
+
+				tn = cn
 			} else { // Create child node
 				nn = &routeNode{
 					label:      s[ll],
 					nType:      nt,
 					prefix:     s[ll:],
 					paramNames: paramNames,
+					priority:   priority,
 					handlers:   map[string]Handler{},
+					routes:     map[string]*Route{},
 				}
 				if h != nil {
 					nn.handlers[method] = h
+					nn.routes[method] = rt
 				}
 
 				cn.children = append(cn.children, nn)
+				tn = nn
 			}
 		} else if ll < sl {
+			if priority > cn.priority {
+				cn.priority = priority
+			}
+
 			s = s[ll:]
 			if nn = cn.childByLabel(s[0]); nn != nil {
 				// Go deeper.
@@ -273,25 +430,38 @@ func (r *router) insert(
 				nType:      nt,
 				prefix:     s,
 				handlers:   map[string]Handler{},
+				routes:     map[string]*Route{},
 				paramNames: paramNames,
+				priority:   priority,
 			}
 			if h != nil {
 				nn.handlers[method] = h
+				nn.routes[method] = rt
 			}
 
 			cn.children = append(cn.children, nn)
+			tn = nn
 		} else { // Node already exists
 			if len(cn.paramNames) == 0 {
 				cn.paramNames = paramNames
 			}
 
+			if priority > cn.priority {
+				cn.priority = priority
+			}
+
 			if h != nil {
 				cn.handlers[method] = h
+				cn.routes[method] = rt
 			}
+
+			tn = cn
 		}
 
 		break
 	}
+
+	return tn
 }
 
 // route returns a handler registered for the req.
@@ -303,6 +473,9 @@ func (r *router) route(req *Request) Handler {
 		sn   *routeNode      // Saved node
 		snt  routeNodeType   // Saved type
 		ss   string          // Saved search
+		sspn *routeNode      // Saved STATIC parent node
+		ssps string          // Saved STATIC parent search
+		sspc int             // Saved STATIC parent param counter
 		sapn *routeNode      // Saved ANY parent node
 		saps string          // Saved ANY parent search
 		sl   int             // Search length
@@ -313,7 +486,7 @@ func (r *router) route(req *Request) Handler {
 		pc   int             // Param counter
 	)
 
-	// Search order: STATIC > PARAM > ANY.
+	// Search order: STATIC > PARAM > ANY, unless overridden by priorities.
 	for {
 		if s == "" {
 			if len(cn.handlers) == 0 {
@@ -371,6 +544,18 @@ func (r *router) route(req *Request) Handler {
 
 		// Try STATIC node.
 		if nn = cn.child(s[0], routeNodeTypeSTATIC); nn != nil {
+			switch cn.preferredChildType(nn) {
+			case routeNodeTypePARAM:
+				// Save STATIC parent node for struggling.
+				sspn = cn
+				ssps = s
+				sspc = pc
+
+				goto TryPARAM
+			case routeNodeTypeANY:
+				goto TryANY
+			}
+
 			// Save node for struggling.
 			if pl = len(cn.prefix); pl > 0 &&
 				cn.prefix[pl-1] == '/' {
@@ -387,8 +572,29 @@ func (r *router) route(req *Request) Handler {
 		// Try PARAM node.
 	TryPARAM:
 		if nn = cn.childByType(routeNodeTypePARAM); nn != nil {
-			// Save node for struggling.
-			if pl = len(cn.prefix); pl > 0 &&
+			if cn.preferredChildType(nn) == routeNodeTypeANY {
+				goto TryANY
+			}
+
+			for i, sl = 0, len(s); i < sl && s[i] != '/'; i++ {
+			}
+
+			if !nn.matchParam(s[:i]) {
+				if cn == sspn {
+					// Fall back to STATIC node.
+					cn = cn.child(ssps[0], routeNodeTypeSTATIC)
+					sspn = nil
+					s = ssps
+					pc = sspc
+					continue
+				}
+
+				goto TryANY
+			}
+
+			// Save node for struggling, unless the STATIC node
+			// should be tried first.
+			if pl = len(cn.prefix); cn != sspn && pl > 0 &&
 				cn.prefix[pl-1] == '/' {
 				sn = cn
 				snt = routeNodeTypeANY
@@ -397,9 +603,6 @@ func (r *router) route(req *Request) Handler {
 
 			cn = nn
 
-			for i, sl = 0, len(s); i < sl && s[i] != '/'; i++ {
-			}
-
 			if req.routeParamValues == nil {
 				req.routeParamValues = r.allocRouteParamValues()
 			}
@@ -440,6 +643,12 @@ func (r *router) route(req *Request) Handler {
 			case routeNodeTypeANY:
 				goto TryANY
 			}
+		} else if sspn != nil {
+			cn = sspn.child(ssps[0], routeNodeTypeSTATIC)
+			sspn = nil
+			s = ssps
+			pc = sspc
+			continue
 		} else if sapn != nil {
 			cn = sapn
 			sapn = nil
@@ -450,9 +659,18 @@ func (r *router) route(req *Request) Handler {
 		return r.a.NotFoundHandler
 	}
 
+	req.routeHandlers = cn.handlers
+
 	h := cn.handlers[req.Method]
 	if h != nil {
 		req.routeParamNames = cn.paramNames
+		req.route = cn.routes[req.Method]
+	} else if len(cn.handlers) > 0 &&
+		r.a.AutoOptionsForCORS &&
+		req.Method == http.MethodOptions &&
+		req.Header.Get("Access-Control-Request-Method") != "" {
+		req.routeParamNames = cn.paramNames
+		h = cn.autoOptionsHandler
 	} else if len(cn.handlers) > 0 {
 		h = r.a.MethodNotAllowedHandler
 	} else {
@@ -463,14 +681,16 @@ func (r *router) route(req *Request) Handler {
 }
 
 // allocRouteParamValues reuses or creates a string slice for storing route
-// param values.
+// param values. The returned slice always has a length of the
+// `maxRouteParams`, even if the `maxRouteParams` has grown since the pooled
+// slices were created.
 func (r *router) allocRouteParamValues() []string {
-	rpvs := r.routeParamValuesPool.Get().([]string)
-	if len(rpvs) < r.maxRouteParams {
-		rpvs = r.routeParamValuesPool.New().([]string)
+	rpvs, ok := r.routeParamValuesPool.Get().([]string)
+	if !ok || cap(rpvs) < r.maxRouteParams {
+		return make([]string, r.maxRouteParams)
 	}
 
-	return rpvs
+	return rpvs[:r.maxRouteParams]
 }
 
 // routeNode is the node of the route radix tree.
@@ -480,7 +700,68 @@ type routeNode struct {
 	prefix     string
 	children   []*routeNode
 	paramNames []string
+	priority   int
 	handlers   map[string]Handler
+	routes     map[string]*Route
+
+	paramConstraint  *regexp.Regexp
+	paramConstrained bool
+}
+
+// constrainParam sets the constraint of the rn, which is a PARAM node, to the
+// c (nil means no constraint). It panics if the rn already has a different
+// constraint, since the routes sharing a PARAM node must agree on it.
+func (rn *routeNode) constrainParam(c *regexp.Regexp) {
+	if !rn.paramConstrained {
+		rn.paramConstraint = c
+		rn.paramConstrained = true
+		return
+	}
+
+	var cs, rncs string
+	if c != nil {
+		cs = c.String()
+	}
+
+	if rn.paramConstraint != nil {
+		rncs = rn.paramConstraint.String()
+	}
+
+	if cs != rncs {
+		panic("air: route param constraint conflicts with " +
+			"existing routes")
+	}
+}
+
+// matchParam reports whether the value, which is a raw path segment, matches
+// the constraint (if any) of the rn.
+func (rn *routeNode) matchParam(value string) bool {
+	if rn.paramConstraint == nil {
+		return true
+	}
+
+	if uv, err := url.PathUnescape(value); err == nil {
+		value = uv
+	}
+
+	return rn.paramConstraint.MatchString(value)
+}
+
+// autoOptionsHandler is the `Handler` that answers the CORS preflight requests
+// for the rn.
+func (rn *routeNode) autoOptionsHandler(req *Request, res *Response) error {
+	methods := make([]string, 0, len(rn.handlers)+1)
+	for m := range rn.handlers {
+		methods = append(methods, m)
+	}
+
+	methods = append(methods, http.MethodOptions)
+	sort.Strings(methods)
+
+	res.Header.Set("Allow", strings.Join(methods, ", "))
+	res.Status = http.StatusNoContent
+
+	return res.Write(nil)
 }
 
 // child returns a child node of the rn by the l and t.
@@ -516,6 +797,29 @@ func (rn *routeNode) childByType(t routeNodeType) *routeNode {
 	return nil
 }
 
+// preferredChildType returns the type of the child of the rn that should be
+// tried first when the dn, which is a child of the rn, would be tried first by
+// default. A child of a later type in the default order is preferred only if
+// it has a strictly higher priority.
+func (rn *routeNode) preferredChildType(dn *routeNode) routeNodeType {
+	nt, p := dn.nType, dn.priority
+	if nt == routeNodeTypeSTATIC {
+		if c := rn.childByType(routeNodeTypePARAM); c != nil &&
+			c.priority > p {
+			nt, p = c.nType, c.priority
+		}
+	}
+
+	if nt != routeNodeTypeANY {
+		if c := rn.childByType(routeNodeTypeANY); c != nil &&
+			c.priority > p {
+			nt = c.nType
+		}
+	}
+
+	return nt
+}
+
 // routeNodeType is the type of the `routeNode`.
 type routeNodeType uint8
 
@@ -1,6 +1,7 @@
 package air
 
 import (
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"testing"
@@ -16,7 +17,10 @@ func TestNewRouter(t *testing.T) {
 	assert.NotNil(t, r.a)
 	assert.NotNil(t, r.routeTree)
 	assert.NotNil(t, r.routeTree.handlers)
+	assert.NotNil(t, r.routeTree.routes)
 	assert.NotNil(t, r.registeredRoutes)
+	assert.NotNil(t, r.namedRoutes)
+	assert.Nil(t, r.routes)
 }
 
 func TestRouterRegister(t *testing.T) {
@@ -108,6 +112,27 @@ func TestRouterRegister(t *testing.T) {
 		},
 	)
 
+	// Duplicate route names.
+
+	r.registerRoute(&Route{
+		Method:  m,
+		Path:    "/foo",
+		Handler: h,
+		Name:    "foo",
+	})
+	assert.PanicsWithValue(
+		t,
+		"air: route name already exists",
+		func() {
+			r.registerRoute(&Route{
+				Method:  m,
+				Path:    "/bar",
+				Handler: h,
+				Name:    "foo",
+			})
+		},
+	)
+
 	// Nothing wrong.
 
 	r.register(m, "/:foobar", h)
@@ -914,6 +939,266 @@ func TestRouterRouteFallBackToANY(t *testing.T) {
 	assert.Equal(t, "Matched [GET /*]", string(hrwrb))
 }
 
+func TestRouterRouteParamConstraint(t *testing.T) {
+	a := New()
+	r := a.router
+
+	r.register(
+		http.MethodGet,
+		"/users/:UserID|[0-9]+",
+		func(_ *Request, res *Response) error {
+			return res.WriteString("Matched [GET /users/:UserID]")
+		},
+	)
+
+	r.register(
+		http.MethodGet,
+		"/*",
+		func(_ *Request, res *Response) error {
+			return res.WriteString("Matched [GET /*]")
+		},
+	)
+
+	assert.Equal(t, "/users/:UserID", r.routes[0].Path)
+
+	req, res, hrw := fakeRRCycle(a, http.MethodGet, "/users/123", nil)
+
+	assert.NoError(t, r.route(req)(req, res))
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, "123", req.Param("UserID").Value().String())
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "Matched [GET /users/:UserID]", string(hrwrb))
+
+	req, res, hrw = fakeRRCycle(a, http.MethodGet, "/users/foo123", nil)
+
+	assert.NoError(t, r.route(req)(req, res))
+
+	hrwr = hrw.Result()
+	hrwrb, _ = ioutil.ReadAll(hrwr.Body)
+
+	assert.Nil(t, req.Param("UserID"))
+	assert.Equal(t, "users/foo123", req.Param("*").Value().String())
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "Matched [GET /*]", string(hrwrb))
+
+	a = New()
+	r = a.router
+
+	r.register(
+		http.MethodGet,
+		"/users/:UserID|[0-9]+",
+		func(_ *Request, res *Response) error {
+			return res.WriteString("Matched [GET /users/:UserID]")
+		},
+	)
+
+	req, res, _ = fakeRRCycle(a, http.MethodGet, "/users/foo", nil)
+
+	assert.Error(t, r.route(req)(req, res))
+	assert.Equal(t, http.StatusNotFound, res.Status)
+
+	assert.PanicsWithValue(
+		t,
+		"air: route param constraint cannot be empty",
+		func() {
+			r.register(
+				http.MethodGet,
+				"/posts/:PostID|",
+				func(_ *Request, res *Response) error {
+					return nil
+				},
+			)
+		},
+	)
+
+	assert.PanicsWithValue(
+		t,
+		"air: invalid route param constraint: [0-9",
+		func() {
+			r.register(
+				http.MethodGet,
+				"/posts/:PostID|[0-9",
+				func(_ *Request, res *Response) error {
+					return nil
+				},
+			)
+		},
+	)
+
+	assert.PanicsWithValue(
+		t,
+		"air: route param constraint conflicts with existing routes",
+		func() {
+			r.register(
+				http.MethodPost,
+				"/users/:UserID|[a-z]+",
+				func(_ *Request, res *Response) error {
+					return nil
+				},
+			)
+		},
+	)
+}
+
+func TestRouterRoutePriority(t *testing.T) {
+	a := New()
+	r := a.router
+
+	routes := []Route{}
+	for _, c := range []struct {
+		path     string
+		priority int
+	}{
+		{"/users/new", 0},
+		{"/users/new/edit", 0},
+		{"/users/:id", 1},
+		{"/posts/latest", -1},
+		{"/posts/:id", 0},
+		{"/files/readme", 0},
+		{"/files/*", 1},
+	} {
+		body := "Matched [GET " + c.path + "]"
+		routes = append(routes, Route{
+			Method: http.MethodGet,
+			Path:   c.path,
+			Handler: func(_ *Request, res *Response) error {
+				return res.WriteString(body)
+			},
+			Priority: c.priority,
+		})
+	}
+
+	a.RegisterRoutes(routes)
+
+	for _, rt := range r.snapshotRoutes() {
+		if rt.Path == "/users/:id" || rt.Path == "/files/*" {
+			assert.Equal(t, 1, rt.Priority)
+		}
+	}
+
+	for _, c := range []struct {
+		target string
+		body   string
+		pn     string
+		pv     string
+	}{
+		{"/users/new", "Matched [GET /users/:id]", "id", "new"},
+		{"/users/foo", "Matched [GET /users/:id]", "id", "foo"},
+		{"/users/new/edit", "Matched [GET /users/new/edit]", "", ""},
+		{"/posts/latest", "Matched [GET /posts/:id]", "id", "latest"},
+		{"/files/readme", "Matched [GET /files/*]", "*", "readme"},
+	} {
+		req, res, hrw := fakeRRCycle(a, http.MethodGet, c.target, nil)
+
+		assert.NoError(t, r.route(req)(req, res))
+
+		hrwr := hrw.Result()
+		hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+		assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+		assert.Equal(t, c.body, string(hrwrb))
+		if c.pn != "" {
+			assert.Equal(t, c.pv, req.Param(c.pn).Value().String())
+		}
+	}
+
+	a = New()
+	r = a.router
+
+	a.RegisterRoutes([]Route{
+		{
+			Method: http.MethodGet,
+			Path:   "/foo/bar",
+			Handler: func(_ *Request, res *Response) error {
+				return res.WriteString("Matched [GET /foo/bar]")
+			},
+		},
+		{
+			Method: http.MethodGet,
+			Path:   "/foo/:bar",
+			Handler: func(_ *Request, res *Response) error {
+				return res.WriteString("Matched [GET /foo/:bar]")
+			},
+			Priority: 1,
+		},
+	})
+
+	req, res, hrw := fakeRRCycle(a, http.MethodGet, "/foo/bar", nil)
+
+	assert.NoError(t, r.route(req)(req, res))
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, "Matched [GET /foo/:bar]", string(hrwrb))
+}
+
+func TestRouterRouteAutoOptionsForCORS(t *testing.T) {
+	a := New()
+	r := a.router
+
+	h := func(req *Request, res *Response) error {
+		return nil
+	}
+
+	r.register(http.MethodGet, "/foo/:bar", h)
+	r.register(http.MethodPost, "/foo/:bar", h)
+
+	req, res, _ := fakeRRCycle(a, http.MethodOptions, "/foo/bar", nil)
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+
+	err := r.route(req)(req, res)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, res.Status)
+
+	a.AutoOptionsForCORS = true
+
+	req, res, hrw := fakeRRCycle(a, http.MethodOptions, "/foo/bar", nil)
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+
+	assert.NoError(t, r.route(req)(req, res))
+
+	hrwr := hrw.Result()
+
+	assert.Equal(t, http.StatusNoContent, hrwr.StatusCode)
+	assert.Equal(t, "GET, OPTIONS, POST", hrwr.Header.Get("Allow"))
+	assert.Equal(t, "bar", req.Param("bar").Value().String())
+
+	req, res, _ = fakeRRCycle(a, http.MethodOptions, "/foo/bar", nil)
+
+	err = r.route(req)(req, res)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, res.Status)
+
+	req, res, _ = fakeRRCycle(a, http.MethodOptions, "/bar", nil)
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+
+	err = r.route(req)(req, res)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, res.Status)
+
+	r.register(http.MethodOptions, "/foo/:bar", func(
+		req *Request,
+		res *Response,
+	) error {
+		return res.WriteString("Matched [OPTIONS /foo/:bar]")
+	})
+
+	req, res, hrw = fakeRRCycle(a, http.MethodOptions, "/foo/bar", nil)
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+
+	assert.NoError(t, r.route(req)(req, res))
+
+	hrwr = hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, http.StatusOK, hrwr.StatusCode)
+	assert.Equal(t, "Matched [OPTIONS /foo/:bar]", string(hrwrb))
+}
+
 func TestRouterAllocRouteParamValues(t *testing.T) {
 	a := New()
 	r := a.router
@@ -934,6 +1219,49 @@ func TestRouterAllocRouteParamValues(t *testing.T) {
 	rpvs = r.allocRouteParamValues()
 	assert.Len(t, rpvs, 2)
 	assert.Equal(t, 2, cap(rpvs))
+
+	r.routeParamValuesPool.Put(make([]string, 1, 4))
+
+	rpvs = r.allocRouteParamValues()
+	assert.Len(t, rpvs, 2)
+
+	r.routeParamValuesPool.Put("foobar")
+
+	rpvs = r.allocRouteParamValues()
+	assert.Len(t, rpvs, 2)
+
+	a = New()
+	r = a.router
+
+	a.GET("/:a", func(req *Request, res *Response) error {
+		return res.WriteString(req.Param("a").Value().String())
+	})
+
+	for i := 0; i < 8; i++ {
+		r.routeParamValuesPool.Put(r.allocRouteParamValues())
+	}
+
+	a.GET("/:a/:b/:c", func(req *Request, res *Response) error {
+		return res.WriteString(fmt.Sprint(
+			req.Param("a").Value().String(),
+			req.Param("b").Value().String(),
+			req.Param("c").Value().String(),
+		))
+	})
+
+	for i := 0; i < 8; i++ {
+		rpvs = r.allocRouteParamValues()
+		assert.Len(t, rpvs, 3)
+	}
+
+	req, res, hrw := fakeRRCycle(a, http.MethodGet, "/foo/bar/baz", nil)
+
+	assert.NoError(t, r.route(req)(req, res))
+
+	hrwr := hrw.Result()
+	hrwrb, _ := ioutil.ReadAll(hrwr.Body)
+
+	assert.Equal(t, "foobarbaz", string(hrwrb))
 }
 
 func TestRouteNodeChild(t *testing.T) {
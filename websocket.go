@@ -1,13 +1,24 @@
 package air
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"io/ioutil"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// ErrWebSocketMessageTooLarge is returned by the `WebSocket.ReadJSON` when the
+// incoming message exceeds the limit set by the `WebSocket.SetMaxMessageBytes`.
+var ErrWebSocketMessageTooLarge = errors.New(
+	"air: websocket message too large",
+)
+
 // WebSocket is a WebSocket peer.
 //
 // It is highly recommended not to modify any handlers of the `WebSocket` after
@@ -35,10 +46,22 @@ type WebSocket struct {
 	ErrorHandler func(err error)
 
 	// Closed indicates whether the connection has been closed.
+	//
+	// The `Closed` may be set by other goroutines (such as the one started
+	// by the `StartKeepAlive`), so it should only be read after the
+	// `Listen` has returned.
 	Closed bool
 
-	conn     *websocket.Conn
-	listened bool
+	a             *Air
+	conn          *websocket.Conn
+	listened      bool
+	closeOnce     sync.Once
+	closed        chan struct{}
+	closedMutex   sync.Mutex
+	untrackOnce   sync.Once
+	untracked     chan struct{}
+	pongs         chan struct{}
+	keepAliveOnce sync.Once
 }
 
 // NetConn returns the underlying `net.Conn` of the ws.
@@ -73,20 +96,57 @@ func (ws *WebSocket) SetWriteDeadline(t time.Time) error {
 // Listen listens for the messages sent from the remote peer of the ws. After
 // one call to it, subsequent calls have no effect.
 func (ws *WebSocket) Listen() {
+	ws.ListenContext(context.Background())
+}
+
+// ListenContext is just like the `Listen`, except that it returns when the ctx
+// is done. In that case, a connection close message with the "Going Away"
+// status is sent to the remote peer of the ws and then the ws is closed.
+//
+// The `ListenContext` shares the same state with the `Listen`, so after one
+// call to either of them, subsequent calls to both have no effect.
+func (ws *WebSocket) ListenContext(ctx context.Context) {
 	if ws.listened {
 		return
 	}
 
 	ws.listened = true
 
+	if ctx.Done() != nil {
+		listenDone := make(chan struct{})
+		defer close(listenDone)
+
+		go func() {
+			select {
+			case <-ctx.Done():
+			case <-listenDone:
+				return
+			}
+
+			ws.conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(
+					websocket.CloseGoingAway,
+					"",
+				),
+				time.Now().Add(time.Second),
+			)
+
+			// Unblock the pending read.
+			ws.conn.SetReadDeadline(time.Now())
+		}()
+	}
+
 	for {
-		if ws.Closed {
-			break
+		select {
+		case <-ws.closed:
+			return
+		default:
 		}
 
 		mt, r, err := ws.conn.NextReader()
 		if err != nil {
-			if !websocket.IsCloseError(
+			if ctx.Err() == nil && !websocket.IsCloseError(
 				err,
 				websocket.CloseNormalClosure,
 			) && ws.ErrorHandler != nil {
@@ -125,6 +185,49 @@ func (ws *WebSocket) Listen() {
 	}
 }
 
+// ReadJSON reads the next text or binary message from the remote peer of the ws
+// and decodes it as JSON into the v. It returns the
+// `ErrWebSocketMessageTooLarge` if the message exceeds the limit set by the
+// `SetMaxMessageBytes`, in which case the ws has sent a close message to the
+// remote peer and should be closed.
+//
+// The `ReadJSON` must not be used together with the `Listen`, since they both
+// read the messages from the remote peer.
+func (ws *WebSocket) ReadJSON(v interface{}) error {
+	_, r, err := ws.conn.NextReader()
+	if err != nil {
+		if errors.Is(err, websocket.ErrReadLimit) {
+			return ErrWebSocketMessageTooLarge
+		}
+
+		return err
+	}
+
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		if errors.Is(err, websocket.ErrReadLimit) {
+			return ErrWebSocketMessageTooLarge
+		} else if err == io.EOF {
+			// An empty message is not a valid JSON.
+			return io.ErrUnexpectedEOF
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// WriteJSON writes the v encoded as JSON as a text message to the remote peer
+// of the ws.
+func (ws *WebSocket) WriteJSON(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return ws.conn.WriteMessage(websocket.TextMessage, b)
+}
+
 // WriteText writes the text as a text message to the remote peer of the ws.
 func (ws *WebSocket) WriteText(text string) error {
 	return ws.conn.WriteMessage(websocket.TextMessage, []byte(text))
@@ -156,8 +259,119 @@ func (ws *WebSocket) WritePong(appData string) error {
 	return ws.conn.WriteMessage(websocket.PongMessage, []byte(appData))
 }
 
+// StartKeepAlive starts a goroutine that writes a ping message to the remote
+// peer of the ws every interval to keep the connection alive. If no pong
+// message has been received within the interval after a ping message, a
+// connection close message with the "Going Away" status and the "keep-alive
+// timeout" reason is sent to the remote peer and then the ws is closed.
+//
+// The pong messages are only received while the ws is reading the messages
+// (see the `Listen` and the `ReadJSON`), and the `PongHandler` still handles
+// each of them. The goroutine stops once the ws is closed (including when the
+// `Listen` returns). After one call to the `StartKeepAlive`, subsequent calls
+// have no effect. It does nothing if the interval is not positive or the
+// `Air.TestMode` is true.
+func (ws *WebSocket) StartKeepAlive(interval time.Duration) {
+	if interval <= 0 || (ws.a != nil && ws.a.TestMode) {
+		return
+	}
+
+	ws.keepAliveOnce.Do(func() {
+		go ws.keepAlive(interval)
+	})
+}
+
+// keepAlive writes a ping message to the remote peer of the ws every interval
+// until the ws is closed. See the `StartKeepAlive`.
+func (ws *WebSocket) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	pinged := false
+	for {
+		select {
+		case <-ws.closed:
+			return
+		case <-ticker.C:
+		}
+
+		if pinged {
+			select {
+			case <-ws.pongs:
+			default:
+				ws.conn.WriteControl(
+					websocket.CloseMessage,
+					websocket.FormatCloseMessage(
+						websocket.CloseGoingAway,
+						"keep-alive timeout",
+					),
+					time.Now().Add(time.Second),
+				)
+				ws.Close()
+
+				return
+			}
+		}
+
+		if err := ws.conn.WriteControl(
+			websocket.PingMessage,
+			nil,
+			time.Now().Add(interval),
+		); err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+			var ne net.Error
+			if !errors.As(err, &ne) || !ne.Temporary() {
+				ws.Close()
+				return
+			}
+		}
+
+		pinged = true
+	}
+}
+
 // Close closes the ws without sending or waiting for a close message.
 func (ws *WebSocket) Close() error {
-	ws.Closed = true
+	ws.setClosed()
+	ws.closeOnce.Do(func() {
+		ws.untrack()
+		if ws.closed != nil {
+			close(ws.closed)
+		}
+	})
+
 	return ws.conn.Close()
 }
+
+// setClosed sets the `Closed` of the ws to true.
+func (ws *WebSocket) setClosed() {
+	ws.closedMutex.Lock()
+	ws.Closed = true
+	ws.closedMutex.Unlock()
+}
+
+// untrack removes the ws from the WebSocket connections of the `Air` that are
+// waited for by the `Air.Shutdown` and `Air.DrainLongLived`.
+func (ws *WebSocket) untrack() {
+	ws.untrackOnce.Do(func() {
+		if ws.a != nil {
+			ws.a.webSocketMutex.Lock()
+			delete(ws.a.webSockets, ws)
+			ws.a.webSocketMutex.Unlock()
+		}
+
+		if ws.untracked != nil {
+			close(ws.untracked)
+		}
+	})
+}
+
+// notifyShutdown writes a connection close message with the "Service Restart"
+// status to the remote peer of the ws. Unlike the `WriteConnectionClose`, it is
+// safe to be called concurrently with other write methods.
+func (ws *WebSocket) notifyShutdown() error {
+	return ws.conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseServiceRestart, ""),
+		time.Now().Add(time.Second),
+	)
+}
@@ -2,10 +2,14 @@ package air
 
 import (
 	"bytes"
+	"compress/flate"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -407,6 +411,173 @@ func TestWebSocketListen(t *testing.T) {
 	assert.Empty(t, buf.String())
 }
 
+func TestWebSocketListenContext(t *testing.T) {
+	a := New()
+	a.Address = "localhost:0"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	listenReturned := make(chan struct{})
+	errorHandled := false
+	a.GET("/", func(req *Request, res *Response) error {
+		ws, err := res.WebSocket()
+		if err != nil {
+			return err
+		}
+
+		ws.ErrorHandler = func(err error) {
+			errorHandled = true
+		}
+
+		ws.ListenContext(ctx)
+		ws.Listen() // Invalid call
+
+		assert.True(t, ws.Closed)
+		close(listenReturned)
+
+		return nil
+	})
+
+	hijackOSStdout()
+
+	go a.Serve()
+	defer a.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	conn, _, err := websocket.DefaultDialer.Dial(
+		"ws://"+a.Addresses()[0],
+		nil,
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, conn)
+	defer conn.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	cancel()
+
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway))
+
+	select {
+	case <-listenReturned:
+	case <-time.After(time.Second):
+		t.Fatal("ListenContext did not return")
+	}
+
+	assert.False(t, errorHandled)
+}
+
+func TestWebSocketReadJSON(t *testing.T) {
+	a := New()
+	a.Address = "localhost:0"
+
+	errs := make(chan error, 4)
+	a.GET("/", func(req *Request, res *Response) error {
+		ws, err := res.WebSocket()
+		if err != nil {
+			return err
+		}
+		defer ws.Close()
+
+		ws.SetMaxMessageBytes(16)
+
+		var v map[string]string
+		for i := 0; i < 3; i++ {
+			err := ws.ReadJSON(&v)
+			if err == nil {
+				err = ws.WriteText(v["foo"])
+			}
+
+			errs <- err
+		}
+
+		return nil
+	})
+
+	hijackOSStdout()
+
+	go a.Serve()
+	defer a.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	conn, _, err := websocket.DefaultDialer.Dial(
+		"ws://"+a.Addresses()[0],
+		nil,
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, conn)
+	defer conn.Close()
+
+	assert.NoError(t, conn.WriteMessage(
+		websocket.TextMessage,
+		[]byte(`{"foo":"bar"}`),
+	))
+	assert.NoError(t, <-errs)
+
+	mt, m, err := conn.ReadMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, websocket.TextMessage, mt)
+	assert.Equal(t, []byte("bar"), m)
+
+	assert.NoError(t, conn.WriteMessage(websocket.TextMessage, nil))
+	assert.Equal(t, io.ErrUnexpectedEOF, <-errs)
+
+	assert.NoError(t, conn.WriteMessage(
+		websocket.TextMessage,
+		[]byte(`{"foo":"foobarfoobar"}`),
+	))
+
+	err = <-errs
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, ErrWebSocketMessageTooLarge))
+}
+
+func TestWebSocketWriteJSON(t *testing.T) {
+	a := New()
+	a.Address = "localhost:0"
+
+	a.GET("/", func(req *Request, res *Response) error {
+		ws, err := res.WebSocket()
+		if err != nil {
+			return err
+		}
+		defer ws.Close()
+
+		if err := ws.WriteJSON(make(chan int)); err == nil {
+			return errors.New("unexpected nil error")
+		}
+
+		return ws.WriteJSON(map[string]string{
+			"foo": "bar",
+		})
+	})
+
+	hijackOSStdout()
+
+	go a.Serve()
+	defer a.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	conn, _, err := websocket.DefaultDialer.Dial(
+		"ws://"+a.Addresses()[0],
+		nil,
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, conn)
+	defer conn.Close()
+
+	mt, m, err := conn.ReadMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, websocket.TextMessage, mt)
+	assert.Equal(t, []byte(`{"foo":"bar"}`), m)
+}
+
 func TestWebSocketWriteText(t *testing.T) {
 	a := New()
 	a.Address = "localhost:0"
@@ -602,6 +773,198 @@ func TestWebSocketWritePong(t *testing.T) {
 	assert.Equal(t, "Foobar", buf.String())
 }
 
+func TestWebSocketStartKeepAlive(t *testing.T) {
+	a := New()
+	a.Address = "localhost:0"
+
+	pongs := int32(0)
+	a.GET("/", func(req *Request, res *Response) error {
+		ws, err := res.WebSocket()
+		if err != nil {
+			return err
+		}
+
+		ws.PongHandler = func(string) error {
+			atomic.AddInt32(&pongs, 1)
+			return nil
+		}
+
+		ws.StartKeepAlive(50 * time.Millisecond)
+		ws.StartKeepAlive(time.Millisecond)
+		ws.Listen()
+
+		return nil
+	})
+
+	hijackOSStdout()
+
+	go a.Serve()
+	defer a.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	conn, _, err := websocket.DefaultDialer.Dial(
+		"ws://"+a.Addresses()[0],
+		nil,
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, conn)
+	defer conn.Close()
+
+	readErrs := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				readErrs <- err
+				return
+			}
+		}
+	}()
+
+	time.Sleep(300 * time.Millisecond)
+
+	n := atomic.LoadInt32(&pongs)
+	assert.True(t, n >= 2 && n <= 6)
+
+	select {
+	case err := <-readErrs:
+		assert.NoError(t, err)
+	default:
+	}
+
+	conn, _, err = websocket.DefaultDialer.Dial(
+		"ws://"+a.Addresses()[0],
+		nil,
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, conn)
+	defer conn.Close()
+
+	time.Sleep(300 * time.Millisecond)
+
+	for {
+		_, _, err = conn.ReadMessage()
+		if err != nil {
+			break
+		}
+	}
+
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway))
+
+	ce, ok := err.(*websocket.CloseError)
+	assert.True(t, ok)
+	assert.Equal(t, "keep-alive timeout", ce.Text)
+
+	a = New()
+	a.Address = "localhost:0"
+	a.TestMode = true
+
+	a.GET("/", func(req *Request, res *Response) error {
+		ws, err := res.WebSocket()
+		if err != nil {
+			return err
+		}
+
+		ws.StartKeepAlive(10 * time.Millisecond)
+		ws.Listen()
+
+		return nil
+	})
+
+	hijackOSStdout()
+
+	go a.Serve()
+	defer a.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	conn, _, err = websocket.DefaultDialer.Dial(
+		"ws://"+a.Addresses()[0],
+		nil,
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, conn)
+	defer conn.Close()
+
+	pinged := false
+	conn.SetPingHandler(func(string) error {
+		pinged = true
+		return nil
+	})
+
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, _, err = conn.ReadMessage()
+	assert.Error(t, err)
+	assert.False(t, websocket.IsUnexpectedCloseError(err))
+	assert.False(t, pinged)
+}
+
+func TestWebSocketCompression(t *testing.T) {
+	a := New()
+	a.Address = "localhost:0"
+	a.WebSocketSubprotocols = []string{"foobar"}
+	a.WebSocketCompressionEnabled = true
+	a.WebSocketCompressionLevel = flate.BestCompression
+
+	a.GET("/", func(req *Request, res *Response) error {
+		ws, err := res.WebSocket()
+		if err != nil {
+			return err
+		}
+		defer ws.Close()
+
+		return ws.WriteText(strings.Repeat("Foobar", 100))
+	})
+
+	hijackOSStdout()
+
+	go a.Serve()
+	defer a.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	conn, hres, err := (&websocket.Dialer{
+		Subprotocols:      []string{"foobar"},
+		EnableCompression: true,
+	}).Dial("ws://"+a.Addresses()[0], nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, conn)
+	defer conn.Close()
+
+	assert.Equal(t, "foobar", conn.Subprotocol())
+	assert.Contains(
+		t,
+		hres.Header.Get("Sec-WebSocket-Extensions"),
+		"permessage-deflate",
+	)
+
+	mt, m, err := conn.ReadMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, websocket.TextMessage, mt)
+	assert.Equal(t, strings.Repeat("Foobar", 100), string(m))
+
+	a.WebSocketCompressionEnabled = false
+
+	conn, hres, err = (&websocket.Dialer{
+		Subprotocols:      []string{"foobar"},
+		EnableCompression: true,
+	}).Dial("ws://"+a.Addresses()[0], nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, conn)
+	defer conn.Close()
+
+	assert.Equal(t, "foobar", conn.Subprotocol())
+	assert.Empty(t, hres.Header.Get("Sec-WebSocket-Extensions"))
+
+	mt, m, err = conn.ReadMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, websocket.TextMessage, mt)
+	assert.Equal(t, strings.Repeat("Foobar", 100), string(m))
+}
+
 func TestWebSocketClose(t *testing.T) {
 	a := New()
 	a.Address = "localhost:0"
@@ -637,3 +1000,76 @@ func TestWebSocketClose(t *testing.T) {
 		websocket.CloseAbnormalClosure,
 	))
 }
+
+func TestWebSocketUntrack(t *testing.T) {
+	a := New()
+	a.Address = "localhost:0"
+
+	peerClosed := make(chan struct{})
+	release := make(chan struct{})
+	a.GET("/", func(req *Request, res *Response) error {
+		ws, err := res.WebSocket()
+		if err != nil {
+			return err
+		}
+
+		var v interface{}
+		for ws.ReadJSON(&v) == nil {
+		}
+
+		close(peerClosed)
+		<-release
+
+		return nil
+	})
+
+	a.GET("/return", func(req *Request, res *Response) error {
+		_, err := res.WebSocket()
+		return err
+	})
+
+	hijackOSStdout()
+
+	go a.Serve()
+	defer a.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	revertOSStdout()
+
+	webSockets := func() int {
+		a.webSocketMutex.Lock()
+		defer a.webSocketMutex.Unlock()
+		return len(a.webSockets)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(
+		"ws://"+a.Addresses()[0],
+		nil,
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, conn)
+	defer conn.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, webSockets())
+
+	assert.NoError(t, conn.WriteMessage(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+	))
+
+	<-peerClosed
+	assert.Equal(t, 0, webSockets())
+	close(release)
+
+	conn2, _, err := websocket.DefaultDialer.Dial(
+		"ws://"+a.Addresses()[0]+"/return",
+		nil,
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, conn2)
+	defer conn2.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 0, webSockets())
+}